@@ -412,42 +412,50 @@ func readText(txt []byte) (TestCase, error) {
 }
 
 func TestSize(t *testing.T) {
-	if unsafe.Sizeof(vm.Value{}) != 64 {
+	// 64 字节的基本字段加上 datetime 的时区和 interval 的月和天
+	if unsafe.Sizeof(vm.Value{}) != 80 {
 		t.Error("size")
 	}
 }
 
 func TestAll(t *testing.T) {
+	runTests(t, readAllTests(t), memcore.NewStorage)
+}
+
+func TestAllColumnar(t *testing.T) {
+	runTests(t, readAllTests(t), func() memcore.Storage {
+		return memcore.NewColumnarStorage()
+	})
+}
+
+func readAllTests(t *testing.T) []TestCase {
 	var allTests = []TestCase{}
 	list, err := ioutil.ReadDir("./tests")
 	if err != nil {
-		t.Error(err)
-		return
+		t.Fatal(err)
 	}
 
 	for _, file := range list {
 		bs, err := ioutil.ReadFile(filepath.Join("./tests", file.Name()))
 		if err != nil {
-			t.Error(err)
-			return
+			t.Fatal(err)
 		}
 
 		tc, err := readText(bs)
 		if err != nil {
-			t.Error(file.Name(), err)
-			return
+			t.Fatal(file.Name(), err)
 		}
 		tc.Name = file.Name()
 		allTests = append(allTests, tc)
 	}
-
-	runTests(t, allTests)
+	return allTests
 }
 
-func runTests(t *testing.T, allTests []TestCase) {
+func runTests(t *testing.T, allTests []TestCase, newStorage func() memcore.Storage) {
 	for _, test := range allTests {
 		t.Run(test.Name, func(t *testing.T) {
 			app := newTestApp(t)
+			app.s = newStorage()
 			defer func() {
 				err := app.Close()
 				if err != nil {
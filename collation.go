@@ -0,0 +1,75 @@
+package memsql
+
+import (
+	"strings"
+
+	"github.com/runner-mei/memsql/memcore"
+	"github.com/runner-mei/memsql/vm"
+	"github.com/xwb1989/sqlparser"
+)
+
+func (sc *SessionContext) SessionCollation() vm.Collation {
+	return sc.Context.Collation
+}
+
+// ColumnCollation returns the collation which is declared in the schema of
+// the table of the column, CollationBinary is same as not declared.
+func (sc *SessionContext) ColumnCollation(col *sqlparser.ColName) (vm.Collation, bool) {
+	name := col.Name.String()
+	if strings.HasPrefix(name, "@") {
+		return vm.CollationBinary, false
+	}
+	qualifier := col.Qualifier.Name.String()
+	for _, ds := range sc.datasources {
+		if qualifier != "" && !strings.EqualFold(qualifier, ds.Table) && !strings.EqualFold(qualifier, ds.As) {
+			continue
+		}
+		schema, ok := lookupSchema(sc, ds.Table)
+		if !ok {
+			continue
+		}
+		column, ok := schema.Column(name)
+		if !ok {
+			column, ok = schema.Column(strings.ToLower(name))
+		}
+		if ok && column.Collation != vm.CollationBinary {
+			return column.Collation, true
+		}
+	}
+	return vm.CollationBinary, false
+}
+
+// binaryPredicates removes the predicates which compare the strings with a
+// collation which isnot binary, the storage compares them byte by byte.
+func binaryPredicates(ec *SessionContext, schema *memcore.TableSchema, predicates []memcore.Predicate) []memcore.Predicate {
+	var results = predicates[:0:0]
+	for _, predicate := range predicates {
+		if hasString(predicate.Values) && predicateCollation(ec, schema, predicate.Column) != vm.CollationBinary {
+			continue
+		}
+		results = append(results, predicate)
+	}
+	return results
+}
+
+func predicateCollation(ec *SessionContext, schema *memcore.TableSchema, name string) vm.Collation {
+	if schema != nil && !strings.HasPrefix(name, "@") {
+		column, ok := schema.Column(name)
+		if !ok {
+			column, ok = schema.Column(strings.ToLower(name))
+		}
+		if ok && column.Collation != vm.CollationBinary {
+			return column.Collation
+		}
+	}
+	return ec.SessionCollation()
+}
+
+func hasString(values []vm.Value) bool {
+	for _, value := range values {
+		if value.Type == vm.ValueString {
+			return true
+		}
+	}
+	return false
+}
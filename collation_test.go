@@ -0,0 +1,156 @@
+package memsql
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/runner-mei/memsql/memcore"
+	"github.com/runner-mei/memsql/vm"
+)
+
+func TestCollation(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Close()
+
+	app.Add(t, &TestTable{
+		Name: "ports",
+		Records: []map[string]interface{}{
+			{"id": 1, "name": "eth10", "descr": "Uplink"},
+			{"id": 2, "name": "eth2", "descr": "uplink"},
+			{"id": 3, "name": "ETH1", "descr": "ÉTÉ"},
+			{"id": 4, "name": "lo", "descr": "été"},
+		},
+	})
+
+	for _, test := range []struct {
+		ctx    *Context
+		sql    string
+		result []string
+		err    string
+	}{
+		{
+			sql:    "select id from ports where descr = 'uplink'",
+			result: []string{`2`},
+		},
+		{
+			sql:    "select id from ports where descr collate ascii_general_ci = 'UPLINK'",
+			result: []string{`1`, `2`},
+		},
+		{
+			sql:    "select id from ports where descr collate ascii_general_ci = 'été'",
+			result: []string{`4`},
+		},
+		{
+			sql:    "select id from ports where descr collate utf8mb4_general_ci = 'été'",
+			result: []string{`3`, `4`},
+		},
+		{
+			sql:    "select id from ports where name collate nocase like 'eth%'",
+			result: []string{`1`, `2`, `3`},
+		},
+		{
+			sql:    "select id from ports order by name",
+			result: []string{`3`, `1`, `2`, `4`},
+		},
+		{
+			sql:    "select id from ports order by name collate 'natural'",
+			result: []string{`3`, `2`, `1`, `4`},
+		},
+		{
+			ctx:    &Context{Collation: vm.CollationUnicodeCI},
+			sql:    "select id from ports where name like 'eth%' order by name",
+			result: []string{`3`, `1`, `2`},
+		},
+		{
+			ctx:    &Context{Collation: vm.CollationUnicodeCI},
+			sql:    "select id from ports where descr = 'UPLINK' order by id",
+			result: []string{`1`, `2`},
+		},
+		{
+			ctx:    &Context{Collation: vm.CollationUnicodeCI},
+			sql:    "select descr from ports where id = 1 union select descr from ports where id = 2",
+			result: []string{`"Uplink"`},
+		},
+		{
+			ctx:    &Context{Collation: vm.CollationUnicodeCI},
+			sql:    "select id from ports where binary descr = 'uplink'",
+			result: []string{`2`},
+		},
+		{
+			sql: "select id from ports where name collate abc = 'eth2'",
+			err: "collation 'abc' is unsupported",
+		},
+	} {
+		t.Run(test.sql, func(t *testing.T) {
+			results, err := app.Execute(t, test.ctx, test.sql)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Error("want", test.err, "got", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertResults(t, false, false, results, test.result)
+		})
+	}
+}
+
+func TestColumnCollation(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Close()
+
+	app.Add(t, &TestTable{
+		Name: "ifs",
+		Records: []map[string]interface{}{
+			{"id": 1, "name": "eth10", "descr": "Uplink"},
+			{"id": 2, "name": "eth2", "descr": "uplink"},
+			{"id": 3, "name": "eth1", "descr": "LAN"},
+		},
+	})
+	err := app.s.(memcore.SchemaStorage).SetSchema("ifs", &memcore.TableSchema{
+		Columns: []memcore.ColumnSchema{
+			{Name: "id", Type: vm.ValueInt64},
+			{Name: "name", Type: vm.ValueString, Collation: vm.CollationNatural},
+			{Name: "descr", Type: vm.ValueString, Collation: vm.CollationASCIICI},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		sql    string
+		result []string
+	}{
+		{
+			sql:    "select id from ifs order by name",
+			result: []string{`3`, `2`, `1`},
+		},
+		{
+			sql:    "select id from ifs order by name desc",
+			result: []string{`1`, `2`, `3`},
+		},
+		{
+			sql:    "select id from ifs where descr = 'UPLINK' order by id",
+			result: []string{`1`, `2`},
+		},
+		{
+			sql:    "select id from ifs where descr collate utf8mb4_bin = 'uplink'",
+			result: []string{`2`},
+		},
+		{
+			sql:    "select id from ifs where name > 'eth9' order by id",
+			result: []string{`1`},
+		},
+	} {
+		t.Run(test.sql, func(t *testing.T) {
+			results, err := app.Execute(t, nil, test.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertResults(t, false, false, results, test.result)
+		})
+	}
+}
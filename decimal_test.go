@@ -0,0 +1,67 @@
+package memsql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecimalColumns(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Close()
+
+	var records []map[string]interface{}
+	for i := 0; i < 10; i++ {
+		records = append(records, map[string]interface{}{"price": mustParseDecimal(t, "0.10"), "qty": int64(i)})
+	}
+	app.ReadWith(map[string][]map[string]interface{}{
+		"orders-mo=1": records,
+		"orders-mo=2": {
+			{"price": mustParseDecimal(t, "12345678901234567.89"), "qty": int64(3)},
+		},
+	})
+
+	for _, test := range []struct {
+		sql    string
+		result []string
+	}{
+		{
+			sql: "select sum(price), count(price) from orders where @mo = '1'",
+			result: []string{
+				`1.00,10`,
+			},
+		},
+		{
+			sql: "select price * qty, price + 1, price - cast('0.5' as decimal(2, 1)), price / 4, qty % price from orders where @mo = '2'",
+			result: []string{
+				`37037036703703703.67,12345678901234568.89,12345678901234567.39,3086419725308641.972500,3.00`,
+			},
+		},
+		{
+			sql: "select avg(price) from orders where @mo = '1'",
+			result: []string{
+				`0.100000`,
+			},
+		},
+		{
+			sql: "select qty from orders where @mo = '1' and price * qty >= 0.8 order by qty",
+			result: []string{
+				`8`,
+				`9`,
+			},
+		},
+		{
+			sql: "select price * 1.5e0, -price from orders where @mo = '2'",
+			result: []string{
+				`1.8518518351851852e+16,-12345678901234567.89`,
+			},
+		},
+	} {
+		t.Run(test.sql, func(t *testing.T) {
+			results, err := app.Execute(t, nil, test.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertResults(t, !strings.Contains(test.sql, "order by"), false, results, test.result)
+		})
+	}
+}
@@ -0,0 +1,362 @@
+package memsql
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/runner-mei/errors"
+	"github.com/runner-mei/memsql/parser"
+	"github.com/runner-mei/memsql/vm"
+	"github.com/xwb1989/sqlparser"
+)
+
+// Dialect generates the sql for the database driver, all the literals are
+// bound as the placeholders of the driver.
+type Dialect struct {
+	Name string
+
+	QuoteIdent  func(name string) string
+	Placeholder func(idx int) string
+	BindValue   func(value vm.Value) (interface{}, error)
+
+	// Interval formats the interval expression, the value of the expr
+	// has been written.
+	Interval func(buf *sqlparser.TrackedBuffer, expr sqlparser.Expr, unit string) error
+
+	// BindInterval is true if the constant interval is bound by BindValue,
+	// otherwise the interval expressions are always formatted by Interval.
+	BindInterval bool
+
+	// NoLimit is used as the row count when there is only the offset, it is
+	// empty if the driver supports OFFSET without LIMIT.
+	NoLimit string
+}
+
+func quoteWith(quote string) func(string) string {
+	return func(name string) string {
+		return quote + strings.Replace(name, quote, quote+quote, -1) + quote
+	}
+}
+
+func questionPlaceholder(int) string {
+	return "?"
+}
+
+func bindValue(value vm.Value) (interface{}, error) {
+	switch value.Type {
+	case vm.ValueNull:
+		return nil, nil
+	case vm.ValueBool:
+		return value.BoolValue(), nil
+	case vm.ValueString:
+		return value.Str, nil
+	case vm.ValueInt64:
+		return value.Int64, nil
+	case vm.ValueUint64:
+		return value.Uint64, nil
+	case vm.ValueFloat64:
+		return value.Float64, nil
+	case vm.ValueDecimal:
+		return value.String(), nil
+	case vm.ValueDatetime:
+		return vm.IntToDatetime(value.Int64), nil
+	case vm.ValueInterval:
+		return value.Int64, nil
+	default:
+		return nil, errors.New("bind value '" + value.String() + "' fail: type '" + value.Type.String() + "' is unsupported")
+	}
+}
+
+var (
+	Sqlite3Dialect = &Dialect{
+		Name:        "sqlite3",
+		QuoteIdent:  quoteWith("\""),
+		Placeholder: questionPlaceholder,
+		BindValue: func(value vm.Value) (interface{}, error) {
+			switch value.Type {
+			case vm.ValueBool:
+				// sqlite3 没有 boolean
+				if value.BoolValue() {
+					return int64(1), nil
+				}
+				return int64(0), nil
+			}
+			return bindValue(value)
+		},
+		Interval: func(buf *sqlparser.TrackedBuffer, expr sqlparser.Expr, unit string) error {
+			return errors.New("interval isnot supported by sqlite3")
+		},
+	}
+
+	MysqlDialect = &Dialect{
+		Name:        "mysql",
+		QuoteIdent:  quoteWith("`"),
+		Placeholder: questionPlaceholder,
+		BindValue:   bindValue,
+		Interval: func(buf *sqlparser.TrackedBuffer, expr sqlparser.Expr, unit string) error {
+			buf.Myprintf("interval %v %s", expr, unit)
+			return nil
+		},
+	}
+
+	PostgresDialect = &Dialect{
+		Name:       "postgres",
+		QuoteIdent: quoteWith("\""),
+		Placeholder: func(idx int) string {
+			return "$" + strconv.Itoa(idx)
+		},
+		BindValue: func(value vm.Value) (interface{}, error) {
+			if value.Type == vm.ValueInterval {
+				s := strconv.FormatInt(value.Int64/int64(time.Microsecond), 10) + " microseconds"
+				if value.IsCalendarInterval() {
+					s = strconv.FormatInt(int64(value.IntervalMonths()), 10) + " months " +
+						strconv.FormatInt(int64(value.IntervalDays()), 10) + " days " + s
+				}
+				return s, nil
+			}
+			return bindValue(value)
+		},
+		Interval: func(buf *sqlparser.TrackedBuffer, expr sqlparser.Expr, unit string) error {
+			buf.Myprintf("(%v * interval '1 %s')", expr, unit)
+			return nil
+		},
+		BindInterval: true,
+	}
+)
+
+// DialectByDriver returns the dialect of the database driver, the sqlite3
+// dialect is the default.
+func DialectByDriver(drv string) *Dialect {
+	switch strings.ToLower(drv) {
+	case "mysql":
+		return MysqlDialect
+	case "postgres", "postgresql", "pgx", "pq", "kingbase", "opengauss":
+		return PostgresDialect
+	default:
+		return Sqlite3Dialect
+	}
+}
+
+// QuoteTable quotes the table name which may be qualified with the schema.
+func (d *Dialect) QuoteTable(name string) string {
+	parts := strings.Split(name, ".")
+	for idx := range parts {
+		parts[idx] = d.QuoteIdent(parts[idx])
+	}
+	return strings.Join(parts, ".")
+}
+
+// SelectSQL generates the select statement on the table, whereStr is the
+// condition which is generated by ToSQL.
+func (d *Dialect) SelectSQL(tableName TableAlias, whereStr string, spec *ForeignSpec) string {
+	var sb strings.Builder
+	sb.WriteString("SELECT ")
+	switch {
+	case spec != nil && len(spec.Aggregates) > 0:
+		for idx, aggregate := range spec.Aggregates {
+			if idx > 0 {
+				sb.WriteString(", ")
+			}
+			column := "*"
+			if aggregate.Column != "" {
+				column = d.QuoteIdent(aggregate.Column)
+			}
+			if aggregate.Func == "sum" {
+				// 和 memcore 一致, 没有记录时为 0
+				sb.WriteString("COALESCE(SUM(" + column + "), 0)")
+			} else {
+				sb.WriteString(strings.ToUpper(aggregate.Func) + "(" + column + ")")
+			}
+			sb.WriteString(" AS ")
+			sb.WriteString(d.QuoteIdent(aggregate.As))
+		}
+	case spec != nil && len(spec.Columns) > 0:
+		for idx, column := range spec.Columns {
+			if idx > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(d.QuoteIdent(column))
+		}
+	default:
+		sb.WriteString("*")
+	}
+
+	sb.WriteString(" FROM ")
+	sb.WriteString(d.QuoteTable(tableName.Name))
+	if tableName.Alias != "" {
+		sb.WriteString(" AS ")
+		sb.WriteString(d.QuoteIdent(tableName.Alias))
+	}
+	if whereStr != "" {
+		sb.WriteString(" WHERE ")
+		sb.WriteString(whereStr)
+	}
+	if spec == nil {
+		return sb.String()
+	}
+
+	for idx, order := range spec.OrderBy {
+		if idx == 0 {
+			sb.WriteString(" ORDER BY ")
+		} else {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(d.QuoteIdent(order.Column))
+		if order.Desc {
+			sb.WriteString(" DESC")
+		}
+	}
+	if spec.HasLimit {
+		sb.WriteString(" LIMIT ")
+		sb.WriteString(strconv.FormatInt(spec.Limit, 10))
+	} else if spec.Offset > 0 && d.NoLimit != "" {
+		sb.WriteString(" LIMIT ")
+		sb.WriteString(d.NoLimit)
+	}
+	if spec.Offset > 0 {
+		sb.WriteString(" OFFSET ")
+		sb.WriteString(strconv.FormatInt(spec.Offset, 10))
+	}
+	return sb.String()
+}
+
+// ToSQL formats the expr, the literals and the constant expressions are
+// appended to args as the bound values. The tables in the subqueries are
+// written as they are.
+func (d *Dialect) ToSQL(ctx parser.FilterContext, expr sqlparser.SQLNode, args []interface{}) (string, []interface{}, error) {
+	return d.toSQL(ctx, expr, args, nil)
+}
+
+// toSQL 中 server 的表被替换为数据库中的表名
+func (d *Dialect) toSQL(ctx parser.FilterContext, expr sqlparser.SQLNode, args []interface{}, server *foreignServer) (string, []interface{}, error) {
+	var lastErr error
+	bind := func(buf *sqlparser.TrackedBuffer, value vm.Value) {
+		arg, err := d.BindValue(value)
+		if err != nil {
+			if lastErr == nil {
+				lastErr = err
+			}
+			return
+		}
+		args = append(args, arg)
+		buf.WriteString(d.Placeholder(len(args)))
+	}
+
+	var format sqlparser.NodeFormatter
+	format = func(buf *sqlparser.TrackedBuffer, node sqlparser.SQLNode) {
+		switch v := node.(type) {
+		case *sqlparser.SQLVal:
+			switch v.Type {
+			case sqlparser.StrVal, sqlparser.IntVal, sqlparser.FloatVal:
+				read, err := parser.ToGetValue(ctx, v)
+				if err == nil {
+					var value vm.Value
+					value, err = read(nil)
+					if err == nil {
+						bind(buf, value)
+						return
+					}
+				}
+				if lastErr == nil {
+					lastErr = err
+				}
+				return
+			}
+		case sqlparser.BoolVal:
+			bind(buf, vm.BoolToValue(bool(v)))
+			return
+		case *sqlparser.ColName:
+			if !v.Qualifier.IsEmpty() {
+				buf.WriteString(d.QuoteIdent(v.Qualifier.Name.String()))
+				buf.WriteString(".")
+			}
+			// tag 作为普通的列
+			buf.WriteString(d.QuoteIdent(strings.TrimPrefix(v.Name.String(), "@")))
+			return
+		case *sqlparser.AliasedTableExpr:
+			// 改名后的表用原来的表名作为别名, 子查询中的列仍然可以用它限定
+			if name, ok := v.Expr.(sqlparser.TableName); ok && v.As.IsEmpty() && server.isOwner(name) {
+				if server.remoteName(name.Name.String()) != name.Name.String() {
+					copyed := *v
+					copyed.As = name.Name
+					copyed.Format(buf)
+					return
+				}
+			}
+		case sqlparser.TableName:
+			if server.isOwner(v) {
+				buf.WriteString(d.QuoteTable(server.remoteName(v.Name.String())))
+				return
+			}
+			if !v.Qualifier.IsEmpty() {
+				buf.WriteString(d.QuoteIdent(v.Qualifier.String()))
+				buf.WriteString(".")
+			}
+			buf.WriteString(d.QuoteIdent(v.Name.String()))
+			return
+		case *sqlparser.IntervalExpr:
+			// 月和天的长度与日期有关, 由数据库计算
+			if isConstantExpr(v) && !vm.IsCalendarUnit(v.Unit) && d.bindConstant(ctx, buf, v, bind) {
+				return
+			}
+			if err := d.Interval(buf, v.Expr, v.Unit); err != nil && lastErr == nil {
+				lastErr = err
+			}
+			return
+		case *sqlparser.BinaryExpr, *sqlparser.UnaryExpr, *sqlparser.FuncExpr, *sqlparser.ConvertExpr:
+			if isConstantExpr(v.(sqlparser.Expr)) && d.bindConstant(ctx, buf, v.(sqlparser.Expr), bind) {
+				return
+			}
+		}
+		node.Format(buf)
+	}
+
+	buf := sqlparser.NewTrackedBuffer(format)
+	buf.Myprintf("%v", expr)
+	if lastErr != nil {
+		return "", nil, errors.Wrap(lastErr, "generate sql for '"+sqlparser.String(expr)+"' fail")
+	}
+	return buf.String(), args, nil
+}
+
+func (d *Dialect) bindConstant(ctx parser.FilterContext, buf *sqlparser.TrackedBuffer, expr sqlparser.Expr, bind func(*sqlparser.TrackedBuffer, vm.Value)) bool {
+	read, err := parser.ToGetValue(ctx, expr)
+	if err != nil {
+		return false
+	}
+	value, err := read(nil)
+	if err != nil {
+		return false
+	}
+	if value.Type == vm.ValueInterval && !d.BindInterval {
+		return false
+	}
+	bind(buf, value)
+	return true
+}
+
+// isConstantExpr 表达式中没有列, 子查询和聚合函数
+func isConstantExpr(expr sqlparser.Expr) bool {
+	constant := true
+	sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch v := node.(type) {
+		case *sqlparser.ColName, *sqlparser.Subquery, sqlparser.ListArg:
+			constant = false
+		case *sqlparser.SQLVal:
+			if v.Type == sqlparser.ValArg {
+				constant = false
+			}
+		case *sqlparser.FuncExpr:
+			if v.IsAggregate() {
+				constant = false
+			}
+			// now() 等函数与当前时间和时区有关, 由数据库计算
+			if _, ok := vm.TimeFuncs[v.Name.Lowered()]; ok {
+				constant = false
+			}
+		}
+		return constant, nil
+	}, expr)
+	return constant
+}
@@ -0,0 +1,118 @@
+package memsql
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/memsql/vm"
+	"github.com/xwb1989/sqlparser"
+)
+
+func TestDialect(t *testing.T) {
+	for _, test := range []struct {
+		dialect *Dialect
+		server  *foreignServer
+		sql     string
+		result  string
+		args    []interface{}
+	}{
+		{
+			dialect: Sqlite3Dialect,
+			sql:     "select * from t where a = 'is true' and b = true and c.`d\"` > 1.5",
+			result:  `"a" = ? and "b" = ? and "c"."d""" > ?`,
+			args:    []interface{}{"is true", int64(1), 1.5},
+		},
+		{
+			dialect: MysqlDialect,
+			sql:     "select * from t where @mo in (1, 2) and b = false",
+			result:  "`mo` in (?, ?) and `b` = ?",
+			args:    []interface{}{int64(1), int64(2), false},
+		},
+		{
+			dialect: PostgresDialect,
+			sql:     "select * from t where a = 'x' or b < 1 + 2",
+			result:  `"a" = $1 or "b" < $2`,
+			args:    []interface{}{"x", int64(3)},
+		},
+		{
+			dialect: PostgresDialect,
+			server:  &foreignServer{name: DefaultForeignName},
+			sql:     "select * from t where a in (select id from fdw.t2 where b = 'c')",
+			result:  `"a" in (select "id" from "t2" where "b" = $1)`,
+			args:    []interface{}{"c"},
+		},
+		{
+			dialect: PostgresDialect,
+			server:  &foreignServer{name: "cmdb", opts: ForeignOptions{Schema: "s1", Tables: map[string]string{"t2": "mo"}}},
+			sql:     "select * from t where a in (select t2.id from cmdb.t2 where b = 'c') and b in (select id from fdw.t3)",
+			result:  `"a" in (select "t2"."id" from "s1"."mo" as t2 where "b" = $1) and "b" in (select "id" from "fdw"."t3")`,
+			args:    []interface{}{"c"},
+		},
+		{
+			dialect: MysqlDialect,
+			sql:     "select * from t where a > now() - interval 1 hour and b < interval 2 day",
+			result:  "`a` > now() - interval ? hour and `b` < interval ? day",
+			args:    []interface{}{int64(1), int64(2)},
+		},
+
+		{
+			dialect: MysqlDialect,
+			sql:     "select * from t where a > now() - interval b day",
+			result:  "`a` > now() - interval `b` day",
+			args:    nil,
+		},
+		{
+			dialect: PostgresDialect,
+			sql:     "select * from t where a > interval b day",
+			result:  `"a" > ("b" * interval '1 day')`,
+			args:    nil,
+		},
+	} {
+		stmt, err := sqlparser.Parse(test.sql)
+		if err != nil {
+			t.Error(test.sql, err)
+			continue
+		}
+		where := stmt.(*sqlparser.Select).Where
+
+		result, args, err := test.dialect.toSQL(nil, where.Expr, nil, test.server)
+		if err != nil {
+			t.Error(test.sql, err)
+			continue
+		}
+		if result != test.result {
+			t.Error(test.sql)
+			t.Error("want", test.result)
+			t.Error(" got", result)
+		}
+		if !reflect.DeepEqual(args, test.args) {
+			t.Error(test.sql)
+			t.Errorf("want %#v", test.args)
+			t.Errorf(" got %#v", args)
+		}
+	}
+
+	stmt, _ := sqlparser.Parse("select * from t where a > '2021-01-02 03:04:05' and b > interval 1 hour")
+	_, args, err := PostgresDialect.ToSQL(nil, stmt.(*sqlparser.Select).Where.Expr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 2 || args[1] != "3600000000 microseconds" {
+		t.Errorf("got %#v", args)
+	}
+
+	// sqlite3 的驱动按它的格式写入 time.Time
+	value, err := Sqlite3Dialect.BindValue(vm.DatetimeToValue(time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := value.(time.Time); !ok {
+		t.Errorf("want time.Time got %#v", value)
+	}
+
+	_, _, err = Sqlite3Dialect.ToSQL(nil, &sqlparser.IntervalExpr{Expr: &sqlparser.ColName{Name: sqlparser.NewColIdent("a")}, Unit: "day"}, nil)
+	if err == nil {
+		t.Error("want error got ok")
+	}
+}
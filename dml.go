@@ -0,0 +1,454 @@
+package memsql
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/runner-mei/errors"
+	"github.com/runner-mei/memsql/memcore"
+	"github.com/runner-mei/memsql/parser"
+	"github.com/runner-mei/memsql/vm"
+	"github.com/xwb1989/sqlparser"
+)
+
+// Exec executes the INSERT, REPLACE, DELETE, CREATE TABLE AS SELECT or
+// materialized view statement and returns the count of the affected rows.
+//
+// The columns with the '@' prefix are the tags, the rows are saved into the
+// measurement of their tags. INSERT appends the rows to the measurement and
+// REPLACE replaces all the rows of the measurement with the rows of the same
+// tags, the measurements of the other tags are kept.
+func Exec(ctx *Context, sqlstmt string) (affected int64, err error) {
+	ms, e := mutableStorage(ctx)
+	if e != nil {
+		return 0, e
+	}
+	if affected, ok, e := execDefinition(ctx, ms, sqlstmt); ok {
+		return affected, e
+	}
+
+	stmt, e := sqlparser.Parse(sqlstmt)
+	if e != nil {
+		return 0, e
+	}
+
+	sessctx := &SessionContext{
+		Context:    ctx,
+		alias:      map[string]string{},
+		resultSets: map[string][]memcore.Record{},
+	}
+	defer func() {
+		if e := sessctx.Close(); e != nil && err == nil {
+			err = e
+		}
+	}()
+
+	switch v := stmt.(type) {
+	case *sqlparser.Insert:
+		return ExecuteInsert(sessctx, ms, v)
+	case *sqlparser.Delete:
+		return ExecuteDelete(sessctx, ms, v)
+	case sqlparser.SelectStatement:
+		return 0, errors.New("select statement should be executed with Execute")
+	default:
+		return 0, errors.New("only support insert, replace and delete statement")
+	}
+}
+
+func mutableStorage(ctx *Context) (memcore.MutableStorage, error) {
+	if mutable, ok := ctx.Storage.(MutableStorage); ok {
+		if ms, ok := mutable.Mutable(); ok {
+			return ms, nil
+		}
+	}
+	return nil, errors.New("storage isnot support insert, replace and delete")
+}
+
+type insertMeasurement struct {
+	tags  []memcore.KeyValue
+	table memcore.Table
+}
+
+func ExecuteInsert(ec *SessionContext, ms memcore.MutableStorage, stmt *sqlparser.Insert) (int64, error) {
+	if !stmt.Table.Qualifier.IsEmpty() {
+		return 0, errors.New("insert into '" + sqlparser.String(stmt.Table) + "' is unsupported")
+	}
+	if stmt.Ignore != "" {
+		return 0, errors.New("currently unsupport insert ignore")
+	}
+	if len(stmt.OnDup) > 0 {
+		return 0, errors.New("currently unsupport on duplicate key update")
+	}
+	if len(stmt.Partitions) > 0 {
+		return 0, errors.New("currently unsupport partitions")
+	}
+	tableName := stmt.Table.Name.String()
+
+	var columns []string
+	for _, column := range stmt.Columns {
+		columns = append(columns, column.String())
+	}
+	if len(columns) == 0 {
+		schema, ok := lookupSchema(ec, tableName)
+		if !ok {
+			return 0, errors.New("columns of the table '" + tableName + "' is missing")
+		}
+		for idx := range schema.Columns {
+			columns = append(columns, schema.Columns[idx].Name)
+		}
+	}
+
+	rows, err := readInsertRows(ec, stmt.Rows)
+	if err != nil {
+		return 0, err
+	}
+
+	var dataColumns []memcore.Column
+	for _, column := range columns {
+		if !strings.HasPrefix(column, "@") {
+			dataColumns = append(dataColumns, memcore.Column{Name: column})
+		}
+	}
+
+	var measurements []*insertMeasurement
+	var byKey = map[string]*insertMeasurement{}
+	for idx, row := range rows {
+		if len(row) != len(columns) {
+			return 0, errors.New("column count doesnot match value count at row " + strconv.Itoa(idx+1))
+		}
+
+		var tags []memcore.KeyValue
+		var values = make([]memcore.Value, 0, len(dataColumns))
+		for i, column := range columns {
+			if !strings.HasPrefix(column, "@") {
+				values = append(values, row[i])
+				continue
+			}
+			if row[i].IsNull() {
+				return 0, errors.New("tag '" + column + "' is null at row " + strconv.Itoa(idx+1))
+			}
+			s, err := row[i].AsString(true)
+			if err != nil {
+				return 0, errors.Wrap(err, "tag '"+column+"' is invalid at row "+strconv.Itoa(idx+1))
+			}
+			tags = append(tags, memcore.KeyValue{Key: strings.TrimPrefix(column, "@"), Value: s})
+		}
+
+		key := memcore.KeyValues(sortedTags(tags)).ToKey()
+		m := byKey[key]
+		if m == nil {
+			m = &insertMeasurement{
+				tags:  tags,
+				table: memcore.Table{Columns: dataColumns},
+			}
+			byKey[key] = m
+			measurements = append(measurements, m)
+		}
+		m.table.Records = append(m.table.Records, values)
+	}
+
+	var affected int64
+	now := time.Now()
+	replace := stmt.Action == sqlparser.ReplaceStr
+	for _, m := range measurements {
+		// 在 storage 的锁中追加, 并发的 INSERT 不会丢失数据
+		err := ms.Update(tableName, m.tags, now, func(old memcore.Table, exists bool) (memcore.Table, error) {
+			if exists && !replace {
+				return appendTable(old, m.table), nil
+			}
+			return m.table, nil
+		})
+		if err != nil {
+			return affected, err
+		}
+		affected += int64(len(m.table.Records))
+	}
+	return affected, nil
+}
+
+func readInsertRows(ec *SessionContext, rows sqlparser.InsertRows) ([][]memcore.Value, error) {
+	switch v := rows.(type) {
+	case sqlparser.Values:
+		var results = make([][]memcore.Value, 0, len(v))
+		for _, tuple := range v {
+			row := make([]memcore.Value, 0, len(tuple))
+			for _, expr := range tuple {
+				if err := checkInsertValue(expr); err != nil {
+					return nil, err
+				}
+				read, err := parser.ToGetValue(ec, expr)
+				if err != nil {
+					return nil, err
+				}
+				value, err := read(nil)
+				if err != nil {
+					return nil, err
+				}
+				row = append(row, value)
+			}
+			results = append(results, row)
+		}
+		return results, nil
+	case sqlparser.SelectStatement:
+		query, err := ExecuteSelectStatement(ec, v, false)
+		if err != nil {
+			return nil, err
+		}
+		if err := ec.Init(); err != nil {
+			return nil, err
+		}
+		records, err := query.Results(ec)
+		if err != nil {
+			return nil, err
+		}
+		var results = make([][]memcore.Value, 0, len(records))
+		for idx := range records {
+			results = append(results, records[idx].Values)
+		}
+		return results, nil
+	default:
+		return nil, errors.New("currently unsupport insert rows '" + sqlparser.String(rows) + "'")
+	}
+}
+
+// checkInsertValue VALUES 中的值在没有记录的情况下计算, 所以不能引用列或
+// 子查询
+func checkInsertValue(expr sqlparser.Expr) error {
+	var invalid sqlparser.SQLNode
+	sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch node.(type) {
+		case *sqlparser.ColName, *sqlparser.Subquery:
+			if invalid == nil {
+				invalid = node
+			}
+			return false, nil
+		}
+		return invalid == nil, nil
+	}, expr)
+	if invalid != nil {
+		return errors.New("'" + sqlparser.String(invalid) + "' cannot be used in the values")
+	}
+	return nil
+}
+
+// appendTable 按列名合并两个表, 缺少的列填 null
+func appendTable(table, rows memcore.Table) memcore.Table {
+	result := memcore.Table{
+		Columns: make([]memcore.Column, len(table.Columns)),
+		Records: make([][]memcore.Value, 0, len(table.Records)+len(rows.Records)),
+	}
+	copy(result.Columns, table.Columns)
+
+	var indexes = make([]int, len(rows.Columns))
+	for idx := range rows.Columns {
+		indexes[idx] = -1
+		for i := range result.Columns {
+			if result.Columns[i].Name == rows.Columns[idx].Name {
+				indexes[idx] = i
+				break
+			}
+		}
+		if indexes[idx] < 0 {
+			indexes[idx] = len(result.Columns)
+			result.Columns = append(result.Columns, memcore.Column{Name: rows.Columns[idx].Name})
+		}
+	}
+
+	for _, record := range table.Records {
+		values := make([]memcore.Value, len(result.Columns))
+		copy(values, record)
+		for i := len(record); i < len(values); i++ {
+			values[i] = vm.Null()
+		}
+		result.Records = append(result.Records, values)
+	}
+	for _, record := range rows.Records {
+		values := make([]memcore.Value, len(result.Columns))
+		for i := range values {
+			values[i] = vm.Null()
+		}
+		for idx := range record {
+			values[indexes[idx]] = record[idx]
+		}
+		result.Records = append(result.Records, values)
+	}
+	return result
+}
+
+func ExecuteDelete(ec *SessionContext, ms memcore.MutableStorage, stmt *sqlparser.Delete) (int64, error) {
+	if len(stmt.Targets) > 0 || len(stmt.TableExprs) != 1 {
+		return 0, errors.New("currently unsupport multiple-table delete")
+	}
+	if len(stmt.OrderBy) > 0 || stmt.Limit != nil {
+		return 0, errors.New("currently unsupport order by and limit in delete")
+	}
+	if len(stmt.Partitions) > 0 {
+		return 0, errors.New("currently unsupport partitions")
+	}
+	aliased, ok := stmt.TableExprs[0].(*sqlparser.AliasedTableExpr)
+	if !ok {
+		return 0, errors.New("currently unsupport delete from '" + sqlparser.String(stmt.TableExprs[0]) + "'")
+	}
+	tableName, ok := aliased.Expr.(sqlparser.TableName)
+	if !ok || !tableName.Qualifier.IsEmpty() {
+		return 0, errors.New("currently unsupport delete from '" + sqlparser.String(aliased.Expr) + "'")
+	}
+	name := tableName.Name.String()
+	tableAs := aliased.As.String()
+
+	filter := func(vm.Context) (bool, error) {
+		return true, nil
+	}
+	if stmt.Where != nil && stmt.Where.Expr != nil {
+		var err error
+		filter, err = parser.ToFilter(ec, stmt.Where.Expr)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	plan := func(tags memcore.KeyValues) (*deletePlan, error) {
+		table, ok := ms.Get(name, tags)
+		if !ok {
+			return nil, nil
+		}
+		columns := make([]memcore.Column, len(table.Columns))
+		for idx := range table.Columns {
+			columns[idx] = table.Columns[idx]
+			columns[idx].TableName = name
+			columns[idx].TableAs = tableAs
+		}
+
+		p := &deletePlan{
+			tags:     tags,
+			snapshot: table.Records,
+			deleted:  make([]bool, len(table.Records)),
+		}
+		for idx, values := range table.Records {
+			record := memcore.Record{
+				Tags:    tags,
+				Columns: columns,
+				Values:  values,
+			}
+			ok, err := filter(memcore.ToRecordValuer(&record, true))
+			if err != nil {
+				// 与 storage.from 一样, 缺少 tag 或列的行不匹配
+				if !errors.Is(err, memcore.ErrNotFound) {
+					return nil, err
+				}
+				ok = false
+			}
+			if ok {
+				p.deleted[idx] = true
+				p.count++
+			}
+		}
+		if p.count == 0 {
+			return nil, nil
+		}
+		return p, nil
+	}
+
+	// 先过滤所有的 measurement, 都成功后才修改, 出错时不会只删除了一部分
+	var plans []*deletePlan
+	for _, tags := range ms.Measurements(name) {
+		p, err := plan(tags)
+		if err != nil {
+			return 0, err
+		}
+		if p != nil {
+			plans = append(plans, p)
+		}
+	}
+
+	// filter 可能读取 storage, 所以不能在 storage 的锁中执行, 在锁中只删除
+	// 过滤时的那些行, 这些行被并发地修改了时重新过滤
+	var affected int64
+	now := time.Now()
+	for _, p := range plans {
+		for retries := 0; ; retries++ {
+			err := ms.Update(name, p.tags, now, p.apply)
+			if err == nil {
+				affected += int64(p.count)
+				break
+			}
+			if err != errConcurrentModified {
+				return affected, err
+			}
+			if retries >= maxDeleteRetries {
+				return affected, errors.New("measurement '" + p.tags.ToKey() + "' of table '" + name + "' is modified concurrently")
+			}
+			p, err = plan(p.tags)
+			if err != nil {
+				return affected, err
+			}
+			if p == nil {
+				break
+			}
+		}
+	}
+	return affected, nil
+}
+
+const maxDeleteRetries = 3
+
+var errConcurrentModified = errors.New("measurement is modified concurrently")
+
+// deletePlan 是 DELETE 过滤一个 measurement 的结果
+type deletePlan struct {
+	tags     memcore.KeyValues
+	snapshot [][]memcore.Value
+	deleted  []bool
+	count    int
+}
+
+// apply 删除过滤时的那些行, INSERT 只会在后面追加行和列, 所以过滤时的行仍然
+// 是开头的那些行, 否则返回 errConcurrentModified
+func (p *deletePlan) apply(old memcore.Table, exists bool) (memcore.Table, error) {
+	if !exists || len(old.Records) < len(p.snapshot) {
+		return old, errConcurrentModified
+	}
+	kept := make([][]memcore.Value, 0, len(old.Records)-p.count)
+	for idx, values := range old.Records {
+		if idx >= len(p.snapshot) {
+			kept = append(kept, values)
+			continue
+		}
+		if !sameValues(p.snapshot[idx], values) {
+			return old, errConcurrentModified
+		}
+		if !p.deleted[idx] {
+			kept = append(kept, values)
+		}
+	}
+	old.Records = kept
+	return old, nil
+}
+
+// sameValues 判断 values 的开头是否与 snapshot 相同
+func sameValues(snapshot, values []memcore.Value) bool {
+	if len(values) < len(snapshot) {
+		return false
+	}
+	if len(snapshot) == 0 || &snapshot[0] == &values[0] {
+		return true
+	}
+	for idx := range snapshot {
+		a, b := &snapshot[idx], &values[idx]
+		if a.Type != b.Type || a.Str != b.Str || a.Int64 != b.Int64 || a.Uint64 != b.Uint64 ||
+			math.Float64bits(a.Float64) != math.Float64bits(b.Float64) || !reflect.DeepEqual(a.Any, b.Any) {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedTags(tags []memcore.KeyValue) memcore.KeyValues {
+	copyed := memcore.KeyValues(memcore.CloneKeyValues(tags))
+	sort.Sort(copyed)
+	return copyed
+}
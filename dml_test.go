@@ -0,0 +1,225 @@
+package memsql
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestExecInsertAndDelete(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Close()
+
+	ctx := &Context{
+		Ctx:     context.Background(),
+		Storage: WrapStorage(app.s),
+	}
+
+	affected, err := Exec(ctx, "INSERT INTO cpu (@mo, f1, f2) VALUES ('1', 1, 'a'), ('2', 2, 'b'), ('1', 3, 'c')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if affected != 3 {
+		t.Error("want 3 got", affected)
+	}
+
+	// 追加到已有的 measurement, 新的列填 null
+	affected, err = Exec(ctx, "INSERT INTO cpu (@mo, f1, f3) VALUES ('2', 4, 'x')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if affected != 1 {
+		t.Error("want 1 got", affected)
+	}
+
+	results, err := app.Execute(t, ctx, "select f1, f2, f3 from cpu where cpu.@mo = '2'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResults(t, true, false, results, []string{
+		`2,"b",null`,
+		`4,null,"x"`,
+	})
+
+	affected, err = Exec(ctx, "INSERT INTO mem (@mo, f1) SELECT cpu.@mo, f1 FROM cpu WHERE f1 > 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if affected != 2 {
+		t.Error("want 2 got", affected)
+	}
+	results, err = app.Execute(t, ctx, "select mem.@mo, f1 from mem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResults(t, true, false, results, []string{
+		`"1",3`,
+		`"2",4`,
+	})
+
+	affected, err = Exec(ctx, "DELETE FROM cpu WHERE @mo = '2'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if affected != 2 {
+		t.Error("want 2 got", affected)
+	}
+
+	affected, err = Exec(ctx, "DELETE FROM cpu WHERE f1 = 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if affected != 1 {
+		t.Error("want 1 got", affected)
+	}
+
+	results, err = app.Execute(t, ctx, "select cpu.@mo, f1, f2 from cpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResults(t, true, false, results, []string{
+		`"1",1,"a"`,
+	})
+}
+
+func TestExecConcurrentInsert(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Close()
+
+	ctx := &Context{
+		Ctx:     context.Background(),
+		Storage: WrapStorage(app.s),
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := Exec(ctx, "INSERT INTO cpu (@mo, f1) VALUES ('1', "+strconv.Itoa(i)+")")
+			if err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	results, err := app.Execute(t, ctx, "select count(*) from cpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResults(t, false, false, results, []string{`20`})
+}
+
+func TestExecDeleteFilter(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Close()
+
+	ctx := &Context{
+		Ctx:     context.Background(),
+		Storage: WrapStorage(app.s),
+	}
+
+	_, err := Exec(ctx, "INSERT INTO cpu (@mo, f1, f2) VALUES ('1', 1, 'a'), ('1', 2, 'b')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Exec(ctx, "INSERT INTO cpu (@mo, f1, f3) VALUES ('2', 3, 'x'), ('2', 4, 'y')")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 出错时不能删除任何行
+	if _, err := Exec(ctx, "DELETE FROM cpu WHERE f1 > 0 AND f2 + 1 > 0"); err == nil {
+		t.Error("want error")
+	}
+	results, err := app.Execute(t, ctx, "select count(*) from cpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResults(t, false, false, results, []string{`4`})
+
+	// 缺少 f3 的行不匹配
+	affected, err := Exec(ctx, "DELETE FROM cpu WHERE f3 = 'x'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if affected != 1 {
+		t.Error("want 1 got", affected)
+	}
+	results, err = app.Execute(t, ctx, "select f1 from cpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResults(t, true, false, results, []string{`1`, `2`, `4`})
+}
+
+func TestExecReplace(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Close()
+
+	ctx := &Context{
+		Ctx:     context.Background(),
+		Storage: WrapStorage(app.s),
+	}
+
+	_, err := Exec(ctx, "INSERT INTO cpu (@mo, f1, f2) VALUES ('1', 1, 'a'), ('1', 2, 'b'), ('2', 3, 'c')")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 只替换相同 tag 的 measurement, 其它的 measurement 不变
+	affected, err := Exec(ctx, "REPLACE INTO cpu (@mo, f1) VALUES ('1', 5), ('3', 6)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if affected != 2 {
+		t.Error("want 2 got", affected)
+	}
+
+	results, err := app.Execute(t, ctx, "select cpu.@mo, f1 from cpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResults(t, true, false, results, []string{`"1",5`, `"2",3`, `"3",6`})
+
+	// 原来的列也被替换了
+	results, err = app.Execute(t, ctx, "select * from cpu where cpu.@mo = '1'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResults(t, true, false, results, []string{`5`})
+}
+
+func TestExecUnsupported(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Close()
+
+	ctx := &Context{
+		Ctx:     context.Background(),
+		Storage: WrapStorage(app.s),
+	}
+
+	for _, sqlstmt := range []string{
+		"INSERT INTO fdw.cpu (@mo, f1) VALUES ('1', 1)",
+		"INSERT INTO cpu (@mo, f1) VALUES ('1')",
+		"DELETE FROM cpu WHERE f1 = 1 LIMIT 1",
+		"INSERT INTO cpu (@mo, f1, f2) VALUES ('1', f2, 1)",
+		"INSERT INTO cpu (@mo, f1) VALUES ('1', (select 1 from dual))",
+		"select * from cpu",
+	} {
+		_, err := Exec(ctx, sqlstmt)
+		if err == nil {
+			t.Error(sqlstmt, ": want error got ok")
+		} else if strings.Contains(err.Error(), "isnot support insert") {
+			t.Error(sqlstmt, ":", err)
+		}
+	}
+}
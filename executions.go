@@ -6,6 +6,8 @@ import (
 	"io"
 	"reflect"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/runner-mei/errors"
 	"github.com/runner-mei/memsql/memcore"
@@ -38,6 +40,24 @@ type Storage interface {
 	// Exists(name string, tags []KeyValue) bool
 }
 
+// SchemaStorage is implemented by the Storage which knows the schemas of the
+// tables, the planner validates the column references with them.
+type SchemaStorage interface {
+	Schema(name string) (*memcore.TableSchema, bool)
+}
+
+// PredicateStorage is implemented by the Storage which can evaluate the
+// simple conditions of the where clause before the records are materialized.
+type PredicateStorage interface {
+	FromWhere(ctx *SessionContext, tableName TableAlias, tableExpr sqlparser.Expr, predicates []memcore.Predicate, trace func(TableName)) (memcore.Query, error)
+}
+
+// MutableStorage is implemented by the Storage which supports the INSERT,
+// REPLACE and DELETE statements.
+type MutableStorage interface {
+	Mutable() (memcore.MutableStorage, bool)
+}
+
 func WrapStorage(storage memcore.Storage) Storage {
 	return storageWrapper{storage: storage}
 }
@@ -47,10 +67,27 @@ type storageWrapper struct {
 }
 
 func (s storageWrapper) From(ctx *SessionContext, tableName TableAlias, tableExpr sqlparser.Expr, trace func(name TableName)) (memcore.Query, error) {
-	return fromRun(ctx, s.storage, tableName, tableExpr, trace)
+	return fromRun(ctx, s.storage, tableName, tableExpr, nil, trace)
 }
 
-func fromRun(ctx *SessionContext, storage memcore.Storage, tableName TableAlias, tableExpr sqlparser.Expr, trace func(name TableName)) (memcore.Query, error) {
+func (s storageWrapper) FromWhere(ctx *SessionContext, tableName TableAlias, tableExpr sqlparser.Expr, predicates []memcore.Predicate, trace func(name TableName)) (memcore.Query, error) {
+	return fromRun(ctx, s.storage, tableName, tableExpr, predicates, trace)
+}
+
+func (s storageWrapper) Schema(name string) (*memcore.TableSchema, bool) {
+	ss, ok := s.storage.(memcore.SchemaStorage)
+	if !ok {
+		return nil, false
+	}
+	return ss.Schema(name)
+}
+
+func (s storageWrapper) Mutable() (memcore.MutableStorage, bool) {
+	ms, ok := s.storage.(memcore.MutableStorage)
+	return ms, ok
+}
+
+func fromRun(ctx *SessionContext, storage memcore.Storage, tableName TableAlias, tableExpr sqlparser.Expr, predicates []memcore.Predicate, trace func(name TableName)) (memcore.Query, error) {
 	var f = func(vm.Context) (bool, error) {
 		return true, nil
 	}
@@ -66,6 +103,9 @@ func fromRun(ctx *SessionContext, storage memcore.Storage, tableName TableAlias,
 		}
 		f = ff
 	}
+	if ps, ok := storage.(memcore.PredicateStorage); ok && len(predicates) > 0 {
+		return ps.FromWhere(ctx, tableName.Name, f, predicates, trace)
+	}
 	return storage.From(ctx, tableName.Name, f, trace)
 }
 
@@ -74,6 +114,43 @@ type Context struct {
 	Debuger ExecuteTracer
 	Storage Storage
 	Foreign Foreign
+
+	// SemiJoinBatchSize is the count of the join keys in a IN list which is
+	// sent to the foreign table, 0 is DefaultSemiJoinBatchSize and a negative
+	// value disables the semi-join.
+	SemiJoinBatchSize int
+
+	// ForeignCache caches the results of the foreign queries across the
+	// sessions, the results are always cached in the session.
+	ForeignCache *ForeignCache
+
+	// MaxRecursion is the max count of the iterations of a recursive common
+	// table expression, 0 is DefaultMaxRecursion.
+	MaxRecursion int
+
+	// TimeZone is the time zone of the session, the datetime strings are
+	// parsed in it, the datetimes in the results are formatted in it and
+	// now(), date() and the intervals of months and days use its calendar,
+	// nil is vm.TimeLocal.
+	TimeZone *time.Location
+
+	// Collation is the collation of the session, it is used to compare the
+	// strings if the column isnot declared with a collation and no COLLATE is
+	// specified.
+	Collation vm.Collation
+
+	// Parallelism is the max count of the measurements of a table which are
+	// scanned, filtered and aggregated concurrently, and the inner table of a
+	// join is built concurrently if it is greater than 1. 0 or 1 means the
+	// query runs in one goroutine. The order of the rows isnot changed by it.
+	Parallelism int
+
+	foreignsMu sync.Mutex
+	foreigns   map[string]*foreignServer
+
+	viewsMu     sync.Mutex
+	viewsLoaded bool
+	views       map[string]*MaterializedView
 }
 
 
@@ -85,12 +162,17 @@ type SessionContext struct {
 	alias      map[string]string
 	resultSets map[string][]memcore.Record
 	queries    []TableQuery
+	datasources []Datasource
+
+	foreignResults map[string][]memcore.Record
+	commonTables   map[string]*commonTable
 }
 
 type TableQuery struct {
-	Name  string
-	Alias string
-	Query *memcore.ReferenceQuery
+	Name    string
+	Alias   string
+	Query   *memcore.ReferenceQuery
+	Foreign bool
 }
 
 func (sc *SessionContext) SetResultSet(stmt string, records []memcore.Record) {
@@ -106,6 +188,11 @@ func (sc *SessionContext) ExecuteSelect(stmt sqlparser.SelectStatement) (memcore
 	return ExecuteSelectStatement(sc, stmt, false)
 }
 
+// Location returns the time zone of the session, nil is vm.TimeLocal.
+func (sc *SessionContext) Location() *time.Location {
+	return sc.Context.TimeZone
+}
+
 func (sc *SessionContext) GetQuery(name string) (*memcore.ReferenceQuery, bool) {
 	for idx := range sc.queries {
 		if sc.queries[idx].Name == name || sc.queries[idx].Alias == name {
@@ -115,10 +202,23 @@ func (sc *SessionContext) GetQuery(name string) (*memcore.ReferenceQuery, bool)
 
 	return nil, false
 }
+func (sc *SessionContext) getTableQuery(name string) (*TableQuery, bool) {
+	for idx := range sc.queries {
+		if sc.queries[idx].Name == name || sc.queries[idx].Alias == name {
+			return &sc.queries[idx], true
+		}
+	}
+	return nil, false
+}
+
 func (sc *SessionContext) addQuery(tableName, tableAlias string, query *memcore.ReferenceQuery) {
 	sc.queries = append(sc.queries, TableQuery{Name: tableName, Alias: tableAlias, Query: query})
 }
 
+func (sc *SessionContext) addForeignQuery(tableName, tableAlias string, query *memcore.ReferenceQuery) {
+	sc.queries = append(sc.queries, TableQuery{Name: tableName, Alias: tableAlias, Query: query, Foreign: true})
+}
+
 func (sc *SessionContext) addAlias(tableAlias, tableName string) error {
 	_, ok := sc.alias[tableAlias]
 	if ok {
@@ -128,6 +228,8 @@ func (sc *SessionContext) addAlias(tableAlias, tableName string) error {
 	return nil
 }
 
+var _ memcore.ClosingContext = &SessionContext{}
+
 func (sc *SessionContext) OnClosing(closers ...io.Closer) {
 	sc.closers = append(sc.closers, closers...)
 }
@@ -186,7 +288,7 @@ type TableContext struct {
 
 
 func Execute(ctx *Context, sqlstmt string) (rset RecordSet, err error) {
-	stmt, e := parse(sqlstmt)
+	with, stmt, e := parseWith(sqlstmt)
 	if e != nil {
 		return nil, e
 	}
@@ -201,6 +303,11 @@ func Execute(ctx *Context, sqlstmt string) (rset RecordSet, err error) {
 		}
 	}()
 
+	e = ExecuteWith(sessctx, with)
+	if e != nil {
+		return nil, e
+	}
+
 	query, e := ExecuteSelectStatement(sessctx, stmt, false)
 	if e != nil {
 		return nil, e
@@ -215,12 +322,15 @@ func Execute(ctx *Context, sqlstmt string) (rset RecordSet, err error) {
 	if e != nil {
 		return nil, e
 	}
+	if ctx.TimeZone != nil {
+		resultsIn(results, ctx.TimeZone)
+	}
 
 	return RecordSet(results), nil
 }
 
 func parse(sqlstr string) (sqlparser.SelectStatement, error) {
-	stmt, err := sqlparser.Parse(sqlstr)
+	stmt, err := sqlparser.Parse(rewriteAtTimeZone(sqlstr))
 	if err != nil {
 		return nil, err
 	}
@@ -264,7 +374,7 @@ func ExecuteUnion(ec *SessionContext, stmt *sqlparser.Union, hasJoin bool) (memc
 	var query memcore.Query
 	switch stmt.Type {
 	case sqlparser.UnionStr:
-		query = left.Union(right)
+		query = left.UnionWith(right, parser.CompareOptionOf(ec))
 	case sqlparser.UnionAllStr:
 		query = left.UnionAll(right)
 	// case sqlparser.UnionDistinctStr:
@@ -310,7 +420,18 @@ func ExecuteSelect(ec *SessionContext, stmt *sqlparser.Select, hasJoin bool) (me
 		hasJoin = true
 	}
 
-	_, query, err := ExecuteTableExpression(ec, stmt.From[0], stmt.Where, hasJoin)
+	if err := validateSelect(ec, stmt); err != nil {
+		return memcore.Query{}, err
+	}
+
+	var query memcore.Query
+	var err error
+	pushdown := planForeignPushdown(ec, stmt, hasJoin)
+	if pushdown != nil {
+		query, err = pushdown.execute(ec, stmt.Where)
+	} else {
+		_, query, err = ExecuteTableExpression(ec, stmt.From[0], stmt.Where, hasJoin)
+	}
 	if err != nil {
 		return memcore.Query{}, errors.Wrap(err, "couldn't parse from expression")
 	}
@@ -358,21 +479,22 @@ func ExecuteSelect(ec *SessionContext, stmt *sqlparser.Select, hasJoin bool) (me
 		}
 	}
 
-	if stmt.OrderBy != nil {
+	// 聚合下推后只有一行结果
+	if stmt.OrderBy != nil && (pushdown == nil || !pushdown.aggregate) {
 		query, err = ExecuteOrderBy(ec, query, stmt.OrderBy)
 		if err != nil {
 			return memcore.Query{}, err
 		}
 	}
 
-	if stmt.Limit != nil {
+	if stmt.Limit != nil && (pushdown == nil || !pushdown.limit) {
 		query, err = ExecuteLimit(ec, query, stmt.Limit)
 		if err != nil {
 			return memcore.Query{}, err
 		}
 	}
 
-	if stmt.SelectExprs != nil {
+	if stmt.SelectExprs != nil && (pushdown == nil || !pushdown.aggregate) {
 		query, err = ExecuteSelectExprs(ec, query, stmt.SelectExprs)
 		if err != nil {
 			return memcore.Query{}, err
@@ -431,18 +553,18 @@ func ExecuteJoinTableExpression(ec *SessionContext, expr *sqlparser.JoinTableExp
 		resultSelector := func(outer memcore.Record, inner Record) memcore.Record {
 			return memcore.MergeRecord(leftAs.As, outer, rightAs.As, inner)
 		}
-		return Datasource{}, query1.Join(false, query2, left, right, resultSelector), nil
+		return Datasource{}, join(ec, false, query1, query2, left, right, resultSelector), nil
 	// case sqlparser.StraightJoinStr:
 	case sqlparser.LeftJoinStr:
 		resultSelector := func(outer memcore.Record, inner Record) memcore.Record {
 			return memcore.MergeRecord(leftAs.As, outer, rightAs.As, inner)
 		}
-		return Datasource{}, query1.Join(true, query2, left, right, resultSelector), nil
+		return Datasource{}, join(ec, true, query1, query2, left, right, resultSelector), nil
 	case sqlparser.RightJoinStr:
 		resultSelector := func(outer memcore.Record, inner Record) memcore.Record {
 			return memcore.MergeRecord(rightAs.As, inner, leftAs.As, outer)
 		}
-		return Datasource{}, query2.Join(true, query1, right, left, resultSelector), nil
+		return Datasource{}, join(ec, true, query2, query1, right, left, resultSelector), nil
 	// case sqlparser.NaturalJoinStr:
 	// case sqlparser.NaturalLeftJoinStr:
 	// case sqlparser.NaturalRightJoinStr:
@@ -451,6 +573,17 @@ func ExecuteJoinTableExpression(ec *SessionContext, expr *sqlparser.JoinTableExp
 	}
 }
 
+// join 在 Parallelism 大于 1 时并发地读取 inner, 只有由 partition 组成的
+// inner 才能并发地读取, 见 ExecuteWhere
+func join(ec *SessionContext, isLeft bool, outer, inner memcore.Query,
+	outerKeySelector, innerKeySelector func(memcore.Record) (memcore.Value, error),
+	resultSelector func(outer memcore.Record, inner memcore.Record) memcore.Record) memcore.Query {
+	if ec.Parallelism > 1 && inner.Partitions != nil {
+		return outer.JoinParallel(isLeft, inner, memcore.BatchKeys(outerKeySelector), innerKeySelector, resultSelector)
+	}
+	return outer.Join(isLeft, inner, outerKeySelector, innerKeySelector, resultSelector)
+}
+
 func ParseJoinOn(ctx *SessionContext, on sqlparser.Expr) (
 	leftAs string, left func(memcore.Record) (memcore.Value, error),
 	rightAs string, right func(memcore.Record) (memcore.Value, error), err error) {
@@ -530,7 +663,11 @@ func ExecuteAliasedTableExpression(ec *SessionContext, expr *sqlparser.AliasedTa
 		}
 
 		reference := query.ToReference()
-		ec.addQuery(ds.Table, ds.As, reference)
+		if ds.Qualifier != "" && ec.lookupForeign(ds.Qualifier) != nil {
+			ec.addForeignQuery(ds.Table, ds.As, reference)
+		} else {
+			ec.addQuery(ds.Table, ds.As, reference)
+		}
 		return ds, reference.Query, err
 	case *sqlparser.Subquery:
 		query, err := ExecuteSelectStatement(ec, subExpr.Select, hasJoin)
@@ -552,10 +689,19 @@ func ExecuteAliasedTableExpression(ec *SessionContext, expr *sqlparser.AliasedTa
 }
 
 func ExecuteTable(ec *SessionContext, ds Datasource, where *sqlparser.Where, hasJoin bool) (memcore.Query, error) {
-	if ds.Qualifier == "fdw" {
-		tableAlias := TableAlias{Name: strings.TrimPrefix(ds.Table, "fdw."), Alias: ds.As}
+	if ds.Qualifier != "" {
+		foreign, err := ec.LookupForeign(ds.Qualifier)
+		if err != nil {
+			// 限定名不是外部源时读取本地的表, 本地也没有时返回 err
+			if !hasLocalTable(ec, ds.Table) {
+				return memcore.Query{}, err
+			}
+			ds.Qualifier = ""
+			return ExecuteTable(ec, ds, where, hasJoin)
+		}
+		tableAlias := TableAlias{Name: strings.TrimPrefix(ds.Table, ds.Qualifier+"."), Alias: ds.As}
 		if where == nil || !hasJoin {
-			return ec.Foreign.From(ec, tableAlias, where)
+			return fromForeign(ec, ds.Qualifier, foreign, tableAlias, where)
 		}
 
 		whereExpr, err := parser.SplitByTableName(where.Expr, ds.Table, ds.As)
@@ -563,7 +709,14 @@ func ExecuteTable(ec *SessionContext, ds Datasource, where *sqlparser.Where, has
 			return memcore.Query{}, err
 		}
 
-		return ec.Foreign.From(ec, tableAlias, &sqlparser.Where{Expr: whereExpr})
+		if key, ok := findSemiJoinKey(ec, ds, where.Expr); ok {
+			return semiJoin(ec, ds.Qualifier, foreign, tableAlias, whereExpr, key), nil
+		}
+		return fromForeign(ec, ds.Qualifier, foreign, tableAlias, &sqlparser.Where{Expr: whereExpr})
+	}
+
+	if table, ok := ec.lookupCommonTable(ds.Table); ok {
+		return fromCommonTable(ec, table, ds, where, hasJoin)
 	}
 
 	tableAlias := TableAlias{Name: ds.Table, Alias: ds.As}
@@ -572,13 +725,31 @@ func ExecuteTable(ec *SessionContext, ds Datasource, where *sqlparser.Where, has
 		expr = where.Expr
 	}
 
+	ec.datasources = append(ec.datasources, ds)
+	schema, hasSchema := lookupSchema(ec, ds.Table)
+	if hasSchema && expr != nil {
+		if err := validateColumns(ds, schema, expr, !hasJoin); err != nil {
+			return memcore.Query{}, err
+		}
+	}
+
 	var tableNames []TableName
-	query, err := ec.Storage.From(ec, tableAlias, expr, func(name TableName){
+	var trace = func(name TableName) {
 		tableNames = append(tableNames, name)
-	})
+	}
+	var query memcore.Query
+	var err error
+	if ps, ok := ec.Storage.(PredicateStorage); ok {
+		predicates := parser.ToPredicates(expr, tableAlias, !hasJoin)
+		predicates = binaryPredicates(ec, schema, predicates)
+		query, err = ps.FromWhere(ec, tableAlias, expr, predicates, trace)
+	} else {
+		query, err = ec.Storage.From(ec, tableAlias, expr, trace)
+	}
 	if err != nil {
 		return memcore.Query{}, err
 	}
+	query = query.WithParallelism(ec.Parallelism)
 	debuger := ec.Debuger.NewTable(ds.Table, ds.As, expr)
 	if debuger != nil {
 		debuger.SetTableNames(tableNames)
@@ -600,7 +771,11 @@ func ExecuteTable(ec *SessionContext, ds Datasource, where *sqlparser.Where, has
 	}
 
 	if ds.As != "" {
-		query = query.Map(memcore.RenameTableToAlias(ds.As))
+		if query.IterateBatch != nil {
+			query = query.SelectBatch(memcore.RenameBatchToAlias(ds.As))
+		} else {
+			query = query.Map(memcore.RenameTableToAlias(ds.As))
+		}
 	}
 
 
@@ -615,12 +790,23 @@ func ExecuteWhere(ec *SessionContext, query memcore.Query, expr sqlparser.Expr)
 		return query, nil
 	}
 
-	f, err := parser.ToFilter(ec, expr)
+	program, err := parser.Compile(ec, expr)
 	if err != nil {
 		return memcore.Query{}, errors.Wrap(err, "couldn't convert where '"+sqlparser.String(expr)+"'")
 	}
+	filter := memcore.NewProgram(program, true)
+	if len(program.Funcs) > 0 {
+		// OpEval 的函数是 parser.ToGetValue 生成的闭包, 如子查询会调用
+		// ec.GetResultSet 和 ec.ExecuteSelect, SessionContext 的 resultSets
+		// 等没有加锁, 所以它们不能在每个 partition 上并发地执行. 这时
+		// partition 仍然并发地读取, 只是在汇集后的行上过滤
+		query = query.Gather()
+	}
+	if query.IterateBatch != nil {
+		return query.WhereBatch(filter.FilterBatch), nil
+	}
 	query = query.Where(func(idx int, r memcore.Record) (bool, error) {
-		return f(memcore.ToRecordValuer(&r, true))
+		return filter.Filter(&r)
 	})
 
 	// type Where Expr
@@ -646,41 +832,30 @@ func ExecuteOrderBy(ec *SessionContext, query memcore.Query, orderBy sqlparser.O
 		return query, nil
 	}
 
-	read, err := parser.ToGetValue(ec, orderBy[0].Expr)
-	if err != nil {
-		return memcore.Query{}, err
-	}
-
 	var orderedQuery memcore.OrderedQuery
-	switch orderBy[0].Direction {
-	case sqlparser.AscScr, "":
-		orderedQuery = query.OrderByAscending(func(r memcore.Record) (memcore.Value, error) {
-			return read(memcore.ToRecordValuer(&r, false))
-		})
-	case sqlparser.DescScr:
-		orderedQuery = query.OrderByDescending(func(r memcore.Record) (memcore.Value, error) {
-			return read(memcore.ToRecordValuer(&r, false))
-		})
-	default:
-		return memcore.Query{}, errors.New("invalid order by " + sqlparser.String(orderBy[0]))
-	}
-
-	for idx := 1; idx < len(orderBy); idx++ {
-		read, err := parser.ToGetValue(ec, orderBy[idx].Expr)
+	for idx := range orderBy {
+		program, err := parser.Compile(ec, orderBy[idx].Expr)
 		if err != nil {
 			return memcore.Query{}, err
 		}
+		read := memcore.NewProgram(program, false)
+		var desc bool
 		switch orderBy[idx].Direction {
 		case sqlparser.AscScr, "":
-			orderedQuery = orderedQuery.ThenByAscending(func(r memcore.Record) (memcore.Value, error) {
-				return read(memcore.ToRecordValuer(&r, false))
-			})
 		case sqlparser.DescScr:
-			orderedQuery = orderedQuery.ThenByDescending(func(r memcore.Record) (memcore.Value, error) {
-				return read(memcore.ToRecordValuer(&r, false))
-			})
+			desc = true
 		default:
-			return memcore.Query{}, errors.New("invalid order by " + sqlparser.String(orderBy[0]))
+			return memcore.Query{}, errors.New("invalid order by " + sqlparser.String(orderBy[idx]))
+		}
+
+		selector := func(r memcore.Record) (memcore.Value, error) {
+			return read.Run(&r)
+		}
+		opt := parser.CompareOptionOf(ec, orderBy[idx].Expr)
+		if idx == 0 {
+			orderedQuery = query.OrderByWith(selector, desc, opt)
+		} else {
+			orderedQuery = orderedQuery.ThenByWith(selector, desc, opt)
 		}
 	}
 	return orderedQuery.Query, nil
@@ -724,7 +899,11 @@ func ExecuteLimit(ec *SessionContext, query memcore.Query, limit *sqlparser.Limi
 		if err != nil {
 			return query, err
 		}
-		query = query.Take(int(i64))
+		if query.IterateBatch != nil {
+			query = query.TakeBatch(int(i64))
+		} else {
+			query = query.Take(int(i64))
+		}
 	}
 
 	return query, nil
@@ -743,7 +922,7 @@ func ExecuteSelectExprs(ec *SessionContext, query memcore.Query, selectExprs sql
 
 	var aggAsNames []string
 	var aggFuncs []memcore.AggregatorFactory
-	var selectFuncs []func(vm.Context, Record) (Record, error)
+	var selectFuncs []func(*Record, Record) (Record, error)
 	for idx := range selectExprs {
 		subexpr := selectExprs[idx]
 		switch v := subexpr.(type) {
@@ -757,14 +936,13 @@ func ExecuteSelectExprs(ec *SessionContext, query memcore.Query, selectExprs sql
 						return query, fmt.Errorf("invalid expression %T %+v", subexpr, subexpr)
 					}
 					if len(subexpr.Exprs) == 1 {
-						var readValue func(vm.Context) (vm.Value, error)
+						var readValue *vm.Program
 						if _, ok := subexpr.Exprs[0].(*sqlparser.StarExpr); ok {
-							readValue = func(vm.Context) (vm.Value, error) {
-								return vm.IntToValue(1), nil
-							}
+							readValue = &vm.Program{}
+							readValue.Emit(vm.OpConst, readValue.AddConst(vm.IntToValue(1)))
 						} else {
 							var err error
-							readValue, err = parser.ToGetSelectValue(ec, subexpr.Exprs[0])
+							readValue, err = parser.CompileSelect(ec, subexpr.Exprs[0])
 							if err != nil {
 								return query, err
 							}
@@ -802,19 +980,13 @@ func ExecuteSelectExprs(ec *SessionContext, query memcore.Query, selectExprs sql
 					aggFuncs = append(aggFuncs, aggFunc)
 					break
 				}
-				f, err := parser.ToFuncGetValue(ec, subexpr)
-				if err != nil {
-					return query, err
-				}
-				selectFuncs = append(selectFuncs, toSelectFunc(v.As.String(), f))
-				break
 			}
 
-			f, err := parser.ToGetValue(ec, v.Expr)
+			program, err := parser.CompileSelect(ec, v)
 			if err != nil {
 				return query, err
 			}
-			selectFuncs = append(selectFuncs, toSelectFunc(v.As.String(), f))
+			selectFuncs = append(selectFuncs, toSelectFunc(v.As.String(), memcore.NewProgram(program, true)))
 		case sqlparser.Nextval:
 			return query, fmt.Errorf("invalid expression %T %+v", subexpr, subexpr)
 		default:
@@ -827,10 +999,8 @@ func ExecuteSelectExprs(ec *SessionContext, query memcore.Query, selectExprs sql
 			return query, errors.New("agg function and nonagg function exist simultaneously")
 		}
 		selector := func(index int, r Record) (result Record, err error) {
-			valuer := memcore.ToRecordValuer(&r, true)
-			// valuer = vm.WrapAlias(valuer, ec.alias)
 			for _, f := range selectFuncs {
-				result, err = f(valuer, result)
+				result, err = f(&r, result)
 				if err != nil {
 					return
 				}
@@ -841,15 +1011,18 @@ func ExecuteSelectExprs(ec *SessionContext, query memcore.Query, selectExprs sql
 	}
 
 	if len(aggFuncs) > 0 {
+		if query.IterateBatch != nil {
+			return query.AggregateWithBatch(aggAsNames, aggFuncs), nil
+		}
 		return query.AggregateWith(aggAsNames, aggFuncs), nil
 	}
 
 	return query, nil
 }
 
-func toSelectFunc(as string, f func(vm.Context) (Value, error)) func(ctx vm.Context, result Record) (Record, error) {
-	return func(ctx vm.Context, result Record) (Record, error) {
-		value, err := f(ctx)
+func toSelectFunc(as string, program *memcore.Program) func(r *Record, result Record) (Record, error) {
+	return func(r *Record, result Record) (Record, error) {
+		value, err := program.Run(r)
 		if err != nil {
 			return Record{}, err
 		}
@@ -867,9 +1040,7 @@ func toSelectAggFunc(idx int, as string, funcName string,
 
 func toSelectAggOneFunc(idx int, as string, funcName string,
 	f func() vm.Aggregator,
-	readValue func(vm.Context) (Value, error)) (memcore.AggregatorFactoryFunc, error) {
-	return memcore.AggregatorFunc(f, func(ctx memcore.Context, r memcore.Record) (vm.Value, error) {
-		return readValue(memcore.ToRecordValuer(&r, false))
-	}), nil
+	readValue *vm.Program) (memcore.AggregatorFactoryFunc, error) {
+	return memcore.ProgramAggregatorFunc(f, memcore.NewProgram(readValue, false)), nil
 }
 
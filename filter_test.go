@@ -1,6 +1,7 @@
 package memsql
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/runner-mei/memsql/memcore"
@@ -251,3 +252,37 @@ func TestFilter(t *testing.T) {
 	}
 
 }
+
+// TestFilterRuntimeError 常量表达式的错误在运行时返回, 空表不会出错
+func TestFilterRuntimeError(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Close()
+
+	app.Add(t, &TestTable{Name: "empty", Records: []map[string]interface{}{}})
+	app.Add(t, &TestTable{Name: "one", Records: []map[string]interface{}{{"id": 1}}})
+
+	for _, sql := range []string{
+		"select * from empty where id > 'a' + 1",
+		"select * from empty where id + 1 > ('a' + 1) * 2",
+		"select * from empty where id in (1, 'a' + 1)",
+	} {
+		results, err := app.Execute(t, nil, sql)
+		if err != nil {
+			t.Error(sql, err)
+			continue
+		}
+		if len(results) != 0 {
+			t.Error(sql, ": want empty got", results)
+		}
+	}
+
+	for _, sql := range []string{
+		"select * from one where id > 'a' + 1",
+		"select * from one where id + 1 > ('a' + 1) * 2",
+	} {
+		_, err := app.Execute(t, nil, sql)
+		if err == nil || !strings.Contains(err.Error(), "cloudn't 'string' + 'int'") {
+			t.Error(sql, ": want error got", err)
+		}
+	}
+}
@@ -3,45 +3,80 @@ package memsql
 import (
 	"database/sql"
 	"fmt"
-	"strings"
 
 	"github.com/runner-mei/memsql/memcore"
 	"github.com/xwb1989/sqlparser"
 )
 
 func NewDbForeign(drv string, conn *sql.DB) Foreign {
+	return NewDbForeignWithMapper(drv, conn, nil)
+}
+
+// NewDbForeignWithMapper creates the foreign with the custom mapping of the
+// column types, the default mapping is used if mapper returns nil.
+func NewDbForeignWithMapper(drv string, conn *sql.DB, mapper ColumnTypeMapper) Foreign {
 	return &dbForeign{
-		Drv:  drv,
-		Conn: conn,
+		Drv:        drv,
+		Conn:       conn,
+		Dialect:    DialectByDriver(drv),
+		TypeMapper: mapper,
 	}
 }
 
 type dbForeign struct {
-	Drv  string
-	Conn *sql.DB
+	Drv        string
+	Conn       *sql.DB
+	Dialect    *Dialect
+	TypeMapper ColumnTypeMapper
+
+	// Server is set when the foreign is registered, the tables of the server
+	// in the subqueries are renamed to the tables in the database. The
+	// qualifier is DefaultForeignName if the foreign isnot registered.
+	Server *foreignServer
+}
+
+func (f *dbForeign) Capabilities() ForeignCapabilities {
+	return ForeignCapabilities{
+		Projection: true,
+		OrderBy:    true,
+		Limit:      true,
+		Aggregate:  true,
+	}
 }
 
 func (f *dbForeign) From(ctx *SessionContext, tableName TableAlias, where *sqlparser.Where) (memcore.Query, error) {
-	sqlstr := "SELECT * FROM " + tableName.Name
-	if tableName.Alias != "" {
-		sqlstr = sqlstr + " AS " + tableName.Alias
+	return f.FromSpec(ctx, tableName, where, nil)
+}
+
+func (f *dbForeign) FromSpec(ctx *SessionContext, tableName TableAlias, where *sqlparser.Where, spec *ForeignSpec) (memcore.Query, error) {
+	dialect := f.Dialect
+	if dialect == nil {
+		dialect = DialectByDriver(f.Drv)
 	}
 
+	var args []interface{}
 	debuger := ctx.Debuger.NewTable(tableName.Name, tableName.Alias, nil)
+	var whereStr string
 	if where != nil && where.Expr != nil {
-		sqlstr = sqlstr +" WHERE "+ sqlparser.String(where.Expr)
+		var err error
+		server := f.Server
+		if server == nil {
+			server = &foreignServer{name: DefaultForeignName}
+		}
+		whereStr, args, err = dialect.toSQL(ctx, where.Expr, nil, server)
+		if err != nil {
+			return memcore.Query{}, err
+		}
 		if debuger != nil {
 			debuger.SetWhere(where.Expr)
 		}
-		if f.Drv == "sqlite3" {
-			sqlstr = strings.Replace(sqlstr, "true", "1", -1)
-			sqlstr = strings.Replace(sqlstr, "false", "0", -1)
-		}
 	}
+	sqlstr := dialect.SelectSQL(tableName, whereStr, spec)
+	isAggregate := spec != nil && len(spec.Aggregates) > 0
 
 	query := memcore.Query{
 		Iterate: func() memcore.Iterator {
-			rows, err := f.Conn.QueryContext(ctx.Ctx, sqlstr)
+			rows, err := f.Conn.QueryContext(ctx.Ctx, sqlstr, args...)
 			if err != nil {
 				return func(memcore.Context) ( memcore.Record, error) {
 					return memcore.Record{}, wrap(err, "execute '"+sqlstr+"' fail")
@@ -57,22 +92,23 @@ func (f *dbForeign) From(ctx *SessionContext, tableName TableAlias, where *sqlpa
 				}
 			}
 
-			// columnTypes, err := rows.ColumnTypes()
-			// if err != nil {
-			// 	return nil, memcore.Query{}, err
-			// }
+			columnTypes, err := rows.ColumnTypes()
+			if err != nil {
+				rows.Close()
+
+				return func(memcore.Context) ( memcore.Record, error) {
+					return memcore.Record{}, wrap(err, fmt.Sprintf("read column types of %q fail", sqlstr))
+				}
+			}
 
-			var initFuncs = make([]func(*memcore.Value) interface{}, len(columnNames))
+			var initFuncs = toColumnScanners(f.Drv, columnTypes, f.TypeMapper)
 			var columns = make([]memcore.Column, len(columnNames))
 			for idx := range columns {
-				columns[idx].TableName = tableName.Name
-				columns[idx].TableAs = tableName.Alias
-				columns[idx].Name = columnNames[idx]
-				initFuncs[idx] = func(value *memcore.Value) interface{} {
-					return scanValue{
-						value: value,
-					}
+				if !isAggregate {
+					columns[idx].TableName = tableName.Name
+					columns[idx].TableAs = tableName.Alias
 				}
+				columns[idx].Name = columnNames[idx]
 			}
 
 			ctx.OnClosing(rows)
@@ -116,7 +152,7 @@ func (f *dbForeign) From(ctx *SessionContext, tableName TableAlias, where *sqlpa
 		},
 	}
 
-	if tableName.Alias != "" {
+	if tableName.Alias != "" && !isAggregate {
 		query = query.Map(memcore.RenameTableToAlias(tableName.Alias))
 	}
 	if debuger != nil {
@@ -124,49 +160,3 @@ func (f *dbForeign) From(ctx *SessionContext, tableName TableAlias, where *sqlpa
 	}
 	return query, nil
 }
-
-type scanValue struct {
-	value *memcore.Value
-}
-
-func (sv scanValue) Scan(value interface{}) error {
-	if value == nil {
-		return nil
-	}
-
-	switch v := value.(type) {
-	case int8:
-		sv.value.SetInt64(int64(v))
-	case int16:
-		sv.value.SetInt64(int64(v))
-	case int32:
-		sv.value.SetInt64(int64(v))
-	case int64:
-		sv.value.SetInt64(v)
-	case int:
-		sv.value.SetInt64(int64(v))
-	case uint8:
-		sv.value.SetUint64(uint64(v))
-	case uint16:
-		sv.value.SetUint64(uint64(v))
-	case uint32:
-		sv.value.SetUint64(uint64(v))
-	case uint64:
-		sv.value.SetUint64(v)
-	case uint:
-		sv.value.SetUint64(uint64(v))
-	case float32:
-		sv.value.SetFloat64(float64(v))
-	case float64:
-		sv.value.SetFloat64(v)
-	case string:
-		sv.value.SetString(v)
-	case bool:
-		sv.value.SetBool(v)
-	case []byte:
-		sv.value.SetString(string(v))
-	default:
-		return fmt.Errorf("unsupported type %T", v)
-	}
-	return nil
-}
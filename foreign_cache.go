@@ -0,0 +1,212 @@
+package memsql
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/runner-mei/memsql/memcore"
+	"github.com/runner-mei/memsql/vm"
+	"github.com/xwb1989/sqlparser"
+)
+
+// ForeignCache caches the results of the foreign queries across the
+// sessions, the entries are expired after TTL and the least recently used
+// entries are removed when there are more than MaxEntries entries.
+type ForeignCache struct {
+	TTL        time.Duration
+	MaxEntries int
+	// MaxRecords is the max count of the records in a entry, the larger
+	// results are not cached. 0 is unlimited.
+	MaxRecords int
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+type foreignCacheEntry struct {
+	key     string
+	records []memcore.Record
+	expired time.Time
+}
+
+func NewForeignCache(ttl time.Duration, maxEntries int) *ForeignCache {
+	return &ForeignCache{
+		TTL:        ttl,
+		MaxEntries: maxEntries,
+		lru:        list.New(),
+		entries:    map[string]*list.Element{},
+	}
+}
+
+func (c *ForeignCache) Get(key string) ([]memcore.Record, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*foreignCacheEntry)
+	if c.TTL > 0 && time.Now().After(entry.expired) {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return entry.records, true
+}
+
+func (c *ForeignCache) Put(key string, records []memcore.Record) {
+	if c.MaxRecords > 0 && len(records) > c.MaxRecords {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &foreignCacheEntry{
+		key:     key,
+		records: records,
+		expired: time.Now().Add(c.TTL),
+	}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+
+	for c.MaxEntries > 0 && c.lru.Len() > c.MaxEntries {
+		elem := c.lru.Back()
+		c.lru.Remove(elem)
+		delete(c.entries, elem.Value.(*foreignCacheEntry).key)
+	}
+}
+
+func (c *ForeignCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+func (c *ForeignCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Init()
+	c.entries = map[string]*list.Element{}
+}
+
+// foreignCacheKey 由数据源, 表名, 别名, 下推的条件和 spec 组成, 条件中有 now()
+// 等与当前时间有关的函数时结果不能在会话之间共享, shared 为 false
+func foreignCacheKey(source string, tableAs TableAlias, where *sqlparser.Where, spec *ForeignSpec) (key string, shared bool) {
+	shared = true
+	var sb strings.Builder
+	sb.WriteString(source)
+	sb.WriteString(".")
+	sb.WriteString(tableAs.Name)
+	if tableAs.Alias != "" {
+		sb.WriteString(" as ")
+		sb.WriteString(tableAs.Alias)
+	}
+	if where != nil && where.Expr != nil {
+		sb.WriteString(" where ")
+		sb.WriteString(sqlparser.String(where.Expr))
+		shared = !hasTimeFunc(where.Expr)
+	}
+	if !spec.IsEmpty() {
+		fmt.Fprintf(&sb, " spec %+v", *spec)
+	}
+	return sb.String(), shared
+}
+
+func hasTimeFunc(expr sqlparser.SQLNode) bool {
+	found := false
+	sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if v, ok := node.(*sqlparser.FuncExpr); ok {
+			if _, ok := vm.TimeFuncs[v.Name.Lowered()]; ok {
+				found = true
+			}
+		}
+		return !found, nil
+	}, expr)
+	return found
+}
+
+func (sc *SessionContext) lookupForeignCache(key string, shared bool) ([]memcore.Record, bool) {
+	if records, ok := sc.foreignResults[key]; ok {
+		sc.Debuger.CacheHit(key, CacheSession)
+		return records, true
+	}
+	if shared && sc.ForeignCache != nil {
+		if records, ok := sc.ForeignCache.Get(key); ok {
+			sc.Debuger.CacheHit(key, CacheGlobal)
+			sc.storeSessionCache(key, records)
+			return records, true
+		}
+	}
+	return nil, false
+}
+
+func (sc *SessionContext) storeSessionCache(key string, records []memcore.Record) {
+	if sc.foreignResults == nil {
+		sc.foreignResults = map[string][]memcore.Record{}
+	}
+	sc.foreignResults[key] = records
+}
+
+func (sc *SessionContext) storeForeignCache(key string, shared bool, records []memcore.Record) {
+	sc.storeSessionCache(key, records)
+	if shared && sc.ForeignCache != nil {
+		sc.ForeignCache.Put(key, records)
+	}
+}
+
+func fromForeign(ec *SessionContext, source string, foreign Foreign, tableAs TableAlias, where *sqlparser.Where) (memcore.Query, error) {
+	key, shared := foreignCacheKey(source, tableAs, where, nil)
+	return fromForeignCache(ec, key, shared, func() (memcore.Query, error) {
+		return foreign.From(ec, tableAs, where)
+	})
+}
+
+// fromForeignCache reads the results from the cache, the results of the
+// query are saved into the cache after they are all read. The results are
+// only cached in the session if shared is false.
+func fromForeignCache(ec *SessionContext, key string, shared bool, from func() (memcore.Query, error)) (memcore.Query, error) {
+	if records, ok := ec.lookupForeignCache(key, shared); ok {
+		return memcore.FromRecords(records), nil
+	}
+
+	query, err := from()
+	if err != nil {
+		return memcore.Query{}, err
+	}
+	return memcore.Query{
+		Iterate: func() memcore.Iterator {
+			// 同一个语句中可能有相同的查询
+			if records, ok := ec.lookupForeignCache(key, shared); ok {
+				return memcore.FromRecords(records).Iterate()
+			}
+			ec.Debuger.CacheMiss(key)
+
+			next := query.Iterate()
+			var records []memcore.Record
+			var done bool
+			return func(ctx memcore.Context) (memcore.Record, error) {
+				record, err := next(ctx)
+				if err != nil {
+					if memcore.IsNoRows(err) && !done {
+						done = true
+						ec.storeForeignCache(key, shared, records)
+					}
+					return record, err
+				}
+				records = append(records, record)
+				return record, nil
+			}
+		},
+	}, nil
+}
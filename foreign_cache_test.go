@@ -0,0 +1,138 @@
+package memsql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/memsql/memcore"
+	"github.com/xwb1989/sqlparser"
+)
+
+type countForeign struct {
+	Foreign
+	count int
+}
+
+func (f *countForeign) From(ctx *SessionContext, tableAs TableAlias, where *sqlparser.Where) (memcore.Query, error) {
+	query, err := f.Foreign.From(ctx, tableAs, where)
+	if err != nil {
+		return memcore.Query{}, err
+	}
+	return memcore.Query{
+		Iterate: func() memcore.Iterator {
+			f.count++
+			return query.Iterate()
+		},
+	}, nil
+}
+
+func TestForeignCache(t *testing.T) {
+	cache := NewForeignCache(time.Hour, 2)
+	cache.Put("a", []memcore.Record{{}})
+	cache.Put("b", nil)
+	if _, ok := cache.Get("a"); !ok {
+		t.Error("a isnot found")
+	}
+	cache.Put("c", nil)
+	if _, ok := cache.Get("b"); ok {
+		t.Error("b isnot removed")
+	}
+	if cache.Len() != 2 {
+		t.Error("want 2 got", cache.Len())
+	}
+
+	cache.MaxRecords = 1
+	cache.Put("d", []memcore.Record{{}, {}})
+	if _, ok := cache.Get("d"); ok {
+		t.Error("d is too large")
+	}
+
+	cache.TTL = time.Nanosecond
+	cache.Put("e", nil)
+	time.Sleep(time.Millisecond)
+	if _, ok := cache.Get("e"); ok {
+		t.Error("e isnot expired")
+	}
+}
+
+func TestForeignCacheQuery(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Close()
+
+	table, err := readTable([]byte("id,f2\n1,dev1\n2,dev2\n3,dev3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	table.Name = "db.managed_objects"
+	if err := app.Add(t, &table); err != nil {
+		t.Fatal(err)
+	}
+
+	foreign := &countForeign{Foreign: NewDbForeign(app.driver, app.conn)}
+	ctx := &Context{
+		Ctx:          context.Background(),
+		Foreign:      foreign,
+		ForeignCache: NewForeignCache(time.Minute, 10),
+	}
+
+	// session
+	sessctx := &SessionContext{Context: ctx}
+	where := &sqlparser.Where{Expr: &sqlparser.ComparisonExpr{
+		Operator: sqlparser.GreaterThanStr,
+		Left:     &sqlparser.ColName{Name: sqlparser.NewColIdent("id")},
+		Right:    sqlparser.NewIntVal([]byte("1")),
+	}}
+	query, err := fromForeign(sessctx, "fdw", foreign, TableAlias{Name: "managed_objects"}, where)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		results, err := query.Results(sessctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertResults(t, false, true, results, []string{`"dev2",2`, `"dev3",3`})
+	}
+	if foreign.count != 1 {
+		t.Error("want 1 got", foreign.count)
+	}
+	if ctx.Debuger.CacheHits != 1 || ctx.Debuger.CacheMisses != 1 {
+		t.Error("want 1 hit and 1 miss got", ctx.Debuger.CacheHits, ctx.Debuger.CacheMisses)
+	}
+
+	// across sessions
+	foreign.count = 0
+	ctx.Debuger = ExecuteTracer{}
+	for i := 0; i < 2; i++ {
+		results, err := app.Execute(t, ctx, "select f2 from fdw.managed_objects where id =  2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertResults(t, false, false, results, []string{`"dev2"`})
+	}
+	if foreign.count != 1 {
+		t.Error("want 1 got", foreign.count)
+	}
+	if ctx.Debuger.CacheHits != 1 || ctx.Debuger.Caches[1].Scope != CacheGlobal {
+		t.Error("want 1 global hit got", ctx.Debuger.Caches)
+	}
+
+	// now() 的结果与当前时间有关, 只缓存在会话中
+	stmt, err := sqlparser.Parse("select * from managed_objects where id > 1 and created_at > now() - interval 1 hour")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, shared := foreignCacheKey("fdw", TableAlias{Name: "managed_objects"}, stmt.(*sqlparser.Select).Where, nil)
+	if shared {
+		t.Error("want not shared")
+	}
+	sessctx = &SessionContext{Context: ctx}
+	sessctx.storeForeignCache(key, shared, []memcore.Record{})
+	if _, ok := sessctx.lookupForeignCache(key, shared); !ok {
+		t.Error("want cached in the session")
+	}
+	if _, ok := ctx.ForeignCache.Get(key); ok {
+		t.Error("want not cached across sessions")
+	}
+}
@@ -0,0 +1,281 @@
+package memsql
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/runner-mei/errors"
+	"github.com/runner-mei/memsql/memcore"
+	"github.com/runner-mei/memsql/vm"
+	"github.com/xwb1989/sqlparser"
+)
+
+// FileExtensions are the extensions of the table files, the first existing
+// file is used.
+var FileExtensions = []string{".csv", ".json", ".jsonl"}
+
+// NewFileForeign reads the table 'name' from the file name.csv, name.json
+// or name.jsonl in the directory. The first line of the csv file is the
+// header, the json file is an array of objects and the jsonl file is an
+// object per line.
+func NewFileForeign(dir string) Foreign {
+	return &fileForeign{Dir: dir}
+}
+
+type fileForeign struct {
+	Dir string
+}
+
+func (f *fileForeign) From(ctx *SessionContext, tableName TableAlias, where *sqlparser.Where) (memcore.Query, error) {
+	table, err := f.readTable(tableName.Name)
+	if err != nil {
+		return memcore.Query{}, err
+	}
+	return fromForeignTable(ctx, tableName, table, where)
+}
+
+func (f *fileForeign) readTable(name string) (memcore.Table, error) {
+	if strings.ContainsAny(name, `/\`) {
+		return memcore.Table{}, errors.New("table name '" + name + "' is invalid")
+	}
+	for _, ext := range FileExtensions {
+		filename := filepath.Join(f.Dir, name+ext)
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return memcore.Table{}, errors.Wrap(err, "read table '"+name+"' fail")
+		}
+
+		var table memcore.Table
+		switch ext {
+		case ".csv":
+			table, err = readCSVTable(data)
+		case ".json":
+			table, err = readJSONTable(data)
+		default:
+			table, err = readJSONLinesTable(data)
+		}
+		if err != nil {
+			return memcore.Table{}, errors.Wrap(err, "read table '"+name+"' from '"+filename+"' fail")
+		}
+		return table, nil
+	}
+	return memcore.Table{}, errors.New("table '" + name + "' isnot found in '" + f.Dir + "'")
+}
+
+// inferValue 将 csv 中的字符串转换为数字, 布尔值或 null
+func inferValue(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	switch strings.ToLower(s) {
+	case "null":
+		return nil
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	// 转换后与原文不一致的仍然是字符串, 如 '007' 和 '1.50'
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if strconv.FormatInt(i, 10) == s {
+			return json.Number(s)
+		}
+		return s
+	}
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		if strconv.FormatUint(u, 10) == s {
+			return json.Number(s)
+		}
+		return s
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		if strconv.FormatFloat(f, 'f', -1, 64) == s || strconv.FormatFloat(f, 'g', -1, 64) == s {
+			return json.Number(s)
+		}
+	}
+	return s
+}
+
+func toForeignValue(value interface{}) (vm.Value, error) {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		return vm.JSONToValue(value), nil
+	}
+	return vm.ToValue(value)
+}
+
+func readCSVTable(data []byte) (memcore.Table, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+
+	var table memcore.Table
+	for {
+		fields, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				return table, nil
+			}
+			return memcore.Table{}, err
+		}
+		if table.Columns == nil {
+			for _, name := range fields {
+				table.Columns = append(table.Columns, memcore.Column{Name: strings.TrimSpace(name)})
+			}
+			continue
+		}
+
+		values := make([]memcore.Value, len(table.Columns))
+		for idx := range values {
+			if idx >= len(fields) {
+				values[idx] = vm.Null()
+				continue
+			}
+			values[idx], err = vm.ToValue(inferValue(strings.TrimSpace(fields[idx])))
+			if err != nil {
+				return memcore.Table{}, err
+			}
+		}
+		table.Records = append(table.Records, values)
+	}
+}
+
+func readJSONTable(data []byte) (memcore.Table, error) {
+	var rows []map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&rows); err != nil {
+		return memcore.Table{}, err
+	}
+	return rowsToTable(rows, nil)
+}
+
+func readJSONLinesTable(data []byte) (memcore.Table, error) {
+	var rows []map[string]interface{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 16*1024*1024)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var row map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.UseNumber()
+		if err := decoder.Decode(&row); err != nil {
+			return memcore.Table{}, errors.Wrap(err, "line "+strconv.Itoa(lineno)+" is invalid")
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return memcore.Table{}, err
+	}
+	return rowsToTable(rows, nil)
+}
+
+// rowsToTable converts the json objects to the table, columns maps the
+// column name to the path of the value in the object. All the keys of the
+// objects are the columns if columns is empty.
+func rowsToTable(rows []map[string]interface{}, columns map[string]string) (memcore.Table, error) {
+	var names []string
+	if len(columns) > 0 {
+		for name := range columns {
+			names = append(names, name)
+		}
+	} else {
+		var exists = map[string]struct{}{}
+		for _, row := range rows {
+			for name := range row {
+				if _, ok := exists[name]; !ok {
+					exists[name] = struct{}{}
+					names = append(names, name)
+				}
+			}
+		}
+	}
+	sort.Strings(names)
+
+	var table memcore.Table
+	for _, name := range names {
+		table.Columns = append(table.Columns, memcore.Column{Name: name})
+	}
+	for _, row := range rows {
+		values := make([]memcore.Value, len(names))
+		for idx, name := range names {
+			var value interface{}
+			if len(columns) > 0 {
+				value = lookupJSONPath(row, columns[name])
+			} else {
+				value = row[name]
+			}
+
+			var err error
+			values[idx], err = toForeignValue(value)
+			if err != nil {
+				return memcore.Table{}, errors.Wrap(err, "column '"+name+"' is invalid")
+			}
+		}
+		table.Records = append(table.Records, values)
+	}
+	return table, nil
+}
+
+// lookupJSONPath returns the value of the path such as 'data.items', the
+// path is split with '.'.
+func lookupJSONPath(value interface{}, path string) interface{} {
+	if path == "" || path == "." || path == "$" {
+		return value
+	}
+	for _, name := range strings.Split(strings.TrimPrefix(path, "$."), ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value = v[name]
+		case []interface{}:
+			idx, err := strconv.Atoi(name)
+			if err != nil || idx < 0 || idx >= len(v) {
+				return nil
+			}
+			value = v[idx]
+		default:
+			return nil
+		}
+	}
+	return value
+}
+
+// fromForeignTable filters the table in memory, it is used by the foreign
+// which cannot evaluate the where.
+func fromForeignTable(ctx *SessionContext, tableName TableAlias, table memcore.Table, where *sqlparser.Where) (memcore.Query, error) {
+	for idx := range table.Columns {
+		table.Columns[idx].TableName = tableName.Name
+		table.Columns[idx].TableAs = tableName.Alias
+	}
+
+	var query = memcore.From(table)
+	debuger := ctx.Debuger.NewTable(tableName.Name, tableName.Alias, nil)
+	if where != nil && where.Expr != nil {
+		var err error
+		query, err = ExecuteWhere(ctx, query, where.Expr)
+		if err != nil {
+			return memcore.Query{}, err
+		}
+		if debuger != nil {
+			debuger.SetWhere(where.Expr)
+		}
+	}
+	if debuger != nil {
+		query = debuger.Track(query)
+	}
+	return query, nil
+}
@@ -0,0 +1,67 @@
+package memsql
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileForeign(t *testing.T) {
+	dir, err := ioutil.TempDir("", "memsql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, content := range map[string]string{
+		"devices.csv":    "id,name,port,code\n1,dev1,80,007\n2,dev2,,1.50\n3,dev3,443,1.5\n",
+		"racks.json":     `[{"id": 1, "name": "r1", "tags": {"a": 1}}, {"id": 2, "name": "r2"}]`,
+		"sessions.jsonl": "{\"id\": 1, \"user\": \"u1\"}\n\n{\"id\": 2, \"user\": \"u2\", \"ok\": true}\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	app := newTestApp(t)
+	defer app.Close()
+	ctx := &Context{Ctx: context.Background()}
+	if err := ctx.RegisterForeign("files", NewFileForeign(dir)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		sql     string
+		results []string
+	}{
+		{
+			sql:     "select name, port from files.devices where id > 1",
+			results: []string{`"dev2",null`, `"dev3",443`},
+		},
+		{
+			sql:     "select id, code from files.devices",
+			results: []string{`1,"007"`, `2,"1.50"`, `3,1.5`},
+		},
+		{
+			sql:     "select r.name from files.racks as r where r.id = 2",
+			results: []string{`"r2"`},
+		},
+		{
+			sql:     "select user from files.sessions where ok = true",
+			results: []string{`"u2"`},
+		},
+	} {
+		results, err := app.Execute(t, ctx, test.sql)
+		if err != nil {
+			t.Error(test.sql, err)
+			continue
+		}
+		assertResults(t, true, false, results, test.results)
+	}
+
+	if _, err := app.Execute(t, ctx, "select * from files.unknown"); err == nil {
+		t.Error("want error")
+	}
+}
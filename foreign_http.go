@@ -0,0 +1,189 @@
+package memsql
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/runner-mei/errors"
+	"github.com/runner-mei/memsql/memcore"
+	"github.com/runner-mei/memsql/parser"
+	"github.com/xwb1989/sqlparser"
+)
+
+type HTTPTable struct {
+	// URL is the address of the table
+	URL string
+
+	// RowsPath is the path of the rows in the response, such as 'data.items'.
+	// The response is the rows if it is empty.
+	RowsPath string
+
+	// Columns maps the column name to the path of the value in the row, all
+	// the keys of the row are the columns if it is empty.
+	Columns map[string]string
+
+	// Params maps the column name to the query parameter, the conditions
+	// 'column = literal' and 'column in (literals)' are sent as the parameter.
+	Params map[string]string
+}
+
+type HTTPOptions struct {
+	Client *http.Client
+	Header http.Header
+
+	// URL is the address of the table which isnot in Tables, '{table}' is
+	// replaced with the name of the table.
+	URL    string
+	Tables map[string]HTTPTable
+}
+
+// NewHTTPForeign reads the tables from the http endpoints which return the
+// json rows.
+func NewHTTPForeign(opts HTTPOptions) Foreign {
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	return &httpForeign{opts: opts}
+}
+
+type httpForeign struct {
+	opts HTTPOptions
+}
+
+func (f *httpForeign) table(name string) (HTTPTable, error) {
+	if table, ok := f.opts.Tables[name]; ok {
+		return table, nil
+	}
+	if f.opts.URL == "" {
+		return HTTPTable{}, errors.New("table '" + name + "' isnot found")
+	}
+	return HTTPTable{
+		URL: strings.Replace(f.opts.URL, "{table}", url.PathEscape(name), -1),
+	}, nil
+}
+
+// queryParams 将 where 中的简单条件转换为查询参数, 不能转换的条件在内存中过滤
+func (f *httpForeign) queryParams(table HTTPTable, tableName TableAlias, where *sqlparser.Where) url.Values {
+	var params = url.Values{}
+	if where == nil || where.Expr == nil || len(table.Params) == 0 {
+		return params
+	}
+
+	for _, predicate := range parser.ToPredicates(where.Expr, tableName, true) {
+		if predicate.Op != memcore.OpEqual && predicate.Op != memcore.OpIn {
+			continue
+		}
+		var param string
+		for column, name := range table.Params {
+			if strings.EqualFold(column, predicate.Column) {
+				param = name
+				break
+			}
+		}
+		if param == "" || params.Get(param) != "" {
+			continue
+		}
+
+		var values []string
+		for idx := range predicate.Values {
+			s, err := predicate.Values[idx].AsString(true)
+			if err != nil {
+				values = nil
+				break
+			}
+			values = append(values, s)
+		}
+		for _, value := range values {
+			params.Add(param, value)
+		}
+	}
+	return params
+}
+
+func (f *httpForeign) From(ctx *SessionContext, tableName TableAlias, where *sqlparser.Where) (memcore.Query, error) {
+	table, err := f.table(tableName.Name)
+	if err != nil {
+		return memcore.Query{}, err
+	}
+
+	u, err := url.Parse(table.URL)
+	if err != nil {
+		return memcore.Query{}, errors.Wrap(err, "url of table '"+tableName.Name+"' is invalid")
+	}
+	params := f.queryParams(table, tableName, where)
+	if len(params) > 0 {
+		query := u.Query()
+		for key, values := range params {
+			for _, value := range values {
+				query.Add(key, value)
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+
+	rows, err := f.read(ctx, u.String(), table.RowsPath)
+	if err != nil {
+		return memcore.Query{}, errors.Wrap(err, "read table '"+tableName.Name+"' fail")
+	}
+	result, err := rowsToTable(rows, table.Columns)
+	if err != nil {
+		return memcore.Query{}, errors.Wrap(err, "read table '"+tableName.Name+"' fail")
+	}
+	return fromForeignTable(ctx, tableName, result, where)
+}
+
+func (f *httpForeign) read(ctx *SessionContext, urlStr, rowsPath string) ([]map[string]interface{}, error) {
+	req, err := http.NewRequest("GET", urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Ctx != nil {
+		req = req.WithContext(ctx.Ctx)
+	}
+	for key, values := range f.opts.Header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := f.opts.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, errors.New("request '" + urlStr + "' fail: " + strconv.Itoa(resp.StatusCode) + " " + string(body))
+	}
+
+	var body interface{}
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil {
+		return nil, errors.Wrap(err, "decode response of '"+urlStr+"' fail")
+	}
+
+	var rows []map[string]interface{}
+	switch v := lookupJSONPath(body, rowsPath).(type) {
+	case nil:
+	case map[string]interface{}:
+		rows = append(rows, v)
+	case []interface{}:
+		for idx := range v {
+			row, ok := v[idx].(map[string]interface{})
+			if !ok {
+				return nil, errors.New("row " + strconv.Itoa(idx) + " of '" + urlStr + "' isnot a object")
+			}
+			rows = append(rows, row)
+		}
+	default:
+		return nil, errors.New("rows of '" + urlStr + "' isnot a array")
+	}
+	return rows, nil
+}
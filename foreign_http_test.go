@@ -0,0 +1,64 @@
+package memsql
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPForeign(t *testing.T) {
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Path+"?"+r.URL.RawQuery)
+		switch r.URL.Path {
+		case "/api/accounts":
+			if r.URL.Query().Get("status") != "active" {
+				w.Write([]byte(`{"data": {"items": [{"id": 1, "info": {"name": "a1"}, "status": "active"}, {"id": 2, "info": {"name": "a2"}, "status": "closed"}]}}`))
+				return
+			}
+			w.Write([]byte(`{"data": {"items": [{"id": 1, "info": {"name": "a1"}, "status": "active"}]}}`))
+		case "/tables/users":
+			w.Write([]byte(`[{"id": 1, "name": "u1"}, {"id": 2, "name": "u2"}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	app := newTestApp(t)
+	defer app.Close()
+	ctx := &Context{Ctx: context.Background()}
+	if err := ctx.RegisterForeign("api", NewHTTPForeign(HTTPOptions{
+		URL: srv.URL + "/tables/{table}",
+		Tables: map[string]HTTPTable{
+			"accounts": {
+				URL:      srv.URL + "/api/accounts",
+				RowsPath: "data.items",
+				Columns:  map[string]string{"id": "id", "name": "info.name", "status": "status"},
+				Params:   map[string]string{"status": "status"},
+			},
+		},
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := app.Execute(t, ctx, "select id, name from api.accounts where status = 'active'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResults(t, false, false, results, []string{`1,"a1"`})
+	if len(queries) != 1 || queries[0] != "/api/accounts?status=active" {
+		t.Error("want pushed params got", queries)
+	}
+
+	results, err = app.Execute(t, ctx, "select name from api.users where id = 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResults(t, false, false, results, []string{`"u2"`})
+
+	if _, err := app.Execute(t, ctx, "select * from api.unknown"); err == nil {
+		t.Error("want error")
+	}
+}
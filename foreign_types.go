@@ -0,0 +1,252 @@
+package memsql
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/runner-mei/memsql/memcore"
+	"github.com/runner-mei/memsql/vm"
+)
+
+// ColumnScanner returns the destination which is passed to rows.Scan, the
+// scanned value is saved into value.
+type ColumnScanner func(value *memcore.Value) interface{}
+
+// ColumnTypeMapper returns the scanner of the column, it returns nil if the
+// default scanner should be used.
+type ColumnTypeMapper func(drv string, columnType *sql.ColumnType) ColumnScanner
+
+// DefaultColumnScanner guesses the type of the value from the go type
+func DefaultColumnScanner(value *memcore.Value) interface{} {
+	return scanValue{value: value}
+}
+
+// DefaultColumnTypeMapper maps the database type name of the column to the
+// value type.
+func DefaultColumnTypeMapper(drv string, columnType *sql.ColumnType) ColumnScanner {
+	typeName := strings.ToUpper(columnType.DatabaseTypeName())
+	// 去掉长度, 如 DECIMAL(10,2)
+	if idx := strings.IndexByte(typeName, '('); idx >= 0 {
+		typeName = strings.TrimSpace(typeName[:idx])
+	}
+	typeName = strings.TrimPrefix(typeName, "UNSIGNED ")
+
+	switch typeName {
+	case "DECIMAL", "NUMERIC", "NUMBER":
+		return func(value *memcore.Value) interface{} {
+			return decimalScanValue{value: value}
+		}
+	case "DATETIME", "TIMESTAMP", "TIMESTAMPTZ", "DATE",
+		"TIMESTAMP WITH TIME ZONE", "TIMESTAMP WITHOUT TIME ZONE":
+		return func(value *memcore.Value) interface{} {
+			return datetimeScanValue{value: value}
+		}
+	case "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB", "BINARY", "VARBINARY", "BYTEA":
+		return func(value *memcore.Value) interface{} {
+			return blobScanValue{value: value}
+		}
+	case "JSON", "JSONB":
+		return func(value *memcore.Value) interface{} {
+			return jsonScanValue{value: value}
+		}
+	case "BOOL", "BOOLEAN":
+		return func(value *memcore.Value) interface{} {
+			return boolScanValue{value: value}
+		}
+	}
+	return nil
+}
+
+func toColumnScanners(drv string, columnTypes []*sql.ColumnType, mapper ColumnTypeMapper) []ColumnScanner {
+	var scanners = make([]ColumnScanner, len(columnTypes))
+	for idx := range columnTypes {
+		if mapper != nil {
+			scanners[idx] = mapper(drv, columnTypes[idx])
+		}
+		if scanners[idx] == nil {
+			scanners[idx] = DefaultColumnTypeMapper(drv, columnTypes[idx])
+		}
+		if scanners[idx] == nil {
+			scanners[idx] = DefaultColumnScanner
+		}
+	}
+	return scanners
+}
+
+type scanValue struct {
+	value *memcore.Value
+}
+
+func (sv scanValue) Scan(value interface{}) error {
+	if value == nil {
+		*sv.value = vm.Null()
+		return nil
+	}
+
+	switch v := value.(type) {
+	case int8:
+		sv.value.SetInt64(int64(v))
+	case int16:
+		sv.value.SetInt64(int64(v))
+	case int32:
+		sv.value.SetInt64(int64(v))
+	case int64:
+		sv.value.SetInt64(v)
+	case int:
+		sv.value.SetInt64(int64(v))
+	case uint8:
+		sv.value.SetUint64(uint64(v))
+	case uint16:
+		sv.value.SetUint64(uint64(v))
+	case uint32:
+		sv.value.SetUint64(uint64(v))
+	case uint64:
+		sv.value.SetUint64(v)
+	case uint:
+		sv.value.SetUint64(uint64(v))
+	case float32:
+		sv.value.SetFloat64(float64(v))
+	case float64:
+		sv.value.SetFloat64(v)
+	case string:
+		sv.value.SetString(v)
+	case bool:
+		sv.value.SetBool(v)
+	case []byte:
+		sv.value.SetString(string(v))
+	case time.Time:
+		*sv.value = vm.DatetimeToValue(v)
+	default:
+		return fmt.Errorf("unsupported type %T", v)
+	}
+	return nil
+}
+
+type decimalScanValue struct {
+	value *memcore.Value
+}
+
+func (sv decimalScanValue) Scan(value interface{}) error {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	case int64:
+		*sv.value = vm.DecimalToValue(vm.IntToDecimal(v))
+		return nil
+	case float64:
+		// sqlite3 中 DECIMAL 保存为浮点数
+		d, err := vm.FloatToDecimal(v)
+		if err != nil {
+			return err
+		}
+		*sv.value = vm.DecimalToValue(d)
+		return nil
+	default:
+		return scanValue(sv).Scan(value)
+	}
+
+	d, err := vm.ParseDecimal(s)
+	if err != nil {
+		return fmt.Errorf("invalid decimal %q", s)
+	}
+	*sv.value = vm.DecimalToValue(d)
+	return nil
+}
+
+type datetimeScanValue struct {
+	value *memcore.Value
+}
+
+func (sv datetimeScanValue) Scan(value interface{}) error {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	case int64:
+		// sqlite3 中可能是 unix 时间
+		*sv.value = vm.DatetimeToValue(time.Unix(v, 0))
+		return nil
+	default:
+		return scanValue(sv).Scan(value)
+	}
+
+	t, err := vm.ToDatetimeValue(strings.TrimSpace(s))
+	if err != nil {
+		return err
+	}
+	*sv.value = t
+	return nil
+}
+
+type blobScanValue struct {
+	value *memcore.Value
+}
+
+func (sv blobScanValue) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		// driver 会重用 v 的内存
+		bs := make([]byte, len(v))
+		copy(bs, v)
+		*sv.value = vm.AnyToValue(bs)
+		return nil
+	case string:
+		*sv.value = vm.AnyToValue([]byte(v))
+		return nil
+	default:
+		return scanValue(sv).Scan(value)
+	}
+}
+
+type jsonScanValue struct {
+	value *memcore.Value
+}
+
+func (sv jsonScanValue) Scan(value interface{}) error {
+	var bs []byte
+	switch v := value.(type) {
+	case []byte:
+		bs = v
+	case string:
+		bs = []byte(v)
+	default:
+		return scanValue(sv).Scan(value)
+	}
+
+	result, err := vm.ParseJSON(string(bs))
+	if err != nil {
+		return fmt.Errorf("invalid json %q: %s", bs, err)
+	}
+	*sv.value = result
+	return nil
+}
+
+type boolScanValue struct {
+	value *memcore.Value
+}
+
+func (sv boolScanValue) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case int64:
+		sv.value.SetBool(v != 0)
+	case []byte:
+		return sv.Scan(string(v))
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", v)
+		}
+		sv.value.SetBool(b)
+	default:
+		return scanValue(sv).Scan(value)
+	}
+	return nil
+}
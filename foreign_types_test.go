@@ -0,0 +1,94 @@
+package memsql
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/memsql/memcore"
+	"github.com/runner-mei/memsql/vm"
+)
+
+func TestForeignColumnTypes(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Close()
+
+	for _, stmt := range []string{
+		"CREATE TABLE items(id INTEGER, price DECIMAL(10,2), created DATETIME, data BLOB, attrs JSON, enabled BOOLEAN, color COLOR)",
+		"INSERT INTO items VALUES(1, 1.5, '2020-01-02 03:04:05', x'0102', '{\"a\":1}', 1, 'red')",
+		"INSERT INTO items VALUES(2, NULL, NULL, NULL, NULL, NULL, NULL)",
+	} {
+		if _, err := app.conn.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mapper := func(drv string, columnType *sql.ColumnType) ColumnScanner {
+		if columnType.DatabaseTypeName() != "COLOR" {
+			return nil
+		}
+		return func(value *memcore.Value) interface{} {
+			return colorScanValue{value: value}
+		}
+	}
+	ctx := &Context{
+		Ctx:     context.Background(),
+		Foreign: NewDbForeignWithMapper(app.driver, app.conn, mapper),
+	}
+	results, err := app.Execute(t, ctx, "select * from fdw.items order by id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatal("want 2 got", len(results))
+	}
+
+	created, _ := time.ParseInLocation("2006-01-02 15:04:05", "2020-01-02 03:04:05", time.UTC)
+	for idx, want := range []vm.Value{
+		vm.IntToValue(1),
+		vm.DecimalToValue(mustParseDecimal(t, "1.5")),
+		vm.DatetimeToValue(created),
+		vm.AnyToValue([]byte{1, 2}),
+		vm.JSONToValue(map[string]interface{}{"a": 1}),
+		vm.BoolToValue(true),
+		vm.StringToValue("RED"),
+	} {
+		got := results[0].Values[idx]
+		if got.Type != want.Type {
+			t.Error(results[0].Columns[idx].Name, ": want", want.Type, "got", got.Type)
+			continue
+		}
+		if got.String() != want.String() {
+			t.Error(results[0].Columns[idx].Name, ": want", want.String(), "got", got.String())
+		}
+	}
+
+	for idx, value := range results[1].Values[1:] {
+		if !value.IsNull() {
+			t.Error(results[1].Columns[idx+1].Name, ": want null got", value.String())
+		}
+	}
+}
+
+type colorScanValue struct {
+	value *memcore.Value
+}
+
+func (sv colorScanValue) Scan(value interface{}) error {
+	if value == nil {
+		*sv.value = vm.Null()
+		return nil
+	}
+	sv.value.SetString(strings.ToUpper(value.(string)))
+	return nil
+}
+
+func mustParseDecimal(t *testing.T, s string) *vm.Decimal {
+	d, err := vm.ParseDecimal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
@@ -28,8 +28,21 @@ type HookStorage struct {
 }
 
 func (hs *HookStorage) From(ctx *SessionContext, tableName TableAlias, tableExpr sqlparser.Expr, trace func(TableName)) (memcore.Query, error) {
+	return hs.FromWhere(ctx, tableName, tableExpr, nil, trace)
+}
+
+func (hs *HookStorage) FromWhere(ctx *SessionContext, tableName TableAlias, tableExpr sqlparser.Expr, predicates []memcore.Predicate, trace func(TableName)) (memcore.Query, error) {
 	ctx.OnIniting(func() error {
-		kvs, err := parser.ToKeyValues(ctx, tableExpr, tableName, nil)
+		expr, ok, err := semiJoinTags(ctx, tableName, tableExpr)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// 外部表中没有可以 join 的记录
+			return nil
+		}
+
+		kvs, err := parser.ToKeyValues(ctx, expr, tableName, nil)
 		if err != nil {
 			return   err
 		}
@@ -41,7 +54,20 @@ func (hs *HookStorage) From(ctx *SessionContext, tableName TableAlias, tableExpr
 		return nil
 	})
 
-	return fromRun(ctx, hs.Storage, tableName, tableExpr, trace)
+	return fromRun(ctx, hs.Storage, tableName, tableExpr, predicates, trace)
+}
+
+func (hs *HookStorage) Schema(name string) (*memcore.TableSchema, bool) {
+	ss, ok := hs.Storage.(memcore.SchemaStorage)
+	if !ok {
+		return nil, false
+	}
+	return ss.Schema(name)
+}
+
+func (hs *HookStorage) Mutable() (memcore.MutableStorage, bool) {
+	ms, ok := hs.Storage.(memcore.MutableStorage)
+	return ms, ok
 }
 
 func (hs *HookStorage) EnsureTables(ctx *SessionContext, tableName TableAlias, iterator parser.KeyValueIterator) error {
@@ -0,0 +1,73 @@
+package memsql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJSONColumns(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Close()
+
+	app.ReadWith(map[string][]map[string]interface{}{
+		"cpu-mo=1": {
+			{"name": "a", "attrs": map[string]interface{}{"ip": "10.0.0.1", "ports": []interface{}{80, 443}, "env": map[string]interface{}{"zone": "z1"}}},
+		},
+		"cpu-mo=2": {
+			{"name": "b", "attrs": map[string]interface{}{"ip": "10.0.0.2", "ports": []interface{}{22}, "env": map[string]interface{}{"zone": "z2"}}},
+		},
+	})
+
+	for _, test := range []struct {
+		sql    string
+		result []string
+	}{
+		{
+			sql: "select name, attrs->>'$.ip', attrs->'$.env.zone', attrs->'$.ports[1]' from cpu where @mo in ('1', '2')",
+			result: []string{
+				`"a","10.0.0.1","z1",443`,
+				`"b","10.0.0.2","z2",null`,
+			},
+		},
+		{
+			sql: "select name from cpu where @mo in ('1', '2') and attrs->>'$.env.zone' = 'z2'",
+			result: []string{
+				`"b"`,
+			},
+		},
+		{
+			sql: "select name, json_array_length(attrs, '$.ports'), json_keys(attrs->'$.env') from cpu where @mo in ('1', '2')",
+			result: []string{
+				`"a",2,["zone"]`,
+				`"b",1,["zone"]`,
+			},
+		},
+		{
+			sql: "select name from cpu where @mo in ('1', '2') and json_contains(attrs, '443', '$.ports')",
+			result: []string{
+				`"a"`,
+			},
+		},
+		{
+			sql: "select name, JSON_EXTRACT(attrs, '$.ports[0]') + 1, cast('{\"x\": [1, 2]}' as json) from cpu where @mo = '1'",
+			result: []string{
+				`"a",81,{"x":[1,2]}`,
+			},
+		},
+		{
+			sql: "select name from cpu where @mo in ('1', '2') order by attrs->'$.ports[0]'",
+			result: []string{
+				`"b"`,
+				`"a"`,
+			},
+		},
+	} {
+		t.Run(test.sql, func(t *testing.T) {
+			results, err := app.Execute(t, nil, test.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertResults(t, !strings.Contains(test.sql, "order by"), false, results, test.result)
+		})
+	}
+}
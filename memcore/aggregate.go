@@ -232,3 +232,183 @@ func (q Query) AggregateWith(names []string, aggregatorFactories []AggregatorFac
 		},
 	}
 }
+
+// BatchAggregator is implemented by the Aggregator which aggregates the rows
+// of a batch at once, see AggregateWithBatch.
+type BatchAggregator interface {
+	AggBatch(Context, *Batch) error
+}
+
+type programAggregator struct {
+	Aggregator vm.Aggregator
+	Program    *Program
+	values     []Value
+}
+
+func (a *programAggregator) Agg(ctx Context, r Record) error {
+	value, err := a.Program.Run(&r)
+	if err != nil {
+		return err
+	}
+	return a.Aggregator.Agg(value)
+}
+
+func (a *programAggregator) AggBatch(ctx Context, b *Batch) error {
+	if cap(a.values) < b.Length {
+		a.values = make([]Value, b.Length)
+	}
+	values := a.values[:b.Length]
+	if err := a.Program.RunBatch(b, values); err != nil {
+		return err
+	}
+	for idx := range values {
+		if err := a.Aggregator.Agg(values[idx]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *programAggregator) Result(ctx Context) (Value, error) {
+	return a.Aggregator.Result()
+}
+
+// ProgramAggregatorFunc is same as AggregatorFunc but the values are read
+// by the program, the aggregators are BatchAggregator.
+func ProgramAggregatorFunc(create func() vm.Aggregator, p *Program) AggregatorFactoryFunc {
+	return AggregatorFactoryFunc(func() Aggregator {
+		return &programAggregator{
+			Aggregator: create(),
+			Program:    p,
+		}
+	})
+}
+
+// partialAggregator 返回可以合并的 vm.Aggregator, 只有 ProgramAggregatorFunc
+// 创建的聚合可以在 partition 中并发地执行, OpEval 的函数不一定能并发地执行
+func partialAggregator(a Aggregator) (vm.MergeableAggregator, bool) {
+	pa, ok := a.(*programAggregator)
+	if !ok || len(pa.Program.Funcs) > 0 {
+		return nil, false
+	}
+	merger, ok := pa.Aggregator.(vm.MergeableAggregator)
+	return merger, ok
+}
+
+// AggregateWithBatch is same as AggregateWith but the elements are read by
+// the batches, the BatchAggregator aggregates a batch at once and the
+// others aggregate the rows of the batch one by one.
+//
+// If q has the partitions and all the aggregators are created by
+// ProgramAggregatorFunc with a vm.MergeableAggregator, the partitions are
+// aggregated concurrently and the partial results are merged in the order of
+// the partitions.
+func (q Query) AggregateWithBatch(names []string, aggregatorFactories []AggregatorFactory) Query {
+	return Query{
+		Iterate: func() Iterator {
+			done := false
+
+			return func(ctx Context) (Record, error) {
+				if done {
+					return Record{}, ErrNoRows
+				}
+				aggregators, err := q.aggregatePartitions(ctx, aggregatorFactories)
+				if err != nil {
+					return Record{}, err
+				}
+				done = true
+
+				var result Record
+				for idx := range aggregators {
+					value, err := aggregators[idx].Result(ctx)
+					if err != nil {
+						return result, err
+					}
+					result.Columns = append(result.Columns, mkColumn(names[idx]))
+					result.Values = append(result.Values, value)
+				}
+				return result, nil
+			}
+		},
+	}
+}
+
+func createAggregators(aggregatorFactories []AggregatorFactory) []Aggregator {
+	var aggregators = make([]Aggregator, len(aggregatorFactories))
+	for idx := range aggregators {
+		aggregators[idx] = aggregatorFactories[idx].Create()
+	}
+	return aggregators
+}
+
+func isMergeable(aggregators []Aggregator) bool {
+	for idx := range aggregators {
+		if _, ok := partialAggregator(aggregators[idx]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// aggregatePartitions 聚合 q 的所有批, 可以合并时并发地聚合各个 partition
+func (q Query) aggregatePartitions(ctx Context, aggregatorFactories []AggregatorFactory) ([]Aggregator, error) {
+	aggregators := createAggregators(aggregatorFactories)
+	if q.Partitions == nil || q.Partitions.Parallelism <= 1 || !isMergeable(aggregators) {
+		return aggregators, aggregateBatches(ctx, q.Batches(), aggregators)
+	}
+
+	list, err := q.Partitions.Get()
+	if err != nil {
+		return nil, err
+	}
+	partials := make([][]Aggregator, len(list))
+	err = forEachPartition(list, q.Partitions.Parallelism, func(i int, partition Query) error {
+		partials[i] = createAggregators(aggregatorFactories)
+		return aggregateBatches(ctx, partition.Batches(), partials[i])
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, partial := range partials {
+		for idx := range aggregators {
+			merger, _ := partialAggregator(aggregators[idx])
+			other, _ := partialAggregator(partial[idx])
+			if err := merger.Merge(other); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return aggregators, nil
+}
+
+func aggregateBatches(ctx Context, next BatchIterator, aggregators []Aggregator) error {
+	for {
+		b, err := next(ctx)
+		if err != nil {
+			if !IsNoRows(err) {
+				return err
+			}
+			return nil
+		}
+
+		var records []Record
+		for idx := range aggregators {
+			if ba, ok := aggregators[idx].(BatchAggregator); ok {
+				if err := ba.AggBatch(ctx, b); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if records == nil {
+				records = b.Records()
+			}
+			for _, item := range records {
+				if err := aggregators[idx].Agg(ctx, item); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package memcore
+
+import (
+	"github.com/runner-mei/memsql/vm"
+)
+
+// BatchSize is the number of the rows of the batches which are collected
+// from the rows.
+const BatchSize = 1024
+
+// Batch is a chunk of the rows which have the same columns and tags, the
+// values are stored by the columns, the value of the column c of the row i
+// is Vectors[c][i].
+type Batch struct {
+	Tags    KeyValues
+	Columns []Column
+	Vectors [][]Value
+	Length  int
+}
+
+// BatchIterator returns a batch every time and returns ErrNoRows at the
+// end. The batch isnot reused by the iterator, but it may share the vectors
+// with the source, so it must not be modified.
+type BatchIterator func(Context) (*Batch, error)
+
+func NewBatch(tags KeyValues, columns []Column, capacity int) *Batch {
+	values := make([]Value, len(columns)*capacity)
+	vectors := make([][]Value, len(columns))
+	for idx := range vectors {
+		vectors[idx] = values[idx*capacity : idx*capacity : (idx+1)*capacity]
+	}
+	return &Batch{
+		Tags:    tags,
+		Columns: columns,
+		Vectors: vectors,
+	}
+}
+
+// Append appends a row to the batch, the missing values are NULL.
+func (b *Batch) Append(values []Value) {
+	for idx := range b.Vectors {
+		if idx < len(values) {
+			b.Vectors[idx] = append(b.Vectors[idx], values[idx])
+		} else {
+			b.Vectors[idx] = append(b.Vectors[idx], vm.Null())
+		}
+	}
+	b.Length++
+}
+
+func (b *Batch) accepts(r Record) bool {
+	return equalColumns(b.Columns, r.Columns) && equalTags(b.Tags, r.Tags)
+}
+
+// Row returns the row i of the batch.
+func (b *Batch) Row(i int) Record {
+	values := make([]Value, len(b.Vectors))
+	for idx := range b.Vectors {
+		values[idx] = b.Vectors[idx][i]
+	}
+	return Record{
+		Tags:    b.Tags,
+		Columns: b.Columns,
+		Values:  values,
+	}
+}
+
+// Records returns all the rows of the batch.
+func (b *Batch) Records() []Record {
+	columns := len(b.Vectors)
+	values := make([]Value, columns*b.Length)
+	records := make([]Record, b.Length)
+	for i := range records {
+		row := values[i*columns : (i+1)*columns : (i+1)*columns]
+		for idx := range b.Vectors {
+			row[idx] = b.Vectors[idx][i]
+		}
+		records[i] = Record{
+			Tags:    b.Tags,
+			Columns: b.Columns,
+			Values:  row,
+		}
+	}
+	return records
+}
+
+// Slice returns the rows from start to end of the batch, the vectors are
+// shared with the batch.
+func (b *Batch) Slice(start, end int) *Batch {
+	if start == 0 && end == b.Length {
+		return b
+	}
+	vectors := make([][]Value, len(b.Vectors))
+	for idx := range vectors {
+		vectors[idx] = b.Vectors[idx][start:end:end]
+	}
+	return &Batch{
+		Tags:    b.Tags,
+		Columns: b.Columns,
+		Vectors: vectors,
+		Length:  end - start,
+	}
+}
+
+// Filter returns the rows which keep is true, it returns the batch self if
+// all the rows are kept.
+func (b *Batch) Filter(keep []bool) *Batch {
+	count := 0
+	for i := 0; i < b.Length; i++ {
+		if keep[i] {
+			count++
+		}
+	}
+	if count == b.Length {
+		return b
+	}
+
+	result := NewBatch(b.Tags, b.Columns, count)
+	for idx := range b.Vectors {
+		vector := result.Vectors[idx]
+		for i := 0; i < b.Length; i++ {
+			if keep[i] {
+				vector = append(vector, b.Vectors[idx][i])
+			}
+		}
+		result.Vectors[idx] = vector
+	}
+	result.Length = count
+	return result
+}
+
+func (b *Batch) rowContext(withQualifier bool) func(int) vm.Context {
+	return func(i int) vm.Context {
+		r := b.Row(i)
+		return ToRecordValuer(&r, withQualifier)
+	}
+}
+
+func equalColumns(a, b []Column) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	if len(a) == 0 || &a[0] == &b[0] {
+		return true
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalTags(a, b KeyValues) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	if len(a) == 0 || &a[0] == &b[0] {
+		return true
+	}
+	return a.Equal(b)
+}
+
+// FromBatches initializes a query with the batches, the rows of the query
+// are read from the batches.
+func FromBatches(iterate func() BatchIterator) Query {
+	return Query{
+		Iterate:      rowsOf(iterate),
+		IterateBatch: iterate,
+	}
+}
+
+// Batches returns the batches of the query, the rows are collected to the
+// batches if the query hasnot the batches.
+func (q Query) Batches() BatchIterator {
+	if q.IterateBatch != nil {
+		return q.IterateBatch()
+	}
+	return batchesOf(q.Iterate(), BatchSize)
+}
+
+// batchesOf 将行收集为批, 列或 tags 不同的行放在不同的批中
+func batchesOf(next Iterator, size int) BatchIterator {
+	var pending Record
+	var hasPending bool
+	var done bool
+
+	return func(ctx Context) (*Batch, error) {
+		var b *Batch
+		for !done && (b == nil || b.Length < size) {
+			var r Record
+			if hasPending {
+				r, hasPending = pending, false
+			} else {
+				var err error
+				r, err = next(ctx)
+				if err != nil {
+					if !IsNoRows(err) {
+						return nil, err
+					}
+					done = true
+					break
+				}
+			}
+
+			if b == nil {
+				b = NewBatch(r.Tags, r.Columns, size)
+			} else if !b.accepts(r) {
+				pending, hasPending = r, true
+				break
+			}
+			b.Append(r.Values)
+		}
+		if b == nil {
+			return nil, ErrNoRows
+		}
+		return b, nil
+	}
+}
+
+func rowsOf(iterate func() BatchIterator) func() Iterator {
+	return func() Iterator {
+		next := iterate()
+		var records []Record
+		index := 0
+
+		return func(ctx Context) (Record, error) {
+			for index >= len(records) {
+				b, err := next(ctx)
+				if err != nil {
+					return Record{}, err
+				}
+				records, index = b.Records(), 0
+			}
+			index++
+			return records[index-1], nil
+		}
+	}
+}
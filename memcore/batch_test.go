@@ -0,0 +1,188 @@
+package memcore
+
+import (
+	"testing"
+
+	"github.com/runner-mei/memsql/vm"
+)
+
+func makeTable(size int) Table {
+	table := Table{
+		Columns: []Column{{Name: "c1"}, {Name: "c2"}},
+	}
+	for i := 0; i < size; i++ {
+		table.Records = append(table.Records, []Value{vm.IntToValue(int64(i)), vm.IntToValue(int64(i % 10))})
+	}
+	return table
+}
+
+// c1 % 3 = 0
+func makeBatchProgram() *Program {
+	var p vm.Program
+	p.Emit(vm.OpColumn, p.AddColumn("", "c1"))
+	p.Emit(vm.OpConst, p.AddConst(vm.IntToValue(3)))
+	p.Emit(vm.OpMod, 0)
+	p.Emit(vm.OpConst, p.AddConst(vm.IntToValue(0)))
+	p.Emit(vm.OpEqual, p.AddOption(vm.EmptyCompareOption()))
+	return NewProgram(&p, false)
+}
+
+func TestBatches(t *testing.T) {
+	records := []Record{
+		makeRecord(1),
+		makeRecord(2),
+		makeRecordWithStr("a"),
+		{Columns: []Column{{Name: "c1"}, {Name: "c2"}}, Values: []Value{vm.IntToValue(3)}},
+	}
+	next := FromRecords(records).Batches()
+
+	var lengths []int
+	var all []Record
+	for {
+		b, err := next(nil)
+		if err != nil {
+			if !IsNoRows(err) {
+				t.Fatal(err)
+			}
+			break
+		}
+		lengths = append(lengths, b.Length)
+		all = append(all, b.Records()...)
+	}
+	if len(lengths) != 2 || lengths[0] != 3 || lengths[1] != 1 {
+		t.Error("want [3 1] got", lengths)
+	}
+	if len(all) != 4 || !all[3].Values[1].IsNil() {
+		t.Error(all)
+	}
+
+	q := FromBatches(From(makeTable(2500)).IterateBatch)
+	if n, err := q.Count(nil); err != nil || n != 2500 {
+		t.Error(n, err)
+	}
+}
+
+func TestWhereBatch(t *testing.T) {
+	p := makeBatchProgram()
+	for _, q := range []Query{From(makeTable(3000)), FromRecords(toSlice(From(makeTable(3000))))} {
+		results, err := q.WhereBatch(p.FilterBatch).TakeBatch(1025).Results(nil)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if len(results) != 1000 {
+			t.Error("want 1000 got", len(results))
+			continue
+		}
+		for idx, r := range results {
+			if r.Values[0] != vm.IntToValue(int64(idx*3)) {
+				t.Error(idx, r.GoString())
+				break
+			}
+		}
+	}
+
+	results, err := From(makeTable(3000)).TakeBatch(1025).Results(nil)
+	if err != nil || len(results) != 1025 {
+		t.Error(len(results), err)
+	}
+}
+
+func TestWhereBatchFallback(t *testing.T) {
+	// 'a' + 1 fails, the rows are run one by one and the error is same as Where
+	var p vm.Program
+	p.Emit(vm.OpColumn, p.AddColumn("", "c1"))
+	p.Emit(vm.OpConst, p.AddConst(vm.IntToValue(1)))
+	p.Emit(vm.OpPlus, 0)
+	p.Emit(vm.OpConst, p.AddConst(vm.IntToValue(2)))
+	p.Emit(vm.OpGreaterThan, p.AddOption(vm.EmptyCompareOption()))
+	filter := NewProgram(&p, false)
+
+	_, err := fromStrings("a").WhereBatch(filter.FilterBatch).Results(nil)
+	if err == nil {
+		t.Error("want error")
+	}
+	_, want := fromStrings("a").Where(func(idx int, r Record) (bool, error) {
+		return filter.Filter(&r)
+	}).Results(nil)
+	if want == nil || err.Error() != want.Error() {
+		t.Error("want", want, "got", err)
+	}
+}
+
+func TestAggregateWithBatch(t *testing.T) {
+	sum := NewProgram(func() *vm.Program {
+		var p vm.Program
+		p.Emit(vm.OpColumn, p.AddColumn("", "c2"))
+		return &p
+	}(), false)
+
+	factories := []AggregatorFactory{
+		ProgramAggregatorFunc(vm.AggFuncs["sum"], sum),
+		AggregatorFunc(vm.AggFuncs["count"], func(ctx Context, r Record) (Value, error) {
+			return r.Values[0], nil
+		}),
+	}
+	names := []string{"sum", "count"}
+
+	want, err := From(makeTable(3000)).AggregateWith(names, factories).Results(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := From(makeTable(3000)).AggregateWithBatch(names, factories).Results(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || len(want) != 1 {
+		t.Fatal(got, want)
+	}
+	if ok, _ := got[0].EqualTo(want[0], vm.EmptyCompareOption()); !ok {
+		t.Error("want", want[0].GoString(), "got", got[0].GoString())
+	}
+	if got[0].Values[0] != vm.IntToValue(13500) || got[0].Values[1] != vm.IntToValue(3000) {
+		t.Error(got[0].GoString())
+	}
+}
+
+func TestJoinBatch(t *testing.T) {
+	outer := []int64{0, 1, 2, 3, 4, 5, 8}
+	inner := []int64{1, 2, 1, 4, 7, 6, 7, 2}
+
+	columns := []Column{
+		{Name: "c1"},
+		{Name: "c1"},
+	}
+
+	want := []Record{
+		{Columns: columns, Values: []Value{MustToValue(0), vm.Null()}},
+		{Columns: columns, Values: []Value{MustToValue(1), MustToValue(1)}},
+		{Columns: columns, Values: []Value{MustToValue(1), MustToValue(1)}},
+		{Columns: columns, Values: []Value{MustToValue(2), MustToValue(2)}},
+		{Columns: columns, Values: []Value{MustToValue(2), MustToValue(2)}},
+		{Columns: columns, Values: []Value{MustToValue(3), vm.Null()}},
+		{Columns: columns, Values: []Value{MustToValue(4), MustToValue(4)}},
+		{Columns: columns, Values: []Value{MustToValue(5), vm.Null()}},
+		{Columns: columns, Values: []Value{MustToValue(8), vm.Null()}},
+	}
+
+	q := fromInts(outer...).JoinBatch(true,
+		fromInts(inner...),
+		func(ctx Context, b *Batch, keys []Value) error {
+			copy(keys, b.Vectors[0])
+			return nil
+		},
+		func(i Record) (Value, error) { return i.Values[0], nil },
+		func(outer Record, inner Record) Record {
+			if inner.Columns == nil {
+				inner = Record{Columns: outer.Columns, Values: []Value{vm.Null()}}
+			}
+			return Record{
+				Columns: append(append([]Column{}, outer.Columns...), inner.Columns...),
+				Values:  append(append([]Value{}, outer.Values...), inner.Values...),
+			}
+		})
+
+	if !validateQuery(q, want) {
+		t.Errorf("From().JoinBatch()=%v expected %v", toSlice(q), want)
+	}
+}
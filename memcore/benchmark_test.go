@@ -1,6 +1,10 @@
 package memcore
 
-// import "testing"
+import (
+	"testing"
+
+	"github.com/runner-mei/memsql/vm"
+)
 
 // const (
 // 	size = 1000000
@@ -91,3 +95,151 @@ package memcore
 // 		FromChannelT(ch).All(func(i interface{}) bool { return true })
 // 	}
 // }
+
+const exprSize = 100000
+
+func makeExprRecords() []Record {
+	columns := []Column{{Name: "id"}, {Name: "a"}, {Name: "b"}, {Name: "name"}}
+	records := make([]Record, exprSize)
+	for i := range records {
+		records[i] = Record{
+			Columns: columns,
+			Values: []Value{
+				vm.IntToValue(int64(i)),
+				vm.IntToValue(int64(i % 100)),
+				vm.FloatToValue(float64(i) / 3),
+				vm.StringToValue("name"),
+			},
+		}
+	}
+	return records
+}
+
+// (a + 2) * 3 > 100 and b <= 1000
+func exprClosure() func(vm.Context) (vm.Truth, error) {
+	column := func(name string) func(vm.Context) (Value, error) {
+		return func(ctx vm.Context) (Value, error) {
+			return ctx.GetValue("", name)
+		}
+	}
+	constant := func(v Value) func(vm.Context) (Value, error) {
+		return func(vm.Context) (Value, error) {
+			return v, nil
+		}
+	}
+	opt := vm.EmptyCompareOption()
+	return vm.And(
+		vm.GreaterThanWith(
+			vm.MultFunc(vm.PlusFunc(column("a"), constant(vm.IntToValue(2))), constant(vm.IntToValue(3))),
+			constant(vm.IntToValue(100)), opt),
+		vm.LessEqualWith(column("b"), constant(vm.IntToValue(1000)), opt))
+}
+
+func exprProgram() *vm.Program {
+	var p vm.Program
+	opt := p.AddOption(vm.EmptyCompareOption())
+	p.Emit(vm.OpColumn, p.AddColumn("", "a"))
+	p.Emit(vm.OpConst, p.AddConst(vm.IntToValue(2)))
+	p.Emit(vm.OpPlus, 0)
+	p.Emit(vm.OpConst, p.AddConst(vm.IntToValue(3)))
+	p.Emit(vm.OpMult, 0)
+	p.Emit(vm.OpConst, p.AddConst(vm.IntToValue(100)))
+	p.Emit(vm.OpGreaterThan, opt)
+	jump := p.Emit(vm.OpJumpIfFalse, 0)
+	p.Emit(vm.OpColumn, p.AddColumn("", "b"))
+	p.Emit(vm.OpConst, p.AddConst(vm.IntToValue(1000)))
+	p.Emit(vm.OpLessEqual, opt)
+	p.Emit(vm.OpAnd, 0)
+	p.Patch(jump)
+	return &p
+}
+
+func BenchmarkWhereClosure(b *testing.B) {
+	records := makeExprRecords()
+	f := vm.Filter(exprClosure())
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		count, err := FromRecords(records).Where(func(idx int, r Record) (bool, error) {
+			return f(ToRecordValuer(&r, false))
+		}).Count(nil)
+		if err != nil || count == 0 {
+			b.Fatal(count, err)
+		}
+	}
+}
+
+func BenchmarkWhereProgram(b *testing.B) {
+	records := makeExprRecords()
+	p := NewProgram(exprProgram(), false)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		count, err := FromRecords(records).Where(func(idx int, r Record) (bool, error) {
+			return p.Filter(&r)
+		}).Count(nil)
+		if err != nil || count == 0 {
+			b.Fatal(count, err)
+		}
+	}
+}
+
+func BenchmarkSelectClosure(b *testing.B) {
+	records := makeExprRecords()
+	f := vm.TruthToValue(exprClosure())
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for idx := range records {
+			if _, err := f(ToRecordValuer(&records[idx], false)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkSelectProgram(b *testing.B) {
+	records := makeExprRecords()
+	p := NewProgram(exprProgram(), false)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for idx := range records {
+			if _, err := p.Run(&records[idx]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func benchmarkAggregate(b *testing.B, batch bool) {
+	source := From(makeTable(exprSize))
+	filter := makeBatchProgram()
+	sum := NewProgram(func() *vm.Program {
+		var p vm.Program
+		p.Emit(vm.OpColumn, p.AddColumn("", "c2"))
+		return &p
+	}(), false)
+	names := []string{"sum"}
+	factories := []AggregatorFactory{ProgramAggregatorFunc(vm.AggFuncs["sum"], sum)}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		var q Query
+		if batch {
+			q = source.WhereBatch(filter.FilterBatch).AggregateWithBatch(names, factories)
+		} else {
+			q = source.Where(func(idx int, r Record) (bool, error) {
+				return filter.Filter(&r)
+			}).AggregateWith(names, factories)
+		}
+		results, err := q.Results(nil)
+		if err != nil || len(results) != 1 {
+			b.Fatal(results, err)
+		}
+	}
+}
+
+func BenchmarkAggregateRows(b *testing.B) {
+	benchmarkAggregate(b, false)
+}
+
+func BenchmarkAggregateBatches(b *testing.B) {
+	benchmarkAggregate(b, true)
+}
@@ -0,0 +1,604 @@
+package memcore
+
+import (
+	"sync"
+	"time"
+
+	"github.com/runner-mei/memsql/vm"
+)
+
+const (
+	OpEqual        = "="
+	OpNotEqual     = "<>"
+	OpLessThan     = "<"
+	OpLessEqual    = "<="
+	OpGreaterThan  = ">"
+	OpGreaterEqual = ">="
+	OpIn           = "in"
+	OpNotIn        = "not in"
+	OpLike         = "like"
+	OpIsNull       = "is null"
+	OpIsNotNull    = "is not null"
+)
+
+// Predicate is a simple condition 'Column Op Values' of the where clause, the
+// storage may evaluate it before the records are materialized. A predicate
+// only narrows the rows, the where clause is still applied to the results.
+type Predicate struct {
+	Column string
+	Op     string
+	Values []Value
+}
+
+func (p Predicate) String() string {
+	switch p.Op {
+	case OpIsNull, OpIsNotNull:
+		return p.Column + " " + p.Op
+	case OpIn, OpNotIn:
+		s := p.Column + " " + p.Op + " ("
+		for idx := range p.Values {
+			if idx > 0 {
+				s += ", "
+			}
+			s += p.Values[idx].String()
+		}
+		return s + ")"
+	}
+	if len(p.Values) == 0 {
+		return p.Column + " " + p.Op
+	}
+	return p.Column + " " + p.Op + " " + p.Values[0].String()
+}
+
+// PredicateStorage is implemented by the Storage which can evaluate the
+// predicates before the records are materialized.
+type PredicateStorage interface {
+	Storage
+
+	FromWhere(ctx Context, tablename string, filter func(ctx GetValuer) (bool, error), predicates []Predicate, trace func(TableName)) (Query, error)
+}
+
+type bitmap []uint64
+
+func newBitmap(n int) bitmap {
+	return make(bitmap, (n+63)/64)
+}
+
+func (b bitmap) set(idx int) {
+	b[idx/64] |= 1 << uint(idx%64)
+}
+
+func (b bitmap) get(idx int) bool {
+	if b == nil {
+		return false
+	}
+	return b[idx/64]&(1<<uint(idx%64)) != 0
+}
+
+type vector interface {
+	at(idx int) Value
+	isNull(idx int) bool
+
+	// match returns the rows in sel which may satisfy the predicate, ok is
+	// false if the vector cannot evaluate it natively.
+	match(p *Predicate, sel []int) (results []int, ok bool)
+}
+
+type int64Vector struct {
+	typ    vm.ValueType
+	values []int64
+	nulls  bitmap
+}
+
+func (v *int64Vector) at(idx int) Value {
+	if v.nulls.get(idx) {
+		return vm.Null()
+	}
+	return Value{Type: v.typ, Int64: v.values[idx]}
+}
+
+func (v *int64Vector) isNull(idx int) bool {
+	return v.nulls.get(idx)
+}
+
+func (v *int64Vector) match(p *Predicate, sel []int) ([]int, bool) {
+	if v.typ != vm.ValueInt64 && v.typ != vm.ValueDatetime {
+		return nil, false
+	}
+	var values = make([]int64, len(p.Values))
+	for idx := range p.Values {
+		if p.Values[idx].Type != v.typ {
+			return nil, false
+		}
+		values[idx] = p.Values[idx].Int64
+	}
+
+	var cmp func(a int64) bool
+	switch p.Op {
+	case OpEqual:
+		cmp = func(a int64) bool { return a == values[0] }
+	case OpNotEqual:
+		cmp = func(a int64) bool { return a != values[0] }
+	case OpLessThan:
+		cmp = func(a int64) bool { return a < values[0] }
+	case OpLessEqual:
+		cmp = func(a int64) bool { return a <= values[0] }
+	case OpGreaterThan:
+		cmp = func(a int64) bool { return a > values[0] }
+	case OpGreaterEqual:
+		cmp = func(a int64) bool { return a >= values[0] }
+	case OpIn, OpNotIn:
+		set := make(map[int64]struct{}, len(values))
+		for _, value := range values {
+			set[value] = struct{}{}
+		}
+		in := p.Op == OpIn
+		cmp = func(a int64) bool {
+			_, ok := set[a]
+			return ok == in
+		}
+	default:
+		return nil, false
+	}
+
+	results := sel[:0]
+	for _, idx := range sel {
+		// null 留给 where 去判断
+		if v.nulls.get(idx) || cmp(v.values[idx]) {
+			results = append(results, idx)
+		}
+	}
+	return results, true
+}
+
+type float64Vector struct {
+	values []float64
+	nulls  bitmap
+}
+
+func (v *float64Vector) at(idx int) Value {
+	if v.nulls.get(idx) {
+		return vm.Null()
+	}
+	return vm.FloatToValue(v.values[idx])
+}
+
+func (v *float64Vector) isNull(idx int) bool {
+	return v.nulls.get(idx)
+}
+
+func (v *float64Vector) match(p *Predicate, sel []int) ([]int, bool) {
+	return nil, false
+}
+
+type boolVector struct {
+	values bitmap
+	nulls  bitmap
+}
+
+func (v *boolVector) at(idx int) Value {
+	if v.nulls.get(idx) {
+		return vm.Null()
+	}
+	return vm.BoolToValue(v.values.get(idx))
+}
+
+func (v *boolVector) isNull(idx int) bool {
+	return v.nulls.get(idx)
+}
+
+func (v *boolVector) match(p *Predicate, sel []int) ([]int, bool) {
+	return nil, false
+}
+
+// stringVector is encoded with a dictionary, the predicate is evaluated
+// once for every distinct value.
+type stringVector struct {
+	dict  []string
+	codes []int32
+	nulls bitmap
+}
+
+func (v *stringVector) at(idx int) Value {
+	if v.nulls.get(idx) {
+		return vm.Null()
+	}
+	return vm.StringToValue(v.dict[v.codes[idx]])
+}
+
+func (v *stringVector) isNull(idx int) bool {
+	return v.nulls.get(idx)
+}
+
+func (v *stringVector) match(p *Predicate, sel []int) ([]int, bool) {
+	var matched = make([]bool, len(v.dict))
+	for code := range v.dict {
+		matched[code] = matchValue(vm.StringToValue(v.dict[code]), p)
+	}
+
+	results := sel[:0]
+	for _, idx := range sel {
+		if v.nulls.get(idx) || matched[v.codes[idx]] {
+			results = append(results, idx)
+		}
+	}
+	return results, true
+}
+
+type anyVector struct {
+	values []Value
+}
+
+func (v *anyVector) at(idx int) Value {
+	return v.values[idx]
+}
+
+func (v *anyVector) isNull(idx int) bool {
+	return v.values[idx].IsNull()
+}
+
+func (v *anyVector) match(p *Predicate, sel []int) ([]int, bool) {
+	return nil, false
+}
+
+// matchValue 和 where 的结果不一致时返回 true, 让 where 去判断
+func matchValue(value Value, p *Predicate) bool {
+	if value.IsNull() || len(p.Values) == 0 {
+		return true
+	}
+	opt := vm.EmptyCompareOption()
+
+	switch p.Op {
+	case OpEqual:
+		ok, err := value.EqualTo(p.Values[0], opt)
+		return err != nil || ok
+	case OpNotEqual:
+		ok, err := value.EqualTo(p.Values[0], opt)
+		return err != nil || !ok
+	case OpIn:
+		for idx := range p.Values {
+			ok, err := p.Values[idx].EqualTo(value, opt)
+			if err != nil || ok {
+				return true
+			}
+		}
+		return false
+	case OpNotIn:
+		for idx := range p.Values {
+			ok, err := p.Values[idx].EqualTo(value, opt)
+			if err != nil {
+				return true
+			}
+			if ok {
+				return false
+			}
+		}
+		return true
+	case OpLessThan, OpLessEqual, OpGreaterThan, OpGreaterEqual:
+		r, err := value.CompareTo(p.Values[0], opt)
+		if err != nil {
+			return true
+		}
+		switch p.Op {
+		case OpLessThan:
+			return r < 0
+		case OpLessEqual:
+			return r <= 0
+		case OpGreaterThan:
+			return r > 0
+		default:
+			return r >= 0
+		}
+	case OpLike:
+		if value.Type != vm.ValueString || p.Values[0].Type != vm.ValueString {
+			return true
+		}
+		return vm.MatchLike(value.Str, p.Values[0].Str)
+	}
+	return true
+}
+
+func filterVector(vec vector, p *Predicate, sel []int) []int {
+	switch p.Op {
+	case OpIsNull, OpIsNotNull:
+		isNull := p.Op == OpIsNull
+		results := sel[:0]
+		for _, idx := range sel {
+			if vec.isNull(idx) == isNull {
+				results = append(results, idx)
+			}
+		}
+		return results
+	}
+
+	if results, ok := vec.match(p, sel); ok {
+		return results
+	}
+
+	results := sel[:0]
+	for _, idx := range sel {
+		if matchValue(vec.at(idx), p) {
+			results = append(results, idx)
+		}
+	}
+	return results
+}
+
+func valueAt(record []Value, idx int) Value {
+	// Columns 和 Values 的长度不一定一致, 看 ToTable
+	if idx < len(record) {
+		return record[idx]
+	}
+	return vm.Null()
+}
+
+func toVector(table Table, column int) vector {
+	length := len(table.Records)
+
+	typ := vm.ValueNull
+	for row := range table.Records {
+		value := valueAt(table.Records[row], column)
+		if value.IsNull() {
+			continue
+		}
+		if value.IsCalendarInterval() || value.Location != nil {
+			// 日历 interval 和有时区的 datetime 不能只保存 Int64
+			typ = vm.ValueAny
+			break
+		}
+		if typ == vm.ValueNull {
+			typ = value.Type
+		} else if typ != value.Type {
+			typ = vm.ValueAny
+			break
+		}
+	}
+
+	var nulls bitmap
+	setNull := func(row int) {
+		if nulls == nil {
+			nulls = newBitmap(length)
+		}
+		nulls.set(row)
+	}
+
+	switch typ {
+	case vm.ValueInt64, vm.ValueDatetime, vm.ValueInterval:
+		values := make([]int64, length)
+		for row := range table.Records {
+			value := valueAt(table.Records[row], column)
+			if value.IsNull() {
+				setNull(row)
+				continue
+			}
+			values[row] = value.Int64
+		}
+		return &int64Vector{typ: typ, values: values, nulls: nulls}
+	case vm.ValueFloat64:
+		values := make([]float64, length)
+		for row := range table.Records {
+			value := valueAt(table.Records[row], column)
+			if value.IsNull() {
+				setNull(row)
+				continue
+			}
+			values[row] = value.Float64
+		}
+		return &float64Vector{values: values, nulls: nulls}
+	case vm.ValueBool:
+		values := newBitmap(length)
+		for row := range table.Records {
+			value := valueAt(table.Records[row], column)
+			if value.IsNull() {
+				setNull(row)
+				continue
+			}
+			if value.BoolValue() {
+				values.set(row)
+			}
+		}
+		return &boolVector{values: values, nulls: nulls}
+	case vm.ValueString:
+		var dict []string
+		var codes = make([]int32, length)
+		var byValue = map[string]int32{}
+		for row := range table.Records {
+			value := valueAt(table.Records[row], column)
+			if value.IsNull() {
+				setNull(row)
+				continue
+			}
+			code, ok := byValue[value.Str]
+			if !ok {
+				code = int32(len(dict))
+				dict = append(dict, value.Str)
+				byValue[value.Str] = code
+			}
+			codes[row] = code
+		}
+		return &stringVector{dict: dict, codes: codes, nulls: nulls}
+	default:
+		values := make([]Value, length)
+		for row := range table.Records {
+			values[row] = valueAt(table.Records[row], column)
+		}
+		return &anyVector{values: values}
+	}
+}
+
+// columnarTable 是 columnarStorage 中 measurement 的数据
+type columnarTable struct {
+	columns []Column
+	vectors []vector
+	length  int
+}
+
+func toColumnarTable(data Table) *columnarTable {
+	m := &columnarTable{
+		columns: data.Columns,
+		length:  len(data.Records),
+		vectors: make([]vector, len(data.Columns)),
+	}
+	for idx := range data.Columns {
+		m.vectors[idx] = toVector(data, idx)
+	}
+	return m
+}
+
+func (m *columnarTable) toTable() Table {
+	table := Table{
+		Columns: m.columns,
+		Records: make([][]Value, m.length),
+	}
+	for row := 0; row < m.length; row++ {
+		table.Records[row] = m.record(row)
+	}
+	return table
+}
+
+func (m *columnarTable) record(row int) []Value {
+	values := make([]Value, len(m.vectors))
+	for idx := range m.vectors {
+		values[idx] = m.vectors[idx].at(row)
+	}
+	return values
+}
+
+func (m *columnarTable) filter(predicates []Predicate) []int {
+	sel := make([]int, m.length)
+	for idx := range sel {
+		sel[idx] = idx
+	}
+
+	for idx := range predicates {
+		column := columnSearchByName(m.columns, predicates[idx].Column)
+		if column < 0 {
+			continue
+		}
+		sel = filterVector(m.vectors[column], &predicates[idx], sel)
+		if len(sel) == 0 {
+			break
+		}
+	}
+	return sel
+}
+
+func (m *columnarTable) query(tags KeyValues, sel []int) Query {
+	return Query{
+		Iterate: func() Iterator {
+			index := 0
+
+			return func(Context) (item Record, err error) {
+				if index < len(sel) {
+					item = Record{
+						Tags:    tags,
+						Columns: m.columns,
+						Values:  m.record(sel[index]),
+					}
+					index++
+					return
+				}
+
+				err = ErrNoRows
+				return
+			}
+		},
+		IterateBatch: func() BatchIterator {
+			index := 0
+
+			return func(Context) (*Batch, error) {
+				if index >= len(sel) {
+					return nil, ErrNoRows
+				}
+				end := index + BatchSize
+				if end > len(sel) {
+					end = len(sel)
+				}
+				b := NewBatch(tags, m.columns, end-index)
+				for idx := range m.vectors {
+					vector := b.Vectors[idx]
+					for _, row := range sel[index:end] {
+						vector = append(vector, m.vectors[idx].at(row))
+					}
+					b.Vectors[idx] = vector
+				}
+				b.Length = end - index
+				index = end
+				return b, nil
+			}
+		},
+	}
+}
+
+type columnarStorage struct {
+	mu sync.Mutex
+	measurementSet
+}
+
+// NewColumnarStorage 按列保存数据, 适合行数很多的表
+func NewColumnarStorage() PredicateStorage {
+	return &columnarStorage{
+		measurementSet: newMeasurementSet(func(data interface{}) Table {
+			return data.(*columnarTable).toTable()
+		}, func(table Table) interface{} {
+			return toColumnarTable(table)
+		}),
+	}
+}
+
+func (s *columnarStorage) From(ctx Context, tablename string, filter func(ctx GetValuer) (bool, error), trace func(TableName)) (Query, error) {
+	return s.FromWhere(ctx, tablename, filter, nil, trace)
+}
+
+func (s *columnarStorage) FromWhere(ctx Context, tablename string, filter func(ctx GetValuer) (bool, error), predicates []Predicate, trace func(TableName)) (Query, error) {
+	// 每个 measurement 是一个 partition, 它们可以并发地读取
+	return FromPartitions(&Partitions{
+		Get: func() ([]Query, error) {
+			return s.from(ctx, tablename, filter, predicates, trace)
+		},
+	}), nil
+}
+
+func (s *columnarStorage) from(ctx Context, tablename string, filter func(ctx GetValuer) (bool, error), predicates []Predicate, trace func(TableName)) ([]Query, error) {
+	s.mu.Lock()
+	list, err := s.find(tablename, filter, predicates, trace)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	partitions := make([]Query, len(list))
+	for i := range list {
+		data := list[i].data.(*columnarTable)
+		partitions[i] = data.query(list[i].tags, data.filter(predicates))
+	}
+	return partitions, nil
+}
+
+func (s *columnarStorage) Set(name string, tags []KeyValue, t time.Time, data Table, err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.set(name, tags, t, data, err)
+}
+
+func (s *columnarStorage) Exists(tablename string, tags []KeyValue, predateLimit time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.exists(tablename, tags, predateLimit)
+}
+
+func (s *columnarStorage) SetSchema(name string, schema *TableSchema) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.setSchema(name, schema)
+}
+
+func (s *columnarStorage) Schema(name string) (*TableSchema, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.schema(name)
+}
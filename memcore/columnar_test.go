@@ -0,0 +1,88 @@
+package memcore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/runner-mei/memsql/vm"
+)
+
+func TestColumnarStorage(t *testing.T) {
+	s := NewColumnarStorage()
+
+	table, err := ToTable([]map[string]interface{}{
+		{"id": 1, "name": "a", "value": 1.5, "ok": true},
+		{"id": 2, "name": "b", "value": 2.5, "ok": false},
+		{"id": 3, "name": "a", "ok": true},
+		{"id": 4, "name": "c", "value": 4.5, "ok": false},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("cpu", []KeyValue{{Key: "host", Value: "h1"}}, time.Now(), table, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	all := func(GetValuer) (bool, error) { return true, nil }
+
+	for _, test := range []struct {
+		predicates []Predicate
+		ids        []int64
+	}{
+		{
+			predicates: nil,
+			ids:        []int64{1, 2, 3, 4},
+		},
+		{
+			predicates: []Predicate{{Column: "id", Op: OpGreaterThan, Values: []Value{vm.IntToValue(2)}}},
+			ids:        []int64{3, 4},
+		},
+		{
+			predicates: []Predicate{{Column: "name", Op: OpEqual, Values: []Value{vm.StringToValue("a")}}},
+			ids:        []int64{1, 3},
+		},
+		{
+			predicates: []Predicate{
+				{Column: "name", Op: OpIn, Values: []Value{vm.StringToValue("a"), vm.StringToValue("c")}},
+				{Column: "id", Op: OpNotEqual, Values: []Value{vm.IntToValue(1)}},
+			},
+			ids: []int64{3, 4},
+		},
+		{
+			predicates: []Predicate{{Column: "value", Op: OpIsNull}},
+			ids:        []int64{3},
+		},
+		{
+			predicates: []Predicate{{Column: "value", Op: OpLessThan, Values: []Value{vm.FloatToValue(3)}}},
+			ids:        []int64{1, 2, 3},
+		},
+		{
+			predicates: []Predicate{{Column: "ok", Op: OpEqual, Values: []Value{vm.BoolToValue(true)}}},
+			ids:        []int64{1, 3},
+		},
+		{
+			predicates: []Predicate{{Column: "notexists", Op: OpEqual, Values: []Value{vm.IntToValue(1)}}},
+			ids:        []int64{1, 2, 3, 4},
+		},
+	} {
+		query, err := s.FromWhere(mkCtx(), "cpu", all, test.predicates, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := query.Results(mkCtx())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var ids []int64
+		for _, result := range results {
+			assertEqual(t, "h1", result.Tags[0].Value)
+			value, ok := result.Get("id")
+			if !ok {
+				t.Fatal("id isnot found")
+			}
+			ids = append(ids, value.Int64)
+		}
+		assertEqual(t, test.ids, ids)
+	}
+}
@@ -5,6 +5,12 @@ import "github.com/runner-mei/memsql/vm"
 // Distinct method returns distinct elements from a collection. The result is an
 // unordered collection that contains no duplicate values.
 func (q Query) Distinct() Query {
+	return q.DistinctWith(vm.EmptyCompareOption())
+}
+
+// DistinctWith is same as Distinct but the elements are compared with opt,
+// such as the collation of the strings.
+func (q Query) DistinctWith(opt vm.CompareOption) Query {
 	return Query{
 		Iterate: func() Iterator {
 			next := q.Iterate()
@@ -17,7 +23,7 @@ func (q Query) Distinct() Query {
 						return
 					}
 
-					if !set.Has(item) {
+					if !set.HasWith(item, opt) {
 						set.Add(item)
 						return
 					}
@@ -81,7 +87,7 @@ func (q Query) DistinctBy(selector func(Record) Value) Query {
 	return Query{
 		Iterate: func() Iterator {
 			next := q.Iterate()
-			set := make(map[Value]struct{})
+			set := newValueSet()
 
 			return func(ctx Context) (item Record, err error) {
 				for {
@@ -90,8 +96,8 @@ func (q Query) DistinctBy(selector func(Record) Value) Query {
 						return
 					}
 					s := selector(item)
-					if _, has := set[s]; !has {
-						set[s] = struct{}{}
+					if !set.has(s) {
+						set.add(s)
 						return
 					}
 				}
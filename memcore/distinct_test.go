@@ -1,6 +1,10 @@
 package memcore
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/runner-mei/memsql/vm"
+)
 
 func TestDistinct(t *testing.T) {
 	tests := []struct {
@@ -65,3 +69,24 @@ func TestDistinctBy(t *testing.T) {
 		t.Errorf("From(%v).DistinctBy()=%v expected %v", users, toSlice(q), want)
 	}
 }
+
+func TestDistinctByJSON(t *testing.T) {
+	columns := []Column{
+		{Name: "doc"},
+	}
+	var records []Record
+	for _, s := range []string{`{"a":1,"b":[1,2]}`, `[1,2]`, `{"b":[1,2],"a":1}`, `[1,2]`, `"a"`} {
+		value, err := vm.ParseJSON(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, Record{Columns: columns, Values: []Value{value}})
+	}
+	want := []Record{records[0], records[1], records[4]}
+
+	if q := FromRecords(records).DistinctBy(func(r Record) Value {
+		return r.Values[0]
+	}); !validateQuery(q, want) {
+		t.Errorf("From(%v).DistinctBy()=%v expected %v", records, toSlice(q), want)
+	}
+}
@@ -59,7 +59,7 @@ func (q Query) ExceptBy(q2 Query,
 			next1 := q.Iterate()
 			next2 := q2.Iterate()
 
-			set := make(map[Value]struct{})
+			set := newValueSet()
 			readDone := false
 			var readError error
 
@@ -81,7 +81,7 @@ func (q Query) ExceptBy(q2 Query,
 						}
 
 						s := selector(current)
-						set[s] = struct{}{}
+						set.add(s)
 					}
 					readDone = true
 				}
@@ -92,7 +92,7 @@ func (q Query) ExceptBy(q2 Query,
 					}
 
 					s := selector(item)
-					if _, has := set[s]; !has {
+					if !set.has(s) {
 						return
 					}
 				}
@@ -19,6 +19,14 @@ type Iterator func(Context) (item Record, err error)
 // as shown in the example.
 type Query struct {
 	Iterate func() Iterator
+
+	// IterateBatch is nil if the query cannot be read by the batches
+	// directly, see Batches.
+	IterateBatch func() BatchIterator
+
+	// Partitions is nil if the query isnot made up of the independent
+	// partitions, see FromPartitions.
+	Partitions *Partitions
 }
 
 // Iterable is an interface that has to be implemented by a custom collection in
@@ -52,6 +60,24 @@ func FromWithTags(source Table, tags KeyValues) Query {
 				return
 			}
 		},
+		IterateBatch: func() BatchIterator {
+			index := 0
+
+			return func(Context) (*Batch, error) {
+				if index >= source.Length() {
+					return nil, ErrNoRows
+				}
+				end := index + BatchSize
+				if end > source.Length() {
+					end = source.Length()
+				}
+				b := NewBatch(tags, source.Columns, end-index)
+				for ; index < end; index++ {
+					b.Append(source.Records[index])
+				}
+				return b, nil
+			}
+		},
 	}
 }
 
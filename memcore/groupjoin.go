@@ -26,7 +26,7 @@ func (q Query) GroupJoin(inner Query,
 			outernext := q.Iterate()
 			innernext := inner.Iterate()
 
-			var innerLookup = make(map[Value][]Record)
+			var innerLookup = newValueLookup()
 			var readDone = false
 			var readError error
 
@@ -48,7 +48,7 @@ func (q Query) GroupJoin(inner Query,
 						}
 
 						innerKey := innerKeySelector(innerItem)
-						innerLookup[innerKey] = append(innerLookup[innerKey], innerItem)
+						innerLookup.add(innerKey, innerItem)
 					}
 					readDone = true
 				}
@@ -57,7 +57,7 @@ func (q Query) GroupJoin(inner Query,
 					return
 				}
 
-				if group, has := innerLookup[outerKeySelector(item)]; !has {
+				if group, has := innerLookup.get(outerKeySelector(item)); !has {
 					item = resultSelector(item, []Record{})
 				} else {
 					item = resultSelector(item, group)
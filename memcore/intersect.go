@@ -67,7 +67,7 @@ func (q Query) IntersectBy(q2 Query,
 			next1 := q.Iterate()
 			next2 := q2.Iterate()
 
-			set := make(map[Value]struct{})
+			set := newValueSet()
 			var readDone = false
 			var readError error
 
@@ -88,7 +88,7 @@ func (q Query) IntersectBy(q2 Query,
 						}
 
 						s := selector(current)
-						set[s] = struct{}{}
+						set.add(s)
 					}
 					readDone = true
 				}
@@ -100,8 +100,8 @@ func (q Query) IntersectBy(q2 Query,
 					}
 
 					s := selector(item)
-					if _, has := set[s]; has {
-						delete(set, s)
+					if set.has(s) {
+						set.remove(s)
 						return
 					}
 				}
@@ -1,7 +1,7 @@
 package memcore
 
 import (
-	"github.com/runner-mei/memsql/vm"
+	"fmt"
 )
 
 // Join correlates the elements of two collection based on matching keys.
@@ -24,7 +24,7 @@ func (q Query) Join(isLeft bool, inner Query,
 			outernext := q.Iterate()
 			innernext := inner.Iterate()
 
-			var innerLookup = make(map[Value][]Record)
+			var innerLookup = newValueLookup()
 			var readDone = false
 			var readError error
 
@@ -53,7 +53,7 @@ func (q Query) Join(isLeft bool, inner Query,
 							readError = err
 							return Record{}, err
 						}
-						innerLookup[innerKey] = append(innerLookup[innerKey], innerItem)
+						innerLookup.add(innerKey, innerItem)
 					}
 					readDone = true
 				}
@@ -72,19 +72,7 @@ func (q Query) Join(isLeft bool, inner Query,
 							return Record{}, err
 						}
 
-						innerGroup, has = innerLookup[outKey]
-						if !has {
-							// FIXME: outKey 和 innerKey 可能会因为类型不匹配
-							//        所以这里用 Equal 再试一下
-							for innerKey, group := range innerLookup {
-								ok, _ := innerKey.EqualTo(outKey, vm.EmptyCompareOption())
-								if ok {
-									innerGroup = group
-									has = true
-									break
-								}
-							}
-						}
+						innerGroup, has = innerLookup.lookup(outKey)
 						innerLen = len(innerGroup)
 						innerIndex = 0
 
@@ -104,6 +92,152 @@ func (q Query) Join(isLeft bool, inner Query,
 	}
 }
 
+// JoinBatch is same as Join but the outer collection is probed by the
+// batches, outerKeys reads the keys of the rows of the batch to keys.
+func (q Query) JoinBatch(isLeft bool, inner Query,
+	outerKeys func(ctx Context, b *Batch, keys []Value) error,
+	innerKeySelector func(Record) (Value, error),
+	resultSelector func(outer Record, inner Record) Record) Query {
+	return q.joinBatch(false, isLeft, inner, outerKeys, innerKeySelector, resultSelector)
+}
+
+// JoinParallel is same as JoinBatch but the inner collection is read and
+// hashed by another goroutine while the first batch of the outer collection
+// is read, so inner must can be read concurrently.
+func (q Query) JoinParallel(isLeft bool, inner Query,
+	outerKeys func(ctx Context, b *Batch, keys []Value) error,
+	innerKeySelector func(Record) (Value, error),
+	resultSelector func(outer Record, inner Record) Record) Query {
+	return q.joinBatch(true, isLeft, inner, outerKeys, innerKeySelector, resultSelector)
+}
+
+// BatchKeys reads the keys of the rows of the batch by keySelector, see
+// JoinBatch.
+func BatchKeys(keySelector func(Record) (Value, error)) func(Context, *Batch, []Value) error {
+	return func(ctx Context, b *Batch, keys []Value) error {
+		for i, r := range b.Records() {
+			key, err := keySelector(r)
+			if err != nil {
+				return err
+			}
+			keys[i] = key
+		}
+		return nil
+	}
+}
+
+// buildLookup 读取 inner 的所有行, 并按 key 分组
+func buildLookup(ctx Context, inner Query, innerKeySelector func(Record) (Value, error)) (*valueLookup, error) {
+	innernext := inner.Iterate()
+	innerLookup := newValueLookup()
+	for {
+		innerItem, err := innernext(ctx)
+		if err != nil {
+			if !IsNoRows(err) {
+				return nil, err
+			}
+			return innerLookup, nil
+		}
+
+		innerKey, err := innerKeySelector(innerItem)
+		if err != nil {
+			return nil, err
+		}
+		innerLookup.add(innerKey, innerItem)
+	}
+}
+
+func (q Query) joinBatch(parallel, isLeft bool, inner Query,
+	outerKeys func(ctx Context, b *Batch, keys []Value) error,
+	innerKeySelector func(Record) (Value, error),
+	resultSelector func(outer Record, inner Record) Record) Query {
+
+	return Query{
+		Iterate: func() Iterator {
+			outernext := q.Batches()
+
+			var innerLookup *valueLookup
+			var readDone = false
+			var readError error
+
+			// 并行时预先读取的 outer 的第一个批
+			var first *Batch
+			var firstError error
+			var hasFirst bool
+
+			var keys []Value
+			var results []Record
+			index := 0
+
+			return func(ctx Context) (Record, error) {
+				if !readDone {
+					if readError != nil {
+						return Record{}, readError
+					}
+					if parallel {
+						built := make(chan struct{})
+						go func() {
+							defer close(built)
+							defer func() {
+								if o := recover(); o != nil {
+									readError = fmt.Errorf("read inner fail: %v", o)
+								}
+							}()
+							innerLookup, readError = buildLookup(ctx, inner, innerKeySelector)
+						}()
+						first, firstError = outernext(ctx)
+						hasFirst = true
+						<-built
+					} else {
+						innerLookup, readError = buildLookup(ctx, inner, innerKeySelector)
+					}
+					if readError != nil {
+						return Record{}, readError
+					}
+					readDone = true
+				}
+
+				for index >= len(results) {
+					var b *Batch
+					var err error
+					if hasFirst {
+						b, err, hasFirst = first, firstError, false
+						first = nil
+					} else {
+						b, err = outernext(ctx)
+					}
+					if err != nil {
+						return Record{}, err
+					}
+
+					if cap(keys) < b.Length {
+						keys = make([]Value, b.Length)
+					}
+					keys = keys[:b.Length]
+					if err := outerKeys(ctx, b, keys); err != nil {
+						return Record{}, err
+					}
+
+					results, index = results[:0], 0
+					for i, outerItem := range b.Records() {
+						innerGroup, _ := innerLookup.lookup(keys[i])
+						if isLeft && len(innerGroup) == 0 {
+							results = append(results, resultSelector(outerItem, Record{}))
+							continue
+						}
+						for _, innerItem := range innerGroup {
+							results = append(results, resultSelector(outerItem, innerItem))
+						}
+					}
+				}
+
+				index++
+				return results[index-1], nil
+			}
+		},
+	}
+}
+
 func (q Query) FullJoin(inner Query, resultSelector func(outer Record, inner Record) Record) Query {
 	return Query{
 		Iterate: func() Iterator {
@@ -1,6 +1,10 @@
 package memcore
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/runner-mei/memsql/vm"
+)
 
 func TestJoin(t *testing.T) {
 	outer := []int64{0, 1, 2, 3, 4, 5, 8}
@@ -69,3 +73,47 @@ func TestFullJoin(t *testing.T) {
 		t.Errorf("From().Join()=%v expected %v", toSlice(q), want)
 	}
 }
+
+func TestJoinJSON(t *testing.T) {
+	columns := []Column{
+		{Name: "doc"},
+	}
+	toRecords := func(docs ...string) []Record {
+		var records []Record
+		for _, s := range docs {
+			value, err := vm.ParseJSON(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			records = append(records, Record{Columns: columns, Values: []Value{value}})
+		}
+		return records
+	}
+	outer := toRecords(`{"a":1}`, `[1,2]`, `"x"`, `[3]`)
+	inner := toRecords(`[1,2]`, `{"a":1}`, `"x"`, `[1,2]`)
+
+	want := []Record{
+		{Columns: append(columns, columns...), Values: []Value{outer[0].Values[0], inner[1].Values[0]}},
+		{Columns: append(columns, columns...), Values: []Value{outer[1].Values[0], inner[0].Values[0]}},
+		{Columns: append(columns, columns...), Values: []Value{outer[1].Values[0], inner[3].Values[0]}},
+		{Columns: append(columns, columns...), Values: []Value{outer[2].Values[0], inner[2].Values[0]}},
+	}
+
+	keySelector := func(r Record) (Value, error) { return r.Values[0], nil }
+	resultSelector := func(outer Record, inner Record) Record {
+		return Record{
+			Columns: append(outer.Columns, inner.Columns...),
+			Values:  append(outer.Values, inner.Values...),
+		}
+	}
+
+	q := FromRecords(outer).Join(false, FromRecords(inner), keySelector, keySelector, resultSelector)
+	if !validateQuery(q, want) {
+		t.Errorf("From().Join()=%v expected %v", toSlice(q), want)
+	}
+
+	q = FromRecords(outer).JoinBatch(false, FromRecords(inner), BatchKeys(keySelector), keySelector, resultSelector)
+	if !validateQuery(q, want) {
+		t.Errorf("From().JoinBatch()=%v expected %v", toSlice(q), want)
+	}
+}
@@ -0,0 +1,124 @@
+package memcore
+
+import (
+	"reflect"
+
+	"github.com/runner-mei/memsql/vm"
+)
+
+// isHashable 判断 v 能否作为 map 的键, json 的对象和数组不能作为 map 的键
+func isHashable(v Value) bool {
+	return v.Any == nil || reflect.TypeOf(v.Any).Comparable()
+}
+
+type valueGroup struct {
+	key     Value
+	records []Record
+}
+
+// valueLookup 按 key 分组保存记录, 不能作为 map 的键的 key 保存在 others 中,
+// 查找它们时用 EqualTo 逐个比较
+type valueLookup struct {
+	groups map[Value][]Record
+	others []valueGroup
+}
+
+func newValueLookup() *valueLookup {
+	return &valueLookup{groups: make(map[Value][]Record)}
+}
+
+func (l *valueLookup) add(key Value, record Record) {
+	if isHashable(key) {
+		l.groups[key] = append(l.groups[key], record)
+		return
+	}
+	for idx := range l.others {
+		if ok, _ := l.others[idx].key.EqualTo(key, vm.EmptyCompareOption()); ok {
+			l.others[idx].records = append(l.others[idx].records, record)
+			return
+		}
+	}
+	l.others = append(l.others, valueGroup{key: key, records: []Record{record}})
+}
+
+// get 返回与 key 相同的组
+func (l *valueLookup) get(key Value) ([]Record, bool) {
+	if isHashable(key) {
+		group, ok := l.groups[key]
+		return group, ok
+	}
+	for idx := range l.others {
+		if ok, _ := l.others[idx].key.EqualTo(key, vm.EmptyCompareOption()); ok {
+			return l.others[idx].records, true
+		}
+	}
+	return nil, false
+}
+
+// lookup 与 get 相同, 但 key 的类型可能与组的不一致, 所以找不到时用 EqualTo
+// 与所有的组再比较一次
+func (l *valueLookup) lookup(key Value) ([]Record, bool) {
+	if isHashable(key) {
+		if group, ok := l.groups[key]; ok {
+			return group, true
+		}
+	}
+	for innerKey, group := range l.groups {
+		if ok, _ := innerKey.EqualTo(key, vm.EmptyCompareOption()); ok {
+			return group, true
+		}
+	}
+	for idx := range l.others {
+		if ok, _ := l.others[idx].key.EqualTo(key, vm.EmptyCompareOption()); ok {
+			return l.others[idx].records, true
+		}
+	}
+	return nil, false
+}
+
+// valueSet 是 key 的集合, 不能作为 map 的键的 key 保存在 others 中
+type valueSet struct {
+	values map[Value]struct{}
+	others []Value
+}
+
+func newValueSet() *valueSet {
+	return &valueSet{values: make(map[Value]struct{})}
+}
+
+func (s *valueSet) has(key Value) bool {
+	if isHashable(key) {
+		_, ok := s.values[key]
+		return ok
+	}
+	for idx := range s.others {
+		if ok, _ := s.others[idx].EqualTo(key, vm.EmptyCompareOption()); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *valueSet) add(key Value) {
+	if s.has(key) {
+		return
+	}
+	if isHashable(key) {
+		s.values[key] = struct{}{}
+		return
+	}
+	s.others = append(s.others, key)
+}
+
+func (s *valueSet) remove(key Value) {
+	if isHashable(key) {
+		delete(s.values, key)
+		return
+	}
+	for idx := range s.others {
+		if ok, _ := s.others[idx].EqualTo(key, vm.EmptyCompareOption()); ok {
+			s.others = append(s.others[:idx], s.others[idx+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package memcore
+
+import (
+	"time"
+
+	"github.com/runner-mei/errors"
+)
+
+// measurement 是表中 tag 相同的记录, data 是 storage 保存的数据, 它是 Table
+// 或 *columnarTable. measurement 保存后不再修改, 更新时用新的替换它, 所以可
+// 以在锁之外读取它
+type measurement struct {
+	tags     KeyValues
+	dataTime time.Time
+	data     interface{}
+
+	errTime time.Time
+	err     error
+}
+
+// measurementSet 保存每个表的 measurement, tag 的索引, schema 和视图的定
+// 义, storage 和 columnarStorage 共用它, 它们只是保存数据的格式不同. 调用者
+// 负责加锁
+type measurementSet struct {
+	tables  map[string]map[string]*measurement
+	indexes map[string]tagIndex
+	schemas map[string]*TableSchema
+	views   map[string]*View
+
+	// toTable 和 fromTable 在 Table 和 storage 保存的数据之间转换
+	toTable   func(data interface{}) Table
+	fromTable func(table Table) interface{}
+}
+
+func newMeasurementSet(toTable func(data interface{}) Table, fromTable func(table Table) interface{}) measurementSet {
+	return measurementSet{
+		tables:    map[string]map[string]*measurement{},
+		indexes:   map[string]tagIndex{},
+		schemas:   map[string]*TableSchema{},
+		views:     map[string]*View{},
+		toTable:   toTable,
+		fromTable: fromTable,
+	}
+}
+
+// find 用 tag 的索引找出候选的 measurement, 只对候选者执行 filter, 其它的
+// predicates 由调用者处理
+func (ms *measurementSet) find(tablename string, filter func(ctx GetValuer) (bool, error), predicates []Predicate, trace func(TableName)) ([]*measurement, error) {
+	byKey := ms.tables[tablename]
+	if len(byKey) == 0 {
+		return nil, TableNotExists(tablename)
+	}
+
+	// 有索引时只读取候选者
+	candidates, indexed := ms.indexes[tablename].lookup(predicates)
+	if indexed {
+		selected := make(map[string]*measurement, len(candidates))
+		for key := range candidates {
+			if m, ok := byKey[key]; ok {
+				selected[key] = m
+			}
+		}
+		byKey = selected
+	}
+
+	var list []*measurement
+	for _, m := range byKey {
+		values := toGetValuer(m.tags)
+		ok, err := filter(values)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+
+			return nil, TableNotExists(tablename, err)
+		}
+		if m.err != nil {
+			return nil, m.err
+		}
+		if ok {
+			if trace != nil {
+				trace(TableName{
+					Table: tablename,
+					Tags:  m.tags,
+				})
+			}
+			list = append(list, m)
+		}
+	}
+	if len(list) == 0 {
+		return nil, TableNotExists(tablename)
+	}
+	return list, nil
+}
+
+// get 返回 measurement 的记录的复本, 出错的 measurement 被当作不存在
+func (ms *measurementSet) get(name string, tags []KeyValue) (Table, bool) {
+	_, key := measurementKey(tags)
+	m, ok := ms.tables[name][key]
+	if !ok || m.err != nil {
+		return Table{}, false
+	}
+	return copyTable(ms.toTable(m.data)), true
+}
+
+// set 保存 measurement, err 不为 nil 时保留原来的数据
+func (ms *measurementSet) set(name string, tags []KeyValue, t time.Time, data Table, err error) error {
+	copyed, key := measurementKey(tags)
+	m := &measurement{
+		tags:     copyed,
+		dataTime: t,
+		errTime:  t,
+		err:      err,
+	}
+
+	old, ok := ms.tables[name][key]
+	if ok && err != nil {
+		m.data = old.data
+		m.dataTime = old.dataTime
+	} else {
+		// 出错时的数据不一定与 schema 一致
+		schema := ms.schemas[name]
+		if err != nil {
+			schema = nil
+		}
+		table, e := ms.coerce(name, schema, data)
+		if e != nil {
+			return errors.Wrap(e, "table '"+name+"' is mismatch with the schema")
+		}
+		m.data = ms.fromTable(table)
+	}
+	ms.add(name, key, m)
+	return nil
+}
+
+// coerce 将 data 转换为 schema 中的类型, 并设置列的表名, data 不会被修改
+func (ms *measurementSet) coerce(name string, schema *TableSchema, data Table) (Table, error) {
+	if schema != nil {
+		coerced, err := schema.Apply(data)
+		if err != nil {
+			return Table{}, err
+		}
+		data = coerced
+	}
+
+	columns := make([]Column, len(data.Columns))
+	for idx := range data.Columns {
+		columns[idx] = data.Columns[idx]
+		columns[idx].TableName = name
+	}
+	data.Columns = columns
+	return data, nil
+}
+
+// add 保存 measurement, 它的 tags 已经排好序
+func (ms *measurementSet) add(name, key string, m *measurement) {
+	byKey := ms.tables[name]
+	if byKey == nil {
+		byKey = map[string]*measurement{}
+		ms.tables[name] = byKey
+	}
+	index := ms.indexes[name]
+	if index == nil {
+		index = tagIndex{}
+		ms.indexes[name] = index
+	}
+	if _, ok := byKey[key]; !ok {
+		index.add(key, m.tags)
+	}
+	byKey[key] = m
+}
+
+func (ms *measurementSet) remove(name string, tags []KeyValue) bool {
+	copyed, key := measurementKey(tags)
+	byKey := ms.tables[name]
+	if _, ok := byKey[key]; !ok {
+		return false
+	}
+	delete(byKey, key)
+	ms.indexes[name].remove(key, copyed)
+	if len(byKey) == 0 {
+		delete(ms.tables, name)
+		delete(ms.indexes, name)
+	}
+	return true
+}
+
+// update 用 update 的结果替换 measurement 的记录, 结果为空时删除它
+func (ms *measurementSet) update(name string, tags []KeyValue, t time.Time, update func(old Table, exists bool) (Table, error)) error {
+	old, exists := ms.get(name, tags)
+	data, err := update(old, exists)
+	if err != nil {
+		return err
+	}
+	if len(data.Records) == 0 {
+		ms.remove(name, tags)
+		return nil
+	}
+	return ms.set(name, tags, t, data, nil)
+}
+
+// replace 用 measurements 替换表中所有的 measurement, 有一个与 schema 不
+// 一致时不做任何修改
+func (ms *measurementSet) replace(name string, t time.Time, measurements []Measurement) error {
+	byKey := make(map[string]*measurement, len(measurements))
+	index := tagIndex{}
+	for _, m := range measurements {
+		copyed, key := measurementKey(m.Tags)
+		table, err := ms.coerce(name, ms.schemas[name], m.Table)
+		if err != nil {
+			return errors.Wrap(err, "table '"+name+"("+key+")' is mismatch with the schema")
+		}
+		if _, ok := byKey[key]; !ok {
+			index.add(key, copyed)
+		}
+		byKey[key] = &measurement{
+			tags:     copyed,
+			dataTime: t,
+			data:     ms.fromTable(table),
+			errTime:  t,
+		}
+	}
+
+	if len(byKey) == 0 {
+		delete(ms.tables, name)
+		delete(ms.indexes, name)
+		return nil
+	}
+	ms.tables[name] = byKey
+	ms.indexes[name] = index
+	return nil
+}
+
+// list 返回表中所有 measurement 的 tags
+func (ms *measurementSet) list(name string) []KeyValues {
+	var results []KeyValues
+	for _, m := range ms.tables[name] {
+		results = append(results, m.tags)
+	}
+	return results
+}
+
+func (ms *measurementSet) exists(name string, tags []KeyValue, predateLimit time.Time) bool {
+	_, key := measurementKey(tags)
+	old, ok := ms.tables[name][key]
+	if !ok {
+		return false
+	}
+
+	if predateLimit.After(old.dataTime) {
+		return false
+	}
+	if old.err != nil {
+		if predateLimit.After(old.errTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// setSchema 将表中已有的数据转换为 schema 中的类型, 有一个转换失败时不做
+// 任何修改
+func (ms *measurementSet) setSchema(name string, schema *TableSchema) error {
+	if schema == nil {
+		delete(ms.schemas, name)
+		return nil
+	}
+	if err := schema.Validate(); err != nil {
+		return errors.Wrap(err, "schema of the table '"+name+"' is invalid")
+	}
+
+	byKey := ms.tables[name]
+	var coerced = make(map[string]*measurement, len(byKey))
+	for key, m := range byKey {
+		table, err := ms.coerce(name, schema, ms.toTable(m.data))
+		if err != nil {
+			return errors.Wrap(err, "table '"+name+"("+key+")' is mismatch with the schema")
+		}
+
+		copyed := *m
+		copyed.data = ms.fromTable(table)
+		coerced[key] = &copyed
+	}
+	for key, m := range coerced {
+		byKey[key] = m
+	}
+	ms.schemas[name] = schema
+	return nil
+}
+
+func (ms *measurementSet) schema(name string) (*TableSchema, bool) {
+	schema, ok := ms.schemas[name]
+	return schema, ok
+}
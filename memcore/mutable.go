@@ -0,0 +1,120 @@
+package memcore
+
+import (
+	"sort"
+	"time"
+)
+
+// MutableStorage is implemented by the Storage which supports the INSERT and
+// DELETE statements.
+type MutableStorage interface {
+	Storage
+
+	// Get returns the records of the measurement
+	Get(name string, tags []KeyValue) (Table, bool)
+
+	// Remove removes the measurement, it returns false if it isnot exists.
+	Remove(name string, tags []KeyValue) (bool, error)
+
+	// Measurements returns the tags of all the measurements of the table
+	Measurements(name string) []KeyValues
+
+	// Update runs update with the records of the measurement and replaces
+	// them with the result atomically, the measurement is removed if the
+	// result has no records.
+	Update(name string, tags []KeyValue, t time.Time, update func(old Table, exists bool) (Table, error)) error
+
+	// Replace replaces all the measurements of the table atomically, the
+	// table is removed if measurements is empty.
+	Replace(name string, t time.Time, measurements []Measurement) error
+}
+
+// Measurement is the records of the tags
+type Measurement struct {
+	Tags  []KeyValue
+	Table Table
+}
+
+func measurementKey(tags []KeyValue) (KeyValues, string) {
+	copyed := KeyValues(CloneKeyValues(tags))
+	sort.Sort(copyed)
+	return copyed, copyed.ToKey()
+}
+
+func copyTable(table Table) Table {
+	columns := make([]Column, len(table.Columns))
+	copy(columns, table.Columns)
+	records := make([][]Value, len(table.Records))
+	copy(records, table.Records)
+	return Table{Columns: columns, Records: records}
+}
+
+func (s *storage) Get(name string, tags []KeyValue) (Table, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.get(name, tags)
+}
+
+func (s *storage) Remove(name string, tags []KeyValue) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.remove(name, tags), nil
+}
+
+func (s *storage) Update(name string, tags []KeyValue, t time.Time, update func(old Table, exists bool) (Table, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.update(name, tags, t, update)
+}
+
+func (s *storage) Replace(name string, t time.Time, measurements []Measurement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.replace(name, t, measurements)
+}
+
+func (s *storage) Measurements(name string) []KeyValues {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.list(name)
+}
+
+func (s *columnarStorage) Get(name string, tags []KeyValue) (Table, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.get(name, tags)
+}
+
+func (s *columnarStorage) Remove(name string, tags []KeyValue) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.remove(name, tags), nil
+}
+
+func (s *columnarStorage) Update(name string, tags []KeyValue, t time.Time, update func(old Table, exists bool) (Table, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.update(name, tags, t, update)
+}
+
+func (s *columnarStorage) Replace(name string, t time.Time, measurements []Measurement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.replace(name, t, measurements)
+}
+
+func (s *columnarStorage) Measurements(name string) []KeyValues {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.list(name)
+}
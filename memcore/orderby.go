@@ -211,6 +211,76 @@ func (oq OrderedQuery) ThenByDescending(selector func(Record) (Value, error)) Or
 	}
 }
 
+// OrderByWith sorts the elements of a collection by a key which is compared
+// with opt, such as the collation of the strings.
+func (q Query) OrderByWith(selector func(Record) (Value, error), desc bool, opt vm.CompareOption) OrderedQuery {
+	return newOrderedQuery(q, []order{{selector: selector, compare: compareWith(opt), desc: desc}})
+}
+
+// ThenByWith performs a subsequent ordering of the elements by a key which is
+// compared with opt.
+func (oq OrderedQuery) ThenByWith(selector func(Record) (Value, error), desc bool, opt vm.CompareOption) OrderedQuery {
+	orders := make([]order, len(oq.orders), len(oq.orders)+1)
+	copy(orders, oq.orders)
+	orders = append(orders, order{selector: selector, compare: compareWith(opt), desc: desc})
+	return newOrderedQuery(oq.original, orders)
+}
+
+func compareWith(opt vm.CompareOption) comparer {
+	return func(a Value, b Value) int {
+		ret, err := a.CompareTo(b, opt)
+		if err != nil {
+			panic(err)
+		}
+		return ret
+	}
+}
+
+func newOrderedQuery(original Query, orders []order) OrderedQuery {
+	return OrderedQuery{
+		orders:   orders,
+		original: original,
+		Query: Query{
+			Iterate: func() Iterator {
+				var items []Record
+				var readDone = false
+				var readError error
+
+				var length = 0
+				var index = 0
+
+				return func(ctx Context) (item Record, err error) {
+					if !readDone {
+						if readError != nil {
+							err = readError
+							return
+						}
+
+						items, err = original.sort(ctx, orders)
+						if err != nil {
+							readError = err
+							return Record{}, err
+						}
+
+						length = len(items)
+						index = 0
+						readDone = true
+					}
+
+					if index < length {
+						item = items[index]
+						index++
+						return
+					}
+
+					err = ErrNoRows
+					return
+				}
+			},
+		},
+	}
+}
+
 // Sort returns a new query by sorting elements with provided less function in
 // ascending order. The comparer function should return true if the parameter i
 // is less than j. While this method is uglier than chaining OrderBy,
@@ -0,0 +1,363 @@
+package memcore
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// Partitions are the independent parts of a query, such as the measurements
+// of a table, the partitions may be read and filtered concurrently.
+type Partitions struct {
+	// Parallelism is the max number of the partitions which are read at the
+	// same time, 0 or 1 means the partitions are read one by one. A few
+	// batches of a partition are read ahead until the partitions before it
+	// are read.
+	Parallelism int
+
+	Get func() ([]Query, error)
+}
+
+// FromPartitions initializes a query with the partitions, the rows of the
+// query are the rows of the partitions in order, it doesnot depend on the
+// parallelism.
+//
+// WhereBatch, SelectBatch and AggregateWithBatch run in the partitions, the
+// others read the rows which are gathered from the partitions.
+func FromPartitions(partitions *Partitions) Query {
+	return Query{
+		Iterate: func() Iterator {
+			if partitions.Parallelism > 1 {
+				return rowsOf(func() BatchIterator {
+					return gather(partitions)
+				})()
+			}
+			return concatRows(partitions)
+		},
+		IterateBatch: func() BatchIterator {
+			return gather(partitions)
+		},
+		Partitions: partitions,
+	}
+}
+
+// WithParallelism returns the query whose partitions are read by n
+// goroutines, it returns q self if q hasnot the partitions.
+func (q Query) WithParallelism(n int) Query {
+	if q.Partitions == nil {
+		return q
+	}
+	return FromPartitions(&Partitions{
+		Parallelism: n,
+		Get:         q.Partitions.Get,
+	})
+}
+
+// Gather returns the query whose partitions are still read concurrently,
+// but the later operators run on the gathered rows, it is used if the
+// operators cannot run concurrently.
+func (q Query) Gather() Query {
+	return Query{
+		Iterate:      q.Iterate,
+		IterateBatch: q.IterateBatch,
+	}
+}
+
+// mapPartitions 对每个 partition 执行 f, q 没有 partition 时对 q 执行 f
+func (q Query) mapPartitions(f func(Query) Query) Query {
+	if q.Partitions == nil {
+		return f(q)
+	}
+
+	get := q.Partitions.Get
+	return FromPartitions(&Partitions{
+		Parallelism: q.Partitions.Parallelism,
+		Get: func() ([]Query, error) {
+			partitions, err := get()
+			if err != nil {
+				return nil, err
+			}
+			results := make([]Query, len(partitions))
+			for i := range partitions {
+				results[i] = f(partitions[i])
+			}
+			return results, nil
+		},
+	})
+}
+
+// concatRows 依次读取各个 partition 的行
+func concatRows(partitions *Partitions) Iterator {
+	var list []Query
+	var next Iterator
+	var index int
+	var err error
+
+	return func(ctx Context) (Record, error) {
+		if list == nil && err == nil {
+			list, err = partitions.Get()
+			if list == nil && err == nil {
+				list = []Query{}
+			}
+		}
+		if err != nil {
+			return Record{}, err
+		}
+		for {
+			if next == nil {
+				if index >= len(list) {
+					return Record{}, ErrNoRows
+				}
+				next = list[index].Iterate()
+				index++
+			}
+			item, e := next(ctx)
+			if e == nil || !IsNoRows(e) {
+				return item, e
+			}
+			next = nil
+		}
+	}
+}
+
+// concatBatches 依次读取各个 partition 的批
+func concatBatches(partitions *Partitions) BatchIterator {
+	var list []Query
+	var next BatchIterator
+	var index int
+	var err error
+
+	return func(ctx Context) (*Batch, error) {
+		if list == nil && err == nil {
+			list, err = partitions.Get()
+			if list == nil && err == nil {
+				list = []Query{}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		for {
+			if next == nil {
+				if index >= len(list) {
+					return nil, ErrNoRows
+				}
+				next = list[index].Batches()
+				index++
+			}
+			b, e := next(ctx)
+			if e == nil || !IsNoRows(e) {
+				return b, e
+			}
+			next = nil
+		}
+	}
+}
+
+// partitionBuffer 是每个 partition 预先读取的批的个数
+const partitionBuffer = 4
+
+// ClosingContext is implemented by the Context which closes the resources of
+// the iterators when the statement is done, the goroutines which read the
+// partitions are stopped by it if the iterator is abandoned.
+type ClosingContext interface {
+	OnClosing(closers ...io.Closer)
+}
+
+type partitionStream struct {
+	batches chan *Batch
+	// err 在 batches 关闭之前写入
+	err error
+}
+
+// gatherer 最多 Parallelism 个 goroutine 并发地读取各个 partition 的批, 返回
+// 的批与依次读取时的顺序一致. 每个 partition 最多预先读取 partitionBuffer
+// 个批, 读取完成, 出错或 Close 后 goroutine 都会结束
+type gatherer struct {
+	partitions *Partitions
+	streams    []partitionStream
+	current    int
+	started    bool
+	err        error
+
+	stopOnce sync.Once
+	stopped  chan struct{}
+}
+
+func newGatherer(partitions *Partitions) *gatherer {
+	return &gatherer{
+		partitions: partitions,
+		stopped:    make(chan struct{}),
+	}
+}
+
+func gather(partitions *Partitions) BatchIterator {
+	if partitions.Parallelism <= 1 {
+		return concatBatches(partitions)
+	}
+	return newGatherer(partitions).next
+}
+
+func (g *gatherer) next(ctx Context) (*Batch, error) {
+	if !g.started {
+		g.started = true
+		list, err := g.partitions.Get()
+		if err != nil {
+			g.err = err
+		} else {
+			g.start(ctx, list)
+		}
+	}
+	if g.err != nil {
+		return nil, g.err
+	}
+	if g.isStopped() {
+		return nil, ErrNoRows
+	}
+
+	for g.current < len(g.streams) {
+		s := &g.streams[g.current]
+		var b *Batch
+		var ok bool
+		select {
+		case b, ok = <-s.batches:
+		case <-g.stopped:
+			return nil, ErrNoRows
+		}
+		if ok {
+			return b, nil
+		}
+		if s.err != nil {
+			g.err = s.err
+			g.Close()
+			return nil, g.err
+		}
+		g.current++
+	}
+	return nil, ErrNoRows
+}
+
+// Close stops the goroutines, the iterator returns ErrNoRows after it.
+func (g *gatherer) Close() error {
+	g.stopOnce.Do(func() {
+		close(g.stopped)
+	})
+	return nil
+}
+
+func (g *gatherer) start(ctx Context, list []Query) {
+	g.streams = make([]partitionStream, len(list))
+	for i := range g.streams {
+		g.streams[i].batches = make(chan *Batch, partitionBuffer)
+	}
+	if closing, ok := ctx.(ClosingContext); ok {
+		closing.OnClosing(g)
+	}
+
+	parallelism := g.partitions.Parallelism
+	if parallelism > len(list) {
+		parallelism = len(list)
+	}
+	var next int32 = -1
+	for w := 0; w < parallelism; w++ {
+		go func() {
+			for {
+				i := int(atomic.AddInt32(&next, 1))
+				if i >= len(list) || g.isStopped() {
+					return
+				}
+				s := &g.streams[i]
+				s.err = g.read(ctx, list[i], s.batches)
+				close(s.batches)
+			}
+		}()
+	}
+}
+
+func (g *gatherer) isStopped() bool {
+	select {
+	case <-g.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// read 读取一个 partition 的批, 调用者读取得慢时会等待
+func (g *gatherer) read(ctx Context, q Query, out chan<- *Batch) (err error) {
+	defer func() {
+		if o := recover(); o != nil {
+			err = fmt.Errorf("read partition fail: %v", o)
+		}
+	}()
+
+	next := q.Batches()
+	for !g.isStopped() {
+		b, e := next(ctx)
+		if e != nil {
+			if !IsNoRows(e) {
+				return e
+			}
+			return nil
+		}
+		select {
+		case out <- b:
+		case <-g.stopped:
+			return nil
+		}
+	}
+	return nil
+}
+
+// batchesWithStop 返回 q 的批和停止读取的函数, q 的 partition 并发地读取时
+// stop 会结束读取 partition 的 goroutine
+func (q Query) batchesWithStop() (BatchIterator, func()) {
+	if q.Partitions != nil && q.Partitions.Parallelism > 1 {
+		g := newGatherer(q.Partitions)
+		return g.next, func() { g.Close() }
+	}
+	return q.Batches(), func() {}
+}
+
+// forEachPartition 最多 parallelism 个 goroutine 并发地对各个 partition 执行
+// f, 返回第一个 partition 的错误
+func forEachPartition(list []Query, parallelism int, f func(int, Query) error) error {
+	errs := make([]error, len(list))
+	if parallelism > len(list) {
+		parallelism = len(list)
+	}
+
+	var wait sync.WaitGroup
+	var next int32 = -1
+	for w := 0; w < parallelism; w++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for {
+				i := int(atomic.AddInt32(&next, 1))
+				if i >= len(list) {
+					return
+				}
+				errs[i] = callPartition(f, i, list[i])
+			}
+		}()
+	}
+	wait.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func callPartition(f func(int, Query) error, i int, q Query) (err error) {
+	defer func() {
+		if o := recover(); o != nil {
+			err = fmt.Errorf("read partition fail: %v", o)
+		}
+	}()
+	return f(i, q)
+}
@@ -0,0 +1,252 @@
+package memcore
+
+import (
+	"errors"
+	"io"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/memsql/vm"
+)
+
+func makePartitions(parallelism int, sizes ...int) *Partitions {
+	return &Partitions{
+		Parallelism: parallelism,
+		Get: func() ([]Query, error) {
+			var list []Query
+			start := 0
+			for _, size := range sizes {
+				table := makeTable(start + size)
+				table.Records = table.Records[start:]
+				list = append(list, FromWithTags(table, KeyValues{{Key: "start", Value: strconv.Itoa(start)}}))
+				start += size
+			}
+			return list, nil
+		},
+	}
+}
+
+func TestPartitions(t *testing.T) {
+	p := makeBatchProgram()
+	want, err := From(makeTable(6000)).WhereBatch(p.FilterBatch).Results(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, parallelism := range []int{0, 1, 3, 10} {
+		q := FromPartitions(makePartitions(parallelism, 1500, 0, 2000, 10, 2490)).WhereBatch(p.FilterBatch)
+		if q.Partitions == nil {
+			t.Error("partitions is missing")
+		}
+		if gathered := q.Gather(); gathered.Partitions != nil {
+			t.Error("partitions isnot gathered")
+		}
+
+		for _, iterate := range []func() ([]Record, error){
+			func() ([]Record, error) { return q.Results(nil) },
+			func() ([]Record, error) { return FromBatches(q.IterateBatch).Results(nil) },
+		} {
+			results, err := iterate()
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+			if len(results) != len(want) {
+				t.Error(parallelism, "want", len(want), "got", len(results))
+				continue
+			}
+			for idx := range results {
+				if results[idx].Values[0] != want[idx].Values[0] {
+					t.Error(parallelism, idx, results[idx].GoString())
+					break
+				}
+			}
+		}
+
+		results, err := q.TakeBatch(10).Results(nil)
+		if err != nil || len(results) != 10 {
+			t.Error(parallelism, len(results), err)
+		}
+	}
+}
+
+func TestPartitionsError(t *testing.T) {
+	fail := errors.New("fail")
+	partitions := &Partitions{
+		Parallelism: 4,
+		Get: func() ([]Query, error) {
+			return []Query{
+				From(makeTable(100)),
+				FromBatches(func() BatchIterator {
+					return func(Context) (*Batch, error) {
+						return nil, fail
+					}
+				}),
+				From(makeTable(100)),
+			}, nil
+		},
+	}
+
+	results, err := FromPartitions(partitions).Results(nil)
+	if err != fail || len(results) != 100 {
+		t.Error(len(results), err)
+	}
+
+	_, err = FromPartitions(&Partitions{
+		Parallelism: 4,
+		Get: func() ([]Query, error) {
+			return nil, fail
+		},
+	}).Results(nil)
+	if err != fail {
+		t.Error(err)
+	}
+}
+
+func TestAggregatePartitions(t *testing.T) {
+	sum := NewProgram(func() *vm.Program {
+		var p vm.Program
+		p.Emit(vm.OpColumn, p.AddColumn("", "c2"))
+		return &p
+	}(), false)
+
+	factories := []AggregatorFactory{
+		ProgramAggregatorFunc(vm.AggFuncs["sum"], sum),
+		ProgramAggregatorFunc(vm.AggFuncs["avg"], sum),
+		ProgramAggregatorFunc(vm.AggFuncs["count"], sum),
+	}
+	names := []string{"sum", "avg", "count"}
+	if !isMergeable(createAggregators(factories)) {
+		t.Fatal("aggregators isnot mergeable")
+	}
+
+	want, err := From(makeTable(6000)).AggregateWithBatch(names, factories).Results(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, parallelism := range []int{1, 4} {
+		got, err := FromPartitions(makePartitions(parallelism, 1500, 0, 2000, 2500)).
+			AggregateWithBatch(names, factories).Results(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || len(want) != 1 {
+			t.Fatal(got, want)
+		}
+		if got[0].GoString() != want[0].GoString() {
+			t.Error("want", want[0].GoString(), "got", got[0].GoString())
+		}
+	}
+}
+
+func TestJoinParallel(t *testing.T) {
+	keys := func(ctx Context, b *Batch, keys []Value) error {
+		copy(keys, b.Vectors[0])
+		return nil
+	}
+	resultSelector := func(outer Record, inner Record) Record {
+		if inner.Columns == nil {
+			inner = Record{Columns: outer.Columns[:1], Values: []Value{vm.Null()}}
+		}
+		return Record{
+			Columns: append(append([]Column{}, outer.Columns[:1]...), inner.Columns[:1]...),
+			Values:  append(append([]Value{}, outer.Values[:1]...), inner.Values[:1]...),
+		}
+	}
+	innerKey := func(r Record) (Value, error) { return r.Values[1], nil }
+
+	inner := FromPartitions(makePartitions(4, 3, 5, 2))
+	want := toSlice(From(makeTable(20)).JoinBatch(true, inner, keys, innerKey, resultSelector))
+	if len(want) != 20 {
+		t.Fatal(want)
+	}
+	q := From(makeTable(20)).JoinParallel(true, inner, BatchKeys(func(r Record) (Value, error) {
+		return r.Values[0], nil
+	}), innerKey, resultSelector)
+	if !validateQuery(q, want) {
+		t.Errorf("From().JoinParallel()=%v expected %v", toSlice(q), want)
+	}
+}
+
+// endlessPartitions 返回 n 个不会结束的 partition, read 记录读取的批数
+func endlessPartitions(n int, read *int32) *Partitions {
+	return &Partitions{
+		Parallelism: 4,
+		Get: func() ([]Query, error) {
+			list := make([]Query, n)
+			for i := range list {
+				list[i] = FromBatches(func() BatchIterator {
+					return func(Context) (*Batch, error) {
+						atomic.AddInt32(read, 1)
+						b := NewBatch(nil, []Column{{Name: "c1"}}, 1)
+						b.Append([]Value{vm.IntToValue(1)})
+						return b, nil
+					}
+				})
+			}
+			return list, nil
+		},
+	}
+}
+
+// waitGoroutines 等待 goroutine 的个数回到 count
+func waitGoroutines(t *testing.T, count int) {
+	for i := 0; i < 100; i++ {
+		if runtime.NumGoroutine() <= count {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("goroutines isnot stopped, want", count, "got", runtime.NumGoroutine())
+}
+
+type closingContext struct {
+	closers []io.Closer
+}
+
+func (ctx *closingContext) OnClosing(closers ...io.Closer) {
+	ctx.closers = append(ctx.closers, closers...)
+}
+
+func TestPartitionsStop(t *testing.T) {
+	count := runtime.NumGoroutine()
+
+	var read int32
+	results, err := FromPartitions(endlessPartitions(10, &read)).TakeBatch(3).Results(nil)
+	if err != nil || len(results) != 3 {
+		t.Fatal(len(results), err)
+	}
+	waitGoroutines(t, count)
+	if n := atomic.LoadInt32(&read); n > 4*(partitionBuffer+2) {
+		t.Error("too many batches are read", n)
+	}
+
+	results, err = FromPartitions(endlessPartitions(10, &read)).Take(3).Results(nil)
+	if err != nil || len(results) != 3 {
+		t.Fatal(len(results), err)
+	}
+	waitGoroutines(t, count)
+
+	// 放弃读取时由 ClosingContext 结束 goroutine
+	ctx := &closingContext{}
+	next := FromPartitions(endlessPartitions(10, &read)).Batches()
+	if _, err := next(ctx); err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&read, 0)
+	time.Sleep(20 * time.Millisecond)
+	if n := atomic.LoadInt32(&read); n > 4*(partitionBuffer+2) {
+		t.Error("too many batches are read", n)
+	}
+	if len(ctx.closers) != 1 {
+		t.Fatal("closer isnot registered")
+	}
+	ctx.closers[0].Close()
+	waitGoroutines(t, count)
+	if _, err := next(ctx); !IsNoRows(err) {
+		t.Error("want ErrNoRows got", err)
+	}
+}
@@ -0,0 +1,76 @@
+package memcore
+
+import (
+	"sync/atomic"
+
+	"github.com/runner-mei/memsql/vm"
+)
+
+// Program runs a compiled expression on the records, the columns of the
+// expression are resolved to the slots of the record once for the columns
+// of the records, the records of a table share the same columns.
+type Program struct {
+	*vm.Program
+
+	withQualifier bool
+	binding       atomic.Value
+}
+
+type slotBinding struct {
+	columns []Column
+	slots   []int
+}
+
+func NewProgram(p *vm.Program, withQualifier bool) *Program {
+	return &Program{Program: p, withQualifier: withQualifier}
+}
+
+// Slots returns the slots of the columns of the program in the columns, -1
+// means the column isnot found and it is read from the tags.
+func (p *Program) Slots(columns []Column) []int {
+	if binding, ok := p.binding.Load().(*slotBinding); ok && equalColumns(binding.columns, columns) {
+		return binding.slots
+	}
+
+	slots := make([]int, len(p.Columns))
+	for idx, ref := range p.Columns {
+		if p.withQualifier {
+			slots[idx] = columnSearchByQualifierName(columns, ref.Table, ref.Name)
+		} else {
+			slots[idx] = columnSearchByName(columns, ref.Name)
+		}
+	}
+	p.binding.Store(&slotBinding{columns: columns, slots: slots})
+	return slots
+}
+
+func (p *Program) Run(r *Record) (Value, error) {
+	return p.Program.Run(ToRecordValuer(r, p.withQualifier), r.Values, p.Slots(r.Columns))
+}
+
+func (p *Program) Filter(r *Record) (bool, error) {
+	return p.Program.Filter(ToRecordValuer(r, p.withQualifier), r.Values, p.Slots(r.Columns))
+}
+
+// RunBatch runs the program for the rows of the batch, the results are
+// stored in out.
+func (p *Program) RunBatch(b *Batch, out []Value) error {
+	return p.Program.RunBatch(b.Length, b.Vectors, p.Slots(b.Columns), b.rowContext(p.withQualifier), out)
+}
+
+// FilterBatch runs the program as the predicate of the rows of the batch,
+// Unknown is false, see WhereBatch.
+func (p *Program) FilterBatch(ctx Context, b *Batch, keep []bool) error {
+	values := make([]Value, b.Length)
+	if err := p.RunBatch(b, values); err != nil {
+		return err
+	}
+	for i := range values {
+		t, err := vm.ToTruth(values[i])
+		if err != nil {
+			return err
+		}
+		keep[i] = t == vm.True
+	}
+	return nil
+}
@@ -310,6 +310,24 @@ func RenameTableToAlias(alias string) func(Context, Record) (Record, error) {
 	}
 }
 
+// RenameBatchToAlias is same as RenameTableToAlias but it renames the
+// columns of the batches, see SelectBatch.
+func RenameBatchToAlias(alias string) func(Context, *Batch) (*Batch, error) {
+	return func(ctx Context, b *Batch) (*Batch, error) {
+		columns := make([]Column, len(b.Columns))
+		copy(columns, b.Columns)
+		for idx := range columns {
+			columns[idx].TableAs = alias
+		}
+		return &Batch{
+			Tags:    b.Tags,
+			Columns: columns,
+			Vectors: b.Vectors,
+			Length:  b.Length,
+		}, nil
+	}
+}
+
 var _ encoding.TextMarshaler = &Record{}
 
 type recordValuer Record
@@ -369,8 +387,12 @@ func (set *RecordSet) Search(r Record) int {
 }
 
 func (set *RecordSet) Has(r Record) bool {
+	return set.HasWith(r, vm.EmptyCompareOption())
+}
+
+func (set *RecordSet) HasWith(r Record, opt vm.CompareOption) bool {
 	for _, a := range *set {
-		ok, _ := a.EqualTo(r, vm.EmptyCompareOption())
+		ok, _ := a.EqualTo(r, opt)
 		if ok {
 			return true
 		}
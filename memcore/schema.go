@@ -0,0 +1,123 @@
+package memcore
+
+import (
+	"strconv"
+
+	"github.com/runner-mei/errors"
+	"github.com/runner-mei/memsql/vm"
+)
+
+// ColumnSchema declares the type of a column. Default is used when the value
+// is null or the column is missing, a null Default means no default.
+// Collation is used to compare the strings of the column, CollationBinary
+// means the collation of the session.
+type ColumnSchema struct {
+	Name      string
+	Type      vm.ValueType
+	Nullable  bool
+	Default   Value
+	Collation vm.Collation
+}
+
+// TableSchema declares all the columns of a table, the values of a table are
+// coerced to the declared types on Storage.Set.
+type TableSchema struct {
+	Columns []ColumnSchema
+}
+
+// SchemaStorage is implemented by the Storage which saves the schemas of the
+// tables, the records are coerced to the declared types when they are saved.
+type SchemaStorage interface {
+	// SetSchema coerces the records of the table to the schema, it is
+	// removed if schema is nil.
+	SetSchema(name string, schema *TableSchema) error
+
+	Schema(name string) (*TableSchema, bool)
+}
+
+func (schema *TableSchema) Column(name string) (*ColumnSchema, bool) {
+	for idx := range schema.Columns {
+		if schema.Columns[idx].Name == name {
+			return &schema.Columns[idx], true
+		}
+	}
+	return nil, false
+}
+
+func (schema *TableSchema) Validate() error {
+	for idx := range schema.Columns {
+		column := &schema.Columns[idx]
+		if column.Name == "" {
+			return errors.New("name of the column with index is '" + strconv.Itoa(idx) + "' is empty")
+		}
+		for i := 0; i < idx; i++ {
+			if schema.Columns[i].Name == column.Name {
+				return errors.New("column '" + column.Name + "' is duplicated")
+			}
+		}
+		if column.Default.IsNull() {
+			continue
+		}
+		value, err := vm.ConvertValue(column.Default, column.Type)
+		if err != nil {
+			return errors.Wrap(err, "default value of the column '"+column.Name+"' is invalid")
+		}
+		column.Default = value
+	}
+	return nil
+}
+
+// Apply coerces the values of the table to the declared types, the missing
+// columns are filled with the default values.
+func (schema *TableSchema) Apply(table Table) (Table, error) {
+	for idx := range table.Columns {
+		if _, ok := schema.Column(table.Columns[idx].Name); !ok {
+			return Table{}, errors.New("column '" + table.Columns[idx].Name + "' isnot declared in the schema")
+		}
+	}
+
+	var result = Table{
+		Columns: make([]Column, len(schema.Columns)),
+		Records: make([][]Value, len(table.Records)),
+	}
+	var indexes = make([]int, len(schema.Columns))
+	for idx := range schema.Columns {
+		result.Columns[idx] = Column{Name: schema.Columns[idx].Name}
+		indexes[idx] = columnSearchByName(table.Columns, schema.Columns[idx].Name)
+		if indexes[idx] >= 0 {
+			result.Columns[idx].TableName = table.Columns[indexes[idx]].TableName
+			result.Columns[idx].TableAs = table.Columns[indexes[idx]].TableAs
+		}
+	}
+
+	for row := range table.Records {
+		record := make([]Value, len(schema.Columns))
+		for idx := range schema.Columns {
+			column := &schema.Columns[idx]
+
+			value := vm.Null()
+			// Columns 和 Values 的长度不一定一致, 看 ToTable
+			if indexes[idx] >= 0 && indexes[idx] < len(table.Records[row]) {
+				value = table.Records[row][indexes[idx]]
+			}
+			if value.IsNull() {
+				value = column.Default
+			}
+			if value.IsNull() {
+				if !column.Nullable {
+					return Table{}, errors.New("value of the column '" + column.Name + "' with index is '" + strconv.Itoa(row) + "' is null")
+				}
+				record[idx] = value
+				continue
+			}
+
+			converted, err := vm.ConvertValue(value, column.Type)
+			if err != nil {
+				return Table{}, errors.Wrap(err, "value '"+value.String()+"' of the column '"+column.Name+"' with index is '"+strconv.Itoa(row)+"' is invalid")
+			}
+			record[idx] = converted
+		}
+		result.Records[row] = record
+	}
+	return result, nil
+}
@@ -0,0 +1,159 @@
+package memcore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/runner-mei/memsql/vm"
+)
+
+func TestSchemaApply(t *testing.T) {
+	schema := &TableSchema{
+		Columns: []ColumnSchema{
+			{Name: "id", Type: vm.ValueInt64},
+			{Name: "name", Type: vm.ValueString, Nullable: true},
+			{Name: "ratio", Type: vm.ValueFloat64, Default: vm.StringToValue("0.5")},
+		},
+	}
+	if err := schema.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := ToTable([]map[string]interface{}{
+		{"id": "1", "name": "a"},
+		{"id": 2, "ratio": 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := schema.Apply(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, 3, len(result.Columns))
+	for idx, name := range []string{"id", "name", "ratio"} {
+		assertEqual(t, name, result.Columns[idx].Name)
+	}
+
+	for _, record := range result.Records {
+		assertEqual(t, vm.ValueInt64, record[0].Type)
+		assertEqual(t, vm.ValueFloat64, record[2].Type)
+	}
+	assertEqual(t, int64(1), result.Records[0][0].Int64)
+	assertEqual(t, 0.5, result.Records[0][2].Float64)
+	assertEqual(t, true, result.Records[1][1].IsNull())
+	assertEqual(t, 3.0, result.Records[1][2].Float64)
+
+	for _, test := range []map[string]interface{}{
+		{"id": "abc"},
+		{"name": "a"},
+		{"id": 1, "unknown": 1},
+	} {
+		table, err := ToTable([]map[string]interface{}{test})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := schema.Apply(table); err == nil {
+			t.Error("want error got ok -", test)
+		}
+	}
+}
+
+func TestSchemaApplyExactly(t *testing.T) {
+	schema := &TableSchema{
+		Columns: []ColumnSchema{
+			{Name: "id", Type: vm.ValueInt64, Nullable: true},
+			{Name: "count", Type: vm.ValueUint64, Nullable: true},
+			{Name: "enabled", Type: vm.ValueBool, Nullable: true},
+		},
+	}
+
+	table, err := ToTable([]map[string]interface{}{
+		{"id": 2.0, "count": "3", "enabled": "TRUE"},
+		{"id": uint64(4), "count": 5, "enabled": "0"},
+		{"enabled": 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := schema.Apply(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, int64(2), result.Records[0][0].Int64)
+	assertEqual(t, uint64(3), result.Records[0][1].Uint64)
+	assertEqual(t, true, result.Records[0][2].BoolValue())
+	assertEqual(t, int64(4), result.Records[1][0].Int64)
+	assertEqual(t, false, result.Records[1][2].BoolValue())
+	assertEqual(t, true, result.Records[2][2].BoolValue())
+
+	for _, test := range []map[string]interface{}{
+		{"id": 1.5},
+		{"id": 1e19},
+		{"id": uint64(1) << 63},
+		{"count": -1},
+		{"count": 2.5},
+		{"enabled": "yes"},
+		{"enabled": "false1"},
+		{"enabled": 2},
+		{"enabled": 1.0},
+	} {
+		table, err := ToTable([]map[string]interface{}{test})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := schema.Apply(table); err == nil {
+			t.Error("want error got ok -", test)
+		}
+	}
+}
+
+func TestStorageSchema(t *testing.T) {
+	s := NewStorage()
+
+	table, err := ToTable([]map[string]interface{}{
+		{"id": "1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("t1", nil, time.Now(), table, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.(SchemaStorage).SetSchema("t1", &TableSchema{
+		Columns: []ColumnSchema{
+			{Name: "id", Type: vm.ValueInt64},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := s.(SchemaStorage).Schema("t1"); !ok {
+		t.Error("schema isnot found")
+	}
+
+	records, err := s.From(mkCtx(), "t1", func(GetValuer) (bool, error) { return true, nil }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := records.Results(mkCtx())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 1, len(results))
+	assertEqual(t, vm.ValueInt64, results[0].Values[0].Type)
+
+	table, err = ToTable([]map[string]interface{}{
+		{"id": "abc"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("t1", nil, time.Now(), table, nil); err == nil {
+		t.Error("want error got ok")
+	}
+}
@@ -38,3 +38,28 @@ func (q Query) Select(selector func(int, Record) (Record, error)) Query {
 		},
 	}
 }
+
+// SelectBatch projects each batch of a collection into a new batch, the
+// result must have the same number of the rows as the batch.
+//
+// selector runs in the partitions of q concurrently if q has the partitions,
+// see Partitions.
+func (q Query) SelectBatch(selector func(Context, *Batch) (*Batch, error)) Query {
+	return q.mapPartitions(func(q Query) Query {
+		return q.selectBatch(selector)
+	})
+}
+
+func (q Query) selectBatch(selector func(Context, *Batch) (*Batch, error)) Query {
+	return FromBatches(func() BatchIterator {
+		next := q.Batches()
+
+		return func(ctx Context) (*Batch, error) {
+			b, err := next(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return selector(ctx, b)
+		}
+	})
+}
@@ -0,0 +1,858 @@
+package memcore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/runner-mei/errors"
+	"github.com/runner-mei/memsql/vm"
+)
+
+const (
+	snapshotMagic   = "MSQL"
+	snapshotVersion = 1
+
+	// SnapshotFilename is the name of the snapshot file in the directory
+	SnapshotFilename = "memsql.snapshot"
+)
+
+// SnapshotStorage is implemented by the Storage which can save all the
+// measurements and schemas to a stream and load them back.
+type SnapshotStorage interface {
+	Storage
+
+	Save(w io.Writer) error
+	Load(r io.Reader) error
+}
+
+// snapshotMeta 是快照中除 measurement 之外的内容
+type snapshotMeta struct {
+	schemas map[string]*TableSchema
+	views   []View
+}
+
+type snapshotMeasurement struct {
+	table    string
+	tags     KeyValues
+	dataTime time.Time
+	errTime  time.Time
+	err      error
+	data     Table
+}
+
+type snapshotEncoder struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func (enc *snapshotEncoder) write(bs []byte) {
+	if enc.err != nil {
+		return
+	}
+	_, enc.err = enc.w.Write(bs)
+}
+
+func (enc *snapshotEncoder) writeByte(b byte) {
+	if enc.err != nil {
+		return
+	}
+	enc.err = enc.w.WriteByte(b)
+}
+
+func (enc *snapshotEncoder) writeUvarint(u uint64) {
+	n := binary.PutUvarint(enc.buf[:], u)
+	enc.write(enc.buf[:n])
+}
+
+func (enc *snapshotEncoder) writeVarint(i int64) {
+	n := binary.PutVarint(enc.buf[:], i)
+	enc.write(enc.buf[:n])
+}
+
+func (enc *snapshotEncoder) writeString(s string) {
+	enc.writeUvarint(uint64(len(s)))
+	if enc.err != nil {
+		return
+	}
+	_, enc.err = enc.w.WriteString(s)
+}
+
+func (enc *snapshotEncoder) writeTime(t time.Time) {
+	if t.IsZero() {
+		enc.writeByte(0)
+		return
+	}
+	enc.writeByte(1)
+	enc.writeVarint(t.UnixNano())
+}
+
+func (enc *snapshotEncoder) writeValue(value Value) {
+	enc.writeByte(byte(value.Type))
+	switch value.Type {
+	case vm.ValueNull:
+	case vm.ValueBool:
+		if value.BoolValue() {
+			enc.writeByte(1)
+		} else {
+			enc.writeByte(0)
+		}
+	case vm.ValueString:
+		enc.writeString(value.Str)
+	case vm.ValueDecimal:
+		enc.writeString(value.String())
+	case vm.ValueInt64:
+		enc.writeVarint(value.Int64)
+	case vm.ValueDatetime:
+		enc.writeVarint(value.Int64)
+		// 时区为空表示 DatetimeIn 没有设置时区
+		if value.Location == nil {
+			enc.writeString("")
+		} else {
+			enc.writeString(value.Location.String())
+		}
+	case vm.ValueInterval:
+		enc.writeVarint(value.Int64)
+		enc.writeVarint(int64(value.Months))
+		enc.writeVarint(int64(value.Days))
+	case vm.ValueUint64:
+		enc.writeUvarint(value.Uint64)
+	case vm.ValueFloat64:
+		binary.LittleEndian.PutUint64(enc.buf[:8], math.Float64bits(value.Float64))
+		enc.write(enc.buf[:8])
+	case vm.ValueAny:
+		enc.writeAny(value.Any)
+	case vm.ValueJSON:
+		bs, err := json.Marshal(value.Any)
+		if err != nil {
+			if enc.err == nil {
+				enc.err = errors.Wrap(err, "encode value '"+value.String()+"' fail")
+			}
+			return
+		}
+		enc.writeUvarint(uint64(len(bs)))
+		enc.write(bs)
+	default:
+		if enc.err == nil {
+			enc.err = errors.New("encode value fail: unknown type '" + value.Type.String() + "'")
+		}
+	}
+}
+
+// any 中值的类型, json 会把整数和浮点数都读为 float64
+const (
+	anyNull = iota
+	anyBool
+	anyString
+	anyInt
+	anyUint
+	anyFloat
+	anyArray
+	anyObject
+)
+
+func (enc *snapshotEncoder) writeAny(v interface{}) {
+	switch x := v.(type) {
+	case nil:
+		enc.writeByte(anyNull)
+	case bool:
+		enc.writeByte(anyBool)
+		if x {
+			enc.writeByte(1)
+		} else {
+			enc.writeByte(0)
+		}
+	case string:
+		enc.writeByte(anyString)
+		enc.writeString(x)
+	case int:
+		enc.writeByte(anyInt)
+		enc.writeVarint(int64(x))
+	case int8:
+		enc.writeByte(anyInt)
+		enc.writeVarint(int64(x))
+	case int16:
+		enc.writeByte(anyInt)
+		enc.writeVarint(int64(x))
+	case int32:
+		enc.writeByte(anyInt)
+		enc.writeVarint(int64(x))
+	case int64:
+		enc.writeByte(anyInt)
+		enc.writeVarint(x)
+	case uint:
+		enc.writeByte(anyUint)
+		enc.writeUvarint(uint64(x))
+	case uint8:
+		enc.writeByte(anyUint)
+		enc.writeUvarint(uint64(x))
+	case uint16:
+		enc.writeByte(anyUint)
+		enc.writeUvarint(uint64(x))
+	case uint32:
+		enc.writeByte(anyUint)
+		enc.writeUvarint(uint64(x))
+	case uint64:
+		enc.writeByte(anyUint)
+		enc.writeUvarint(x)
+	case float32:
+		enc.writeFloat(float64(x))
+	case float64:
+		enc.writeFloat(x)
+	case []interface{}:
+		enc.writeByte(anyArray)
+		enc.writeUvarint(uint64(len(x)))
+		for _, item := range x {
+			enc.writeAny(item)
+		}
+	case map[string]interface{}:
+		enc.writeByte(anyObject)
+		keys := make([]string, 0, len(x))
+		for key := range x {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		enc.writeUvarint(uint64(len(keys)))
+		for _, key := range keys {
+			enc.writeString(key)
+			enc.writeAny(x[key])
+		}
+	default:
+		if enc.err == nil {
+			enc.err = fmt.Errorf("encode value fail: type '%T' is unsupported", v)
+		}
+	}
+}
+
+func (enc *snapshotEncoder) writeFloat(f float64) {
+	enc.writeByte(anyFloat)
+	binary.LittleEndian.PutUint64(enc.buf[:8], math.Float64bits(f))
+	enc.write(enc.buf[:8])
+}
+
+func (enc *snapshotEncoder) writeSchema(schema *TableSchema) {
+	enc.writeUvarint(uint64(len(schema.Columns)))
+	for idx := range schema.Columns {
+		column := &schema.Columns[idx]
+		enc.writeString(column.Name)
+		enc.writeByte(byte(column.Type))
+		var flags byte
+		if column.Nullable {
+			flags |= 1
+		}
+		enc.writeByte(flags)
+		enc.writeByte(byte(column.Collation))
+		enc.writeValue(column.Default)
+	}
+}
+
+func (enc *snapshotEncoder) writeView(view *View) {
+	enc.writeString(view.Name)
+	enc.writeString(view.Query)
+	enc.writeVarint(int64(view.Interval))
+}
+
+func (enc *snapshotEncoder) writeMeasurement(m *snapshotMeasurement) {
+	enc.writeString(m.table)
+	enc.writeUvarint(uint64(len(m.tags)))
+	for _, tag := range m.tags {
+		enc.writeString(tag.Key)
+		enc.writeString(tag.Value)
+	}
+	enc.writeTime(m.dataTime)
+	enc.writeTime(m.errTime)
+	if m.err != nil {
+		enc.writeByte(1)
+		enc.writeString(m.err.Error())
+	} else {
+		enc.writeByte(0)
+	}
+
+	enc.writeUvarint(uint64(len(m.data.Columns)))
+	for _, column := range m.data.Columns {
+		enc.writeString(column.Name)
+	}
+	enc.writeUvarint(uint64(len(m.data.Records)))
+	for _, record := range m.data.Records {
+		enc.writeUvarint(uint64(len(record)))
+		for _, value := range record {
+			enc.writeValue(value)
+		}
+	}
+}
+
+// snapshotReader 记录剩余的字节数, 读取的长度不能大于它
+type snapshotReader struct {
+	r         *bufio.Reader
+	remaining int64
+}
+
+func (r *snapshotReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.remaining--
+	}
+	return b, err
+}
+
+func (r *snapshotReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.remaining -= int64(n)
+	return n, err
+}
+
+type snapshotDecoder struct {
+	r   *snapshotReader
+	err error
+}
+
+// newSnapshotDecoder 中 size 是 r 的字节数
+func newSnapshotDecoder(r io.Reader, size int64) *snapshotDecoder {
+	return &snapshotDecoder{
+		r: &snapshotReader{r: bufio.NewReader(r), remaining: size},
+	}
+}
+
+func (dec *snapshotDecoder) fail(err error) {
+	if dec.err == nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		dec.err = err
+	}
+}
+
+func (dec *snapshotDecoder) readByte() byte {
+	if dec.err != nil {
+		return 0
+	}
+	b, err := dec.r.ReadByte()
+	if err != nil {
+		dec.fail(err)
+	}
+	return b
+}
+
+func (dec *snapshotDecoder) readUvarint() uint64 {
+	if dec.err != nil {
+		return 0
+	}
+	u, err := binary.ReadUvarint(dec.r)
+	if err != nil {
+		dec.fail(err)
+	}
+	return u
+}
+
+func (dec *snapshotDecoder) readVarint() int64 {
+	if dec.err != nil {
+		return 0
+	}
+	i, err := binary.ReadVarint(dec.r)
+	if err != nil {
+		dec.fail(err)
+	}
+	return i
+}
+
+// readLength 读取字节数或个数, 每个元素至少有一个字节, 所以它不能大于剩余
+// 的字节数
+func (dec *snapshotDecoder) readLength() int {
+	u := dec.readUvarint()
+	if dec.err != nil {
+		return 0
+	}
+	if u > math.MaxInt32 || u > uint64(dec.r.remaining) {
+		dec.fail(errors.New("decode snapshot fail: length '" + strconv.FormatUint(u, 10) + "' is larger than the remaining input"))
+		return 0
+	}
+	return int(u)
+}
+
+func (dec *snapshotDecoder) readBytes() []byte {
+	n := dec.readLength()
+	if dec.err != nil {
+		return nil
+	}
+	bs := make([]byte, n)
+	if _, err := io.ReadFull(dec.r, bs); err != nil {
+		dec.fail(err)
+		return nil
+	}
+	return bs
+}
+
+func (dec *snapshotDecoder) readString() string {
+	return string(dec.readBytes())
+}
+
+func (dec *snapshotDecoder) readTime() time.Time {
+	if dec.readByte() == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, dec.readVarint())
+}
+
+func (dec *snapshotDecoder) readValue() Value {
+	typ := vm.ValueType(dec.readByte())
+	switch typ {
+	case vm.ValueNull:
+		return vm.Null()
+	case vm.ValueBool:
+		return vm.BoolToValue(dec.readByte() != 0)
+	case vm.ValueString:
+		return vm.StringToValue(dec.readString())
+	case vm.ValueDecimal:
+		s := dec.readString()
+		if dec.err != nil {
+			return vm.Null()
+		}
+		d, err := vm.ParseDecimal(s)
+		if err != nil {
+			dec.fail(errors.Wrap(err, "decode value fail"))
+			return vm.Null()
+		}
+		return vm.DecimalToValue(d)
+	case vm.ValueInt64:
+		return vm.IntToValue(dec.readVarint())
+	case vm.ValueDatetime:
+		value := Value{Type: vm.ValueDatetime, Int64: dec.readVarint()}
+		name := dec.readString()
+		if dec.err != nil || name == "" {
+			return value
+		}
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			dec.fail(errors.Wrap(err, "decode value fail"))
+			return vm.Null()
+		}
+		return vm.DatetimeIn(value, loc)
+	case vm.ValueInterval:
+		value := Value{Type: vm.ValueInterval, Int64: dec.readVarint()}
+		months := dec.readVarint()
+		days := dec.readVarint()
+		return vm.CalendarIntervalToValue(int32(months), int32(days), vm.IntToInterval(value.Int64))
+	case vm.ValueUint64:
+		return vm.UintToValue(dec.readUvarint())
+	case vm.ValueFloat64:
+		var buf [8]byte
+		if dec.err == nil {
+			if _, err := io.ReadFull(dec.r, buf[:]); err != nil {
+				dec.fail(err)
+			}
+		}
+		return vm.FloatToValue(math.Float64frombits(binary.LittleEndian.Uint64(buf[:])))
+	case vm.ValueAny:
+		v := dec.readAny()
+		if dec.err != nil {
+			return vm.Null()
+		}
+		return vm.AnyToValue(v)
+	case vm.ValueJSON:
+		bs := dec.readBytes()
+		if dec.err != nil {
+			return vm.Null()
+		}
+		value, err := vm.ParseJSON(string(bs))
+		if err != nil {
+			dec.fail(errors.Wrap(err, "decode value fail"))
+			return vm.Null()
+		}
+		return value
+	default:
+		dec.fail(errors.New("decode value fail: unknown type '" + strconv.Itoa(int(typ)) + "'"))
+		return vm.Null()
+	}
+}
+
+func (dec *snapshotDecoder) readAny() interface{} {
+	switch typ := dec.readByte(); typ {
+	case anyNull:
+		return nil
+	case anyBool:
+		return dec.readByte() != 0
+	case anyString:
+		return dec.readString()
+	case anyInt:
+		return dec.readVarint()
+	case anyUint:
+		return dec.readUvarint()
+	case anyFloat:
+		var buf [8]byte
+		if dec.err == nil {
+			if _, err := io.ReadFull(dec.r, buf[:]); err != nil {
+				dec.fail(err)
+			}
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(buf[:]))
+	case anyArray:
+		array := make([]interface{}, dec.readLength())
+		for idx := range array {
+			array[idx] = dec.readAny()
+		}
+		return array
+	case anyObject:
+		count := dec.readLength()
+		object := make(map[string]interface{}, count)
+		for i := 0; i < count && dec.err == nil; i++ {
+			key := dec.readString()
+			object[key] = dec.readAny()
+		}
+		return object
+	default:
+		dec.fail(errors.New("decode value fail: unknown type '" + strconv.Itoa(int(typ)) + "' of any"))
+		return nil
+	}
+}
+
+func (dec *snapshotDecoder) readSchema() *TableSchema {
+	schema := &TableSchema{}
+	count := dec.readLength()
+	for i := 0; i < count && dec.err == nil; i++ {
+		var column ColumnSchema
+		column.Name = dec.readString()
+		column.Type = vm.ValueType(dec.readByte())
+		flags := dec.readByte()
+		column.Nullable = flags&1 != 0
+		column.Collation = vm.Collation(dec.readByte())
+		column.Default = dec.readValue()
+		schema.Columns = append(schema.Columns, column)
+	}
+	return schema
+}
+
+func (dec *snapshotDecoder) readView() *View {
+	view := &View{}
+	view.Name = dec.readString()
+	view.Query = dec.readString()
+	view.Interval = time.Duration(dec.readVarint())
+	return view
+}
+
+func (dec *snapshotDecoder) readMeasurement() *snapshotMeasurement {
+	m := &snapshotMeasurement{}
+	m.table = dec.readString()
+
+	count := dec.readLength()
+	for i := 0; i < count && dec.err == nil; i++ {
+		key := dec.readString()
+		value := dec.readString()
+		m.tags = append(m.tags, KeyValue{Key: key, Value: value})
+	}
+	m.dataTime = dec.readTime()
+	m.errTime = dec.readTime()
+	if dec.readByte() != 0 {
+		m.err = errors.New(dec.readString())
+	}
+
+	count = dec.readLength()
+	for i := 0; i < count && dec.err == nil; i++ {
+		m.data.Columns = append(m.data.Columns, Column{TableName: m.table, Name: dec.readString()})
+	}
+	count = dec.readLength()
+	for i := 0; i < count && dec.err == nil; i++ {
+		record := make([]Value, dec.readLength())
+		for j := range record {
+			record[j] = dec.readValue()
+		}
+		m.data.Records = append(m.data.Records, record)
+	}
+	return m
+}
+
+func writeSnapshot(w io.Writer, meta snapshotMeta, measurements []*snapshotMeasurement) error {
+	enc := &snapshotEncoder{w: bufio.NewWriter(w)}
+	enc.write([]byte(snapshotMagic))
+	enc.writeUvarint(snapshotVersion)
+
+	var names = make([]string, 0, len(meta.schemas))
+	for name := range meta.schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	enc.writeUvarint(uint64(len(names)))
+	for _, name := range names {
+		enc.writeString(name)
+		enc.writeSchema(meta.schemas[name])
+	}
+
+	enc.writeUvarint(uint64(len(meta.views)))
+	for idx := range meta.views {
+		enc.writeView(&meta.views[idx])
+	}
+
+	enc.writeUvarint(uint64(len(measurements)))
+	for _, m := range measurements {
+		enc.writeMeasurement(m)
+	}
+	if enc.err != nil {
+		return enc.err
+	}
+	return enc.w.Flush()
+}
+
+// snapshotInput 返回 r 中剩余的字节数, 不能确定时读取全部的内容
+func snapshotInput(r io.Reader) (io.Reader, int64, error) {
+	switch v := r.(type) {
+	case interface{ Len() int }:
+		return r, int64(v.Len()), nil
+	case *os.File:
+		st, err := v.Stat()
+		if err == nil && st.Mode().IsRegular() {
+			offset, err := v.Seek(0, io.SeekCurrent)
+			if err == nil {
+				return r, st.Size() - offset, nil
+			}
+		}
+	}
+	bs, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bytes.NewReader(bs), int64(len(bs)), nil
+}
+
+func readSnapshot(r io.Reader) (snapshotMeta, []*snapshotMeasurement, error) {
+	var meta = snapshotMeta{schemas: map[string]*TableSchema{}}
+	r, size, err := snapshotInput(r)
+	if err != nil {
+		return meta, nil, errors.Wrap(err, "read snapshot fail")
+	}
+	dec := newSnapshotDecoder(r, size)
+
+	var magic [len(snapshotMagic)]byte
+	if _, err := io.ReadFull(dec.r, magic[:]); err != nil {
+		return meta, nil, errors.Wrap(err, "read snapshot fail")
+	}
+	if string(magic[:]) != snapshotMagic {
+		return meta, nil, errors.New("read snapshot fail: magic is invalid")
+	}
+	version := dec.readUvarint()
+	if dec.err == nil && version != snapshotVersion {
+		return meta, nil, errors.New("read snapshot fail: version '" + strconv.FormatUint(version, 10) + "' is unsupported")
+	}
+
+	count := dec.readLength()
+	for i := 0; i < count && dec.err == nil; i++ {
+		name := dec.readString()
+		meta.schemas[name] = dec.readSchema()
+	}
+
+	count = dec.readLength()
+	for i := 0; i < count && dec.err == nil; i++ {
+		meta.views = append(meta.views, *dec.readView())
+	}
+
+	var measurements []*snapshotMeasurement
+	count = dec.readLength()
+	for i := 0; i < count && dec.err == nil; i++ {
+		measurements = append(measurements, dec.readMeasurement())
+	}
+	if dec.err != nil {
+		return meta, nil, errors.Wrap(dec.err, "read snapshot fail")
+	}
+	return meta, measurements, nil
+}
+
+// snapshot 返回所有的 measurement, schema 和视图, measurement 只会被替换而
+// 不会被修改, 所以可以在锁之外读取它们
+func (ms *measurementSet) snapshot() ([]string, []*measurement, snapshotMeta) {
+	var names []string
+	var list []*measurement
+	for name, byKey := range ms.tables {
+		for _, m := range byKey {
+			names = append(names, name)
+			list = append(list, m)
+		}
+	}
+	return names, list, snapshotMeta{schemas: copySchemas(ms.schemas), views: ms.listViews()}
+}
+
+func (ms *measurementSet) save(w io.Writer, names []string, measurements []*measurement, meta snapshotMeta) error {
+	list := make([]*snapshotMeasurement, len(measurements))
+	for idx, m := range measurements {
+		list[idx] = &snapshotMeasurement{
+			table:    names[idx],
+			tags:     m.tags,
+			dataTime: m.dataTime,
+			errTime:  m.errTime,
+			err:      m.err,
+			data:     ms.toTable(m.data),
+		}
+	}
+	return writeSnapshot(w, meta, list)
+}
+
+func copySchemas(schemas map[string]*TableSchema) map[string]*TableSchema {
+	copyed := make(map[string]*TableSchema, len(schemas))
+	for name, schema := range schemas {
+		copyed[name] = schema
+	}
+	return copyed
+}
+
+// load 读取 snapshot, 返回一个新的 measurementSet
+func (ms *measurementSet) load(r io.Reader) (measurementSet, error) {
+	meta, list, err := readSnapshot(r)
+	if err != nil {
+		return measurementSet{}, err
+	}
+
+	loaded := newMeasurementSet(ms.toTable, ms.fromTable)
+	loaded.schemas = meta.schemas
+	for idx := range meta.views {
+		loaded.setView(meta.views[idx].Name, &meta.views[idx])
+	}
+	for _, m := range list {
+		sort.Sort(m.tags)
+		loaded.add(m.table, m.tags.ToKey(), &measurement{
+			tags:     m.tags,
+			dataTime: m.dataTime,
+			data:     ms.fromTable(m.data),
+			errTime:  m.errTime,
+			err:      m.err,
+		})
+	}
+	return loaded, nil
+}
+
+// Save writes all the measurements, schemas and views, the measurements are
+// replaced but not modified by Set, so they are written without the lock.
+func (s *storage) Save(w io.Writer) error {
+	s.mu.Lock()
+	names, list, meta := s.snapshot()
+	s.mu.Unlock()
+
+	return s.save(w, names, list, meta)
+}
+
+// Load replaces all the measurements, schemas and views with the snapshot
+func (s *storage) Load(r io.Reader) error {
+	loaded, err := s.load(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.measurementSet = loaded
+	return nil
+}
+
+// Save writes all the measurements, schemas and views, the measurements are
+// replaced but not modified by Set, so they are written without the lock.
+func (s *columnarStorage) Save(w io.Writer) error {
+	s.mu.Lock()
+	names, list, meta := s.snapshot()
+	s.mu.Unlock()
+
+	return s.save(w, names, list, meta)
+}
+
+// Load replaces all the measurements, schemas and views with the snapshot
+func (s *columnarStorage) Load(r io.Reader) error {
+	loaded, err := s.load(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.measurementSet = loaded
+	return nil
+}
+
+// SaveFile writes the snapshot to a temporary file and renames it to the
+// filename, so the old snapshot is replaced atomically.
+func SaveFile(s SnapshotStorage, filename string) error {
+	dir := filepath.Dir(filename)
+	tmp, err := ioutil.TempFile(dir, filepath.Base(filename)+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "create snapshot fail")
+	}
+	defer os.Remove(tmp.Name())
+
+	err = s.Save(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return errors.Wrap(err, "write snapshot '"+filename+"' fail")
+	}
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return errors.Wrap(err, "replace snapshot '"+filename+"' fail")
+	}
+	if err := syncDir(dir); err != nil {
+		return errors.Wrap(err, "replace snapshot '"+filename+"' fail")
+	}
+	return nil
+}
+
+// syncDir 对目录执行 fsync, 这样目录中文件的创建, 改名和删除在 crash 后不会丢失
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// LoadFile loads the snapshot from the file, it is ok if the file isnot exists.
+func LoadFile(s SnapshotStorage, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "open snapshot fail")
+	}
+	defer f.Close()
+
+	if err := s.Load(f); err != nil {
+		return errors.Wrap(err, "load snapshot '"+filename+"' fail")
+	}
+	return nil
+}
+
+// RunSnapshot saves the snapshot to the directory every interval until the
+// ctx is done, the last snapshot is saved before it returns.
+func RunSnapshot(ctx context.Context, s SnapshotStorage, dir string, interval time.Duration, onError func(error)) {
+	filename := filepath.Join(dir, SnapshotFilename)
+	save := func() {
+		if err := SaveFile(s, filename); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			save()
+			return
+		case <-ticker.C:
+			save()
+		}
+	}
+}
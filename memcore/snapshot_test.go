@@ -0,0 +1,184 @@
+package memcore
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/memsql/vm"
+)
+
+func TestSnapshot(t *testing.T) {
+	now := time.Unix(0, time.Now().UnixNano())
+	decimal, err := vm.ParseDecimal("-12345678901234567890.50")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := []Value{
+		vm.Null(),
+		vm.BoolToValue(true),
+		vm.StringToValue("abc"),
+		vm.IntToValue(-12),
+		vm.UintToValue(12),
+		vm.FloatToValue(1.25),
+		vm.DatetimeToValue(now),
+		vm.DatetimeIn(vm.DatetimeToValue(now), time.UTC),
+		vm.IntervalToValue(3 * time.Second),
+		vm.CalendarIntervalToValue(-1, 2, time.Hour),
+		vm.AnyToValue("any"),
+		vm.AnyToValue(map[string]interface{}{"i": int64(1), "f": 1.5, "a": []interface{}{uint64(2), "s", nil, true}}),
+		vm.DecimalToValue(decimal),
+	}
+	table := Table{}
+	for idx := range values {
+		table.Columns = append(table.Columns, Column{Name: "c" + string(rune('a'+idx))})
+	}
+	table.Records = [][]Value{values}
+
+	for _, newStorage := range []func() Storage{NewStorage, func() Storage { return NewColumnarStorage() }} {
+		s := newStorage().(SnapshotStorage)
+		tags := []KeyValue{{Key: "id", Value: "1"}, {Key: "host", Value: "a"}}
+		if err := s.Set("t1", tags, now, table, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Set("t2", nil, now, Table{}, errors.New("read fail")); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.(SchemaStorage).SetSchema("t3", &TableSchema{Columns: []ColumnSchema{{Name: "a", Type: vm.ValueInt64, Default: vm.IntToValue(1)}, {Name: "b", Type: vm.ValueString, Nullable: true, Collation: vm.CollationNatural}}}); err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err := s.Save(&buf); err != nil {
+			t.Fatal(err)
+		}
+
+		loaded := newStorage().(SnapshotStorage)
+		if err := loaded.Load(bytes.NewReader(buf.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+
+		assertEqual(t, true, loaded.Exists("t1", []KeyValue{{Key: "host", Value: "a"}, {Key: "id", Value: "1"}}, now))
+		query, err := loaded.From(mkCtx(), "t1", func(GetValuer) (bool, error) { return true, nil }, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := query.Results(mkCtx())
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, 1, len(results))
+		if !reflect.DeepEqual(values, results[0].Values) {
+			t.Error("want", values)
+			t.Error(" got", results[0].Values)
+		}
+		assertEqual(t, "t1", results[0].Columns[0].TableName)
+
+		query, _ = loaded.From(mkCtx(), "t2", func(GetValuer) (bool, error) { return true, nil }, nil)
+		if _, err := query.Results(mkCtx()); err == nil || err.Error() != "read fail" {
+			t.Error("want 'read fail' got", err)
+		}
+
+		schema, ok := loaded.(SchemaStorage).Schema("t3")
+		if !ok {
+			t.Fatal("schema isnot found")
+		}
+		assertEqual(t, int64(1), schema.Columns[0].Default.Int64)
+		assertEqual(t, true, schema.Columns[1].Nullable)
+		assertEqual(t, vm.CollationNatural, schema.Columns[1].Collation)
+
+		if err := loaded.Load(bytes.NewReader(buf.Bytes()[:buf.Len()-3])); err == nil {
+			t.Error("want error got ok")
+		}
+		if err := loaded.Load(bytes.NewReader([]byte("abcdefg"))); err == nil {
+			t.Error("want error got ok")
+		}
+	}
+}
+
+func TestSnapshotLength(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString(snapshotMagic)
+	enc := &snapshotEncoder{w: bufio.NewWriter(&buf)}
+	enc.writeUvarint(snapshotVersion)
+	enc.writeUvarint(0)
+	enc.writeUvarint(0)
+	enc.writeUvarint(1)
+	// 表名的长度大于剩余的字节数
+	enc.writeUvarint(math.MaxInt32)
+	enc.w.Flush()
+
+	err := NewStorage().(SnapshotStorage).Load(bytes.NewReader(buf.Bytes()))
+	if err == nil || !strings.Contains(err.Error(), "is larger than the remaining input") {
+		t.Error("want length error got", err)
+	}
+
+	s := NewStorage().(SnapshotStorage)
+	table := Table{Columns: []Column{{Name: "a"}}, Records: [][]Value{{vm.AnyToValue(struct{}{})}}}
+	if err := s.Set("t1", nil, time.Now(), table, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(&buf); err == nil || !strings.Contains(err.Error(), "is unsupported") {
+		t.Error("want type error got", err)
+	}
+}
+
+func TestSnapshotVersion(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString(snapshotMagic)
+	enc := &snapshotEncoder{w: bufio.NewWriter(&buf)}
+	enc.writeUvarint(snapshotVersion + 1)
+	enc.w.Flush()
+
+	s := NewStorage().(SnapshotStorage)
+	if err := s.Load(bytes.NewReader(buf.Bytes())); err == nil || !strings.Contains(err.Error(), "is unsupported") {
+		t.Error("want version error got", err)
+	}
+}
+
+func TestSnapshotFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "memsql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, SnapshotFilename)
+	s := NewStorage().(SnapshotStorage)
+	if err := LoadFile(s, filename); err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := ToTable([]map[string]interface{}{{"id": 1}, {"id": 2}, {"id": 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("t1", nil, time.Now(), table, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveFile(s, filename); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewStorage().(SnapshotStorage)
+	if err := LoadFile(loaded, filename); err != nil {
+		t.Fatal(err)
+	}
+	query, _ := loaded.From(mkCtx(), "t1", func(GetValuer) (bool, error) { return true, nil }, nil)
+	results, err := query.Results(mkCtx())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 3, len(results))
+
+	files, _ := ioutil.ReadDir(dir)
+	assertEqual(t, 1, len(files))
+}
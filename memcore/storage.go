@@ -1,7 +1,6 @@
 package memcore
 
 import (
-	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -149,15 +148,6 @@ func (kvs KeyValues) ToKey() string {
 	return sb.String()
 }
 
-type measurement struct {
-	tags     KeyValues
-	dataTime time.Time
-	data     Table
-
-	errTime time.Time
-	err     error
-}
-
 func toGetValuer(tags KeyValues) GetValuer {
 	return GetValueFunc(func(tableName, name string) (Value, error) {
 		tagName := name
@@ -173,132 +163,74 @@ func toGetValuer(tags KeyValues) GetValuer {
 }
 
 type storage struct {
-	mu           sync.Mutex
-	measurements map[string]map[string]measurement
+	mu sync.Mutex
+	measurementSet
 }
 
 func NewStorage() Storage {
 	return &storage{
-		measurements: map[string]map[string]measurement{},
+		measurementSet: newMeasurementSet(func(data interface{}) Table {
+			return data.(Table)
+		}, func(table Table) interface{} {
+			return table
+		}),
 	}
 }
 
 func (s *storage) From(ctx Context, tablename string, filter func(ctx GetValuer) (bool, error), trace func(TableName)) (Query, error) {
-	return Query{
-		Iterate: func() Iterator {
-			q, err := s.from(ctx, tablename, filter, trace)
-			if err != nil {
-				return func(ctx Context) (Record, error) { 
-					return Record{}, err
-				}
-			}
-			return q.Iterate()
+	return s.FromWhere(ctx, tablename, filter, nil, trace)
+}
+
+// FromWhere 用 tag 的索引找出候选的 measurement, 只对候选者执行 filter,
+// 其它的 predicates 由 where 去处理
+func (s *storage) FromWhere(ctx Context, tablename string, filter func(ctx GetValuer) (bool, error), predicates []Predicate, trace func(TableName)) (Query, error) {
+	// 每个 measurement 是一个 partition, 它们可以并发地读取
+	return FromPartitions(&Partitions{
+		Get: func() ([]Query, error) {
+			return s.from(ctx, tablename, filter, predicates, trace)
 		},
-	}, nil
+	}), nil
 }
 
-func (s *storage) from(ctx Context, tablename string, filter func(ctx GetValuer) (bool, error), trace func(TableName)) (Query, error) {
+func (s *storage) from(ctx Context, tablename string, filter func(ctx GetValuer) (bool, error), predicates []Predicate, trace func(TableName)) ([]Query, error) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	byKey := s.measurements[tablename]
-	if len(byKey) == 0 {
-		return Query{}, TableNotExists(tablename)
+	list, err := s.find(tablename, filter, predicates, trace)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
 	}
 
-	var list []measurement
-	for _, m := range byKey {
-		values := toGetValuer(m.tags)
-		ok, err := filter(values)
-		if err != nil {
-			if errors.Is(err, ErrNotFound) {
-				continue
-			}
-
-			return Query{}, TableNotExists(tablename, err)
-		}
-		if m.err != nil {
-			return Query{},  m.err
-		}
-		if ok {
-			if trace != nil {
-				trace(TableName{
-					Table: tablename,
-					Tags:  m.tags,
-				})
-			}
-			list = append(list, m)
-		}
-	}
-	if len(list) == 0 {
-		return Query{}, TableNotExists(tablename)
+	partitions := make([]Query, len(list))
+	for i := range list {
+		partitions[i] = FromWithTags(list[i].data.(Table), list[i].tags)
 	}
-	query := FromWithTags(list[0].data, list[0].tags)
-	for i := 1; i < len(list); i++ {
-		query = query.UnionAll(FromWithTags(list[i].data, list[i].tags))
-	}
-	return query,  nil
+	return partitions, nil
 }
 
 func (s *storage) Set(name string, tags []KeyValue, t time.Time, data Table, err error) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	byKey := s.measurements[name]
-	if byKey == nil {
-		byKey = map[string]measurement{}
-		s.measurements[name] = byKey
-	}
-
-	for idx := range data.Columns {
-		data.Columns[idx].TableName = name
-	}
-
-	copyed := KeyValues(CloneKeyValues(tags))
-	sort.Sort(copyed)
-	key := KeyValues(copyed).ToKey()
+	return s.set(name, tags, t, data, err)
+}
 
-	m := measurement{
-		tags:     copyed,
-		dataTime: t,
-		data:     data,
-		errTime:  t,
-		err:      err,
-	}
+func (s *storage) Exists(tablename string, tags []KeyValue, predateLimit time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	old, ok := byKey[key]
-	if ok {
-		if err != nil {
-			m.data = old.data
-			m.dataTime = old.dataTime
-		}
-	}
-	byKey[key] = m
-	return nil
+	return s.exists(tablename, tags, predateLimit)
 }
 
-func (s *storage) Exists(tablename string, tags []KeyValue, predateLimit time.Time) bool {
+func (s *storage) SetSchema(name string, schema *TableSchema) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	byKey := s.measurements[tablename]
-	if len(byKey) == 0 {
-		return false
-	}
+	return s.setSchema(name, schema)
+}
 
-	key := KeyValues(tags).ToKey()
-	old, ok := byKey[key]
-	if !ok {
-		return false
-	}
+func (s *storage) Schema(name string) (*TableSchema, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if predateLimit.After(old.dataTime) {
-		return false
-	}
-	if old.err != nil {
-		if predateLimit.After(old.errTime) {
-			return false
-		}
-	}
-	return ok
+	return s.schema(name)
 }
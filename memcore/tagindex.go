@@ -0,0 +1,105 @@
+package memcore
+
+import (
+	"strings"
+
+	"github.com/runner-mei/memsql/vm"
+)
+
+// tagIndex 是 tag 的倒排索引, tag key -> tag value -> measurement key
+type tagIndex map[string]map[string]map[string]struct{}
+
+func (index tagIndex) add(key string, tags KeyValues) {
+	for _, tag := range tags {
+		byValue := index[tag.Key]
+		if byValue == nil {
+			byValue = map[string]map[string]struct{}{}
+			index[tag.Key] = byValue
+		}
+		keys := byValue[tag.Value]
+		if keys == nil {
+			keys = map[string]struct{}{}
+			byValue[tag.Value] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+func (index tagIndex) remove(key string, tags KeyValues) {
+	for _, tag := range tags {
+		byValue := index[tag.Key]
+		keys := byValue[tag.Value]
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(byValue, tag.Value)
+		}
+		if len(byValue) == 0 {
+			delete(index, tag.Key)
+		}
+	}
+}
+
+// lookup returns the keys of the measurements which may satisfy all the tag
+// predicates, ok is false if none of the predicates is on a tag.
+func (index tagIndex) lookup(predicates []Predicate) (candidates map[string]struct{}, ok bool) {
+	for idx := range predicates {
+		p := &predicates[idx]
+		if !strings.HasPrefix(p.Column, "@") {
+			continue
+		}
+		switch p.Op {
+		case OpIsNull, OpIsNotNull:
+			// 没有这个 tag 的 measurement 也满足 is null
+			continue
+		}
+
+		keys := index.match(strings.TrimPrefix(p.Column, "@"), p)
+		if !ok {
+			candidates = keys
+			ok = true
+		} else {
+			for key := range candidates {
+				if _, found := keys[key]; !found {
+					delete(candidates, key)
+				}
+			}
+		}
+		if len(candidates) == 0 {
+			break
+		}
+	}
+	return candidates, ok
+}
+
+func (index tagIndex) match(tagName string, p *Predicate) map[string]struct{} {
+	byValue := index[tagName]
+	results := map[string]struct{}{}
+
+	if p.Op == OpEqual || p.Op == OpIn {
+		exact := true
+		for idx := range p.Values {
+			if p.Values[idx].Type != vm.ValueString {
+				exact = false
+				break
+			}
+		}
+		if exact {
+			for idx := range p.Values {
+				for key := range byValue[p.Values[idx].Str] {
+					results[key] = struct{}{}
+				}
+			}
+			return results
+		}
+	}
+
+	for value, keys := range byValue {
+		if !matchValue(vm.StringToValue(value), p) {
+			continue
+		}
+		for key := range keys {
+			results[key] = struct{}{}
+		}
+	}
+	return results
+}
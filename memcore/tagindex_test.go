@@ -0,0 +1,80 @@
+package memcore
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/memsql/vm"
+)
+
+func TestTagIndex(t *testing.T) {
+	for _, s := range []Storage{NewStorage(), NewColumnarStorage()} {
+		for i := 0; i < 20; i++ {
+			table, err := ToTable([]map[string]interface{}{
+				{"id": i},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tags := []KeyValue{
+				{Key: "host", Value: "h" + strconv.Itoa(i%5)},
+				{Key: "id", Value: strconv.Itoa(i)},
+			}
+			if err := s.Set("cpu", tags, time.Now(), table, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		ps := s.(PredicateStorage)
+
+		for _, test := range []struct {
+			predicates []Predicate
+			ids        []int64
+		}{
+			{
+				predicates: []Predicate{{Column: "@host", Op: OpEqual, Values: []Value{vm.StringToValue("h1")}}},
+				ids:        []int64{1, 6, 11, 16},
+			},
+			{
+				predicates: []Predicate{
+					{Column: "@host", Op: OpIn, Values: []Value{vm.StringToValue("h1"), vm.StringToValue("h2")}},
+					{Column: "@id", Op: OpLike, Values: []Value{vm.StringToValue("1%")}},
+				},
+				ids: []int64{1, 11, 12, 16, 17},
+			},
+			{
+				predicates: []Predicate{{Column: "@id", Op: OpEqual, Values: []Value{vm.IntToValue(3)}}},
+				ids:        []int64{3},
+			},
+			{
+				predicates: []Predicate{{Column: "@id", Op: OpGreaterEqual, Values: []Value{vm.IntToValue(18)}}},
+				ids:        []int64{18, 19},
+			},
+		} {
+			var visited []string
+			query, err := ps.FromWhere(mkCtx(), "cpu", func(GetValuer) (bool, error) {
+				return true, nil
+			}, test.predicates, func(name TableName) {
+				visited = append(visited, name.String())
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			results, err := query.Results(mkCtx())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var ids []int64
+			for _, result := range results {
+				value, _ := result.Get("id")
+				ids = append(ids, value.Int64)
+			}
+			sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+			assertEqual(t, test.ids, ids)
+			assertEqual(t, len(test.ids), len(visited))
+		}
+	}
+}
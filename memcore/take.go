@@ -2,20 +2,36 @@ package memcore
 
 // Take returns a specified number of contiguous elements from the start of a
 // collection.
+//
+// The goroutines which read the partitions of q are stopped after the
+// elements are taken.
 func (q Query) Take(count int) Query {
 	return Query{
 		Iterate: func() Iterator {
-			next := q.Iterate()
+			var next Iterator
+			var stop = func() {}
+			if q.Partitions != nil && q.Partitions.Parallelism > 1 {
+				var batches BatchIterator
+				batches, stop = q.batchesWithStop()
+				next = rowsOf(func() BatchIterator { return batches })()
+			} else {
+				next = q.Iterate()
+			}
 			n := count
 
 			return func(ctx Context) (item Record, err error) {
 				if n <= 0 {
+					stop()
 					err = ErrNoRows
 					return
 				}
 
 				n--
-				return next(ctx)
+				item, err = next(ctx)
+				if n <= 0 || err != nil {
+					stop()
+				}
+				return
 			}
 		},
 	}
@@ -57,3 +73,32 @@ func (q Query) TakeWhile(predicate func(int, Record) bool) Query {
 		},
 	}
 }
+
+// TakeBatch is same as Take but the elements are read by the batches.
+func (q Query) TakeBatch(count int) Query {
+	return FromBatches(func() BatchIterator {
+		next, stop := q.batchesWithStop()
+		n := count
+
+		return func(ctx Context) (*Batch, error) {
+			if n <= 0 {
+				stop()
+				return nil, ErrNoRows
+			}
+
+			b, err := next(ctx)
+			if err != nil {
+				stop()
+				return nil, err
+			}
+			if b.Length > n {
+				b = b.Slice(0, n)
+			}
+			n -= b.Length
+			if n <= 0 {
+				stop()
+			}
+			return b, nil
+		}
+	})
+}
@@ -1,11 +1,19 @@
 package memcore
 
+import "github.com/runner-mei/memsql/vm"
+
 // Union produces the set union of two collections.
 //
 // This method excludes duplicates from the return set. This is different
 // behavior to the Concat method, which returns all the elements in the input
 // collection including duplicates.
 func (q Query) Union(q2 Query) Query {
+	return q.UnionWith(q2, vm.EmptyCompareOption())
+}
+
+// UnionWith is same as Union but the elements are compared with opt, such as
+// the collation of the strings.
+func (q Query) UnionWith(q2 Query, opt vm.CompareOption) Query {
 	return Query{
 		Iterate: func() Iterator {
 			next1 := q.Iterate()
@@ -25,7 +33,7 @@ func (q Query) Union(q2 Query) Query {
 							return
 						}
 
-						if !set.Has(item) {
+						if !set.HasWith(item, opt) {
 							set.Add(item)
 							return
 						}
@@ -40,7 +48,7 @@ func (q Query) Union(q2 Query) Query {
 						return
 					}
 
-					if !set.Has(item) {
+					if !set.HasWith(item, opt) {
 						set.Add(item)
 						return
 					}
@@ -58,7 +66,7 @@ func (q Query) Union(q2 Query) Query {
 // returns all the original elements in the input sequences. The Union method
 // returns only unique elements.
 func (q Query) UnionAll(q2 Query) Query {
-	return Query{
+	query := Query{
 		Iterate: func() Iterator {
 			next1 := q.Iterate()
 			next2 := q2.Iterate()
@@ -82,4 +90,23 @@ func (q Query) UnionAll(q2 Query) Query {
 			}
 		},
 	}
+	if q.IterateBatch != nil && q2.IterateBatch != nil {
+		query.IterateBatch = func() BatchIterator {
+			next1 := q.IterateBatch()
+			next2 := q2.IterateBatch()
+			use1 := true
+
+			return func(ctx Context) (*Batch, error) {
+				if use1 {
+					b, err := next1(ctx)
+					if err == nil || !IsNoRows(err) {
+						return b, err
+					}
+					use1 = false
+				}
+				return next2(ctx)
+			}
+		}
+	}
+	return query
 }
@@ -0,0 +1,78 @@
+package memcore
+
+import (
+	"sort"
+	"time"
+)
+
+// View is the definition of the materialized view, its records are saved as
+// the table of the same name.
+type View struct {
+	Name  string
+	Query string
+
+	// Interval is the refresh interval, 0 means the view is refreshed on
+	// demand only.
+	Interval time.Duration
+}
+
+// ViewStorage is implemented by the Storage which saves the definitions of
+// the materialized views with the records, so they are restored with the
+// snapshot and the write-ahead log.
+type ViewStorage interface {
+	// SetView saves the definition of the view, it is removed if view is nil.
+	SetView(name string, view *View) error
+
+	// Views returns the definitions of all the views
+	Views() []View
+}
+
+func (ms *measurementSet) setView(name string, view *View) {
+	if view == nil {
+		delete(ms.views, name)
+		return
+	}
+	copyed := *view
+	ms.views[name] = &copyed
+}
+
+func (ms *measurementSet) listViews() []View {
+	var views = make([]View, 0, len(ms.views))
+	for _, view := range ms.views {
+		views = append(views, *view)
+	}
+	sort.Slice(views, func(i, j int) bool {
+		return views[i].Name < views[j].Name
+	})
+	return views
+}
+
+func (s *storage) SetView(name string, view *View) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.setView(name, view)
+	return nil
+}
+
+func (s *storage) Views() []View {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.listViews()
+}
+
+func (s *columnarStorage) SetView(name string, view *View) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.setView(name, view)
+	return nil
+}
+
+func (s *columnarStorage) Views() []View {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.listViews()
+}
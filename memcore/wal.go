@@ -0,0 +1,689 @@
+package memcore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/runner-mei/errors"
+)
+
+type SyncPolicy int
+
+const (
+	// SyncAlways calls fsync after every write
+	SyncAlways SyncPolicy = iota
+	// SyncInterval calls fsync every SyncInterval
+	SyncInterval
+	// SyncNever leaves it to the os
+	SyncNever
+)
+
+const (
+	walOpSet       = 1
+	walOpSetSchema = 2
+	walOpRemove    = 3
+	walOpReplace   = 4
+	walOpSetView   = 5
+
+	walHeaderSize = 8
+
+	defaultSegmentSize  = 64 * 1024 * 1024
+	defaultSyncInterval = time.Second
+)
+
+var walTable = crc32.MakeTable(crc32.Castagnoli)
+
+type WALOptions struct {
+	Dir          string
+	SegmentSize  int64
+	Sync         SyncPolicy
+	SyncInterval time.Duration
+}
+
+// DurableStorage logs every modification to the write-ahead log in the
+// directory before it returns, the log and the snapshot are replayed when it
+// is opened.
+type DurableStorage struct {
+	SnapshotStorage
+
+	opts WALOptions
+
+	mu      sync.Mutex
+	seq     uint64
+	segment *os.File
+	size    int64
+	dirty   bool
+	closed  chan struct{}
+	wg      sync.WaitGroup
+}
+
+func OpenDurableStorage(s SnapshotStorage, opts WALOptions) (*DurableStorage, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = defaultSegmentSize
+	}
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = defaultSyncInterval
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "create wal directory fail")
+	}
+
+	if err := LoadFile(s, filepath.Join(opts.Dir, SnapshotFilename)); err != nil {
+		return nil, err
+	}
+
+	segments, err := listSegments(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	for idx, seq := range segments {
+		err := replaySegment(s, filepath.Join(opts.Dir, segmentName(seq)), idx == len(segments)-1)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ds := &DurableStorage{
+		SnapshotStorage: s,
+		opts:            opts,
+		closed:          make(chan struct{}),
+	}
+	next := uint64(1)
+	if len(segments) > 0 {
+		last := segments[len(segments)-1]
+		st, err := os.Stat(filepath.Join(opts.Dir, segmentName(last)))
+		if err != nil {
+			return nil, errors.Wrap(err, "open wal segment fail")
+		}
+		// 最后的 segment 是空的时继续使用它, 否则每次打开都会多一个空的 segment
+		if st.Size() == 0 {
+			next = last
+		} else {
+			next = last + 1
+		}
+	}
+	if err := ds.openSegment(next); err != nil {
+		return nil, err
+	}
+
+	if opts.Sync == SyncInterval {
+		ds.wg.Add(1)
+		go ds.runSync()
+	}
+	return ds, nil
+}
+
+func segmentName(seq uint64) string {
+	return fmt.Sprintf("wal-%016d.log", seq)
+}
+
+func listSegments(dir string) ([]uint64, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "read wal directory fail")
+	}
+	var segments []uint64
+	for _, file := range files {
+		name := file.Name()
+		if !strings.HasPrefix(name, "wal-") || !strings.HasSuffix(name, ".log") {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, "wal-"), ".log"), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, seq)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	return segments, nil
+}
+
+// replaySegment applies all the records of the segment. The tail of the last
+// segment may be truncated by a crash, it is cut off at the last good record.
+func replaySegment(s Storage, filename string, isLast bool) error {
+	f, err := os.OpenFile(filename, os.O_RDWR, 0644)
+	if err != nil {
+		return errors.Wrap(err, "open wal segment fail")
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return errors.Wrap(err, "open wal segment fail")
+	}
+
+	r := bufio.NewReader(f)
+	var offset int64
+	var header [walHeaderSize]byte
+	for {
+		_, err := io.ReadFull(r, header[:])
+		if err == io.EOF {
+			return nil
+		}
+
+		var payload []byte
+		if err == nil {
+			// 损坏的长度可能非常大, 它不能超过剩下的内容
+			length := int64(binary.LittleEndian.Uint32(header[0:4]))
+			if length > st.Size()-offset-walHeaderSize {
+				err = io.ErrUnexpectedEOF
+			} else {
+				payload = make([]byte, length)
+				_, err = io.ReadFull(r, payload)
+			}
+			if err == nil && crc32.Checksum(payload, walTable) != binary.LittleEndian.Uint32(header[4:8]) {
+				err = errors.New("checksum is mismatch")
+			}
+		}
+		if err != nil {
+			if !isLast {
+				return errors.Wrap(err, "read wal segment '"+filename+"' fail at "+strconv.FormatInt(offset, 10))
+			}
+			if e := f.Truncate(offset); e != nil {
+				return errors.Wrap(e, "truncate wal segment '"+filename+"' fail")
+			}
+			return nil
+		}
+
+		if err := applyRecord(s, payload); err != nil {
+			return errors.Wrap(err, "replay wal segment '"+filename+"' fail at "+strconv.FormatInt(offset, 10))
+		}
+		offset += walHeaderSize + int64(len(payload))
+	}
+}
+
+func applyRecord(s Storage, payload []byte) error {
+	dec := newSnapshotDecoder(bytes.NewReader(payload), int64(len(payload)))
+	switch op := dec.readByte(); op {
+	case walOpSet:
+		m := dec.readMeasurement()
+		if dec.err != nil {
+			return dec.err
+		}
+		return s.Set(m.table, m.tags, m.dataTime, m.data, m.err)
+	case walOpSetSchema:
+		name := dec.readString()
+		var schema *TableSchema
+		if dec.readByte() != 0 {
+			schema = dec.readSchema()
+		}
+		if dec.err != nil {
+			return dec.err
+		}
+		ss, ok := s.(SchemaStorage)
+		if !ok {
+			return errors.New("storage isnot support schemas")
+		}
+		return ss.SetSchema(name, schema)
+	case walOpRemove:
+		name := dec.readString()
+		n := dec.readLength()
+		var tags = make([]KeyValue, 0, n)
+		for i := 0; i < n && dec.err == nil; i++ {
+			key := dec.readString()
+			tags = append(tags, KeyValue{Key: key, Value: dec.readString()})
+		}
+		if dec.err != nil {
+			return dec.err
+		}
+		ms, ok := s.(MutableStorage)
+		if !ok {
+			return errors.New("storage isnot support remove")
+		}
+		_, err := ms.Remove(name, tags)
+		return err
+	case walOpReplace:
+		name := dec.readString()
+		t := dec.readTime()
+		n := dec.readLength()
+		var measurements = make([]Measurement, 0, n)
+		for i := 0; i < n && dec.err == nil; i++ {
+			m := dec.readMeasurement()
+			measurements = append(measurements, Measurement{Tags: m.tags, Table: m.data})
+		}
+		if dec.err != nil {
+			return dec.err
+		}
+		ms, ok := s.(MutableStorage)
+		if !ok {
+			return errors.New("storage isnot support replace")
+		}
+		return ms.Replace(name, t, measurements)
+	case walOpSetView:
+		name := dec.readString()
+		var view *View
+		if dec.readByte() != 0 {
+			view = dec.readView()
+		}
+		if dec.err != nil {
+			return dec.err
+		}
+		vs, ok := s.(ViewStorage)
+		if !ok {
+			return errors.New("storage isnot support views")
+		}
+		return vs.SetView(name, view)
+	default:
+		return errors.New("unknown operation '" + strconv.Itoa(int(op)) + "'")
+	}
+}
+
+func (ds *DurableStorage) openSegment(seq uint64) error {
+	filename := filepath.Join(ds.opts.Dir, segmentName(seq))
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrap(err, "open wal segment fail")
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return errors.Wrap(err, "open wal segment fail")
+	}
+	ds.seq = seq
+	ds.segment = f
+	ds.size = st.Size()
+	return nil
+}
+
+func (ds *DurableStorage) rotate() error {
+	if ds.segment != nil {
+		if err := ds.segment.Sync(); err != nil {
+			return errors.Wrap(err, "sync wal segment fail")
+		}
+		if err := ds.segment.Close(); err != nil {
+			return errors.Wrap(err, "close wal segment fail")
+		}
+		ds.segment = nil
+		ds.dirty = false
+	}
+	return ds.openSegment(ds.seq + 1)
+}
+
+// append 写入一条记录, 并按 SyncPolicy 执行 fsync, 返回记录在当前 segment
+// 中的位置. segment 满了时先切换 segment, 这样记录总是在当前 segment 中
+func (ds *DurableStorage) append(encode func(enc *snapshotEncoder)) (int64, error) {
+	var buf bytes.Buffer
+	buf.Write(make([]byte, walHeaderSize))
+	enc := &snapshotEncoder{w: bufio.NewWriter(&buf)}
+	encode(enc)
+	if enc.err == nil {
+		enc.err = enc.w.Flush()
+	}
+	if enc.err != nil {
+		return 0, errors.Wrap(enc.err, "encode wal record fail")
+	}
+
+	record := buf.Bytes()
+	payload := record[walHeaderSize:]
+	binary.LittleEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(record[4:8], crc32.Checksum(payload, walTable))
+
+	if ds.segment == nil {
+		return 0, errors.New("wal is closed")
+	}
+	if ds.size >= ds.opts.SegmentSize {
+		if err := ds.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	offset := ds.size
+	if _, err := ds.segment.Write(record); err != nil {
+		ds.rollback(offset)
+		return 0, errors.Wrap(err, "write wal fail")
+	}
+	ds.size += int64(len(record))
+	ds.dirty = true
+
+	if ds.opts.Sync == SyncAlways {
+		if err := ds.segment.Sync(); err != nil {
+			ds.rollback(offset)
+			return 0, errors.Wrap(err, "sync wal fail")
+		}
+		ds.dirty = false
+	}
+	return offset, nil
+}
+
+// rollback 从当前 segment 中去掉 offset 之后的记录
+func (ds *DurableStorage) rollback(offset int64) error {
+	if err := ds.segment.Truncate(offset); err != nil {
+		return errors.Wrap(err, "truncate wal segment fail")
+	}
+	ds.size = offset
+	ds.dirty = true
+	if ds.opts.Sync == SyncAlways {
+		return ds.sync()
+	}
+	return nil
+}
+
+// logAndApply 先写日志再修改内存中的数据, 修改失败时从日志中去掉这条记录,
+// 这样日志中总是包含所有的修改
+func (ds *DurableStorage) logAndApply(encode func(enc *snapshotEncoder), apply func() error) error {
+	offset, err := ds.append(encode)
+	if err != nil {
+		return err
+	}
+	if err := apply(); err != nil {
+		if e := ds.rollback(offset); e != nil {
+			return errors.Wrap(e, err.Error())
+		}
+		return err
+	}
+	return nil
+}
+
+func encodeSet(name string, tags []KeyValue, t time.Time, table Table, err error) func(enc *snapshotEncoder) {
+	return func(enc *snapshotEncoder) {
+		enc.writeByte(walOpSet)
+		enc.writeMeasurement(&snapshotMeasurement{
+			table:    name,
+			tags:     tags,
+			dataTime: t,
+			errTime:  t,
+			err:      err,
+			data:     table,
+		})
+	}
+}
+
+func encodeRemove(name string, tags []KeyValue) func(enc *snapshotEncoder) {
+	return func(enc *snapshotEncoder) {
+		enc.writeByte(walOpRemove)
+		enc.writeString(name)
+		enc.writeUvarint(uint64(len(tags)))
+		for _, tag := range tags {
+			enc.writeString(tag.Key)
+			enc.writeString(tag.Value)
+		}
+	}
+}
+
+func (ds *DurableStorage) Set(name string, tags []KeyValue, t time.Time, table Table, err error) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	return ds.logAndApply(encodeSet(name, tags, t, table, err), func() error {
+		return ds.SnapshotStorage.Set(name, tags, t, table, err)
+	})
+}
+
+func (ds *DurableStorage) SetSchema(name string, schema *TableSchema) error {
+	ss, ok := ds.SnapshotStorage.(SchemaStorage)
+	if !ok {
+		return errors.New("storage isnot support schemas")
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	return ds.logAndApply(func(enc *snapshotEncoder) {
+		enc.writeByte(walOpSetSchema)
+		enc.writeString(name)
+		if schema == nil {
+			enc.writeByte(0)
+		} else {
+			enc.writeByte(1)
+			enc.writeSchema(schema)
+		}
+	}, func() error {
+		return ss.SetSchema(name, schema)
+	})
+}
+
+func (ds *DurableStorage) Schema(name string) (*TableSchema, bool) {
+	ss, ok := ds.SnapshotStorage.(SchemaStorage)
+	if !ok {
+		return nil, false
+	}
+	return ss.Schema(name)
+}
+
+func (ds *DurableStorage) Get(name string, tags []KeyValue) (Table, bool) {
+	ms, ok := ds.SnapshotStorage.(MutableStorage)
+	if !ok {
+		return Table{}, false
+	}
+	return ms.Get(name, tags)
+}
+
+func (ds *DurableStorage) Measurements(name string) []KeyValues {
+	ms, ok := ds.SnapshotStorage.(MutableStorage)
+	if !ok {
+		return nil
+	}
+	return ms.Measurements(name)
+}
+
+func (ds *DurableStorage) Remove(name string, tags []KeyValue) (bool, error) {
+	ms, ok := ds.SnapshotStorage.(MutableStorage)
+	if !ok {
+		return false, errors.New("storage isnot support remove")
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if !hasMeasurement(ms, name, tags) {
+		return false, nil
+	}
+	err := ds.logAndApply(encodeRemove(name, tags), func() error {
+		_, err := ms.Remove(name, tags)
+		return err
+	})
+	return err == nil, err
+}
+
+// Replace logs all the measurements before the table is replaced, see
+// MutableStorage.
+func (ds *DurableStorage) Replace(name string, t time.Time, measurements []Measurement) error {
+	ms, ok := ds.SnapshotStorage.(MutableStorage)
+	if !ok {
+		return errors.New("storage isnot support replace")
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	return ds.logAndApply(func(enc *snapshotEncoder) {
+		enc.writeByte(walOpReplace)
+		enc.writeString(name)
+		enc.writeTime(t)
+		enc.writeUvarint(uint64(len(measurements)))
+		for _, m := range measurements {
+			enc.writeMeasurement(&snapshotMeasurement{
+				table:    name,
+				tags:     m.Tags,
+				dataTime: t,
+				errTime:  t,
+				data:     m.Table,
+			})
+		}
+	}, func() error {
+		return ms.Replace(name, t, measurements)
+	})
+}
+
+func (ds *DurableStorage) SetView(name string, view *View) error {
+	vs, ok := ds.SnapshotStorage.(ViewStorage)
+	if !ok {
+		return errors.New("storage isnot support views")
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	return ds.logAndApply(func(enc *snapshotEncoder) {
+		enc.writeByte(walOpSetView)
+		enc.writeString(name)
+		if view == nil {
+			enc.writeByte(0)
+		} else {
+			enc.writeByte(1)
+			enc.writeView(view)
+		}
+	}, func() error {
+		return vs.SetView(name, view)
+	})
+}
+
+func (ds *DurableStorage) Views() []View {
+	vs, ok := ds.SnapshotStorage.(ViewStorage)
+	if !ok {
+		return nil
+	}
+	return vs.Views()
+}
+
+// Update logs the result of update before the measurement is replaced, see
+// MutableStorage.
+func (ds *DurableStorage) Update(name string, tags []KeyValue, t time.Time, update func(old Table, exists bool) (Table, error)) error {
+	ms, ok := ds.SnapshotStorage.(MutableStorage)
+	if !ok {
+		return errors.New("storage isnot support update")
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	var logged = false
+	var offset int64
+	err := ms.Update(name, tags, t, func(old Table, exists bool) (Table, error) {
+		data, err := update(old, exists)
+		if err != nil {
+			return data, err
+		}
+		encode := encodeSet(name, tags, t, data, nil)
+		if len(data.Records) == 0 {
+			if !exists {
+				return data, nil
+			}
+			encode = encodeRemove(name, tags)
+		}
+		offset, err = ds.append(encode)
+		logged = err == nil
+		return data, err
+	})
+	if err != nil && logged {
+		if e := ds.rollback(offset); e != nil {
+			return errors.Wrap(e, err.Error())
+		}
+	}
+	return err
+}
+
+// hasMeasurement 判断 measurement 是否存在, 出错的 measurement 也是存在的
+func hasMeasurement(ms MutableStorage, name string, tags []KeyValue) bool {
+	_, key := measurementKey(tags)
+	for _, m := range ms.Measurements(name) {
+		if m.ToKey() == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (ds *DurableStorage) FromWhere(ctx Context, tablename string, filter func(ctx GetValuer) (bool, error), predicates []Predicate, trace func(TableName)) (Query, error) {
+	if ps, ok := ds.SnapshotStorage.(PredicateStorage); ok {
+		return ps.FromWhere(ctx, tablename, filter, predicates, trace)
+	}
+	return ds.SnapshotStorage.From(ctx, tablename, filter, trace)
+}
+
+// Compact saves the snapshot and removes the segments which are included in it.
+func (ds *DurableStorage) Compact() error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if ds.segment == nil {
+		return errors.New("wal is closed")
+	}
+	last := ds.seq
+	if err := ds.rotate(); err != nil {
+		return err
+	}
+	if err := SaveFile(ds.SnapshotStorage, filepath.Join(ds.opts.Dir, SnapshotFilename)); err != nil {
+		return err
+	}
+
+	segments, err := listSegments(ds.opts.Dir)
+	if err != nil {
+		return err
+	}
+	for _, seq := range segments {
+		if seq > last {
+			continue
+		}
+		if err := os.Remove(filepath.Join(ds.opts.Dir, segmentName(seq))); err != nil {
+			return errors.Wrap(err, "remove wal segment fail")
+		}
+	}
+	if err := syncDir(ds.opts.Dir); err != nil {
+		return errors.Wrap(err, "sync wal directory fail")
+	}
+	return nil
+}
+
+func (ds *DurableStorage) Sync() error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	return ds.sync()
+}
+
+func (ds *DurableStorage) sync() error {
+	if ds.segment == nil || !ds.dirty {
+		return nil
+	}
+	if err := ds.segment.Sync(); err != nil {
+		return errors.Wrap(err, "sync wal fail")
+	}
+	ds.dirty = false
+	return nil
+}
+
+func (ds *DurableStorage) runSync() {
+	defer ds.wg.Done()
+
+	ticker := time.NewTicker(ds.opts.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ds.closed:
+			return
+		case <-ticker.C:
+			ds.Sync()
+		}
+	}
+}
+
+func (ds *DurableStorage) Close() error {
+	ds.mu.Lock()
+	if ds.segment == nil {
+		ds.mu.Unlock()
+		return nil
+	}
+	close(ds.closed)
+	err := ds.sync()
+	if e := ds.segment.Close(); err == nil && e != nil {
+		err = errors.Wrap(e, "close wal segment fail")
+	}
+	ds.segment = nil
+	ds.mu.Unlock()
+
+	ds.wg.Wait()
+	return err
+}
@@ -0,0 +1,376 @@
+package memcore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/memsql/vm"
+)
+
+func countRows(t *testing.T, s Storage, tablename string) int {
+	query, err := s.From(mkCtx(), tablename, func(GetValuer) (bool, error) { return true, nil }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := query.Results(mkCtx())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(results)
+}
+
+func TestWAL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "memsql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := WALOptions{
+		Dir:         dir,
+		SegmentSize: 256,
+		Sync:        SyncAlways,
+	}
+
+	ds, err := OpenDurableStorage(NewStorage().(SnapshotStorage), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ds.SetSchema("cpu", &TableSchema{Columns: []ColumnSchema{{Name: "id", Type: vm.ValueInt64}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		table, err := ToTable([]map[string]interface{}{{"id": strconv.Itoa(i)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ds.Set("cpu", []KeyValue{{Key: "id", Value: strconv.Itoa(i)}}, time.Now(), table, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ds.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	segments, err := listSegments(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) < 2 {
+		t.Error("segments isnot rotated -", segments)
+	}
+
+	// 模拟 crash 时写了一半
+	f, err := os.OpenFile(filepath.Join(dir, segmentName(segments[len(segments)-1])), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{100, 0, 0, 0, 1, 2})
+	f.Close()
+
+	ds, err = OpenDurableStorage(NewStorage().(SnapshotStorage), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 20, countRows(t, ds, "cpu"))
+	if _, ok := ds.Schema("cpu"); !ok {
+		t.Error("schema isnot replayed")
+	}
+
+	if err := ds.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	segments, _ = listSegments(dir)
+	assertEqual(t, 1, len(segments))
+
+	table, _ := ToTable([]map[string]interface{}{{"id": 100}})
+	if err := ds.Set("cpu", []KeyValue{{Key: "id", Value: "100"}}, time.Now(), table, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ds, err = OpenDurableStorage(NewColumnarStorage().(SnapshotStorage), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+	assertEqual(t, 21, countRows(t, ds, "cpu"))
+}
+
+func TestWALReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "memsql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := WALOptions{Dir: dir, Sync: SyncAlways}
+
+	// 没有写入时重复打开不会增加 segment
+	for i := 0; i < 3; i++ {
+		ds, err := OpenDurableStorage(NewStorage().(SnapshotStorage), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ds.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	segments, err := listSegments(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, []uint64{1}, segments)
+
+	ds, err := OpenDurableStorage(NewStorage().(SnapshotStorage), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, _ := ToTable([]map[string]interface{}{{"id": 1}})
+	if err := ds.Set("cpu", []KeyValue{{Key: "id", Value: "1"}}, time.Now(), table, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ds, err = OpenDurableStorage(NewStorage().(SnapshotStorage), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+	assertEqual(t, 1, countRows(t, ds, "cpu"))
+	segments, _ = listSegments(dir)
+	assertEqual(t, []uint64{1, 2}, segments)
+}
+
+func TestWALRemove(t *testing.T) {
+	dir, err := ioutil.TempDir("", "memsql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := WALOptions{Dir: dir, Sync: SyncAlways}
+	ds, err := OpenDurableStorage(NewStorage().(SnapshotStorage), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		table, err := ToTable([]map[string]interface{}{{"id": strconv.Itoa(i)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ds.Set("cpu", []KeyValue{{Key: "id", Value: strconv.Itoa(i)}}, time.Now(), table, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ok, err := ds.Remove("cpu", []KeyValue{{Key: "id", Value: "1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("want removed")
+	}
+	if _, ok := ds.Get("cpu", []KeyValue{{Key: "id", Value: "1"}}); ok {
+		t.Error("id=1 isnot removed")
+	}
+	if err := ds.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ds, err = OpenDurableStorage(NewStorage().(SnapshotStorage), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+
+	if count := countRows(t, ds, "cpu"); count != 2 {
+		t.Error("want 2 got", count)
+	}
+	if count := len(ds.Measurements("cpu")); count != 2 {
+		t.Error("want 2 got", count)
+	}
+}
+
+func TestWALWriteAhead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "memsql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := WALOptions{Dir: dir, Sync: SyncAlways}
+	ds, err := OpenDurableStorage(NewStorage().(SnapshotStorage), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ds.SetSchema("cpu", &TableSchema{Columns: []ColumnSchema{{Name: "id", Type: vm.ValueInt64}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, _ := ToTable([]map[string]interface{}{{"id": "1"}})
+	if err := ds.Set("cpu", []KeyValue{{Key: "id", Value: "1"}}, time.Now(), table, nil); err != nil {
+		t.Fatal(err)
+	}
+	size := ds.size
+
+	// 修改失败时日志中不能有这条记录
+	table, _ = ToTable([]map[string]interface{}{{"id": "abc"}})
+	if err := ds.Set("cpu", []KeyValue{{Key: "id", Value: "2"}}, time.Now(), table, nil); err == nil {
+		t.Fatal("want error")
+	}
+	assertEqual(t, size, ds.size)
+	if ok, err := ds.Remove("cpu", []KeyValue{{Key: "id", Value: "3"}}); ok || err != nil {
+		t.Error(ok, err)
+	}
+	assertEqual(t, size, ds.size)
+	if err := ds.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 损坏的长度当作写了一半的记录
+	segments, _ := listSegments(dir)
+	filename := filepath.Join(dir, segmentName(segments[len(segments)-1]))
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0xff, 0xff, 0xff, 0xff, 1, 2, 3, 4, 5, 6})
+	f.Close()
+
+	ds, err = OpenDurableStorage(NewStorage().(SnapshotStorage), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+	assertEqual(t, 1, countRows(t, ds, "cpu"))
+	if st, err := os.Stat(filename); err != nil || st.Size() != size {
+		t.Error("tail isnot truncated", err)
+	}
+}
+
+func TestWALUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "memsql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := WALOptions{Dir: dir, Sync: SyncAlways}
+	ds, err := OpenDurableStorage(NewStorage().(SnapshotStorage), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := []KeyValue{{Key: "id", Value: "1"}}
+	for i := 0; i < 3; i++ {
+		err := ds.Update("cpu", tags, time.Now(), func(old Table, exists bool) (Table, error) {
+			if exists != (i > 0) {
+				t.Error(i, "exists is", exists)
+			}
+			old.Columns = []Column{{Name: "id"}}
+			old.Records = append(old.Records, []Value{vm.IntToValue(int64(i))})
+			return old, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ds.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ds, err = OpenDurableStorage(NewStorage().(SnapshotStorage), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 3, countRows(t, ds, "cpu"))
+
+	// 结果为空时删除 measurement
+	err = ds.Update("cpu", tags, time.Now(), func(old Table, exists bool) (Table, error) {
+		old.Records = nil
+		return old, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ds, err = OpenDurableStorage(NewStorage().(SnapshotStorage), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+	assertEqual(t, 0, len(ds.Measurements("cpu")))
+}
+
+func TestWALReplaceAndViews(t *testing.T) {
+	dir, err := ioutil.TempDir("", "memsql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := WALOptions{Dir: dir, Sync: SyncAlways}
+	ds, err := OpenDurableStorage(NewStorage().(SnapshotStorage), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var measurements []Measurement
+	for i := 0; i < 3; i++ {
+		table, err := ToTable([]map[string]interface{}{{"id": i}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		measurements = append(measurements, Measurement{Tags: []KeyValue{{Key: "id", Value: strconv.Itoa(i)}}, Table: table})
+	}
+	if err := ds.Replace("cpu_view", time.Now(), measurements); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Replace("cpu_view", time.Now(), measurements[1:]); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.SetView("cpu_view", &View{Name: "cpu_view", Query: "select * from cpu", Interval: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.SetView("old_view", &View{Name: "old_view", Query: "select * from cpu"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.SetView("old_view", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 第一次从日志中读取, 第二次从快照中读取
+	for i := 0; i < 2; i++ {
+		ds, err = OpenDurableStorage(NewColumnarStorage().(SnapshotStorage), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, 2, countRows(t, ds, "cpu_view"))
+		views := ds.Views()
+		if len(views) != 1 || views[0].Name != "cpu_view" || views[0].Interval != time.Minute {
+			t.Errorf("%#v", views)
+		}
+		if i == 0 {
+			if err := ds.Compact(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := ds.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -34,3 +34,47 @@ func (q Query) Where(predicate func(int, Record) (bool, error)) Query {
 		},
 	}
 }
+
+// WhereBatch filters a collection of values by the batches, predicate sets
+// keep[i] to true if the row i of the batch is kept. The keep is false for
+// all the rows before predicate is called.
+//
+// predicate runs in the partitions of q concurrently if q has the partitions,
+// see Partitions.
+func (q Query) WhereBatch(predicate func(Context, *Batch, []bool) error) Query {
+	return q.mapPartitions(func(q Query) Query {
+		return q.whereBatch(predicate)
+	})
+}
+
+func (q Query) whereBatch(predicate func(Context, *Batch, []bool) error) Query {
+	return FromBatches(func() BatchIterator {
+		next := q.Batches()
+		var keep []bool
+
+		return func(ctx Context) (*Batch, error) {
+			for {
+				b, err := next(ctx)
+				if err != nil {
+					return nil, err
+				}
+
+				if cap(keep) < b.Length {
+					keep = make([]bool, b.Length)
+				}
+				keep = keep[:b.Length]
+				for i := range keep {
+					keep[i] = false
+				}
+				if err := predicate(ctx, b, keep); err != nil {
+					return nil, err
+				}
+
+				b = b.Filter(keep)
+				if b.Length > 0 {
+					return b, nil
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package memsql
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestParallelism(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Close()
+
+	for i := 0; i < 8; i++ {
+		var cpu, mem []map[string]interface{}
+		for j := 0; j < 300; j++ {
+			id := i*300 + j
+			cpu = append(cpu, map[string]interface{}{"id": id, "value": id % 17})
+			if id%3 == 0 {
+				mem = append(mem, map[string]interface{}{"id": id, "size": id % 5})
+			}
+		}
+		host := "h" + strconv.Itoa(i)
+		app.Add(t, &TestTable{Name: "cpu", Tags: map[string]string{"host": host}, Records: cpu})
+		app.Add(t, &TestTable{Name: "mem", Tags: map[string]string{"host": host}, Records: mem})
+	}
+
+	for _, test := range []struct {
+		sql     string
+		rowSort bool
+	}{
+		{sql: "select id, value from cpu where value > 10", rowSort: true},
+		{sql: "select id from cpu where value > 10 order by id"},
+		{sql: "select id from cpu order by value, id limit 20"},
+		{sql: "select count(*), sum(value), avg(value) from cpu where value > 10"},
+		{sql: "select count(*), sum(value) from cpu where value > 10 and now() is not null"},
+		{sql: "select cpu.id, mem.size from cpu join mem on cpu.id = mem.id where cpu.value > 3", rowSort: true},
+		{sql: "select cpu.id from cpu left join mem on cpu.id = mem.id order by cpu.id"},
+	} {
+		t.Run(test.sql, func(t *testing.T) {
+			want, err := app.Execute(t, nil, test.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(want) == 0 {
+				t.Fatal("results is empty")
+			}
+			for _, parallelism := range []int{2, 4, 16} {
+				results, err := app.Execute(t, &Context{Parallelism: parallelism}, test.sql)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assertResults(t, test.rowSort, false, results, RecordToLines(t, want, false))
+			}
+		})
+	}
+}
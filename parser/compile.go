@@ -0,0 +1,292 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/runner-mei/memsql/vm"
+	"github.com/xwb1989/sqlparser"
+)
+
+// Compile compiles the expression to a program of the stack machine, the
+// literals are folded to the constants and the columns are read by the
+// slots, see memcore.Program. The expressions which aren't supported by
+// the instructions are evaluated by ToGetValue.
+func Compile(ctx FilterContext, expr sqlparser.Expr) (*vm.Program, error) {
+	c := &compiler{ctx: ctx, p: &vm.Program{Location: location(ctx)}}
+	if err := c.compile(expr); err != nil {
+		return nil, err
+	}
+	return c.p, nil
+}
+
+type compiler struct {
+	ctx FilterContext
+	p   *vm.Program
+}
+
+var binaryOpCodes = map[string]vm.OpCode{
+	sqlparser.PlusStr:       vm.OpPlus,
+	sqlparser.MinusStr:      vm.OpMinus,
+	sqlparser.MultStr:       vm.OpMult,
+	sqlparser.DivStr:        vm.OpDiv,
+	sqlparser.IntDivStr:     vm.OpIntDiv,
+	sqlparser.ModStr:        vm.OpMod,
+	sqlparser.BitAndStr:     vm.OpBitAnd,
+	sqlparser.BitOrStr:      vm.OpBitOr,
+	sqlparser.BitXorStr:     vm.OpBitXor,
+	sqlparser.ShiftLeftStr:  vm.OpShiftLeft,
+	sqlparser.ShiftRightStr: vm.OpShiftRight,
+}
+
+var unaryOpCodes = map[string]vm.OpCode{
+	sqlparser.UMinusStr: vm.OpUminus,
+	sqlparser.UPlusStr:  vm.OpUplus,
+	sqlparser.TildaStr:  vm.OpBitNot,
+	sqlparser.BangStr:   vm.OpBang,
+}
+
+var comparisonOpCodes = map[string]vm.OpCode{
+	sqlparser.EqualStr:         vm.OpEqual,
+	sqlparser.NotEqualStr:      vm.OpNotEqual,
+	sqlparser.LessThanStr:      vm.OpLessThan,
+	sqlparser.LessEqualStr:     vm.OpLessEqual,
+	sqlparser.GreaterThanStr:   vm.OpGreaterThan,
+	sqlparser.GreaterEqualStr:  vm.OpGreaterEqual,
+	sqlparser.NullSafeEqualStr: vm.OpNullSafeEqual,
+	sqlparser.LikeStr:          vm.OpLike,
+	sqlparser.NotLikeStr:       vm.OpNotLike,
+	sqlparser.RegexpStr:        vm.OpRegexp,
+	sqlparser.NotRegexpStr:     vm.OpNotRegexp,
+}
+
+var isOpCodes = map[string]vm.OpCode{
+	sqlparser.IsNullStr:     vm.OpIsNull,
+	sqlparser.IsNotNullStr:  vm.OpIsNotNull,
+	sqlparser.IsTrueStr:     vm.OpIsTrue,
+	sqlparser.IsNotTrueStr:  vm.OpIsNotTrue,
+	sqlparser.IsFalseStr:    vm.OpIsFalse,
+	sqlparser.IsNotFalseStr: vm.OpIsNotFalse,
+}
+
+func (c *compiler) compile(expr sqlparser.Expr) error {
+	start := len(c.p.Code)
+	native, err := c.compileExpr(expr)
+	if err != nil {
+		return err
+	}
+	if !native {
+		return c.eval(expr)
+	}
+	if !c.p.IsConst(start) && c.isPure(start) {
+		c.p.Fold(start)
+	}
+	return nil
+}
+
+// eval 用 ToGetValue 计算不能编译为指令的表达式
+func (c *compiler) eval(expr sqlparser.Expr) error {
+	read, err := ToGetValue(c.ctx, expr)
+	if err != nil {
+		return err
+	}
+	c.p.Emit(vm.OpEval, c.p.AddFunc(read))
+	return nil
+}
+
+// isPure 判断从 start 开始的指令是否不读取列, 即可以在编译时计算
+func (c *compiler) isPure(start int) bool {
+	for _, instr := range c.p.Code[start:] {
+		switch instr.Op {
+		case vm.OpColumn, vm.OpColumnOrNull, vm.OpEval:
+			return false
+		}
+	}
+	return true
+}
+
+func (c *compiler) constant(expr sqlparser.Expr) error {
+	read, err := ToGetValue(c.ctx, expr)
+	if err != nil {
+		return err
+	}
+	value, err := read(nil)
+	if err != nil {
+		// 在运行时再返回错误, 这样空表不会出错
+		c.p.Emit(vm.OpEval, c.p.AddFunc(read))
+		return nil
+	}
+	c.p.Emit(vm.OpConst, c.p.AddConst(value))
+	return nil
+}
+
+func (c *compiler) column(col *sqlparser.ColName, op vm.OpCode) {
+	var name = strings.ToLower(col.Name.String())
+	if strings.HasPrefix(name, "@") {
+		name = strings.TrimPrefix(name, "@")
+	}
+	var tableName = strings.ToLower(col.Qualifier.Name.String())
+	if tableName == "" {
+		tableName = strings.ToLower(col.Qualifier.Qualifier.String())
+	}
+	c.p.Emit(op, c.p.AddColumn(tableName, name))
+}
+
+// compileExpr 编译表达式, 返回 false 表示表达式不能编译为指令
+func (c *compiler) compileExpr(expr sqlparser.Expr) (bool, error) {
+	switch v := expr.(type) {
+	case *sqlparser.SQLVal, *sqlparser.NullVal, sqlparser.BoolVal:
+		return true, c.constant(v)
+	case *sqlparser.ColName:
+		c.column(v, vm.OpColumn)
+		return true, nil
+	case *sqlparser.ParenExpr:
+		return true, c.compile(v.Expr)
+	case *sqlparser.CollateExpr:
+		// collation 只影响比较, 由 CompareOptionOf 读取
+		if _, err := vm.ParseCollation(v.Charset); err != nil {
+			return false, err
+		}
+		return true, c.compile(v.Expr)
+	case *sqlparser.BinaryExpr:
+		op, ok := binaryOpCodes[v.Operator]
+		if !ok {
+			return false, nil
+		}
+		if err := c.compile(v.Left); err != nil {
+			return false, err
+		}
+		if err := c.compile(v.Right); err != nil {
+			return false, err
+		}
+		c.p.Emit(op, 0)
+		return true, nil
+	case *sqlparser.UnaryExpr:
+		op, ok := unaryOpCodes[v.Operator]
+		if !ok {
+			return false, nil
+		}
+		if err := c.compile(v.Expr); err != nil {
+			return false, err
+		}
+		c.p.Emit(op, 0)
+		return true, nil
+	case *sqlparser.AndExpr:
+		return true, c.logic(v.Left, v.Right, vm.OpJumpIfFalse, vm.OpAnd)
+	case *sqlparser.OrExpr:
+		return true, c.logic(v.Left, v.Right, vm.OpJumpIfTrue, vm.OpOr)
+	case *sqlparser.NotExpr:
+		if err := c.compile(v.Expr); err != nil {
+			return false, err
+		}
+		c.p.Emit(vm.OpNot, 0)
+		return true, nil
+	case *sqlparser.ComparisonExpr:
+		if v.Operator == sqlparser.InStr || v.Operator == sqlparser.NotInStr {
+			return c.in(v)
+		}
+		op, ok := comparisonOpCodes[v.Operator]
+		if !ok {
+			return false, nil
+		}
+		if err := c.compile(v.Left); err != nil {
+			return false, err
+		}
+		if err := c.compile(v.Right); err != nil {
+			return false, err
+		}
+		c.p.Emit(op, c.p.AddOption(CompareOptionOf(c.ctx, v.Left, v.Right)))
+		return true, nil
+	case *sqlparser.RangeCond:
+		op := vm.OpBetween
+		switch v.Operator {
+		case sqlparser.BetweenStr:
+		case sqlparser.NotBetweenStr:
+			op = vm.OpNotBetween
+		default:
+			return false, nil
+		}
+		for _, e := range []sqlparser.Expr{v.Left, v.From, v.To} {
+			if err := c.compile(e); err != nil {
+				return false, err
+			}
+		}
+		c.p.Emit(op, c.p.AddOption(CompareOptionOf(c.ctx, v.Left, v.From, v.To)))
+		return true, nil
+	case *sqlparser.IsExpr:
+		op, ok := isOpCodes[v.Operator]
+		if !ok {
+			return false, nil
+		}
+		if op == vm.OpIsNull || op == vm.OpIsNotNull {
+			// 不存在的列为 NULL, 见 vm.IsNull
+			col, ok := unparen(v.Expr).(*sqlparser.ColName)
+			if !ok {
+				return false, nil
+			}
+			c.column(col, vm.OpColumnOrNull)
+		} else if err := c.compile(v.Expr); err != nil {
+			return false, err
+		}
+		c.p.Emit(op, 0)
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+func (c *compiler) logic(left, right sqlparser.Expr, jump, op vm.OpCode) error {
+	if err := c.compile(left); err != nil {
+		return err
+	}
+	pc := c.p.Emit(jump, 0)
+	if err := c.compile(right); err != nil {
+		return err
+	}
+	c.p.Emit(op, 0)
+	c.p.Patch(pc)
+	return nil
+}
+
+// in 编译 IN, 只支持常量列表
+func (c *compiler) in(v *sqlparser.ComparisonExpr) (bool, error) {
+	tuple, ok := v.Right.(sqlparser.ValTuple)
+	if !ok {
+		return false, nil
+	}
+
+	values := make([]vm.Value, 0, len(tuple))
+	for _, e := range tuple {
+		start := len(c.p.Code)
+		if err := c.compile(e); err != nil {
+			return false, err
+		}
+		isConst := c.p.IsConst(start)
+		if isConst {
+			values = append(values, c.p.Consts[c.p.Code[start].Arg])
+		}
+		c.p.Code = c.p.Code[:start]
+		if !isConst {
+			return false, nil
+		}
+	}
+
+	if err := c.compile(v.Left); err != nil {
+		return false, err
+	}
+	op := vm.OpIn
+	if v.Operator == sqlparser.NotInStr {
+		op = vm.OpNotIn
+	}
+	c.p.Emit(op, c.p.AddList(values, CompareOptionOf(c.ctx, v.Left)))
+	return true, nil
+}
+
+// CompileSelect is same as ToGetSelectValue but the expression is compiled,
+// see Compile.
+func CompileSelect(ctx FilterContext, expr sqlparser.SelectExpr) (*vm.Program, error) {
+	if aliased, ok := expr.(*sqlparser.AliasedExpr); ok {
+		return Compile(ctx, aliased.Expr)
+	}
+	return nil, fmt.Errorf("invalid expression %T %+v", expr, expr)
+}
@@ -0,0 +1,105 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/runner-mei/memsql/vm"
+	"github.com/xwb1989/sqlparser"
+)
+
+type valuesContext map[string]vm.Value
+
+func (values valuesContext) GetValue(tableName, name string) (vm.Value, error) {
+	value, ok := values[name]
+	if !ok {
+		return vm.Null(), vm.ErrNotFound
+	}
+	return value, nil
+}
+
+func TestCompile(t *testing.T) {
+	ctx := valuesContext{
+		"a": vm.IntToValue(3),
+		"b": vm.StringToValue("abc"),
+		"c": vm.Null(),
+	}
+
+	for _, test := range []struct {
+		s    string
+		code int
+	}{
+		{s: "1 + 2 * 3 = 7", code: 1},
+		{s: "a + 2 * 3", code: 3},
+		{s: "a > 1 and b like 'a%'", code: 8},
+		{s: "a > 5 or c is null", code: 7},
+		{s: "d is null and a between 1 and 3", code: 8},
+		{s: "a in (1, 1 + 2) and b not in ('x')", code: 6},
+		{s: "a in (1, a)", code: 1},
+		{s: "(c > 1) is not true", code: 4},
+		{s: "not (a <=> c) and !(a & 1 = 0)", code: 12},
+		{s: "b collate utf8mb4_bin = 'ABC'", code: 3},
+		{s: "b regexp '^a'", code: 3},
+	} {
+		stmt, err := sqlparser.Parse("select * from cpu where " + test.s)
+		if err != nil {
+			t.Error(test.s)
+			t.Error(err)
+			continue
+		}
+		expr := stmt.(*sqlparser.Select).Where.Expr
+
+		read, err := ToGetValue(nil, expr)
+		if err != nil {
+			t.Error(test.s)
+			t.Error(err)
+			continue
+		}
+		want, err := read(ctx)
+		if err != nil {
+			t.Error(test.s)
+			t.Error(err)
+			continue
+		}
+
+		p, err := Compile(nil, expr)
+		if err != nil {
+			t.Error(test.s)
+			t.Error(err)
+			continue
+		}
+		got, err := p.Run(ctx, nil, nil)
+		if err != nil {
+			t.Error(test.s)
+			t.Error(err)
+			continue
+		}
+		if got != want {
+			t.Error(test.s)
+			t.Error("want:", want.String())
+			t.Error(" got:", got.String())
+		}
+		if len(p.Code) != test.code {
+			t.Error(test.s)
+			t.Error("want:", test.code, "instructions")
+			t.Error(" got:", len(p.Code), "instructions", p.Code)
+		}
+	}
+}
+
+func TestCompileError(t *testing.T) {
+	stmt, err := sqlparser.Parse("select * from cpu where a > 'a' + 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := Compile(nil, stmt.(*sqlparser.Select).Where.Expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 'a' + 1 计算失败, 所以不能被折叠为常量
+	if len(p.Code) != 5 {
+		t.Error("want: 5 instructions got:", len(p.Code), p.Code)
+	}
+	if _, err := p.Run(valuesContext{"a": vm.IntToValue(1)}, nil, nil); err == nil {
+		t.Error("want error")
+	}
+}
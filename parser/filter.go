@@ -19,41 +19,125 @@ type FilterContext interface {
 	ExecuteSelect(sel sqlparser.SelectStatement) (memcore.Query, error)
 }
 
+// LocationContext is implemented by the FilterContext which has a time zone,
+// the datetimes are parsed, formatted and truncated to the day in it.
+type LocationContext interface {
+	Location() *time.Location
+}
+
+// location 返回 ctx 的时区, nil 表示 vm.TimeLocal
+func location(ctx FilterContext) *time.Location {
+	if lc, ok := ctx.(LocationContext); ok {
+		return lc.Location()
+	}
+	return nil
+}
+
+// CollationContext is implemented by the FilterContext which has the
+// collations of the session and the columns.
+type CollationContext interface {
+	SessionCollation() vm.Collation
+	ColumnCollation(col *sqlparser.ColName) (vm.Collation, bool)
+}
+
+// CompareOptionOf returns the option to compare the operands, the collation
+// is the first one of the COLLATE or BINARY of the operands, the collation
+// of the column in the operands and the collation of the session.
+func CompareOptionOf(ctx FilterContext, exprs ...sqlparser.Expr) vm.CompareOption {
+	opt := vm.EmptyCompareOption()
+	opt.Location = location(ctx)
+
+	for _, expr := range exprs {
+		switch v := unparen(expr).(type) {
+		case *sqlparser.CollateExpr:
+			if c, err := vm.ParseCollation(v.Charset); err == nil {
+				opt.Collation = c
+				return opt
+			}
+		case *sqlparser.UnaryExpr:
+			if v.Operator == sqlparser.BinaryStr || v.Operator == sqlparser.UBinaryStr {
+				opt.Collation = vm.CollationBinary
+				return opt
+			}
+		case *sqlparser.ConvertExpr:
+			if strings.ToLower(v.Type.Type) == "binary" {
+				opt.Collation = vm.CollationBinary
+				return opt
+			}
+		}
+	}
+	cc, ok := ctx.(CollationContext)
+	if !ok {
+		return opt
+	}
+	for _, expr := range exprs {
+		if col, ok := unparen(expr).(*sqlparser.ColName); ok {
+			if c, ok := cc.ColumnCollation(col); ok {
+				opt.Collation = c
+				return opt
+			}
+		}
+	}
+	opt.Collation = cc.SessionCollation()
+	return opt
+}
+
+func unparen(expr sqlparser.Expr) sqlparser.Expr {
+	for {
+		paren, ok := expr.(*sqlparser.ParenExpr)
+		if !ok {
+			return expr
+		}
+		expr = paren.Expr
+	}
+}
+
+// ToFilter converts the expression to a filter, Unknown is same as false.
 func ToFilter(ctx FilterContext, expr sqlparser.Expr) (func(vm.Context) (bool, error), error) {
+	f, err := ToCondition(ctx, expr)
+	if err != nil {
+		return nil, err
+	}
+	return vm.Filter(f), nil
+}
+
+// ToCondition converts the expression to a predicate in the three-valued
+// logic, the comparisons with NULL are Unknown.
+func ToCondition(ctx FilterContext, expr sqlparser.Expr) (func(vm.Context) (vm.Truth, error), error) {
 	if expr == nil {
-		return func(vm.Context) (bool, error) {
-			return true, nil
+		return func(vm.Context) (vm.Truth, error) {
+			return vm.True, nil
 		}, nil
 	}
 	switch v := expr.(type) {
 	case *sqlparser.AndExpr:
-		leftFilter, err := ToFilter(ctx, v.Left)
+		leftFilter, err := ToCondition(ctx, v.Left)
 		if err != nil {
 			return nil, err
 		}
-		rightFilter, err := ToFilter(ctx, v.Right)
+		rightFilter, err := ToCondition(ctx, v.Right)
 		if err != nil {
 			return nil, err
 		}
 		return vm.And(leftFilter, rightFilter), nil
 	case *sqlparser.OrExpr:
-		leftFilter, err := ToFilter(ctx, v.Left)
+		leftFilter, err := ToCondition(ctx, v.Left)
 		if err != nil {
 			return nil, err
 		}
-		rightFilter, err := ToFilter(ctx, v.Right)
+		rightFilter, err := ToCondition(ctx, v.Right)
 		if err != nil {
 			return nil, err
 		}
 		return vm.Or(leftFilter, rightFilter), nil
 	case *sqlparser.NotExpr:
-		f, err := ToFilter(ctx, v.Expr)
+		f, err := ToCondition(ctx, v.Expr)
 		if err != nil {
 			return nil, err
 		}
 		return vm.Not(f), nil
 	case *sqlparser.ParenExpr:
-		return ToFilter(ctx, v.Expr)
+		return ToCondition(ctx, v.Expr)
 	case *sqlparser.ComparisonExpr:
 		leftValue, err := ToGetValue(ctx, v.Left)
 		if err != nil {
@@ -64,14 +148,14 @@ func ToFilter(ctx FilterContext, expr sqlparser.Expr) (func(vm.Context) (bool, e
 			if err != nil {
 				return nil, err
 			}
-			return vm.In(leftValue, rightValues), nil
+			return vm.InWith(leftValue, rightValues, CompareOptionOf(ctx, v.Left)), nil
 		}
 		if v.Operator == sqlparser.NotInStr {
 			rightValues, err := ToGetValues(ctx, v.Right)
 			if err != nil {
 				return nil, err
 			}
-			return vm.NotIn(leftValue, rightValues), nil
+			return vm.NotInWith(leftValue, rightValues, CompareOptionOf(ctx, v.Left)), nil
 		}
 
 		rightValue, err := ToGetValue(ctx, v.Right)
@@ -80,25 +164,25 @@ func ToFilter(ctx FilterContext, expr sqlparser.Expr) (func(vm.Context) (bool, e
 		}
 		switch v.Operator {
 		case sqlparser.EqualStr:
-			return vm.Equal(leftValue, rightValue), nil
+			return vm.EqualWith(leftValue, rightValue, CompareOptionOf(ctx, v.Left, v.Right)), nil
 		case sqlparser.LessThanStr:
-			return vm.LessThan(leftValue, rightValue), nil
+			return vm.LessThanWith(leftValue, rightValue, CompareOptionOf(ctx, v.Left, v.Right)), nil
 		case sqlparser.GreaterThanStr:
-			return vm.GreaterThan(leftValue, rightValue), nil
+			return vm.GreaterThanWith(leftValue, rightValue, CompareOptionOf(ctx, v.Left, v.Right)), nil
 		case sqlparser.LessEqualStr:
-			return vm.LessEqual(leftValue, rightValue), nil
+			return vm.LessEqualWith(leftValue, rightValue, CompareOptionOf(ctx, v.Left, v.Right)), nil
 		case sqlparser.GreaterEqualStr:
-			return vm.GreaterEqual(leftValue, rightValue), nil
+			return vm.GreaterEqualWith(leftValue, rightValue, CompareOptionOf(ctx, v.Left, v.Right)), nil
 		case sqlparser.NotEqualStr:
-			return vm.NotEqual(leftValue, rightValue), nil
+			return vm.NotEqualWith(leftValue, rightValue, CompareOptionOf(ctx, v.Left, v.Right)), nil
 		// case sqlparser.InStr:
 		// case sqlparser.NotInStr:
 		case sqlparser.NullSafeEqualStr:
-			return nil, errUnknownOperator(v.Operator)
+			return vm.NullSafeEqualWith(leftValue, rightValue, CompareOptionOf(ctx, v.Left, v.Right)), nil
 		case sqlparser.LikeStr:
-			return vm.Like(leftValue, rightValue), nil
+			return vm.LikeWith(leftValue, rightValue, CompareOptionOf(ctx, v.Left, v.Right)), nil
 		case sqlparser.NotLikeStr:
-			return vm.NotLike(leftValue, rightValue), nil
+			return vm.NotLikeWith(leftValue, rightValue, CompareOptionOf(ctx, v.Left, v.Right)), nil
 		case sqlparser.RegexpStr:
 			return vm.Regexp(leftValue, rightValue), nil
 		case sqlparser.NotRegexpStr:
@@ -125,42 +209,50 @@ func ToFilter(ctx FilterContext, expr sqlparser.Expr) (func(vm.Context) (bool, e
 		}
 
 		if v.Operator == sqlparser.BetweenStr {
-			return vm.Between(leftValue, fromValue, toValue), nil
+			return vm.BetweenWith(leftValue, fromValue, toValue, CompareOptionOf(ctx, v.Left, v.From, v.To)), nil
 		}
 		if v.Operator == sqlparser.NotBetweenStr {
-			return vm.NotBetween(leftValue, fromValue, toValue), nil
+			return vm.NotBetweenWith(leftValue, fromValue, toValue, CompareOptionOf(ctx, v.Left, v.From, v.To)), nil
 		}
 		return nil, errUnknownOperator(v.Operator)
 	case *sqlparser.IsExpr:
-		value, err := ToGetValue(ctx, v.Expr)
+		switch v.Operator {
+		case sqlparser.IsNullStr, sqlparser.IsNotNullStr:
+			value, err := ToGetValue(ctx, v.Expr)
+			if err != nil {
+				return nil, err
+			}
+			if v.Operator == sqlparser.IsNullStr {
+				return vm.IsNull(value), nil
+			}
+			return vm.IsNotNull(value), nil
+		}
+
+		f, err := ToCondition(ctx, v.Expr)
 		if err != nil {
 			return nil, err
 		}
 		switch v.Operator {
-		case sqlparser.IsNullStr:
-			return vm.IsNull(value), nil
-		case sqlparser.IsNotNullStr:
-			return vm.IsNotNull(value), nil
 		case sqlparser.IsTrueStr:
-			return vm.IsTrue(value), nil
+			return vm.IsTrue(f), nil
 		case sqlparser.IsNotTrueStr:
-			return vm.IsNotTrue(value), nil
+			return vm.IsNotTrue(f), nil
 		case sqlparser.IsFalseStr:
-			return vm.IsFalse(value), nil
+			return vm.IsFalse(f), nil
 		case sqlparser.IsNotFalseStr:
-			return vm.IsNotFalse(value), nil
+			return vm.IsNotFalse(f), nil
 		}
 		return nil, errUnknownOperator(v.Operator)
 	case *sqlparser.ExistsExpr:
 		return nil, ErrUnsupportedExpr("ExistsExpr")
 	case *sqlparser.SQLVal:
 		return nil, ErrUnsupportedExpr("SQLVal")
-	case *sqlparser.NullVal:
-		return nil, ErrUnsupportedExpr("NullVal")
-	case sqlparser.BoolVal:
-		return nil, ErrUnsupportedExpr("BoolVal")
-	case *sqlparser.ColName:
-		return nil, ErrUnsupportedExpr("ColName")
+	case *sqlparser.NullVal, sqlparser.BoolVal, *sqlparser.ColName:
+		value, err := ToGetValue(ctx, v)
+		if err != nil {
+			return nil, err
+		}
+		return vm.Truthy(value), nil
 	case sqlparser.ValTuple:
 		return nil, ErrUnsupportedExpr("ValTuple")
 	case *sqlparser.Subquery:
@@ -170,19 +262,40 @@ func ToFilter(ctx FilterContext, expr sqlparser.Expr) (func(vm.Context) (bool, e
 	case *sqlparser.BinaryExpr:
 		return nil, ErrUnsupportedExpr("BinaryExpr")
 	case *sqlparser.UnaryExpr:
-		return nil, ErrUnsupportedExpr("UnaryExpr")
+		if v.Operator == sqlparser.BangStr {
+			f, err := ToCondition(ctx, v.Expr)
+			if err == nil {
+				return vm.Not(f), nil
+			}
+		}
+		value, err := ToGetValue(ctx, v)
+		if err != nil {
+			return nil, err
+		}
+		return vm.Truthy(value), nil
 	case *sqlparser.IntervalExpr:
 		return nil, ErrUnsupportedExpr("IntervalExpr")
 	case *sqlparser.CollateExpr:
-		return nil, ErrUnsupportedExpr("CollateExpr")
+		if _, err := vm.ParseCollation(v.Charset); err != nil {
+			return nil, err
+		}
+		return ToCondition(ctx, v.Expr)
 	case *sqlparser.FuncExpr:
-		return nil, ErrUnsupportedExpr("FuncExpr")
+		value, err := ToFuncGetValue(ctx, v)
+		if err != nil {
+			return nil, err
+		}
+		return vm.Truthy(value), nil
 	case *sqlparser.CaseExpr:
 		return nil, ErrUnsupportedExpr("CaseExpr")
 	case *sqlparser.ValuesFuncExpr:
 		return nil, ErrUnsupportedExpr("ValuesFuncExpr")
 	case *sqlparser.ConvertExpr:
-		return nil, ErrUnsupportedExpr("ConvertExpr")
+		value, err := ToGetValue(ctx, v)
+		if err != nil {
+			return nil, err
+		}
+		return vm.Truthy(value), nil
 	case *sqlparser.SubstrExpr:
 		return nil, ErrUnsupportedExpr("SubstrExpr")
 	case *sqlparser.ConvertUsingExpr:
@@ -194,7 +307,7 @@ func ToFilter(ctx FilterContext, expr sqlparser.Expr) (func(vm.Context) (bool, e
 	case *sqlparser.Default:
 		return nil, ErrUnsupportedExpr("Default")
 	default:
-		return nil, fmt.Errorf("ToFilter: invalid expression %T %+v", expr, expr)
+		return nil, fmt.Errorf("ToCondition: invalid expression %T %+v", expr, expr)
 	}
 }
 
@@ -293,23 +406,32 @@ func ToGetValue(ctx FilterContext, expr sqlparser.Expr) (func(vm.Context) (vm.Va
 		}
 
 		switch v.Operator {
-		// case sqlparser.BitAndStr:
-		// case sqlparser.BitOrStr:
-		// case sqlparser.BitXorStr:
+		case sqlparser.BitAndStr:
+			return vm.BitAndFunc(leftValue, rightValue), nil
+		case sqlparser.BitOrStr:
+			return vm.BitOrFunc(leftValue, rightValue), nil
+		case sqlparser.BitXorStr:
+			return vm.BitXorFunc(leftValue, rightValue), nil
 		case sqlparser.PlusStr:
-			return vm.PlusFunc(leftValue, rightValue), nil
+			return vm.PlusFuncIn(leftValue, rightValue, location(ctx)), nil
 		case sqlparser.MinusStr:
-			return vm.MinusFunc(leftValue, rightValue), nil
+			return vm.MinusFuncIn(leftValue, rightValue, location(ctx)), nil
 		case sqlparser.MultStr:
 			return vm.MultFunc(leftValue, rightValue), nil
 		case sqlparser.DivStr:
 			return vm.DivFunc(leftValue, rightValue), nil
-		// case sqlparser.IntDivStr:
-		// 	return vm.IntDiv(leftValue, rightValue), nil
+		case sqlparser.IntDivStr:
+			return vm.IntDivFunc(leftValue, rightValue), nil
 		case sqlparser.ModStr:
 			return vm.ModFunc(leftValue, rightValue), nil
-		// case sqlparser.ShiftLeftStr:
-		// case sqlparser.ShiftRightStr:
+		case sqlparser.JSONExtractOp:
+			return vm.JSONExtractFunc(leftValue, rightValue), nil
+		case sqlparser.JSONUnquoteExtractOp:
+			return vm.JSONUnquoteExtractFunc(leftValue, rightValue), nil
+		case sqlparser.ShiftLeftStr:
+			return vm.ShiftLeftFunc(leftValue, rightValue), nil
+		case sqlparser.ShiftRightStr:
+			return vm.ShiftRightFunc(leftValue, rightValue), nil
 		default:
 			return nil, fmt.Errorf("ToGetValue: invalid expression %T %+v", expr, expr)
 		}
@@ -320,14 +442,17 @@ func ToGetValue(ctx FilterContext, expr sqlparser.Expr) (func(vm.Context) (vm.Va
 		}
 
 		switch v.Operator {
-		// case sqlparser.UPlusStr:
+		case sqlparser.UPlusStr:
+			return vm.UplusFunc(readValue), nil
 		case sqlparser.UMinusStr:
 			return vm.UminusFunc(readValue), nil
-		// case sqlparser.TildaStr:
-		// case sqlparser.BangStr:
-		// case sqlparser.IntDivStr:
-		// case sqlparser.BinaryStr:
-		// case sqlparser.UBinaryStr:
+		case sqlparser.TildaStr:
+			return vm.BitNotFunc(readValue), nil
+		case sqlparser.BangStr:
+			return vm.BangFunc(readValue), nil
+		case sqlparser.BinaryStr, sqlparser.UBinaryStr:
+			// BINARY 转换为字节串, 比较时按 binary collation, 见 CompareOptionOf
+			return vm.ConvertToBinary(readValue, -1), nil
 		default:
 			return nil, fmt.Errorf("ToGetValue: invalid expression %T %+v", expr, expr)
 		}
@@ -338,9 +463,7 @@ func ToGetValue(ctx FilterContext, expr sqlparser.Expr) (func(vm.Context) (vm.Va
 			return nil, err
 		}
 		unit := strings.ToLower(v.Unit)
-		switch unit {
-		case "years", "year", "months", "month", "weeks", "week", "days", "day", "hours", "hour", "minutes", "minute", "seconds", "second":
-		default:
+		if _, err := vm.IntervalOf(0, unit); err != nil {
 			return nil, fmt.Errorf("invalid interval expression %+v", expr)
 		}
 
@@ -354,29 +477,25 @@ func ToGetValue(ctx FilterContext, expr sqlparser.Expr) (func(vm.Context) (vm.Va
 				return vm.Null(), err
 			}
 
-			switch unit {
-			case "years", "year":
-				return vm.IntervalToValue(time.Duration(i64) * 365 * 24 * 60 * 60 * time.Second), nil
-			case "months", "month":
-				return vm.IntervalToValue(time.Duration(i64) * 30 * 24 * 60 * 60 * time.Second), nil
-			case "weeks", "week":
-				return vm.IntervalToValue(time.Duration(i64) * 7 * 24 * 60 * 60 * time.Second), nil
-			case "days", "day":
-				return vm.IntervalToValue(time.Duration(i64) * 24 * 60 * 60 * time.Second), nil
-			case "hours", "hour":
-				return vm.IntervalToValue(time.Duration(i64) * 60 * 60 * time.Second), nil
-			case "minutes", "minute":
-				return vm.IntervalToValue(time.Duration(i64) * 60 * time.Second), nil
-			case "seconds", "second":
-				return vm.IntervalToValue(time.Duration(i64) * time.Second), nil
-			default:
-				return vm.Null(), fmt.Errorf("invalid interval expression %+v", expr)
-			}
+			return vm.IntervalOf(i64, unit)
 		}, nil
 	case *sqlparser.CollateExpr:
-		return nil, ErrUnsupportedExpr("CollateExpr")
+		// collation 只影响比较, 由 CompareOptionOf 读取
+		if _, err := vm.ParseCollation(v.Charset); err != nil {
+			return nil, err
+		}
+		return ToGetValue(ctx, v.Expr)
 	case *sqlparser.FuncExpr:
 		return ToFuncGetValue(ctx, v)
+	case *sqlparser.ParenExpr:
+		return ToGetValue(ctx, v.Expr)
+	case *sqlparser.AndExpr, *sqlparser.OrExpr, *sqlparser.NotExpr,
+		*sqlparser.ComparisonExpr, *sqlparser.RangeCond, *sqlparser.IsExpr:
+		f, err := ToCondition(ctx, v)
+		if err != nil {
+			return nil, err
+		}
+		return vm.TruthToValue(f), nil
 	case *sqlparser.CaseExpr:
 		// CaseExpr represents a CASE expression.
 		// type CaseExpr struct {
@@ -437,6 +556,11 @@ func ToGetValue(ctx FilterContext, expr sqlparser.Expr) (func(vm.Context) (vm.Va
 			return nil, err
 		}
 
+		length, err := toTypeLength(v.Type.Length, -1)
+		if err != nil {
+			return nil, err
+		}
+
 		switch strings.ToLower(v.Type.Type) {
 		case "int", "integer", "signed", "signed integer":
 			return vm.ConvertToInt(readValue), nil
@@ -444,28 +568,47 @@ func ToGetValue(ctx FilterContext, expr sqlparser.Expr) (func(vm.Context) (vm.Va
 			return vm.ConvertToUint(readValue), nil
 		case "bool", "boolean":
 			return vm.ConvertToBool(readValue), nil
-		// case "binary":
-		// 	return vm.ConvertToBinary(readValue, v.Type.Length), nil
-		// case "char":
-		// 	return vm.ConvertToChar(readValue, v.Type.Length, v.Type.Charset), nil
-		// case "date":
-		// 	return vm.ConvertToDate(readValue), nil
+		case "float", "double", "real":
+			return vm.ConvertToFloat(readValue), nil
+		case "binary":
+			return vm.ConvertToBinary(readValue, length), nil
+		case "char":
+			return vm.ConvertToCharIn(readValue, length, v.Type.Charset, location(ctx)), nil
+		case "nchar":
+			return vm.ConvertToCharIn(readValue, length, "utf8", location(ctx)), nil
+		case "date":
+			return vm.ConvertToDateIn(readValue, location(ctx)), nil
 		case "datetime":
-			return vm.ConvertToDatetime(readValue), nil
-			// case "time":
-			// 	return vm.ConvertToTime(readValue), nil
-			// case "decimal":
-			// 	return vm.ConvertToDecimal(readValue, v.Type.Length), nil
-			// case "json":
-			// 	return vm.ConvertToJSON(readValue), nil
-			// case "nchar":
-			// 	return vm.ConvertToNChar(readValue, v.Type.Length, v.Type.Charset), nil
+			return vm.ConvertToDatetimeIn(readValue, location(ctx)), nil
+		case "time":
+			return vm.ConvertToTimeIn(readValue, location(ctx)), nil
+		case "decimal":
+			if v.Type.Length == nil {
+				length = vm.DefaultDecimalLength
+			}
+			scale, err := toTypeLength(v.Type.Scale, vm.DefaultDecimalScale)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := vm.ConvertValueToDecimal(vm.IntToValue(0), length, scale); err != nil {
+				return nil, err
+			}
+			return vm.ConvertToDecimal(readValue, length, scale), nil
+		case "json":
+			return vm.ConvertToJSON(readValue), nil
 		}
 		return nil, fmt.Errorf("invalid expression %T %+v", expr, expr)
 	case *sqlparser.SubstrExpr:
 		return nil, ErrUnsupportedExpr("SubstrExpr")
 	case *sqlparser.ConvertUsingExpr:
-		return nil, ErrUnsupportedExpr("ConvertUsingExpr")
+		readValue, err := ToGetValue(ctx, v.Expr)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := vm.ConvertCharset("", v.Type); err != nil {
+			return nil, err
+		}
+		return vm.ConvertUsing(readValue, v.Type), nil
 	case *sqlparser.MatchExpr:
 		return nil, ErrUnsupportedExpr("MatchExpr")
 	case *sqlparser.GroupConcatExpr:
@@ -484,7 +627,15 @@ func ToFuncGetValue(ctx FilterContext, expr *sqlparser.FuncExpr) (func(vm.Contex
 	// 	Exprs     SelectExprs
 	// }
 
-	f, ok := vm.Funcs[expr.Name.String()]
+	if timeFunc, ok := vm.TimeFuncs[expr.Name.Lowered()]; ok {
+		values, err := ToGetValues(ctx, expr.Exprs)
+		if err != nil {
+			return nil, err
+		}
+		return vm.CallFunc(timeFunc(location(ctx)), values), nil
+	}
+
+	f, ok := vm.Funcs[expr.Name.Lowered()]
 	if !ok {
 		return nil, errors.New("func '" + expr.Name.String() + "' isnot exists")
 	}
@@ -591,6 +742,18 @@ func ErrUnsupportedExpr(op string) error {
 	return errors.New("unsupported expression '" + op + "'")
 }
 
+// toTypeLength 读取类型中的长度, 如 char(10)
+func toTypeLength(v *sqlparser.SQLVal, defaultValue int) (int, error) {
+	if v == nil {
+		return defaultValue, nil
+	}
+	i, err := strconv.Atoi(string(v.Val))
+	if err != nil || i < 0 {
+		return 0, newTypeError(string(v.Val), "length")
+	}
+	return i, nil
+}
+
 func newTypeError(s, typ string) error {
 	return errors.New("invalid '" + typ + "': '" + s + "'")
 }
@@ -16,6 +16,10 @@ func ToKeyValues(fctx FilterContext, expr sqlparser.Expr, alias TableAlias, resu
 	if expr == nil {
 		return nil, nil
 	}
+	if _, ok := expr.(*sqlparser.AndExpr); !ok && !hasTagColumn(expr) {
+		// 不包含 tag 的条件不影响 key values
+		return results, nil
+	}
 	switch v := expr.(type) {
 	case *sqlparser.AndExpr:
 		tmp, err := ToKeyValues(fctx, v.Left, alias, results)
@@ -139,6 +143,22 @@ func ToKeyValues(fctx FilterContext, expr sqlparser.Expr, alias TableAlias, resu
 	return nil, fmt.Errorf("invalid key value expression %+v", expr)
 }
 
+func hasTagColumn(expr sqlparser.Expr) bool {
+	found := false
+	sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch v := node.(type) {
+		case *sqlparser.ColName:
+			if strings.HasPrefix(v.Name.String(), "@") {
+				found = true
+			}
+		case *sqlparser.Subquery:
+			return false, nil
+		}
+		return !found, nil
+	}, expr)
+	return found
+}
+
 func ToEqualValues(fctx FilterContext, expr *sqlparser.ComparisonExpr, qualifier TableAlias) (KeyValueIterator, error) {
 	left, leftok := expr.Left.(*sqlparser.ColName)
 	right, rightok := expr.Right.(*sqlparser.ColName)
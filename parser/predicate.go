@@ -0,0 +1,151 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/runner-mei/memsql/memcore"
+	"github.com/runner-mei/memsql/vm"
+	"github.com/xwb1989/sqlparser"
+)
+
+var predicateOperators = map[string]string{
+	sqlparser.EqualStr:        memcore.OpEqual,
+	sqlparser.NotEqualStr:     memcore.OpNotEqual,
+	sqlparser.LessThanStr:     memcore.OpLessThan,
+	sqlparser.LessEqualStr:    memcore.OpLessEqual,
+	sqlparser.GreaterThanStr:  memcore.OpGreaterThan,
+	sqlparser.GreaterEqualStr: memcore.OpGreaterEqual,
+	sqlparser.InStr:           memcore.OpIn,
+	sqlparser.NotInStr:        memcore.OpNotIn,
+	sqlparser.LikeStr:         memcore.OpLike,
+}
+
+var reversedOperators = map[string]string{
+	memcore.OpEqual:        memcore.OpEqual,
+	memcore.OpNotEqual:     memcore.OpNotEqual,
+	memcore.OpLessThan:     memcore.OpGreaterThan,
+	memcore.OpLessEqual:    memcore.OpGreaterEqual,
+	memcore.OpGreaterThan:  memcore.OpLessThan,
+	memcore.OpGreaterEqual: memcore.OpLessEqual,
+}
+
+// ToPredicates extracts the simple conditions 'column op literal' which are
+// joined with AND from the expression, the others are ignored. The name of a
+// tag keeps the '@' prefix. If withUnqualified is false only the columns
+// qualified with the table name or alias are extracted.
+func ToPredicates(expr sqlparser.Expr, tableAs TableAlias, withUnqualified bool) []memcore.Predicate {
+	var results []memcore.Predicate
+	var walk func(expr sqlparser.Expr)
+	walk = func(expr sqlparser.Expr) {
+		switch v := expr.(type) {
+		case *sqlparser.AndExpr:
+			walk(v.Left)
+			walk(v.Right)
+		case *sqlparser.ParenExpr:
+			walk(v.Expr)
+		case *sqlparser.ComparisonExpr:
+			op, ok := predicateOperators[v.Operator]
+			if !ok {
+				return
+			}
+			if v.Operator == sqlparser.InStr || v.Operator == sqlparser.NotInStr {
+				column, ok := toPredicateColumn(v.Left, tableAs, withUnqualified)
+				if !ok {
+					return
+				}
+				values, ok := toPredicateValues(v.Right)
+				if !ok {
+					return
+				}
+				results = append(results, memcore.Predicate{Column: column, Op: op, Values: values})
+				return
+			}
+
+			left, right := v.Left, v.Right
+			column, ok := toPredicateColumn(left, tableAs, withUnqualified)
+			if !ok {
+				column, ok = toPredicateColumn(right, tableAs, withUnqualified)
+				if !ok {
+					return
+				}
+				op, ok = reversedOperators[op]
+				if !ok {
+					return
+				}
+				right = left
+			}
+			value, ok := toPredicateValue(right)
+			if !ok {
+				return
+			}
+			results = append(results, memcore.Predicate{Column: column, Op: op, Values: []vm.Value{value}})
+		case *sqlparser.IsExpr:
+			column, ok := toPredicateColumn(v.Expr, tableAs, withUnqualified)
+			if !ok {
+				return
+			}
+			switch v.Operator {
+			case sqlparser.IsNullStr:
+				results = append(results, memcore.Predicate{Column: column, Op: memcore.OpIsNull})
+			case sqlparser.IsNotNullStr:
+				results = append(results, memcore.Predicate{Column: column, Op: memcore.OpIsNotNull})
+			}
+		}
+	}
+	if expr != nil {
+		walk(expr)
+	}
+	return results
+}
+
+func toPredicateColumn(expr sqlparser.Expr, tableAs TableAlias, withUnqualified bool) (string, bool) {
+	colName, ok := expr.(*sqlparser.ColName)
+	if !ok {
+		return "", false
+	}
+	if colName.Qualifier.IsEmpty() {
+		if !withUnqualified {
+			return "", false
+		}
+	} else {
+		qualifier := strings.ToLower(sqlparser.String(colName.Qualifier))
+		if !tableAs.Equal(qualifier) {
+			return "", false
+		}
+	}
+
+	return strings.ToLower(colName.Name.String()), true
+}
+
+func toPredicateValue(expr sqlparser.Expr) (vm.Value, bool) {
+	switch expr.(type) {
+	case *sqlparser.SQLVal, sqlparser.BoolVal:
+	default:
+		return vm.Null(), false
+	}
+	read, err := ToGetValue(nil, expr)
+	if err != nil {
+		return vm.Null(), false
+	}
+	value, err := read(nil)
+	if err != nil {
+		return vm.Null(), false
+	}
+	return value, true
+}
+
+func toPredicateValues(expr sqlparser.Expr) ([]vm.Value, bool) {
+	tuple, ok := expr.(sqlparser.ValTuple)
+	if !ok {
+		return nil, false
+	}
+	var values = make([]vm.Value, 0, len(tuple))
+	for idx := range tuple {
+		value, ok := toPredicateValue(tuple[idx])
+		if !ok {
+			return nil, false
+		}
+		values = append(values, value)
+	}
+	return values, true
+}
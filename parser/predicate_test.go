@@ -0,0 +1,60 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+func TestToPredicates(t *testing.T) {
+	for _, test := range []struct {
+		s               string
+		withUnqualified bool
+		results         []string
+	}{
+		{
+			s:               "select * from cpu where a = 1 and 2 < b and c in (1, 2) and d is null",
+			withUnqualified: true,
+			results:         []string{"a = 1", "b > 2", "c in (1, 2)", "d is null"},
+		},
+		{
+			s:               "select * from cpu where a = 1 or b = 2",
+			withUnqualified: true,
+			results:         nil,
+		},
+		{
+			s:               "select * from cpu where (a = 1 or b = 2) and c <> 'abc' and @id = 2 and d = e",
+			withUnqualified: true,
+			results:         []string{"c <> abc", "@id = 2"},
+		},
+		{
+			s:               "select * from cpu where @host like 'abc%' and 'abc' like a",
+			withUnqualified: true,
+			results:         []string{"@host like abc%"},
+		},
+		{
+			s:               "select * from cpu as c, mem where c.a = 1 and b = 2 and mem.c = 3",
+			withUnqualified: false,
+			results:         []string{"a = 1"},
+		},
+	} {
+		stmt, err := sqlparser.Parse(test.s)
+		if err != nil {
+			t.Error(test.s)
+			t.Error(err)
+			continue
+		}
+		sel, _ := stmt.(*sqlparser.Select)
+
+		var results []string
+		for _, p := range ToPredicates(sel.Where.Expr, TableAlias{Name: "cpu", Alias: "c"}, test.withUnqualified) {
+			results = append(results, p.String())
+		}
+		if !reflect.DeepEqual(test.results, results) {
+			t.Error(test.s)
+			t.Error("want:", test.results)
+			t.Error(" got:", results)
+		}
+	}
+}
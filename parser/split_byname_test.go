@@ -50,7 +50,7 @@ func TestSplitByName(t *testing.T) {
 		sel, _ := stmt.(*sqlparser.Select)
 
 		for key, txt := range test.results {
-			expr, err := SplitByTableName(sel.Where.Expr, key)
+			expr, err := SplitByTableName(sel.Where.Expr, key, "")
 			if err != nil {
 				t.Error(test.s)
 				t.Error(err)
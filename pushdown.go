@@ -0,0 +1,346 @@
+package memsql
+
+import (
+	"strings"
+
+	"github.com/runner-mei/memsql/memcore"
+	"github.com/runner-mei/memsql/parser"
+	"github.com/runner-mei/memsql/vm"
+	"github.com/xwb1989/sqlparser"
+)
+
+// ForeignCapabilities declares which part of the query the foreign source
+// can execute.
+type ForeignCapabilities struct {
+	Projection bool
+	OrderBy    bool
+	Limit      bool
+	Aggregate  bool
+}
+
+type ForeignOrder struct {
+	Column string
+	Desc   bool
+}
+
+// ForeignAggregate is a aggregate function on the whole table, Column is
+// empty for count(*). As is the name of the result column.
+type ForeignAggregate struct {
+	Func   string
+	Column string
+	As     string
+}
+
+// ForeignSpec is the part of the query which is pushed down to the foreign
+// source, all the fields are optional.
+type ForeignSpec struct {
+	Columns    []string
+	OrderBy    []ForeignOrder
+	Limit      int64
+	Offset     int64
+	HasLimit   bool
+	Aggregates []ForeignAggregate
+}
+
+func (spec *ForeignSpec) IsEmpty() bool {
+	return spec == nil || (len(spec.Columns) == 0 &&
+		len(spec.OrderBy) == 0 &&
+		!spec.HasLimit &&
+		spec.Offset == 0 &&
+		len(spec.Aggregates) == 0)
+}
+
+// PushdownForeign is implemented by the Foreign which can execute the
+// projection, order by, limit or aggregates itself.
+type PushdownForeign interface {
+	Foreign
+
+	Capabilities() ForeignCapabilities
+	FromSpec(ctx *SessionContext, tableAs TableAlias, where *sqlparser.Where, spec *ForeignSpec) (memcore.Query, error)
+}
+
+// pushdownAggregates 只下推和 memcore 结果一致的聚合函数, avg 在 memcore 中
+// 的结果类型和数据库的不一致, 所以不下推
+var pushdownAggregates = map[string]bool{
+	"count": true,
+	"sum":   true,
+}
+
+type foreignPushdown struct {
+	foreign PushdownForeign
+	ds      Datasource
+	spec    ForeignSpec
+	aliases map[string]bool
+
+	limit     bool
+	aggregate bool
+}
+
+func toForeignDatasource(expr sqlparser.TableExpr) (Datasource, bool) {
+	aliased, ok := expr.(*sqlparser.AliasedTableExpr)
+	if !ok || len(aliased.Partitions) > 0 || aliased.Hints != nil {
+		return Datasource{}, false
+	}
+	tableName, ok := aliased.Expr.(sqlparser.TableName)
+	if !ok || tableName.Qualifier.IsEmpty() {
+		return Datasource{}, false
+	}
+	return Datasource{
+		Qualifier: tableName.Qualifier.String(),
+		Table:     tableName.Name.String(),
+		As:        aliased.As.String(),
+	}, true
+}
+
+func (pd *foreignPushdown) column(expr sqlparser.Expr) (string, bool) {
+	colName, ok := expr.(*sqlparser.ColName)
+	if !ok {
+		return "", false
+	}
+	if !colName.Qualifier.IsEmpty() {
+		qualifier := colName.Qualifier.Name.String()
+		if qualifier != pd.ds.Table && qualifier != pd.ds.As {
+			return "", false
+		}
+	}
+	name := colName.Name.String()
+	if strings.HasPrefix(name, "@") {
+		return "", false
+	}
+	// 可能是 select 中的别名
+	if colName.Qualifier.IsEmpty() && pd.aliases[strings.ToLower(name)] {
+		return "", false
+	}
+	return name, true
+}
+
+func (pd *foreignPushdown) planProjection(stmt *sqlparser.Select) {
+	var columns []string
+	var ok = true
+	visit := func(node sqlparser.SQLNode) (bool, error) {
+		switch v := node.(type) {
+		case *sqlparser.StarExpr, *sqlparser.Subquery:
+			ok = false
+		case *sqlparser.ColName:
+			name, isColumn := pd.column(v)
+			if !isColumn {
+				ok = false
+				return false, nil
+			}
+			for _, column := range columns {
+				if strings.EqualFold(column, name) {
+					return false, nil
+				}
+			}
+			columns = append(columns, name)
+		}
+		return ok, nil
+	}
+
+	for _, node := range []sqlparser.SQLNode{stmt.SelectExprs, stmt.Where, stmt.GroupBy, stmt.Having, stmt.OrderBy} {
+		if !ok {
+			return
+		}
+		sqlparser.Walk(visit, node)
+	}
+
+	if ok && len(columns) > 0 {
+		pd.spec.Columns = columns
+	}
+}
+
+func (pd *foreignPushdown) planAggregates(stmt *sqlparser.Select) {
+	// memcore 中 limit 是在聚合之前执行的
+	if len(stmt.GroupBy) > 0 || stmt.Having != nil || stmt.Limit != nil {
+		return
+	}
+
+	var aggregates []ForeignAggregate
+	for _, selectExpr := range stmt.SelectExprs {
+		aliased, ok := selectExpr.(*sqlparser.AliasedExpr)
+		if !ok {
+			return
+		}
+		funcExpr, ok := aliased.Expr.(*sqlparser.FuncExpr)
+		if !ok || funcExpr.Distinct || !funcExpr.Qualifier.IsEmpty() || len(funcExpr.Exprs) != 1 {
+			return
+		}
+		name := funcExpr.Name.String()
+		if _, ok := vm.AggFuncs[name]; !ok || !pushdownAggregates[name] {
+			return
+		}
+
+		aggregate := ForeignAggregate{Func: name}
+		switch arg := funcExpr.Exprs[0].(type) {
+		case *sqlparser.StarExpr:
+			if name != "count" {
+				return
+			}
+		case *sqlparser.AliasedExpr:
+			column, ok := pd.column(arg.Expr)
+			if !ok {
+				return
+			}
+			aggregate.Column = column
+		default:
+			return
+		}
+		if aliased.As.IsEmpty() {
+			aggregate.As = sqlparser.String(aliased)
+		} else {
+			aggregate.As = aliased.As.String()
+		}
+		aggregates = append(aggregates, aggregate)
+	}
+
+	if len(aggregates) > 0 {
+		pd.spec.Aggregates = aggregates
+		pd.spec.Columns = nil
+		pd.aggregate = true
+	}
+}
+
+// planOrderBy 不下推按非 binary 的 collation 排序的列, 外部数据源按它自已的
+// 规则排序, 结果可能和 memcore 的不一致
+func (pd *foreignPushdown) planOrderBy(ec *SessionContext, stmt *sqlparser.Select) bool {
+	schema, _ := lookupSchema(ec, pd.ds.Table)
+
+	var orderBy []ForeignOrder
+	for _, order := range stmt.OrderBy {
+		column, ok := pd.column(order.Expr)
+		if !ok {
+			return false
+		}
+		if predicateCollation(ec, schema, column) != vm.CollationBinary {
+			return false
+		}
+		orderBy = append(orderBy, ForeignOrder{
+			Column: column,
+			Desc:   order.Direction == sqlparser.DescScr,
+		})
+	}
+	pd.spec.OrderBy = orderBy
+	return true
+}
+
+func (pd *foreignPushdown) planLimit(stmt *sqlparser.Select) {
+	readInt := func(expr sqlparser.Expr) (int64, bool) {
+		read, err := parser.ToGetValue(nil, expr)
+		if err != nil {
+			return 0, false
+		}
+		value, err := read(nil)
+		if err != nil {
+			return 0, false
+		}
+		u64, err := value.AsUint(true)
+		if err != nil {
+			return 0, false
+		}
+		return int64(u64), true
+	}
+
+	var spec = pd.spec
+	if stmt.Limit.Offset != nil {
+		offset, ok := readInt(stmt.Limit.Offset)
+		if !ok {
+			return
+		}
+		spec.Offset = offset
+	}
+	if stmt.Limit.Rowcount != nil {
+		limit, ok := readInt(stmt.Limit.Rowcount)
+		if !ok {
+			return
+		}
+		spec.Limit = limit
+		spec.HasLimit = true
+	}
+	pd.spec = spec
+	pd.limit = true
+}
+
+// planForeignPushdown returns nil if the select isnot on a single foreign
+// table or nothing can be pushed down.
+func planForeignPushdown(ec *SessionContext, stmt *sqlparser.Select, hasJoin bool) *foreignPushdown {
+	if hasJoin || len(stmt.From) != 1 {
+		return nil
+	}
+	ds, ok := toForeignDatasource(stmt.From[0])
+	if !ok {
+		return nil
+	}
+	f, err := ec.LookupForeign(ds.Qualifier)
+	if err != nil {
+		return nil
+	}
+	foreign, ok := f.(PushdownForeign)
+	if !ok {
+		return nil
+	}
+
+	pd := &foreignPushdown{
+		foreign: foreign,
+		ds:      ds,
+		aliases: map[string]bool{},
+	}
+	for _, selectExpr := range stmt.SelectExprs {
+		if aliased, ok := selectExpr.(*sqlparser.AliasedExpr); ok && !aliased.As.IsEmpty() {
+			pd.aliases[aliased.As.Lowered()] = true
+		}
+	}
+	capabilities := foreign.Capabilities()
+	if capabilities.Projection {
+		pd.planProjection(stmt)
+	}
+	if capabilities.Aggregate {
+		pd.planAggregates(stmt)
+	}
+
+	if !pd.aggregate && len(stmt.GroupBy) == 0 && stmt.Having == nil {
+		orderPushed := len(stmt.OrderBy) == 0
+		if capabilities.OrderBy && len(stmt.OrderBy) > 0 {
+			orderPushed = pd.planOrderBy(ec, stmt)
+		}
+		if capabilities.Limit && stmt.Limit != nil && orderPushed && !hasAggregate(stmt.SelectExprs) {
+			pd.planLimit(stmt)
+		}
+	}
+
+	if pd.spec.IsEmpty() {
+		return nil
+	}
+	return pd
+}
+
+func hasAggregate(selectExprs sqlparser.SelectExprs) bool {
+	found := false
+	sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch v := node.(type) {
+		case *sqlparser.Subquery:
+			return false, nil
+		case *sqlparser.FuncExpr:
+			if v.IsAggregate() {
+				found = true
+				return false, nil
+			}
+		}
+		return true, nil
+	}, selectExprs)
+	return found
+}
+
+func (pd *foreignPushdown) execute(ec *SessionContext, where *sqlparser.Where) (memcore.Query, error) {
+	tableAlias := TableAlias{Name: pd.ds.Table, Alias: pd.ds.As}
+	key, shared := foreignCacheKey(pd.ds.Qualifier, tableAlias, where, &pd.spec)
+	query, err := fromForeignCache(ec, key, shared, func() (memcore.Query, error) {
+		return pd.foreign.FromSpec(ec, tableAlias, where, &pd.spec)
+	})
+	if err != nil {
+		return memcore.Query{}, err
+	}
+
+	reference := query.ToReference()
+	ec.addForeignQuery(pd.ds.Table, pd.ds.As, reference)
+	return reference.Query, nil
+}
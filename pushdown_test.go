@@ -0,0 +1,134 @@
+package memsql
+
+import (
+	"testing"
+
+	"github.com/runner-mei/memsql/vm"
+	"github.com/xwb1989/sqlparser"
+)
+
+func TestForeignPushdown(t *testing.T) {
+	for _, test := range []struct {
+		sql       string
+		result    string
+		limit     bool
+		aggregate bool
+	}{
+		{
+			sql:    "select * from fdw.t3 order by f3 limit 1",
+			result: `SELECT * FROM "t3" ORDER BY "f3" LIMIT 1`,
+			limit:  true,
+		},
+		{
+			sql:    "select f2 from fdw.t3 as t where t.f3 > 1 order by t.f3 desc, id limit 2 offset 1",
+			result: `SELECT "f2", "f3", "id" FROM "t3" AS "t" ORDER BY "f3" DESC, "id" LIMIT 2 OFFSET 1`,
+			limit:  true,
+		},
+		{
+			sql:    "select f2 from fdw.t3 limit 3, 2",
+			result: `SELECT "f2" FROM "t3" LIMIT 2 OFFSET 3`,
+			limit:  true,
+		},
+		{
+			sql:    "select f2 as name from fdw.t3 order by name limit 2",
+			result: "",
+		},
+		{
+			sql:    "select f2 from fdw.t3 order by lower(f2) limit 2",
+			result: `SELECT "f2" FROM "t3"`,
+		},
+		{
+			sql:       "select count(*), sum(f3) as s from fdw.t3",
+			result:    `SELECT COUNT(*) AS "count(*)", COALESCE(SUM("f3"), 0) AS "s" FROM "t3"`,
+			aggregate: true,
+		},
+		{
+			sql:    "select avg(f3) from fdw.t3",
+			result: `SELECT "f3" FROM "t3"`,
+		},
+		{
+			sql:    "select count(*) from fdw.t3 limit 1",
+			result: "",
+		},
+		{
+			sql:    "select @mo from fdw.t3",
+			result: "",
+		},
+	} {
+		stmt, err := sqlparser.Parse(test.sql)
+		if err != nil {
+			t.Error(test.sql, err)
+			continue
+		}
+
+		ctx := &SessionContext{Context: &Context{Foreign: &dbForeign{Dialect: Sqlite3Dialect}}}
+		pd := planForeignPushdown(ctx, stmt.(*sqlparser.Select), false)
+		if pd == nil {
+			if test.result != "" {
+				t.Error(test.sql, ": pushdown is nil")
+			}
+			continue
+		}
+
+		tableAlias := TableAlias{Name: pd.ds.Table, Alias: pd.ds.As}
+		result := Sqlite3Dialect.SelectSQL(tableAlias, "", &pd.spec)
+		if result != test.result {
+			t.Error(test.sql)
+			t.Error("want:", test.result)
+			t.Error(" got:", result)
+		}
+		if pd.limit != test.limit {
+			t.Error(test.sql, ": limit want", test.limit, "got", pd.limit)
+		}
+		if pd.aggregate != test.aggregate {
+			t.Error(test.sql, ": aggregate want", test.aggregate, "got", pd.aggregate)
+		}
+	}
+}
+
+func TestForeignPushdownCollation(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Close()
+
+	records := []map[string]interface{}{
+		{"id": 1, "name": "b"},
+		{"id": 2, "name": "A"},
+		{"id": 3, "name": "C"},
+	}
+	app.Add(t, &TestTable{Name: "ports", Records: records})
+	app.Add(t, &TestTable{Name: "db.ports", Records: records})
+
+	for _, test := range []struct {
+		collation vm.Collation
+		result    []string
+	}{
+		{collation: vm.CollationBinary, result: []string{`2`, `3`}},
+		{collation: vm.CollationUnicodeCI, result: []string{`2`, `1`}},
+	} {
+		// 外部数据源的结果必须和本地的一致
+		for _, sql := range []string{
+			"select id from ports order by name limit 2",
+			"select id from fdw.ports order by name limit 2",
+		} {
+			results, err := app.Execute(t, &Context{Collation: test.collation}, sql)
+			if err != nil {
+				t.Error(sql, err)
+				continue
+			}
+			assertResults(t, false, false, results, test.result)
+		}
+	}
+
+	stmt, err := sqlparser.Parse("select id from fdw.ports order by name limit 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &SessionContext{Context: &Context{
+		Foreign:   &dbForeign{Dialect: Sqlite3Dialect},
+		Collation: vm.CollationUnicodeCI,
+	}}
+	pd := planForeignPushdown(ctx, stmt.(*sqlparser.Select), false)
+	if pd != nil && (len(pd.spec.OrderBy) > 0 || pd.limit) {
+		t.Error("order by and limit should not be pushed down with the collation")
+	}
+}
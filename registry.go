@@ -0,0 +1,200 @@
+package memsql
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/runner-mei/errors"
+	"github.com/runner-mei/memsql/memcore"
+	"github.com/xwb1989/sqlparser"
+)
+
+// DefaultForeignName is the qualifier of Context.Foreign
+const DefaultForeignName = "fdw"
+
+// ForeignOptions are the options of a named foreign source.
+type ForeignOptions struct {
+	// Schema is the schema (or database) of the tables in the source.
+	Schema string
+
+	// Tables maps the table name in the sql to the name in the source, the
+	// unmapped tables keep their names.
+	Tables map[string]string
+}
+
+// RegisterForeign registers the foreign source with the name, the tables
+// of the source are selected with the name as the qualifier, for example
+// 'select * from cmdb.managed_objects'.
+func (ctx *Context) RegisterForeign(name string, foreign Foreign, opts ...ForeignOptions) error {
+	if name == "" {
+		return errors.New("foreign name is empty")
+	}
+	if foreign == nil {
+		return errors.New("foreign '" + name + "' is nil")
+	}
+	server := &foreignServer{
+		name:    name,
+		foreign: foreign,
+	}
+	if len(opts) > 0 {
+		server.opts = opts[0]
+	}
+	if db, ok := foreign.(*dbForeign); ok {
+		// 同一个 foreign 可能用不同的名字注册
+		copyed := *db
+		copyed.Server = server
+		server.foreign = &copyed
+	}
+
+	ctx.foreignsMu.Lock()
+	defer ctx.foreignsMu.Unlock()
+
+	if _, ok := ctx.foreigns[name]; ok {
+		return errors.New("foreign '" + name + "' is already exists")
+	}
+	if ctx.foreigns == nil {
+		ctx.foreigns = map[string]*foreignServer{}
+	}
+	ctx.foreigns[name] = server
+	return nil
+}
+
+// ForeignNames returns the qualifiers of all the foreign sources.
+func (ctx *Context) ForeignNames() []string {
+	ctx.foreignsMu.Lock()
+	defer ctx.foreignsMu.Unlock()
+
+	var names = make([]string, 0, len(ctx.foreigns)+1)
+	if ctx.Foreign != nil {
+		if _, ok := ctx.foreigns[DefaultForeignName]; !ok {
+			names = append(names, DefaultForeignName)
+		}
+	}
+	for name := range ctx.foreigns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupForeign returns the foreign source of the qualifier.
+func (ctx *Context) LookupForeign(name string) (Foreign, error) {
+	if foreign := ctx.lookupForeign(name); foreign != nil {
+		return foreign, nil
+	}
+	return nil, errors.New("foreign '" + name + "' isnot found, known qualifiers are [" + strings.Join(ctx.ForeignNames(), ", ") + "]")
+}
+
+// lookupForeign returns nil if the qualifier isnot a foreign source
+func (ctx *Context) lookupForeign(name string) Foreign {
+	ctx.foreignsMu.Lock()
+	server, ok := ctx.foreigns[name]
+	ctx.foreignsMu.Unlock()
+	if ok {
+		return server
+	}
+	if name == DefaultForeignName && ctx.Foreign != nil {
+		return ctx.Foreign
+	}
+	return nil
+}
+
+// hasLocalTable 判断本地的存储中是否有这个表, 不能判断时当作没有, 以免写错
+// 的限定名读取了本地的表
+func hasLocalTable(ec *SessionContext, name string) bool {
+	if _, ok := ec.lookupCommonTable(name); ok {
+		return true
+	}
+	if _, ok := lookupSchema(ec, name); ok {
+		return true
+	}
+	s, ok := ec.Storage.(MutableStorage)
+	if !ok {
+		return false
+	}
+	ms, ok := s.Mutable()
+	if !ok {
+		return false
+	}
+	return len(ms.Measurements(name)) > 0
+}
+
+type foreignServer struct {
+	name    string
+	foreign Foreign
+	opts    ForeignOptions
+}
+
+// remoteTable returns the table name in the source. The remote table is
+// aliased with the local name, so the columns qualified with it still work.
+func (server *foreignServer) remoteTable(tableAs TableAlias) TableAlias {
+	name := server.remoteName(tableAs.Name)
+	alias := tableAs.Alias
+	if alias == "" && name != tableAs.Name {
+		alias = tableAs.Name
+	}
+	return TableAlias{Name: name, Alias: alias}
+}
+
+// remoteName returns the table name in the source.
+func (server *foreignServer) remoteName(name string) string {
+	if mapped, ok := server.opts.Tables[name]; ok {
+		name = mapped
+	}
+	if server.opts.Schema != "" {
+		name = server.opts.Schema + "." + name
+	}
+	return name
+}
+
+// isOwner 表是否用 server 的名字限定
+func (server *foreignServer) isOwner(name sqlparser.TableName) bool {
+	return server != nil && !name.Qualifier.IsEmpty() && name.Qualifier.String() == server.name
+}
+
+func (server *foreignServer) localTable(tableAs TableAlias, query memcore.Query) memcore.Query {
+	return query.Map(func(ctx memcore.Context, r memcore.Record) (memcore.Record, error) {
+		columns := make([]memcore.Column, len(r.Columns))
+		copy(columns, r.Columns)
+		for idx := range columns {
+			if columns[idx].TableName != "" {
+				columns[idx].TableName = tableAs.Name
+			}
+			if tableAs.Alias == "" && columns[idx].TableAs == tableAs.Name {
+				columns[idx].TableAs = ""
+			}
+		}
+		r.Columns = columns
+		return r, nil
+	})
+}
+
+func (server *foreignServer) From(ctx *SessionContext, tableAs TableAlias, where *sqlparser.Where) (memcore.Query, error) {
+	query, err := server.foreign.From(ctx, server.remoteTable(tableAs), where)
+	if err != nil {
+		return memcore.Query{}, errors.Wrap(err, "read from foreign '"+server.name+"' fail")
+	}
+	return server.localTable(tableAs, query), nil
+}
+
+func (server *foreignServer) Capabilities() ForeignCapabilities {
+	if pf, ok := server.foreign.(PushdownForeign); ok {
+		return pf.Capabilities()
+	}
+	return ForeignCapabilities{}
+}
+
+func (server *foreignServer) FromSpec(ctx *SessionContext, tableAs TableAlias, where *sqlparser.Where, spec *ForeignSpec) (memcore.Query, error) {
+	pf, ok := server.foreign.(PushdownForeign)
+	if !ok {
+		if !spec.IsEmpty() {
+			return memcore.Query{}, errors.New("foreign '" + server.name + "' isnot support pushdown")
+		}
+		return server.From(ctx, tableAs, where)
+	}
+	query, err := pf.FromSpec(ctx, server.remoteTable(tableAs), where, spec)
+	if err != nil {
+		return memcore.Query{}, errors.Wrap(err, "read from foreign '"+server.name+"' fail")
+	}
+	return server.localTable(tableAs, query), nil
+}
@@ -0,0 +1,119 @@
+package memsql
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestForeignRegistry(t *testing.T) {
+	cmdb := newTestApp(t)
+	defer cmdb.Close()
+	billing := newTestApp(t)
+	defer billing.Close()
+
+	for _, test := range []struct {
+		app  *TestApp
+		name string
+		data string
+	}{
+		{app: cmdb, name: "cpu", data: "tags: {\"mo\":\"1\"}\nf1\na1"},
+		{app: cmdb, name: "cpu", data: "tags: {\"mo\":\"2\"}\nf1\na2"},
+		{app: cmdb, name: "db.mo_table", data: "id,f2\n1,dev1\n2,dev2"},
+		{app: billing, name: "db.accounts", data: "id,name\n1,acc1\n2,acc2\n3,acc3"},
+	} {
+		table, err := readTable([]byte(test.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		table.Name = test.name
+		if err := test.app.Add(t, &table); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := &Context{Ctx: context.Background()}
+	if err := ctx.RegisterForeign("cmdb", NewDbForeign(cmdb.driver, cmdb.conn), ForeignOptions{
+		Tables: map[string]string{"managed_objects": "mo_table"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.RegisterForeign("billing", NewDbForeign(billing.driver, billing.conn), ForeignOptions{
+		Schema: "main",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.RegisterForeign("billing", NewDbForeign(billing.driver, billing.conn)); err == nil {
+		t.Error("want error")
+	}
+
+	results, err := cmdb.Execute(t, ctx, "select cpu.f1, managed_objects.f2 from cpu, cmdb.managed_objects where cpu.@mo = managed_objects.id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResults(t, true, false, results, []string{`"a1","dev1"`, `"a2","dev2"`})
+
+	results, err = cmdb.Execute(t, ctx, "select a.name from billing.accounts as a where a.id > 1 order by a.name desc limit 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResults(t, false, false, results, []string{`"acc3"`})
+
+	_, err = cmdb.Execute(t, ctx, "select * from crm.users")
+	if err == nil {
+		t.Fatal("want error")
+	}
+	if !strings.Contains(err.Error(), "[billing, cmdb, fdw]") {
+		t.Error(err)
+	}
+
+	// 不是外部源的限定名读取本地的表
+	results, err = cmdb.Execute(t, ctx, "select f1 from crm.cpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResults(t, true, false, results, []string{`"a1"`, `"a2"`})
+
+	// HookStorage 按需读取表, 只有已经读取的表才是本地的表
+	ctx.Storage = NewHookStorage(cmdb.s, ReadValues(nil))
+	_, err = cmdb.Execute(t, ctx, "select * from crm.users")
+	if err == nil {
+		t.Fatal("want error")
+	}
+	if !strings.Contains(err.Error(), "[billing, cmdb, fdw]") {
+		t.Error(err)
+	}
+	results, err = cmdb.Execute(t, ctx, "select f1 from crm.cpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResults(t, true, false, results, []string{`"a1"`, `"a2"`})
+}
+
+func TestForeignRegistryConcurrent(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Close()
+
+	ctx := &Context{Ctx: context.Background()}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := "db" + strconv.Itoa(i)
+			if err := ctx.RegisterForeign(name, NewDbForeign(app.driver, app.conn)); err != nil {
+				t.Error(err)
+			}
+			if _, err := ctx.LookupForeign(name); err != nil {
+				t.Error(err)
+			}
+			ctx.ForeignNames()
+		}(i)
+	}
+	wg.Wait()
+	if names := ctx.ForeignNames(); len(names) != 10 {
+		t.Error("want 10 foreigns got", names)
+	}
+}
@@ -0,0 +1,146 @@
+package memsql
+
+import (
+	"strings"
+
+	"github.com/runner-mei/errors"
+	"github.com/runner-mei/memsql/memcore"
+	"github.com/runner-mei/memsql/parser"
+	"github.com/runner-mei/memsql/vm"
+	"github.com/xwb1989/sqlparser"
+)
+
+func lookupSchema(ec *SessionContext, tableName string) (*memcore.TableSchema, bool) {
+	s, ok := ec.Storage.(SchemaStorage)
+	if !ok {
+		return nil, false
+	}
+	return s.Schema(tableName)
+}
+
+// validateColumns checks the column references and the literals compared
+// with them against the schema of the table. If withUnqualified is false
+// only the columns qualified with the table name or alias are checked.
+func validateColumns(ds Datasource, schema *memcore.TableSchema, node sqlparser.SQLNode, withUnqualified bool) error {
+	if node == nil {
+		return nil
+	}
+
+	resolve := func(expr sqlparser.Expr) (*memcore.ColumnSchema, error) {
+		colName, ok := expr.(*sqlparser.ColName)
+		if !ok {
+			return nil, nil
+		}
+		if colName.Qualifier.IsEmpty() {
+			if !withUnqualified {
+				return nil, nil
+			}
+		} else {
+			qualifier := colName.Qualifier.Name.String()
+			if !strings.EqualFold(qualifier, ds.Table) && !strings.EqualFold(qualifier, ds.As) {
+				return nil, nil
+			}
+		}
+
+		name := colName.Name.String()
+		if strings.HasPrefix(name, "@") {
+			return nil, nil
+		}
+		column, ok := schema.Column(name)
+		if !ok {
+			column, ok = schema.Column(strings.ToLower(name))
+		}
+		if !ok {
+			return nil, errors.New("column '" + sqlparser.String(colName) + "' isnot declared in the table '" + ds.Table + "'")
+		}
+		return column, nil
+	}
+
+	var checkLiteral func(column *memcore.ColumnSchema, expr sqlparser.Expr) error
+	checkLiteral = func(column *memcore.ColumnSchema, expr sqlparser.Expr) error {
+		switch v := expr.(type) {
+		case *sqlparser.SQLVal:
+			read, err := parser.ToGetValue(nil, v)
+			if err != nil {
+				return nil
+			}
+			value, err := read(nil)
+			if err != nil {
+				return nil
+			}
+			if _, err := vm.ConvertValue(value, column.Type); err != nil {
+				return errors.New("type error: column '" + column.Name + "' is " + column.Type.String() + ", but value is '" + sqlparser.String(v) + "'")
+			}
+		case sqlparser.ValTuple:
+			for _, item := range v {
+				if err := checkLiteral(column, item); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	checkCompare := func(left, right sqlparser.Expr) error {
+		column, err := resolve(left)
+		if err != nil {
+			return err
+		}
+		if column != nil {
+			return checkLiteral(column, right)
+		}
+		column, err = resolve(right)
+		if err != nil {
+			return err
+		}
+		if column != nil {
+			return checkLiteral(column, left)
+		}
+		return nil
+	}
+
+	return sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch v := node.(type) {
+		case *sqlparser.Subquery:
+			return false, nil
+		case *sqlparser.ColName:
+			_, err := resolve(v)
+			return false, err
+		case *sqlparser.ComparisonExpr:
+			if err := checkCompare(v.Left, v.Right); err != nil {
+				return false, err
+			}
+		case *sqlparser.RangeCond:
+			if err := checkCompare(v.Left, v.From); err != nil {
+				return false, err
+			}
+			if err := checkCompare(v.Left, v.To); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}, node)
+}
+
+func validateSelect(ec *SessionContext, stmt *sqlparser.Select) error {
+	if len(stmt.From) != 1 {
+		return nil
+	}
+	aliased, ok := stmt.From[0].(*sqlparser.AliasedTableExpr)
+	if !ok {
+		return nil
+	}
+	tableName, ok := aliased.Expr.(sqlparser.TableName)
+	if !ok || !tableName.Qualifier.IsEmpty() {
+		return nil
+	}
+	ds := Datasource{
+		Table: tableName.Name.String(),
+		As:    aliased.As.String(),
+	}
+	schema, ok := lookupSchema(ec, ds.Table)
+	if !ok {
+		return nil
+	}
+	return validateColumns(ds, schema, stmt.SelectExprs, true)
+}
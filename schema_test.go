@@ -0,0 +1,57 @@
+package memsql
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/runner-mei/memsql/memcore"
+	"github.com/runner-mei/memsql/vm"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Close()
+
+	app.Add(t, &TestTable{
+		Name: "cpu",
+		Records: []map[string]interface{}{
+			{"id": 1, "name": "a"},
+			{"id": 2, "name": "b"},
+		},
+	})
+	err := app.s.(memcore.SchemaStorage).SetSchema("cpu", &memcore.TableSchema{
+		Columns: []memcore.ColumnSchema{
+			{Name: "id", Type: vm.ValueInt64},
+			{Name: "name", Type: vm.ValueString},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := app.Execute(t, nil, "select name from cpu where id = 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResults(t, false, false, results, []string{`"b"`})
+
+	for _, test := range []struct {
+		sql string
+		err string
+	}{
+		{sql: "select abc from cpu", err: "column 'abc' isnot declared"},
+		{sql: "select * from cpu where abc = 1", err: "column 'abc' isnot declared"},
+		{sql: "select * from cpu as c where c.abc = 1", err: "column 'c.abc' isnot declared"},
+		{sql: "select * from cpu where id = 'abc'", err: "type error: column 'id' is int"},
+		{sql: "select * from cpu where id in (1, 'abc')", err: "type error: column 'id' is int"},
+	} {
+		_, err := app.Execute(t, nil, test.sql)
+		if err == nil {
+			t.Error(test.sql, ": want error got ok")
+			continue
+		}
+		if !strings.Contains(err.Error(), test.err) {
+			t.Error(test.sql, ": want", test.err, "got", err)
+		}
+	}
+}
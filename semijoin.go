@@ -0,0 +1,349 @@
+package memsql
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/runner-mei/errors"
+	"github.com/runner-mei/memsql/memcore"
+	"github.com/runner-mei/memsql/parser"
+	"github.com/runner-mei/memsql/vm"
+	"github.com/xwb1989/sqlparser"
+)
+
+const DefaultSemiJoinBatchSize = 500
+
+// semiJoinKey is the condition 'foreign.column = local.column' in the where
+type semiJoinKey struct {
+	column    string
+	qualifier string
+	local     *sqlparser.ColName
+}
+
+// findSemiJoinKey finds the equal condition between the foreign table and
+// the other table, the foreign table is read with the keys of the other one.
+func findSemiJoinKey(ec *SessionContext, ds Datasource, where sqlparser.Expr) (semiJoinKey, bool) {
+	if ec.SemiJoinBatchSize < 0 {
+		return semiJoinKey{}, false
+	}
+	isForeign := func(qualifier string) bool {
+		return qualifier == ds.Table || (ds.As != "" && qualifier == ds.As)
+	}
+
+	var key semiJoinKey
+	var found bool
+	var walk func(expr sqlparser.Expr)
+	walk = func(expr sqlparser.Expr) {
+		if found {
+			return
+		}
+		switch v := expr.(type) {
+		case *sqlparser.AndExpr:
+			walk(v.Left)
+			walk(v.Right)
+		case *sqlparser.ParenExpr:
+			walk(v.Expr)
+		case *sqlparser.ComparisonExpr:
+			if v.Operator != sqlparser.EqualStr {
+				return
+			}
+			left, ok := v.Left.(*sqlparser.ColName)
+			if !ok || left.Qualifier.IsEmpty() {
+				return
+			}
+			right, ok := v.Right.(*sqlparser.ColName)
+			if !ok || right.Qualifier.IsEmpty() {
+				return
+			}
+			if isForeign(right.Qualifier.Name.String()) {
+				left, right = right, left
+			}
+			if !isForeign(left.Qualifier.Name.String()) || isForeign(right.Qualifier.Name.String()) {
+				return
+			}
+			column := left.Name.String()
+			if strings.HasPrefix(column, "@") {
+				return
+			}
+			// HookStorage 中 tag 的值是从外部表中读取的, 不能反过来用它过滤外部表
+			if strings.HasPrefix(right.Name.String(), "@") {
+				if _, ok := ec.Storage.(*HookStorage); ok {
+					return
+				}
+			}
+
+			key = semiJoinKey{
+				column:    column,
+				qualifier: right.Qualifier.Name.String(),
+				local:     right,
+			}
+			found = true
+		}
+	}
+	if where != nil {
+		walk(where)
+	}
+	return key, found
+}
+
+// semiJoin reads the distinct keys from the local table, and then reads the
+// foreign table with 'column IN (keys)' in batches.
+func semiJoin(ec *SessionContext, source string, foreign Foreign, tableAlias TableAlias, where sqlparser.Expr, key semiJoinKey) memcore.Query {
+	batchSize := ec.SemiJoinBatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultSemiJoinBatchSize
+	}
+
+	fullScan := func() memcore.Iterator {
+		var w *sqlparser.Where
+		if where != nil {
+			w = &sqlparser.Where{Type: sqlparser.WhereStr, Expr: where}
+		}
+		query, err := fromForeign(ec, source, foreign, tableAlias, w)
+		if err != nil {
+			return errorIterator(err)
+		}
+		return query.Iterate()
+	}
+
+	readValue, err := parser.ToGetValue(ec, key.local)
+	if err != nil {
+		return memcore.Query{
+			Iterate: func() memcore.Iterator {
+				return errorIterator(err)
+			},
+		}
+	}
+
+	return memcore.Query{
+		Iterate: func() memcore.Iterator {
+			local, ok := ec.getTableQuery(key.qualifier)
+			if !ok || local.Foreign {
+				return fullScan()
+			}
+			// local 的 ReferenceQuery 是 join 共用的, 这里只读取它的复本, 不修改它
+			localQuery := local.Query.Query
+
+			var batches [][]sqlparser.Expr
+			var next memcore.Iterator
+			var started bool
+			var done bool
+
+			return func(ctx memcore.Context) (memcore.Record, error) {
+				if done {
+					return memcore.Record{}, memcore.ErrNoRows
+				}
+				if !started {
+					started = true
+
+					keys, ok, err := readSemiJoinKeys(ctx, localQuery, readValue, valueToSQLVal)
+					if err != nil {
+						done = true
+						return memcore.Record{}, err
+					}
+					if !ok {
+						next = fullScan()
+					} else {
+						for start := 0; start < len(keys); start += batchSize {
+							end := start + batchSize
+							if end > len(keys) {
+								end = len(keys)
+							}
+							batches = append(batches, keys[start:end])
+						}
+					}
+				}
+
+				for {
+					if next != nil {
+						record, err := next(ctx)
+						if err == nil {
+							return record, nil
+						}
+						if !memcore.IsNoRows(err) {
+							done = true
+							return memcore.Record{}, err
+						}
+						next = nil
+					}
+					if len(batches) == 0 {
+						done = true
+						return memcore.Record{}, memcore.ErrNoRows
+					}
+
+					in := &sqlparser.ComparisonExpr{
+						Operator: sqlparser.InStr,
+						Left:     &sqlparser.ColName{Name: sqlparser.NewColIdent(key.column)},
+						Right:    sqlparser.ValTuple(batches[0]),
+					}
+					batches = batches[1:]
+
+					var expr sqlparser.Expr = in
+					if where != nil {
+						expr = &sqlparser.AndExpr{Left: &sqlparser.ParenExpr{Expr: where}, Right: in}
+					}
+					query, err := fromForeign(ec, source, foreign, tableAlias, &sqlparser.Where{Type: sqlparser.WhereStr, Expr: expr})
+					if err != nil {
+						done = true
+						return memcore.Record{}, err
+					}
+					next = query.Iterate()
+				}
+			}
+		},
+	}
+}
+
+// semiJoinTags replaces the condition 'local.@tag = foreign.column' with
+// 'local.@tag IN (keys)', the keys are the distinct values of the column in
+// the foreign table, so HookStorage only reads the measurements of the keys.
+// It returns false if the foreign table has no key.
+func semiJoinTags(ec *SessionContext, tableName TableAlias, expr sqlparser.Expr) (sqlparser.Expr, bool, error) {
+	if ec.SemiJoinBatchSize < 0 || expr == nil {
+		return expr, true, nil
+	}
+
+	switch v := expr.(type) {
+	case *sqlparser.AndExpr:
+		left, ok, err := semiJoinTags(ec, tableName, v.Left)
+		if err != nil || !ok {
+			return nil, ok, err
+		}
+		right, ok, err := semiJoinTags(ec, tableName, v.Right)
+		if err != nil || !ok {
+			return nil, ok, err
+		}
+		return &sqlparser.AndExpr{Left: left, Right: right}, true, nil
+	case *sqlparser.ParenExpr:
+		inner, ok, err := semiJoinTags(ec, tableName, v.Expr)
+		if err != nil || !ok {
+			return nil, ok, err
+		}
+		return &sqlparser.ParenExpr{Expr: inner}, true, nil
+	case *sqlparser.ComparisonExpr:
+		if v.Operator != sqlparser.EqualStr {
+			return expr, true, nil
+		}
+		tag, ok := v.Left.(*sqlparser.ColName)
+		if !ok {
+			return expr, true, nil
+		}
+		column, ok := v.Right.(*sqlparser.ColName)
+		if !ok {
+			return expr, true, nil
+		}
+		if !tableName.Equal(sqlparser.String(tag.Qualifier)) {
+			tag, column = column, tag
+		}
+		if !tableName.Equal(sqlparser.String(tag.Qualifier)) ||
+			!strings.HasPrefix(tag.Name.String(), "@") ||
+			column.Qualifier.IsEmpty() ||
+			tableName.Equal(sqlparser.String(column.Qualifier)) {
+			return expr, true, nil
+		}
+
+		// 只处理外部表, 其它的表仍由 parser.ToEqualValues 读取
+		foreign, ok := ec.getTableQuery(column.Qualifier.Name.String())
+		if !ok || !foreign.Foreign {
+			return expr, true, nil
+		}
+		readValue, err := parser.ToGetValue(ec, column)
+		if err != nil {
+			return nil, false, err
+		}
+
+		// 外部表的结果在会话中有缓存, join 时不会再次读取外部表
+		keys, ok, err := readSemiJoinKeys(ec, foreign.Query.Query, readValue, tagToSQLVal)
+		if err != nil {
+			return nil, false, err
+		}
+		if !ok {
+			return expr, true, nil
+		}
+		if len(keys) == 0 {
+			return nil, false, nil
+		}
+		return &sqlparser.ComparisonExpr{
+			Operator: sqlparser.InStr,
+			Left:     tag,
+			Right:    sqlparser.ValTuple(keys),
+		}, true, nil
+	default:
+		return expr, true, nil
+	}
+}
+
+// readSemiJoinKeys returns false if some key cannot be sent to the foreign
+func readSemiJoinKeys(ctx memcore.Context, query memcore.Query, readValue func(vm.Context) (vm.Value, error), toSQLVal func(vm.Value) (sqlparser.Expr, bool)) ([]sqlparser.Expr, bool, error) {
+	var keys []sqlparser.Expr
+	var exists = map[string]struct{}{}
+	next := query.Iterate()
+	for {
+		record, err := next(ctx)
+		if err != nil {
+			if memcore.IsNoRows(err) {
+				return keys, true, nil
+			}
+			return nil, false, err
+		}
+		value, err := readValue(memcore.ToRecordValuer(&record, false))
+		if err != nil {
+			return nil, false, err
+		}
+		if value.IsNull() {
+			continue
+		}
+
+		expr, ok := toSQLVal(value)
+		if !ok {
+			return nil, false, nil
+		}
+		s := sqlparser.String(expr)
+		if _, ok := exists[s]; ok {
+			continue
+		}
+		exists[s] = struct{}{}
+		keys = append(keys, expr)
+	}
+}
+
+func valueToSQLVal(value vm.Value) (sqlparser.Expr, bool) {
+	switch value.Type {
+	case vm.ValueString:
+		return sqlparser.NewStrVal([]byte(value.Str)), true
+	case vm.ValueInt64:
+		return sqlparser.NewIntVal([]byte(strconv.FormatInt(value.Int64, 10))), true
+	case vm.ValueUint64:
+		return sqlparser.NewIntVal([]byte(strconv.FormatUint(value.Uint64, 10))), true
+	case vm.ValueFloat64:
+		return sqlparser.NewFloatVal([]byte(strconv.FormatFloat(value.Float64, 'g', -1, 64))), true
+	case vm.ValueDecimal:
+		return sqlparser.NewFloatVal([]byte(value.String())), true
+	case vm.ValueBool:
+		return sqlparser.BoolVal(value.BoolValue()), true
+	case vm.ValueDatetime:
+		// cast 后作为 datetime 绑定, 而不是字符串
+		return &sqlparser.ConvertExpr{
+			Expr: sqlparser.NewStrVal([]byte(vm.IntToDatetime(value.Int64).Format(time.RFC3339))),
+			Type: &sqlparser.ConvertType{Type: "datetime"},
+		}, true
+	default:
+		return nil, false
+	}
+}
+
+// tagToSQLVal converts the value to the string, the tags are always strings
+func tagToSQLVal(value vm.Value) (sqlparser.Expr, bool) {
+	s, err := value.AsString(true)
+	if err != nil {
+		return nil, false
+	}
+	return sqlparser.NewStrVal([]byte(s)), true
+}
+
+func errorIterator(err error) memcore.Iterator {
+	return func(memcore.Context) (memcore.Record, error) {
+		return memcore.Record{}, errors.Wrap(err, "read foreign table fail")
+	}
+}
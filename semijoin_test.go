@@ -0,0 +1,160 @@
+package memsql
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/memsql/memcore"
+	"github.com/runner-mei/memsql/vm"
+	"github.com/xwb1989/sqlparser"
+)
+
+type recordForeign struct {
+	Foreign
+	wheres []string
+}
+
+func (f *recordForeign) From(ctx *SessionContext, tableAs TableAlias, where *sqlparser.Where) (memcore.Query, error) {
+	if where == nil || where.Expr == nil {
+		f.wheres = append(f.wheres, "")
+	} else {
+		f.wheres = append(f.wheres, sqlparser.String(where.Expr))
+	}
+	return f.Foreign.From(ctx, tableAs, where)
+}
+
+func TestSemiJoin(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Close()
+
+	for _, test := range []struct {
+		name string
+		data string
+	}{
+		{name: "cpu", data: "tags: {\"mo\":\"1\"}\nf1\na1"},
+		{name: "cpu", data: "tags: {\"mo\":\"2\"}\nf1\na2"},
+		{name: "cpu", data: "tags: {\"mo\":\"3\"}\nf1\na3"},
+		{name: "db.managed_objects", data: "id,f2\n1,dev1\n2,dev2\n3,dev3\n4,dev4"},
+	} {
+		table, err := readTable([]byte(test.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		table.Name = test.name
+		if err := app.Add(t, &table); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, sqlstr := range []string{
+		"select cpu.f1, mo.f2 from cpu, fdw.managed_objects as mo where cpu.@mo = mo.id",
+		"select cpu.f1, mo.f2 from fdw.managed_objects as mo, cpu where mo.id = cpu.@mo",
+	} {
+		foreign := &recordForeign{Foreign: NewDbForeign(app.driver, app.conn)}
+		ctx := &Context{
+			Ctx:               context.Background(),
+			Foreign:           foreign,
+			SemiJoinBatchSize: 2,
+		}
+		results, err := app.Execute(t, ctx, sqlstr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertResults(t, true, false, results, []string{`"a1","dev1"`, `"a2","dev2"`, `"a3","dev3"`})
+
+		if len(foreign.wheres) != 2 {
+			t.Error(sqlstr, ": want 2 batches got", foreign.wheres)
+			continue
+		}
+		for _, where := range foreign.wheres {
+			if !strings.HasPrefix(where, "id in (") {
+				t.Error(sqlstr, ": want in list got", where)
+			}
+		}
+	}
+
+	foreign := &recordForeign{Foreign: NewDbForeign(app.driver, app.conn)}
+	ctx := &Context{
+		Ctx:               context.Background(),
+		Foreign:           foreign,
+		SemiJoinBatchSize: -1,
+	}
+	results, err := app.Execute(t, ctx, "select cpu.f1, mo.f2 from cpu, fdw.managed_objects as mo where cpu.@mo = mo.id and cpu.f1 = 'a2'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResults(t, true, false, results, []string{`"a2","dev2"`})
+	if len(foreign.wheres) != 1 || foreign.wheres[0] != "" {
+		t.Error("want full scan got", foreign.wheres)
+	}
+}
+
+func TestSemiJoinHookStorage(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Close()
+
+	table, err := readTable([]byte("id,f2\n1,dev1\n2,dev2\n3,dev3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	table.Name = "db.managed_objects"
+	if err := app.Add(t, &table); err != nil {
+		t.Fatal(err)
+	}
+
+	var reads []string
+	app.runtimeRead = func(ctx *SessionContext, tableName string, tags []memcore.KeyValue) (time.Time, interface{}, error) {
+		reads = append(reads, tableName+"-"+memcore.KeyValues(tags).ToKey())
+		return time.Now(), map[string]interface{}{"f1": "a" + tags[0].Value}, nil
+	}
+
+	for _, sqlstr := range []string{
+		"select cpu.f1, mo.f2 from cpu, fdw.managed_objects as mo where cpu.@mo = mo.id and mo.f2 = 'dev2'",
+		"select cpu.f1, mo.f2 from fdw.managed_objects as mo, cpu where mo.id = cpu.@mo and mo.f2 = 'dev2'",
+	} {
+		reads = nil
+		foreign := &recordForeign{Foreign: NewDbForeign(app.driver, app.conn)}
+		results, err := app.Execute(t, &Context{Foreign: foreign}, sqlstr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertResults(t, true, false, results, []string{`"a2","dev2"`})
+		if len(reads) != 1 || reads[0] != "cpu-mo=2" {
+			t.Error(sqlstr, ": want read cpu-mo=2 got", reads)
+		}
+		// 读取 tag 和 join 共用会话中缓存的结果
+		if len(foreign.wheres) != 1 || foreign.wheres[0] != "mo.f2 = 'dev2'" {
+			t.Error(sqlstr, ": want read the foreign table once got", foreign.wheres)
+		}
+	}
+
+	reads = nil
+	results, err := app.Execute(t, nil, "select cpu.f1, mo.f2 from cpu, fdw.managed_objects as mo where cpu.@mo = mo.id and mo.f2 = 'dev9'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResults(t, true, false, results, []string{})
+	if len(reads) != 0 {
+		t.Error("want no read got", reads)
+	}
+}
+
+func TestSemiJoinDatetimeKey(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	key, ok := valueToSQLVal(vm.DatetimeToValue(now))
+	if !ok {
+		t.Fatal("datetime isnot supported")
+	}
+	_, args, err := PostgresDialect.ToSQL(nil, key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 1 {
+		t.Fatalf("got %#v", args)
+	}
+	if value, ok := args[0].(time.Time); !ok || !value.Equal(now) {
+		t.Errorf("want %s got %#v", now, args[0])
+	}
+}
@@ -0,0 +1,126 @@
+package memsql
+
+import (
+	"time"
+
+	"github.com/runner-mei/memsql/memcore"
+	"github.com/runner-mei/memsql/vm"
+	"github.com/xwb1989/sqlparser"
+)
+
+// resultsIn 将结果中的 datetime 设为在 loc 中格式化, 值可能与表共享, 所以
+// 修改前先复制
+func resultsIn(results []memcore.Record, loc *time.Location) {
+	for idx := range results {
+		values := results[idx].Values
+		copyed := false
+		for j := range values {
+			if values[j].Type != vm.ValueDatetime {
+				continue
+			}
+			if !copyed {
+				values = append([]memcore.Value(nil), values...)
+				copyed = true
+			}
+			values[j] = vm.DatetimeIn(values[j], loc)
+		}
+		results[idx].Values = values
+	}
+}
+
+// rewriteAtTimeZone 将 'expr AT TIME ZONE zone' 改写为 at_time_zone(expr, zone),
+// sqlparser 不支持它. expr 只能是列, 字符串, 函数调用或括号中的表达式, zone
+// 只能是列或字符串. 引号和注释中的 'AT TIME ZONE' 由词法分析排除
+func rewriteAtTimeZone(sqlstr string) string {
+	for {
+		tokens, ok := scanTokens(sqlstr)
+		if !ok {
+			// 由 sqlparser 报告语法错误
+			return sqlstr
+		}
+		at := findAtTimeZone(sqlstr, tokens)
+		if at < 0 {
+			return sqlstr
+		}
+		exprStart := operandStart(sqlstr, tokens, at)
+		zoneEnd := operandEnd(sqlstr, tokens, at+3)
+		if exprStart < 0 || zoneEnd < 0 {
+			// 无法改写时保持原样, 由 sqlparser 报告语法错误
+			return sqlstr
+		}
+		start, end := tokens[exprStart].start, tokens[zoneEnd].end
+		sqlstr = sqlstr[:start] + "at_time_zone(" + sqlstr[start:tokens[at-1].end] +
+			", " + sqlstr[tokens[at+3].start:end] + ")" + sqlstr[end:]
+	}
+}
+
+// findAtTimeZone 返回第一个 'AT TIME ZONE' 中 AT 的位置
+func findAtTimeZone(sqlstr string, tokens []sqlToken) int {
+	for idx := 0; idx+2 < len(tokens); idx++ {
+		if isWord(sqlstr, tokens[idx], "at") &&
+			isWord(sqlstr, tokens[idx+1], "time") &&
+			isWord(sqlstr, tokens[idx+2], "zone") {
+			return idx
+		}
+	}
+	return -1
+}
+
+// operandStart 返回 end 之前的操作数的第一个 token
+func operandStart(sqlstr string, tokens []sqlToken, end int) int {
+	pos := end - 1
+	if pos < 0 {
+		return -1
+	}
+	switch tokens[pos].typ {
+	case sqlparser.STRING:
+		return pos
+	case ')':
+		depth := 0
+		for ; pos >= 0; pos-- {
+			switch tokens[pos].typ {
+			case ')':
+				depth++
+			case '(':
+				depth--
+			}
+			if depth == 0 {
+				break
+			}
+		}
+		if pos < 0 {
+			return -1
+		}
+		// 函数名与括号之间没有空格
+		if pos > 0 && isName(sqlstr, tokens[pos-1]) && tokens[pos-1].end == tokens[pos].start {
+			pos--
+		}
+		return pos
+	}
+	if !isName(sqlstr, tokens[pos]) {
+		return -1
+	}
+	// 限定的列名, 如 t.`c`
+	for pos >= 2 && tokens[pos-1].typ == '.' && isName(sqlstr, tokens[pos-2]) {
+		pos -= 2
+	}
+	return pos
+}
+
+// operandEnd 返回 start 开始的操作数的最后一个 token
+func operandEnd(sqlstr string, tokens []sqlToken, start int) int {
+	if start >= len(tokens) {
+		return -1
+	}
+	if tokens[start].typ == sqlparser.STRING {
+		return start
+	}
+	if !isName(sqlstr, tokens[start]) {
+		return -1
+	}
+	pos := start
+	for pos+2 < len(tokens) && tokens[pos+1].typ == '.' && isName(sqlstr, tokens[pos+2]) {
+		pos += 2
+	}
+	return pos
+}
@@ -0,0 +1,144 @@
+package memsql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/runner-mei/memsql/vm"
+)
+
+func TestSessionTimeZone(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Close()
+
+	app.ReadWith(map[string][]map[string]interface{}{
+		"events-mo=1": {
+			{"id": int64(1), "time": time.Date(2021, 1, 31, 10, 0, 0, 0, time.UTC)},
+			{"id": int64(2), "time": time.Date(2021, 1, 31, 20, 0, 0, 0, time.UTC)},
+			{"id": int64(3), "time": time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)},
+		},
+	})
+
+	shanghai, err := vm.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	for _, test := range []struct {
+		sql    string
+		result []string
+	}{
+		{
+			sql: "select id, date_format(time, '%Y-%m-%d %H:%i') from events where @mo = '1'",
+			result: []string{
+				`1,"2021-01-31 18:00"`,
+				`2,"2021-02-01 04:00"`,
+				`3,"2020-02-29 08:00"`,
+			},
+		},
+		{
+			sql: "select id from events where @mo = '1' and time >= '2021-02-01'",
+			result: []string{
+				`2`,
+			},
+		},
+		{
+			sql: "select id from events where @mo = '1' and date(time) = '2021-01-31'",
+			result: []string{
+				`1`,
+			},
+		},
+		{
+			sql: "select id, cast(time + interval 1 month as char) from events where @mo = '1' and id = 1",
+			result: []string{
+				`1,"2021-02-28T18:00:00+08:00"`,
+			},
+		},
+		{
+			sql: "select id, cast(time + interval 1 year as char), cast(time - interval 1 month as char) from events where @mo = '1' and id = 3",
+			result: []string{
+				`3,"2021-02-28T08:00:00+08:00","2020-01-29T08:00:00+08:00"`,
+			},
+		},
+		{
+			sql: "select id, date_format(convert_tz(time, '+08:00', 'UTC'), '%Y-%m-%d %H:%i'), date_format(time at time zone 'America/New_York', '%Y-%m-%d %H:%i') from events where @mo = '1' and id = 2",
+			result: []string{
+				`2,"2021-01-31 20:00","2021-01-31 15:00"`,
+			},
+		},
+		{
+			sql: "select id, time from events where @mo = '1' and id = 1",
+			result: []string{
+				`1,'2021-01-31T18:00:00+08:00'`,
+			},
+		},
+		{
+			sql: "select id from events where @mo = '1' and id = 1 and utc_timestamp() + interval 8 hour between now() - interval 1 minute and now() + interval 1 minute",
+			result: []string{
+				`1`,
+			},
+		},
+		{
+			sql: "select id from events where @mo = '1' and time < now() and time > now() - interval 100 year",
+			result: []string{
+				`1`,
+				`2`,
+				`3`,
+			},
+		},
+	} {
+		t.Run(test.sql, func(t *testing.T) {
+			results, err := app.Execute(t, &Context{TimeZone: shanghai}, test.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertResults(t, true, false, results, test.result)
+		})
+	}
+}
+
+func TestRewriteAtTimeZone(t *testing.T) {
+	for _, test := range []struct {
+		sql    string
+		result string
+	}{
+		{
+			sql:    "select a at time zone 'UTC' from t",
+			result: "select at_time_zone(a, 'UTC') from t",
+		},
+		{
+			sql:    "select date(t.a AT  TIME ZONE zone) from t where b = 'at time zone'",
+			result: "select date(at_time_zone(t.a, zone)) from t where b = 'at time zone'",
+		},
+		{
+			sql:    "select now() at time zone '+08:00', (a + interval 1 day) at time zone 'UTC' from t",
+			result: "select at_time_zone(now(), '+08:00'), at_time_zone((a + interval 1 day), 'UTC') from t",
+		},
+		{
+			sql:    "select a from t where format = 'UTC'",
+			result: "select a from t where format = 'UTC'",
+		},
+		{
+			sql:    "select `t`.`at time` at time zone 'UTC', `time` at time zone `t`.zone from t",
+			result: "select at_time_zone(`t`.`at time`, 'UTC'), at_time_zone(`time`, `t`.zone) from t",
+		},
+		{
+			sql:    "select 'it''s at time zone', a /* at time zone 'x' */ at time zone 'UTC' from t -- at time zone 'y'\n",
+			result: "select 'it''s at time zone', at_time_zone(a, 'UTC') from t -- at time zone 'y'\n",
+		},
+		{
+			sql:    "select 'it\\'s at time zone', cpu.@mo at /* x */ time zone 'UTC' from t",
+			result: "select 'it\\'s at time zone', at_time_zone(cpu.@mo, 'UTC') from t",
+		},
+		{
+			sql:    "select date_format(a, '%Y') at time zone 'UTC' from t",
+			result: "select at_time_zone(date_format(a, '%Y'), 'UTC') from t",
+		},
+	} {
+		if result := rewriteAtTimeZone(test.sql); result != test.result {
+			t.Error(test.sql)
+			t.Error("want", test.result)
+			t.Error(" got", result)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package memsql
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/runner-mei/errors"
+	"github.com/xwb1989/sqlparser"
+)
+
+// sqlToken 是 sqlparser 词法分析的结果, start 和 end 是它在语句中的位置,
+// val 是去掉引号后的值
+type sqlToken struct {
+	typ        int
+	val        string
+	start, end int
+}
+
+// scanTokens 用 sqlparser 的词法分析读取语句中的 token, 注释被忽略, 语句有
+// 词法错误时返回 false
+func scanTokens(sqlstr string) ([]sqlToken, bool) {
+	tokenizer := sqlparser.NewStringTokenizer(sqlstr)
+	var tokens []sqlToken
+	end := 0
+	for {
+		typ, val := tokenizer.Scan()
+		switch typ {
+		case 0:
+			return tokens, true
+		case sqlparser.LEX_ERROR:
+			return nil, false
+		}
+		start := end
+		for start < len(sqlstr) && unicode.IsSpace(rune(sqlstr[start])) {
+			start++
+		}
+		// Position 是已读取的字符个数, 它包含 token 之后的一个字符
+		end = tokenizer.Position - 1
+		if typ == sqlparser.COMMENT {
+			continue
+		}
+		tokens = append(tokens, sqlToken{typ: typ, val: string(val), start: start, end: end})
+	}
+}
+
+// isWord token 是没有引号的 word
+func isWord(sqlstr string, token sqlToken, word string) bool {
+	return token.typ != sqlparser.STRING && strings.EqualFold(sqlstr[token.start:token.end], word)
+}
+
+// isName token 是标识符, 没有引号的关键字也可以作为列名或函数名, 如 time
+func isName(sqlstr string, token sqlToken) bool {
+	if token.typ == sqlparser.ID {
+		return true
+	}
+	if token.typ == sqlparser.STRING {
+		return false
+	}
+	for idx := token.start; idx < token.end; idx++ {
+		if !isIdentByte(sqlstr[idx]) {
+			return false
+		}
+	}
+	return token.start < token.end
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// tokenReader 按顺序读取语句中的 token
+type tokenReader struct {
+	sqlstr string
+	tokens []sqlToken
+	pos    int
+}
+
+// words 读取连续的 words, 不匹配时不读取任何 token
+func (r *tokenReader) words(words ...string) bool {
+	if r.pos+len(words) > len(r.tokens) {
+		return false
+	}
+	for idx, word := range words {
+		if !isWord(r.sqlstr, r.tokens[r.pos+idx], word) {
+			return false
+		}
+	}
+	r.pos += len(words)
+	return true
+}
+
+func (r *tokenReader) name() (string, bool) {
+	if r.pos >= len(r.tokens) || !isName(r.sqlstr, r.tokens[r.pos]) {
+		return "", false
+	}
+	r.pos++
+	return r.tokens[r.pos-1].val, true
+}
+
+func (r *tokenReader) str() (string, bool) {
+	if r.pos >= len(r.tokens) || r.tokens[r.pos].typ != sqlparser.STRING {
+		return "", false
+	}
+	r.pos++
+	return r.tokens[r.pos-1].val, true
+}
+
+// next 读取类型为 typ 的 token, 如 '(' 或 ','
+func (r *tokenReader) next(typ int) bool {
+	if r.pos >= len(r.tokens) || r.tokens[r.pos].typ != typ {
+		return false
+	}
+	r.pos++
+	return true
+}
+
+// paren 读取括号和其中的 token, 返回括号中的内容
+func (r *tokenReader) paren() (string, bool) {
+	if r.pos >= len(r.tokens) || r.tokens[r.pos].typ != '(' {
+		return "", false
+	}
+	depth := 0
+	for end := r.pos; end < len(r.tokens); end++ {
+		switch r.tokens[end].typ {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		if depth == 0 {
+			body := r.sqlstr[r.tokens[r.pos].end:r.tokens[end].start]
+			r.pos = end + 1
+			return body, true
+		}
+	}
+	return "", false
+}
+
+// end 判断是否已读取全部的 token, 最后的分号被忽略
+func (r *tokenReader) end() bool {
+	if r.pos < len(r.tokens) && r.tokens[r.pos].typ == ';' {
+		r.pos++
+	}
+	return r.pos >= len(r.tokens)
+}
+
+// rest 返回未读取的部分
+func (r *tokenReader) rest() string {
+	if r.pos >= len(r.tokens) {
+		return ""
+	}
+	return r.sqlstr[r.tokens[r.pos].start:]
+}
+
+func (r *tokenReader) errorf(msg string) error {
+	pos := len(r.sqlstr)
+	if r.pos < len(r.tokens) {
+		pos = r.tokens[r.pos].start
+	}
+	return errors.New(msg + " at position " + strconv.Itoa(pos))
+}
+
+func (r *tokenReader) syntaxError() error {
+	if r.pos >= len(r.tokens) {
+		return errors.New("syntax error at position " + strconv.Itoa(len(r.sqlstr)+1))
+	}
+	token := r.tokens[r.pos]
+	return errors.New("syntax error at position " + strconv.Itoa(token.end+1) + " near '" + r.sqlstr[token.start:token.end] + "'")
+}
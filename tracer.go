@@ -3,6 +3,7 @@ package memsql
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"unsafe"
 
 	"github.com/runner-mei/memsql/memcore"
@@ -38,11 +39,26 @@ const (
 	ReadError = 2
 )
 
+const (
+	CacheSession = "session"
+	CacheGlobal  = "global"
+)
+
+type CacheInfo struct {
+	Key   string
+	Hit   bool
+	Scope string
+}
+
 type ExecuteTracer struct {
 	tables []*TableTracer
 	Results []string
 
 	Reads map[string][]ReadInfo
+
+	CacheHits   int
+	CacheMisses int
+	Caches      []CacheInfo
 }
 
 func (d *ExecuteTracer) String() string {
@@ -62,6 +78,17 @@ func (d *ExecuteTracer) Format(formater Formater) {
 		formater.Println("\t\t\t\t - ", d.Results[idx])
 	}
 
+	if len(d.Caches) > 0 {
+		formater.Println("Caches: hits", d.CacheHits, "misses", d.CacheMisses)
+		for _, cache := range d.Caches {
+			if cache.Hit {
+				formater.Println("\t\t\t\t HIT", cache.Scope, cache.Key)
+			} else {
+				formater.Println("\t\t\t\t MISS", cache.Key)
+			}
+		}
+	}
+
 	if len(d.Reads) > 0 {
 		formater.Println("Reads: ")
 		for tableName, records := range d.Reads {
@@ -84,6 +111,22 @@ func (d *ExecuteTracer) Format(formater Formater) {
 	}
 }
 
+func (d *ExecuteTracer) CacheHit(key, scope string) {
+	d.CacheHits++
+	d.Caches = append(d.Caches, CacheInfo{
+		Key:   key,
+		Hit:   true,
+		Scope: scope,
+	})
+}
+
+func (d *ExecuteTracer) CacheMiss(key string) {
+	d.CacheMisses++
+	d.Caches = append(d.Caches, CacheInfo{
+		Key: key,
+	})
+}
+
 func (d *ExecuteTracer) ReadSkip(tableName string, tags []memcore.KeyValue) {
    if d.Reads == nil {
   	d.Reads = map[string][]ReadInfo{}
@@ -115,8 +158,25 @@ func (d *ExecuteTracer) ReadError(tableName string, tags []memcore.KeyValue, err
 }
 
 func (d *ExecuteTracer) Track(query memcore.Query) memcore.Query {
+	return trackResults(query, &d.Results)
+}
+
+// trackResults 记录 query 的结果, 批的查询仍然按批读取, 各个 partition 可能
+// 并发地记录
+func trackResults(query memcore.Query, results *[]string) memcore.Query {
+	if query.IterateBatch != nil {
+		var mu sync.Mutex
+		return query.SelectBatch(func(ctx memcore.Context, b *memcore.Batch) (*memcore.Batch, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, r := range b.Records() {
+				*results = append(*results, r.GoString())
+			}
+			return b, nil
+		})
+	}
 	return query.Map(func(ctx memcore.Context, r memcore.Record) (memcore.Record, error) {
-		d.Results = append(d.Results, r.GoString())
+		*results = append(*results, r.GoString())
 		return r, nil
 	})
 }
@@ -153,10 +213,7 @@ func (d *TableTracer) SetWhere(expr sqlparser.Expr) {
 }
 
 func (d *TableTracer) Track(query memcore.Query) memcore.Query {
-	return query.Map(func(ctx memcore.Context, r memcore.Record) (memcore.Record, error) {
-		d.Results = append(d.Results, r.GoString())
-		return r, nil
-	})
+	return trackResults(query, &d.Results)
 }
 
 func (d *TableTracer) Format(formater Formater) {
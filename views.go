@@ -0,0 +1,458 @@
+package memsql
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/runner-mei/errors"
+	"github.com/runner-mei/memsql/memcore"
+	"github.com/xwb1989/sqlparser"
+)
+
+// MaterializedView is a table which is computed from the query, the records
+// are saved into the Storage like the other tables and replaced when it is
+// refreshed. The definition is saved into the Storage if it implements
+// memcore.ViewStorage.
+type MaterializedView struct {
+	Name  string
+	Query string
+
+	// Interval is the refresh interval, the view is refreshed on demand only
+	// if it is 0.
+	Interval time.Duration
+
+	RefreshedAt time.Time
+	Err         error
+}
+
+const (
+	defCreateTable = "create table"
+	defCreateView  = "create view"
+	defRefreshView = "refresh view"
+	defDropView    = "drop view"
+)
+
+// definition 是 sqlparser 不支持的定义语句, 它们由 sqlparser 的词法分析
+// 识别, 其中的查询仍由 sqlparser 解析
+//
+//	CREATE TABLE name AS select
+//	CREATE MATERIALIZED VIEW name [REFRESH EVERY 'interval'] AS select
+//	REFRESH MATERIALIZED VIEW name
+//	DROP MATERIALIZED VIEW [IF EXISTS] name
+type definition struct {
+	action   string
+	name     string
+	ifExists bool
+	interval time.Duration
+	query    string
+}
+
+// parseDefinition 解析定义语句, ok 为 false 表示它不是定义语句
+func parseDefinition(sqlstr string) (def *definition, ok bool, err error) {
+	tokens, ok := scanTokens(sqlstr)
+	if !ok {
+		// 由 sqlparser 报告语法错误
+		return nil, false, nil
+	}
+	r := &tokenReader{sqlstr: sqlstr, tokens: tokens}
+
+	switch {
+	case r.words("create", "table"):
+		name, ok := r.name()
+		if !ok || !r.words("as") {
+			// 其它的 CREATE TABLE 由 sqlparser 解析
+			return nil, false, nil
+		}
+		def = &definition{action: defCreateTable, name: name}
+	case r.words("create", "materialized", "view"):
+		name, ok := r.name()
+		if !ok {
+			return nil, true, r.syntaxError()
+		}
+		def = &definition{action: defCreateView, name: name}
+		if r.words("refresh", "every") {
+			s, ok := r.str()
+			if !ok {
+				return nil, true, r.syntaxError()
+			}
+			def.interval, err = time.ParseDuration(s)
+			if err != nil {
+				return nil, true, errors.Wrap(err, "refresh interval '"+s+"' is invalid")
+			}
+		}
+		if !r.words("as") {
+			return nil, true, r.syntaxError()
+		}
+	case r.words("refresh", "materialized", "view"):
+		name, ok := r.name()
+		if !ok || !r.end() {
+			return nil, true, r.syntaxError()
+		}
+		return &definition{action: defRefreshView, name: name}, true, nil
+	case r.words("drop", "materialized", "view"):
+		def = &definition{action: defDropView}
+		def.ifExists = r.words("if", "exists")
+		name, ok := r.name()
+		if !ok || !r.end() {
+			return nil, true, r.syntaxError()
+		}
+		def.name = name
+		return def, true, nil
+	default:
+		return nil, false, nil
+	}
+
+	def.query = r.rest()
+	if _, _, err := parseWith(def.query); err != nil {
+		return nil, true, err
+	}
+	return def, true, nil
+}
+
+func execDefinition(ctx *Context, ms memcore.MutableStorage, sqlstmt string) (int64, bool, error) {
+	def, ok, err := parseDefinition(sqlstmt)
+	if !ok || err != nil {
+		return 0, ok, err
+	}
+
+	switch def.action {
+	case defCreateTable:
+		if len(ms.Measurements(def.name)) > 0 {
+			return 0, true, errors.New("table '" + def.name + "' is already exists")
+		}
+		affected, err := CreateTableAs(ctx, ms, def.name, def.query, time.Now())
+		return affected, true, err
+	case defCreateView:
+		if err := ctx.CreateMaterializedView(def.name, def.query, def.interval); err != nil {
+			return 0, true, err
+		}
+		affected, err := ctx.RefreshMaterializedView(def.name)
+		return affected, true, err
+	case defRefreshView:
+		affected, err := ctx.RefreshMaterializedView(def.name)
+		return affected, true, err
+	default:
+		err := ctx.DropMaterializedView(def.name)
+		if err != nil && def.ifExists && errors.Is(err, errViewNotFound) {
+			err = nil
+		}
+		return 0, true, err
+	}
+}
+
+var errViewNotFound = errors.New("materialized view isnot found")
+
+func viewNotFound(name string) error {
+	return errors.Wrap(errViewNotFound, "materialized view '"+name+"' isnot found")
+}
+
+// CreateTableAs executes the query and saves the results as the table, the
+// columns with the '@' prefix are the tags of the measurements. All the old
+// measurements of the table are replaced.
+func CreateTableAs(ctx *Context, ms memcore.MutableStorage, name, query string, now time.Time) (int64, error) {
+	_, stmt, err := parseWith(query)
+	if err != nil {
+		return 0, err
+	}
+	results, err := Execute(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	measurements, err := recordsToMeasurements(results, selectColumnNames(firstSelect(stmt)))
+	if err != nil {
+		return 0, errors.Wrap(err, "create table '"+name+"' fail")
+	}
+	return replaceTable(ms, name, measurements, now)
+}
+
+// selectColumnNames 返回 select 中各列的名称, 结果中未命名的列使用它
+func selectColumnNames(stmt sqlparser.SelectStatement) []string {
+	sel, ok := stmt.(*sqlparser.Select)
+	if !ok {
+		return nil
+	}
+	var names = make([]string, 0, len(sel.SelectExprs))
+	for _, expr := range sel.SelectExprs {
+		aliased, ok := expr.(*sqlparser.AliasedExpr)
+		if !ok {
+			return nil
+		}
+		if !aliased.As.IsEmpty() {
+			names = append(names, aliased.As.String())
+		} else if colName, ok := aliased.Expr.(*sqlparser.ColName); ok {
+			names = append(names, colName.Name.String())
+		} else {
+			names = append(names, "")
+		}
+	}
+	return names
+}
+
+func recordsToMeasurements(results RecordSet, names []string) ([]*insertMeasurement, error) {
+	var measurements []*insertMeasurement
+	var byKey = map[string]*insertMeasurement{}
+	for _, record := range results {
+		tags := memcore.CloneKeyValues(record.Tags)
+		columns := make([]memcore.Column, 0, len(record.Columns))
+		values := make([]memcore.Value, 0, len(record.Values))
+		for idx, column := range record.Columns {
+			name := column.Name
+			if name == "" && idx < len(names) {
+				name = names[idx]
+			}
+			if name == "" {
+				return nil, errors.New("column " + strconv.Itoa(idx+1) + " has no name, please use 'as' to name it")
+			}
+			if !strings.HasPrefix(name, "@") {
+				columns = append(columns, memcore.Column{Name: name})
+				values = append(values, record.Values[idx])
+				continue
+			}
+			if record.Values[idx].IsNull() {
+				return nil, errors.New("tag '" + name + "' is null")
+			}
+			s, err := record.Values[idx].AsString(true)
+			if err != nil {
+				return nil, errors.Wrap(err, "tag '"+name+"' is invalid")
+			}
+			tags = append(tags, memcore.KeyValue{Key: strings.TrimPrefix(name, "@"), Value: s})
+		}
+
+		row := memcore.Table{Columns: columns, Records: [][]memcore.Value{values}}
+		key := sortedTags(tags).ToKey()
+		m := byKey[key]
+		if m == nil {
+			m = &insertMeasurement{tags: tags, table: row}
+			byKey[key] = m
+			measurements = append(measurements, m)
+		} else if sameColumns(m.table.Columns, columns) {
+			m.table.Records = append(m.table.Records, values)
+		} else {
+			m.table = appendTable(m.table, row)
+		}
+	}
+	return measurements, nil
+}
+
+func sameColumns(a, b []memcore.Column) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx].Name != b[idx].Name {
+			return false
+		}
+	}
+	return true
+}
+
+// replaceTable 用新的 measurements 原子地替换表中所有的 measurements
+func replaceTable(ms memcore.MutableStorage, name string, measurements []*insertMeasurement, now time.Time) (int64, error) {
+	var affected int64
+	var list = make([]memcore.Measurement, 0, len(measurements))
+	for _, m := range measurements {
+		list = append(list, memcore.Measurement{Tags: m.tags, Table: m.table})
+		affected += int64(len(m.table.Records))
+	}
+	if err := ms.Replace(name, now, list); err != nil {
+		return 0, err
+	}
+	return affected, nil
+}
+
+// viewStorage 返回保存视图定义的 storage, 不支持时视图只保存在 Context 中
+func viewStorage(ctx *Context) (memcore.ViewStorage, bool) {
+	ms, err := mutableStorage(ctx)
+	if err != nil {
+		return nil, false
+	}
+	vs, ok := ms.(memcore.ViewStorage)
+	return vs, ok
+}
+
+// loadViews 读取 storage 中保存的视图, 调用者需要持有 viewsMu
+func (ctx *Context) loadViews() {
+	if ctx.viewsLoaded {
+		return
+	}
+	ctx.viewsLoaded = true
+	if ctx.views == nil {
+		ctx.views = map[string]*MaterializedView{}
+	}
+	vs, ok := viewStorage(ctx)
+	if !ok {
+		return
+	}
+	for _, view := range vs.Views() {
+		if _, ok := ctx.views[view.Name]; ok {
+			continue
+		}
+		ctx.views[view.Name] = &MaterializedView{
+			Name:     view.Name,
+			Query:    view.Query,
+			Interval: view.Interval,
+		}
+	}
+}
+
+// CreateMaterializedView registers the materialized view, it isnot
+// refreshed until RefreshMaterializedView is called.
+func (ctx *Context) CreateMaterializedView(name, query string, interval time.Duration) error {
+	if name == "" {
+		return errors.New("materialized view name is empty")
+	}
+	if _, _, err := parseWith(query); err != nil {
+		return errors.Wrap(err, "query of materialized view '"+name+"' is invalid")
+	}
+
+	ctx.viewsMu.Lock()
+	defer ctx.viewsMu.Unlock()
+	ctx.loadViews()
+	if _, ok := ctx.views[name]; ok {
+		return errors.New("materialized view '" + name + "' is already exists")
+	}
+	if vs, ok := viewStorage(ctx); ok {
+		err := vs.SetView(name, &memcore.View{
+			Name:     name,
+			Query:    query,
+			Interval: interval,
+		})
+		if err != nil {
+			return errors.Wrap(err, "save materialized view '"+name+"' fail")
+		}
+	}
+	ctx.views[name] = &MaterializedView{
+		Name:     name,
+		Query:    query,
+		Interval: interval,
+	}
+	return nil
+}
+
+// DropMaterializedView removes the materialized view and its records.
+func (ctx *Context) DropMaterializedView(name string) error {
+	ctx.viewsMu.Lock()
+	ctx.loadViews()
+	_, ok := ctx.views[name]
+	if !ok {
+		ctx.viewsMu.Unlock()
+		return viewNotFound(name)
+	}
+	if vs, ok := viewStorage(ctx); ok {
+		if err := vs.SetView(name, nil); err != nil {
+			ctx.viewsMu.Unlock()
+			return errors.Wrap(err, "remove materialized view '"+name+"' fail")
+		}
+	}
+	delete(ctx.views, name)
+	ctx.viewsMu.Unlock()
+
+	ms, err := mutableStorage(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = replaceTable(ms, name, nil, time.Now())
+	return err
+}
+
+// MaterializedViews returns the copies of all the materialized views.
+func (ctx *Context) MaterializedViews() []MaterializedView {
+	ctx.viewsMu.Lock()
+	defer ctx.viewsMu.Unlock()
+	ctx.loadViews()
+
+	var views = make([]MaterializedView, 0, len(ctx.views))
+	for _, view := range ctx.views {
+		views = append(views, *view)
+	}
+	sort.Slice(views, func(i, j int) bool {
+		return views[i].Name < views[j].Name
+	})
+	return views
+}
+
+// RefreshMaterializedView executes the query of the view and replaces its
+// records atomically, it returns the count of the records.
+//
+// The old records are kept and still served if the query fails, the error
+// is returned and saved into the view, see MaterializedViews.
+func (ctx *Context) RefreshMaterializedView(name string) (int64, error) {
+	ctx.viewsMu.Lock()
+	ctx.loadViews()
+	view, ok := ctx.views[name]
+	var query string
+	if ok {
+		query = view.Query
+	}
+	ctx.viewsMu.Unlock()
+	if !ok {
+		return 0, viewNotFound(name)
+	}
+
+	ms, err := mutableStorage(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	affected, err := CreateTableAs(ctx, ms, name, query, now)
+
+	ctx.viewsMu.Lock()
+	view.RefreshedAt = now
+	view.Err = err
+	ctx.viewsMu.Unlock()
+	return affected, err
+}
+
+// RefreshMaterializedViews refreshes the views which Interval is elapsed.
+func (ctx *Context) RefreshMaterializedViews(now time.Time) error {
+	ctx.viewsMu.Lock()
+	ctx.loadViews()
+	var names []string
+	for name, view := range ctx.views {
+		if view.Interval > 0 && !now.Before(view.RefreshedAt.Add(view.Interval)) {
+			names = append(names, name)
+		}
+	}
+	ctx.viewsMu.Unlock()
+	sort.Strings(names)
+
+	var errList []error
+	for _, name := range names {
+		if _, err := ctx.RefreshMaterializedView(name); err != nil {
+			errList = append(errList, errors.Wrap(err, "refresh materialized view '"+name+"' fail"))
+		}
+	}
+	if len(errList) == 0 {
+		return nil
+	}
+	if len(errList) == 1 {
+		return errList[0]
+	}
+	var sb strings.Builder
+	sb.WriteString("Multiple errors occur:")
+	for _, err := range errList {
+		sb.WriteString("\r\n\t")
+		sb.WriteString(err.Error())
+	}
+	return errors.New(sb.String())
+}
+
+// RunMaterializedViews refreshes the views on their schedule until the
+// context is done, the errors are saved into the views.
+func (ctx *Context) RunMaterializedViews(c context.Context, tick time.Duration) {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.Done():
+			return
+		case now := <-ticker.C:
+			ctx.RefreshMaterializedViews(now)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package memsql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/memsql/memcore"
+)
+
+func TestCreateTableAs(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Close()
+
+	table, err := readTable([]byte("id,name\n1,dev1\n2,dev2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	table.Name = "db.managed_objects"
+	if err := app.Add(t, &table); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &Context{
+		Ctx:     context.Background(),
+		Storage: WrapStorage(app.s),
+		Foreign: NewDbForeign(app.driver, app.conn),
+	}
+	_, err = Exec(ctx, "INSERT INTO cpu (@mo, f1) VALUES ('1', 10), ('2', 20), ('1', 30)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	affected, err := Exec(ctx, "CREATE TABLE cpu_mo AS SELECT cpu.@mo, mo.name, f1 FROM cpu JOIN fdw.managed_objects AS mo ON cpu.@mo = mo.id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if affected != 3 {
+		t.Error("want 3 got", affected)
+	}
+
+	results, err := app.Execute(t, ctx, "select name, f1 from cpu_mo where cpu_mo.@mo = '1'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResults(t, true, false, results, []string{
+		`"dev1",10`,
+		`"dev1",30`,
+	})
+
+	_, err = Exec(ctx, "CREATE TABLE cpu_mo AS SELECT f1 FROM cpu")
+	if err == nil {
+		t.Error("want error got ok")
+	}
+
+	_, err = Exec(ctx, "CREATE TABLE cpu_sum AS SELECT f1 + 1 FROM cpu")
+	if err == nil {
+		t.Error("want error got ok")
+	}
+}
+
+func TestMaterializedView(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Close()
+
+	ctx := &Context{
+		Ctx:     context.Background(),
+		Storage: WrapStorage(app.s),
+	}
+	_, err := Exec(ctx, "INSERT INTO cpu (@mo, f1) VALUES ('1', 10), ('2', 20)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	affected, err := Exec(ctx, "CREATE MATERIALIZED VIEW cpu_view REFRESH EVERY '1m' AS SELECT cpu.@mo, f1 FROM cpu WHERE f1 > 5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if affected != 2 {
+		t.Error("want 2 got", affected)
+	}
+	if !app.s.Exists("cpu_view", []KeyValue{{Key: "mo", Value: "1"}}, time.Now().Add(-time.Minute)) {
+		t.Error("cpu_view isnot exists")
+	}
+
+	_, err = Exec(ctx, "DELETE FROM cpu WHERE @mo = '2'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := app.Execute(t, ctx, "select cpu_view.@mo, f1 from cpu_view")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResults(t, true, false, results, []string{
+		`"1",10`,
+		`"2",20`,
+	})
+
+	// 没有到刷新时间
+	if err := ctx.RefreshMaterializedViews(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if count := len(app.s.(memcore.MutableStorage).Measurements("cpu_view")); count != 2 {
+		t.Error("want 2 got", count)
+	}
+
+	if err := ctx.RefreshMaterializedViews(time.Now().Add(2 * time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	results, err = app.Execute(t, ctx, "select cpu_view.@mo, f1 from cpu_view")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResults(t, true, false, results, []string{
+		`"1",10`,
+	})
+
+	_, err = Exec(ctx, "INSERT INTO cpu (@mo, f1) VALUES ('3', 30)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	affected, err = Exec(ctx, "REFRESH MATERIALIZED VIEW cpu_view")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if affected != 2 {
+		t.Error("want 2 got", affected)
+	}
+
+	views := ctx.MaterializedViews()
+	if len(views) != 1 || views[0].Name != "cpu_view" || views[0].Interval != time.Minute || views[0].RefreshedAt.IsZero() {
+		t.Errorf("%#v", views)
+	}
+
+	// 刷新失败时仍然使用旧的数据
+	_, err = Exec(ctx, "DELETE FROM cpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Exec(ctx, "REFRESH MATERIALIZED VIEW cpu_view"); err == nil {
+		t.Error("want error got ok")
+	}
+	results, err = app.Execute(t, ctx, "select cpu_view.@mo, f1 from cpu_view")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResults(t, true, false, results, []string{
+		`"1",10`,
+		`"3",30`,
+	})
+	if views := ctx.MaterializedViews(); len(views) != 1 || views[0].Err == nil {
+		t.Errorf("%#v", views)
+	}
+
+	// 视图的定义保存在 storage 中
+	other := &Context{
+		Ctx:     context.Background(),
+		Storage: WrapStorage(app.s),
+	}
+	views = other.MaterializedViews()
+	if len(views) != 1 || views[0].Name != "cpu_view" || views[0].Query != "SELECT cpu.@mo, f1 FROM cpu WHERE f1 > 5" || views[0].Interval != time.Minute {
+		t.Errorf("%#v", views)
+	}
+
+	if _, err := Exec(ctx, "DROP MATERIALIZED VIEW cpu_view"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.Execute(t, ctx, "select f1 from cpu_view"); err == nil {
+		t.Error("want error got ok")
+	}
+	if _, err := Exec(ctx, "DROP MATERIALIZED VIEW cpu_view"); err == nil {
+		t.Error("want error got ok")
+	}
+	if _, err := Exec(ctx, "DROP MATERIALIZED VIEW IF EXISTS cpu_view"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParseDefinition(t *testing.T) {
+	tests := []struct {
+		sql  string
+		def  *definition
+		fail bool
+	}{
+		{sql: "create table t1 as select * from cpu", def: &definition{action: defCreateTable, name: "t1", query: "select * from cpu"}},
+		{sql: "CREATE TABLE `t 1` /* c */ AS select 'as' from cpu;", def: &definition{action: defCreateTable, name: "t 1", query: "select 'as' from cpu;"}},
+		{sql: "create table t1 (id int)"},
+		{sql: "select 'create table t1 as' from cpu"},
+		{sql: "create materialized view v1 refresh every '1m' as select * from cpu", def: &definition{action: defCreateView, name: "v1", interval: time.Minute, query: "select * from cpu"}},
+		{sql: "create materialized view v1 refresh every '1x' as select * from cpu", fail: true},
+		{sql: "create materialized view v1 select * from cpu", fail: true},
+		{sql: "create materialized view v1 as select * from", fail: true},
+		{sql: "refresh materialized view v1;", def: &definition{action: defRefreshView, name: "v1"}},
+		{sql: "refresh materialized view v1 v2", fail: true},
+		{sql: "drop materialized view if exists `v1`", def: &definition{action: defDropView, name: "v1", ifExists: true}},
+		{sql: "drop materialized view", fail: true},
+	}
+	for _, test := range tests {
+		def, ok, err := parseDefinition(test.sql)
+		if test.fail {
+			if !ok || err == nil {
+				t.Error(test.sql, ": want error got", def, ok, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Error(test.sql, ":", err)
+			continue
+		}
+		if test.def == nil {
+			if ok {
+				t.Errorf("%s: want not a definition got %#v", test.sql, def)
+			}
+			continue
+		}
+		if !ok || *def != *test.def {
+			t.Errorf("%s: want %#v got %#v", test.sql, test.def, def)
+		}
+	}
+}
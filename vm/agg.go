@@ -6,6 +6,14 @@ type Aggregator interface {
 	Result() (Value, error)
 }
 
+// MergeableAggregator is implemented by the Aggregator whose partial results
+// can be merged, the other is created by the same function.
+type MergeableAggregator interface {
+	Aggregator
+
+	Merge(other Aggregator) error
+}
+
 var AggFuncs = map[string]func() Aggregator{
 	"count": func() Aggregator {
 		return &countAgg{}
@@ -38,6 +46,11 @@ func (c *countAgg) Result() (Value, error) {
 	return IntToValue(c.count), nil
 }
 
+func (c *countAgg) Merge(other Aggregator) error {
+	c.count += other.(*countAgg).count
+	return nil
+}
+
 type sumAgg struct {
 	sum Value
 }
@@ -54,6 +67,11 @@ func (c *sumAgg) Result() (Value, error) {
 	return c.sum, nil
 }
 
+func (c *sumAgg) Merge(other Aggregator) (err error) {
+	c.sum, err = Plus(c.sum, other.(*sumAgg).sum)
+	return err
+}
+
 type avgAgg struct {
 	name  string
 	sum   Value
@@ -73,5 +91,15 @@ func (c *avgAgg) Agg(value Value) (err error) {
 }
 
 func (c *avgAgg) Result() (Value, error) {
-	return divInt(c.sum, c.count)
+	return Div(c.sum, IntToValue(c.count))
+}
+
+func (c *avgAgg) Merge(other Aggregator) (err error) {
+	o := other.(*avgAgg)
+	c.sum, err = Plus(c.sum, o.sum)
+	if err != nil {
+		return err
+	}
+	c.count += o.count
+	return nil
 }
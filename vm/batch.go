@@ -0,0 +1,267 @@
+package vm
+
+import (
+	"sync"
+
+	"github.com/runner-mei/errors"
+)
+
+// vectorEntry 是 RunBatch 的栈上的一个列向量, scalar 表示所有行的值都是 values[0]
+type vectorEntry struct {
+	values []Value
+	scalar bool
+}
+
+func (e *vectorEntry) at(i int) Value {
+	if e.scalar {
+		return e.values[0]
+	}
+	return e.values[i]
+}
+
+var nullVector = []Value{Null()}
+
+// batchStack 的 buffers 保存列向量的结果, scalars 保存 scalar 的结果, 这样
+// 一个指令的结果不会覆盖它读取的 scalar
+type batchStack struct {
+	entries []vectorEntry
+	buffers [][]Value
+	scalars []Value
+}
+
+var batchStacks = sync.Pool{
+	New: func() interface{} {
+		return &batchStack{}
+	},
+}
+
+func (s *batchStack) reset(depth, n int) {
+	if cap(s.entries) < depth {
+		s.entries = make([]vectorEntry, depth)
+	}
+	s.entries = s.entries[:depth]
+	if cap(s.scalars) < depth {
+		s.scalars = make([]Value, depth)
+	}
+	s.scalars = s.scalars[:depth]
+	for len(s.buffers) < depth {
+		s.buffers = append(s.buffers, nil)
+	}
+	for idx := range s.buffers[:depth] {
+		if cap(s.buffers[idx]) < n {
+			s.buffers[idx] = make([]Value, n)
+		}
+		s.buffers[idx] = s.buffers[idx][:n]
+	}
+}
+
+// result 返回保存第 depth 个结果的空间和需要计算的行数
+func (s *batchStack) result(depth, n int, scalar bool) ([]Value, int) {
+	if scalar {
+		return s.scalars[depth : depth+1], 1
+	}
+	return s.buffers[depth], n
+}
+
+// RunBatch runs the program for the n rows at once, the values of the column
+// Columns[i] are vectors[slots[i]] and they are read from rowCtx(row) if
+// slots[i] is negative. The results are stored in out.
+//
+// An instruction is run for all the rows before the next one, so the short
+// circuits of AND and OR aren't taken. If the instruction fails for any row,
+// the rows are run one by one by Run, so the errors are same as Run.
+func (p *Program) RunBatch(n int, vectors [][]Value, slots []int, rowCtx func(int) Context, out []Value) error {
+	if n == 0 {
+		return nil
+	}
+	s := batchStacks.Get().(*batchStack)
+	s.reset(p.stackSize(), n)
+	ok := p.runBatch(s, n, vectors, slots, rowCtx, out)
+	batchStacks.Put(s)
+	if ok {
+		return nil
+	}
+
+	for i := 0; i < n; i++ {
+		value, err := p.Run(rowCtx(i), nil, nil)
+		if err != nil {
+			return err
+		}
+		out[i] = value
+	}
+	return nil
+}
+
+func (p *Program) runBatch(s *batchStack, n int, vectors [][]Value, slots []int, rowCtx func(int) Context, out []Value) bool {
+	var err error
+	var t Truth
+	depth := 0
+	for _, instr := range p.Code {
+		switch instr.Op {
+		case OpConst:
+			s.entries[depth] = vectorEntry{values: p.Consts[instr.Arg : instr.Arg+1], scalar: true}
+			depth++
+			continue
+		case OpColumn, OpColumnOrNull:
+			if slot := slots[instr.Arg]; slot >= 0 {
+				if slot < len(vectors) && len(vectors[slot]) >= n {
+					s.entries[depth] = vectorEntry{values: vectors[slot]}
+				} else {
+					s.entries[depth] = vectorEntry{values: nullVector, scalar: true}
+				}
+				depth++
+				continue
+			}
+			buf := s.buffers[depth]
+			for i := 0; i < n; i++ {
+				buf[i], err = p.column(rowCtx(i), int(instr.Arg))
+				if err != nil {
+					if instr.Op != OpColumnOrNull || !errors.Is(err, ErrNotFound) {
+						return false
+					}
+					buf[i], err = Null(), nil
+				}
+			}
+			s.entries[depth] = vectorEntry{values: buf}
+			depth++
+			continue
+		case OpEval:
+			buf := s.buffers[depth]
+			for i := 0; i < n; i++ {
+				buf[i], err = p.Funcs[instr.Arg](rowCtx(i))
+				if err != nil {
+					return false
+				}
+			}
+			s.entries[depth] = vectorEntry{values: buf}
+			depth++
+			continue
+		case OpJumpIfFalse, OpJumpIfTrue:
+			continue
+		case OpBetween, OpNotBetween:
+			depth -= 2
+			opt := p.Options[instr.Arg]
+			left, from, to := &s.entries[depth-1], &s.entries[depth], &s.entries[depth+1]
+			buf, rows := s.result(depth-1, n, left.scalar && from.scalar && to.scalar)
+			for i := 0; i < rows; i++ {
+				t, err = betweenValues(left.at(i), from.at(i), to.at(i), opt)
+				if err != nil {
+					return false
+				}
+				if instr.Op == OpNotBetween {
+					t = t.Not()
+				}
+				buf[i] = t.ToValue()
+			}
+			*left = vectorEntry{values: buf, scalar: rows == 1}
+			continue
+		}
+
+		switch instr.Op {
+		case OpUminus, OpUplus, OpBitNot, OpBang, OpNot,
+			OpIsNull, OpIsNotNull, OpIsTrue, OpIsNotTrue, OpIsFalse, OpIsNotFalse,
+			OpIn, OpNotIn:
+			e := &s.entries[depth-1]
+			buf, rows := s.result(depth-1, n, e.scalar)
+			for i := 0; i < rows; i++ {
+				buf[i], err = p.unary(instr, e.at(i))
+				if err != nil {
+					return false
+				}
+			}
+			*e = vectorEntry{values: buf, scalar: e.scalar}
+		default:
+			depth--
+			left, right := &s.entries[depth-1], &s.entries[depth]
+			buf, rows := s.result(depth-1, n, left.scalar && right.scalar)
+			for i := 0; i < rows; i++ {
+				buf[i], err = p.binary(instr, left.at(i), right.at(i))
+				if err != nil {
+					return false
+				}
+			}
+			*left = vectorEntry{values: buf, scalar: rows == 1}
+		}
+	}
+	if depth != 1 {
+		return false
+	}
+	result := &s.entries[0]
+	for i := 0; i < n; i++ {
+		out[i] = result.at(i)
+	}
+	return true
+}
+
+// unary 计算一元的指令, 与 run 中的一致
+func (p *Program) unary(instr Instruction, value Value) (Value, error) {
+	var t Truth
+	var err error
+	switch instr.Op {
+	case OpUminus:
+		return Uminus(value)
+	case OpUplus:
+		return Uplus(value)
+	case OpBitNot:
+		return BitNot(value)
+	case OpBang:
+		return Bang(value)
+	case OpNot:
+		t, err = ToTruth(value)
+		return t.Not().ToValue(), err
+	case OpIsNull:
+		return BoolToValue(value.IsNil()), nil
+	case OpIsNotNull:
+		return BoolToValue(!value.IsNil()), nil
+	case OpIsTrue:
+		t, err = ToTruth(value)
+		return BoolToValue(t == True), err
+	case OpIsNotTrue:
+		t, err = ToTruth(value)
+		return BoolToValue(t != True), err
+	case OpIsFalse:
+		t, err = ToTruth(value)
+		return BoolToValue(t == False), err
+	case OpIsNotFalse:
+		t, err = ToTruth(value)
+		return BoolToValue(t != False), err
+	default:
+		list := &p.Lists[instr.Arg]
+		t, err = inValues(value, list.Values, list.Option)
+		if instr.Op == OpNotIn {
+			t = t.Not()
+		}
+		return t.ToValue(), err
+	}
+}
+
+// binary 计算二元的指令, 与 run 中的一致
+func (p *Program) binary(instr Instruction, left, right Value) (Value, error) {
+	switch instr.Op {
+	case OpPlus:
+		return PlusIn(left, right, p.Location)
+	case OpMinus:
+		return MinusIn(left, right, p.Location)
+	case OpMult:
+		return Mult(left, right)
+	case OpDiv:
+		return Div(left, right)
+	case OpIntDiv:
+		return IntDiv(left, right)
+	case OpMod:
+		return Mod(left, right)
+	case OpBitAnd:
+		return BitAnd(left, right)
+	case OpBitOr:
+		return BitOr(left, right)
+	case OpBitXor:
+		return BitXor(left, right)
+	case OpShiftLeft:
+		return ShiftLeft(left, right)
+	case OpShiftRight:
+		return ShiftRight(left, right)
+	default:
+		t, err := p.compare(instr, &left, &right)
+		return t.ToValue(), err
+	}
+}
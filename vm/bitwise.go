@@ -0,0 +1,180 @@
+package vm
+
+// 与 mysql 一样, 位运算的操作数按 64 位无符号整数读取, 负数取其补码,
+// 结果总是 uint64
+
+func BitAndFunc(left, right func(Context) (Value, error)) func(Context) (Value, error) {
+	return binaryFunc(left, right, BitAnd)
+}
+
+func BitAnd(leftValue, rightValue Value) (Value, error) {
+	return bitwise("&", leftValue, rightValue, func(a, b uint64) uint64 {
+		return a & b
+	})
+}
+
+func BitOrFunc(left, right func(Context) (Value, error)) func(Context) (Value, error) {
+	return binaryFunc(left, right, BitOr)
+}
+
+func BitOr(leftValue, rightValue Value) (Value, error) {
+	return bitwise("|", leftValue, rightValue, func(a, b uint64) uint64 {
+		return a | b
+	})
+}
+
+func BitXorFunc(left, right func(Context) (Value, error)) func(Context) (Value, error) {
+	return binaryFunc(left, right, BitXor)
+}
+
+func BitXor(leftValue, rightValue Value) (Value, error) {
+	return bitwise("^", leftValue, rightValue, func(a, b uint64) uint64 {
+		return a ^ b
+	})
+}
+
+func ShiftLeftFunc(left, right func(Context) (Value, error)) func(Context) (Value, error) {
+	return binaryFunc(left, right, ShiftLeft)
+}
+
+// ShiftLeft shifts the bits to the left, the bits which are shifted out of
+// 64 bits are dropped, so the result is 0 if the count is 64 or more.
+func ShiftLeft(leftValue, rightValue Value) (Value, error) {
+	return bitwise("<<", leftValue, rightValue, func(a, b uint64) uint64 {
+		if b >= 64 {
+			return 0
+		}
+		return a << b
+	})
+}
+
+func ShiftRightFunc(left, right func(Context) (Value, error)) func(Context) (Value, error) {
+	return binaryFunc(left, right, ShiftRight)
+}
+
+// ShiftRight shifts the bits to the right, the result is 0 if the count is
+// 64 or more.
+func ShiftRight(leftValue, rightValue Value) (Value, error) {
+	return bitwise(">>", leftValue, rightValue, func(a, b uint64) uint64 {
+		if b >= 64 {
+			return 0
+		}
+		return a >> b
+	})
+}
+
+func BitNotFunc(read func(Context) (Value, error)) func(Context) (Value, error) {
+	return func(ctx Context) (Value, error) {
+		value, err := read(ctx)
+		if err != nil {
+			return Null(), err
+		}
+		return BitNot(value)
+	}
+}
+
+func BitNot(value Value) (Value, error) {
+	u64, ok := toBits(unwrapJSONNumber(value))
+	if !ok {
+		return Null(), NewArithmeticError("~", value.Type.String(), "")
+	}
+	return UintToValue(^u64), nil
+}
+
+func binaryFunc(left, right func(Context) (Value, error), f func(leftValue, rightValue Value) (Value, error)) func(Context) (Value, error) {
+	return func(ctx Context) (Value, error) {
+		leftValue, err := left(ctx)
+		if err != nil {
+			return Null(), err
+		}
+		rightValue, err := right(ctx)
+		if err != nil {
+			return Null(), err
+		}
+		return f(leftValue, rightValue)
+	}
+}
+
+func bitwise(op string, leftValue, rightValue Value, f func(a, b uint64) uint64) (Value, error) {
+	leftValue, rightValue = unwrapJSONNumber(leftValue), unwrapJSONNumber(rightValue)
+
+	a, ok := toBits(leftValue)
+	if !ok {
+		return Null(), NewArithmeticError(op, leftValue.Type.String(), rightValue.Type.String())
+	}
+	b, ok := toBits(rightValue)
+	if !ok {
+		return Null(), NewArithmeticError(op, leftValue.Type.String(), rightValue.Type.String())
+	}
+	return UintToValue(f(a, b)), nil
+}
+
+func toBits(value Value) (uint64, bool) {
+	switch value.Type {
+	case ValueInt64:
+		return uint64(value.Int64), true
+	case ValueUint64:
+		return value.Uint64, true
+	case ValueDecimal:
+		if i64, ok := value.DecimalValue().Int64(); ok {
+			return uint64(i64), true
+		}
+		return 0, false
+	default:
+		return 0, false
+	}
+}
+
+func UplusFunc(read func(Context) (Value, error)) func(Context) (Value, error) {
+	return func(ctx Context) (Value, error) {
+		value, err := read(ctx)
+		if err != nil {
+			return Null(), err
+		}
+		return Uplus(value)
+	}
+}
+
+func Uplus(value Value) (Value, error) {
+	value = unwrapJSONNumber(value)
+
+	switch value.Type {
+	case ValueInt64, ValueUint64, ValueFloat64, ValueDecimal, ValueInterval:
+		return value, nil
+	default:
+		return Null(), NewArithmeticError("+", value.Type.String(), "")
+	}
+}
+
+// BangFunc is the operator '!' of mysql, the number which isnot 0 is true and
+// NULL is NULL.
+func BangFunc(read func(Context) (Value, error)) func(Context) (Value, error) {
+	return func(ctx Context) (Value, error) {
+		value, err := read(ctx)
+		if err != nil {
+			return Null(), err
+		}
+		return Bang(value)
+	}
+}
+
+func Bang(value Value) (Value, error) {
+	value = unwrapJSONNumber(value)
+
+	switch value.Type {
+	case ValueNull:
+		return Null(), nil
+	case ValueBool:
+		return BoolToValue(!value.BoolValue()), nil
+	case ValueInt64:
+		return BoolToValue(value.Int64 == 0), nil
+	case ValueUint64:
+		return BoolToValue(value.Uint64 == 0), nil
+	case ValueFloat64:
+		return BoolToValue(value.Float64 == 0), nil
+	case ValueDecimal:
+		return BoolToValue(value.DecimalValue().Sign() == 0), nil
+	default:
+		return Null(), NewArithmeticError("!", value.Type.String(), "")
+	}
+}
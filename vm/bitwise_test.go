@@ -0,0 +1,58 @@
+package vm
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBitwise(t *testing.T) {
+	value := func(v Value) func(Context) (Value, error) {
+		return func(Context) (Value, error) {
+			return v, nil
+		}
+	}
+
+	tests := []struct {
+		f    func(Context) (Value, error)
+		want Value
+		fail bool
+	}{
+		{f: BitAndFunc(value(IntToValue(6)), value(UintToValue(3))), want: UintToValue(2)},
+		{f: BitOrFunc(value(IntToValue(-1)), value(IntToValue(0))), want: UintToValue(math.MaxUint64)},
+		{f: BitXorFunc(value(IntToValue(5)), value(IntToValue(1))), want: UintToValue(4)},
+		{f: ShiftLeftFunc(value(IntToValue(1)), value(IntToValue(70))), want: UintToValue(0)},
+		{f: ShiftRightFunc(value(IntToValue(-1)), value(IntToValue(63))), want: UintToValue(1)},
+		{f: BitNotFunc(value(UintToValue(math.MaxUint64))), want: UintToValue(0)},
+		{f: BitAndFunc(value(StringToValue("1")), value(IntToValue(1))), fail: true},
+		{f: BitOrFunc(value(IntToValue(1)), value(FloatToValue(1.5))), fail: true},
+		{f: BitNotFunc(value(Null())), fail: true},
+		{f: IntDivFunc(value(IntToValue(-7)), value(UintToValue(2))), want: IntToValue(-3)},
+		{f: IntDivFunc(value(IntToValue(7)), value(IntToValue(0))), want: Null()},
+		{f: IntDivFunc(value(IntToValue(math.MinInt64)), value(IntToValue(-1))), fail: true},
+		{f: IntDivFunc(value(UintToValue(1<<63)), value(IntToValue(-1))), want: IntToValue(math.MinInt64)},
+		{f: IntDivFunc(value(UintToValue(1<<63+1)), value(IntToValue(-1))), fail: true},
+		{f: IntDivFunc(value(UintToValue(math.MaxUint64)), value(IntToValue(-1))), fail: true},
+		{f: IntDivFunc(value(UintToValue(math.MaxUint64)), value(IntToValue(-2))), want: IntToValue(-math.MaxInt64)},
+		{f: IntDivFunc(value(UintToValue(math.MaxUint64)), value(IntToValue(-3))), want: IntToValue(-6148914691236517205)},
+		{f: IntDivFunc(value(FloatToValue(1e300)), value(IntToValue(1))), fail: true},
+		{f: UplusFunc(value(StringToValue("a"))), fail: true},
+		{f: BangFunc(value(FloatToValue(0.5))), want: BoolToValue(false)},
+		{f: BangFunc(value(Null())), want: Null()},
+	}
+	for idx, test := range tests {
+		got, err := test.f(nil)
+		if test.fail {
+			if err == nil {
+				t.Error(idx, ": want error got", got.String())
+			}
+			continue
+		}
+		if err != nil {
+			t.Error(idx, err)
+			continue
+		}
+		if got != test.want {
+			t.Error(idx, ": want", test.want.String(), "got", got.String())
+		}
+	}
+}
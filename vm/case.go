@@ -14,6 +14,10 @@ func ToSwitchWithValue(readValue func(Context) (Value, error),
 			if err != nil {
 				return Null(), err
 			}
+			// 与 '=' 一样, NULL 不等于任何值
+			if value.IsNil() || condValue.IsNil() {
+				continue
+			}
 			ok, err := condValue.EqualTo(value, EmptyCompareOption())
 			if err != nil {
 				return Null(), err
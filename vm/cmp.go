@@ -7,6 +7,12 @@ import (
 )
 
 func (r *Value) CompareTo(to Value, opt CompareOption) (int, error) {
+	if (r.Type == ValueJSON || to.Type == ValueJSON) && !r.IsNil() && !to.IsNil() {
+		return compareWithJSON(*r, to, opt)
+	}
+	if (r.Type == ValueDecimal || to.Type == ValueDecimal) && !r.IsNil() && !to.IsNil() {
+		return compareWithDecimal(*r, to, opt)
+	}
 	switch to.Type {
 	case ValueNull:
 		if r.IsNil() {
@@ -26,7 +32,7 @@ func (r *Value) CompareTo(to Value, opt CompareOption) (int, error) {
 	case ValueDatetime:
 		return r.CompareToDatetime(to.Int64, opt)
 	case ValueInterval:
-		return r.CompareToInterval(time.Duration(to.Int64), opt)
+		return r.CompareToInterval(intervalLength(to), opt)
 	default:
 		return 0, ErrUnknownValueType
 	}
@@ -88,25 +94,7 @@ func (r *Value) CompareToBool(to bool, opt CompareOption) (int, error) {
 
 func (r *Value) CompareToString(to string, opt CompareOption) (int, error) {
 	if r.Type == ValueString {
-		if opt.IgnoreCase {
-			if strings.EqualFold(r.Str, to) {
-				return 0, nil
-			}
-			aS := strings.ToUpper(r.Str)
-			toS := strings.ToUpper(to)
-
-			if aS > toS {
-				return 1, nil
-			}
-			return -1, nil
-		}
-		if r.Str == to {
-			return 0, nil
-		}
-		if r.Str > to {
-			return 1, nil
-		}
-		return -1, nil
+		return CompareStrings(r.Str, to, opt.collation()), nil
 	}
 
 	if opt.Weak {
@@ -151,6 +139,12 @@ func (r *Value) CompareToString(to string, opt CompareOption) (int, error) {
 				return 1, nil
 			}
 			return -1, nil
+		case ValueDatetime:
+			t, err := ToDatetimeIn(to, opt.Location)
+			if err != nil {
+				return 0, NewTypeError(r, "string", "datetime")
+			}
+			return r.CompareToDatetime(DatetimeToInt(t), opt)
 		}
 	}
 	return 0, NewTypeError(r, r.Type.String(), "string")
@@ -317,7 +311,7 @@ func (r *Value) CompareToDatetime(to int64, opt CompareOption) (int, error) {
 		if !opt.Weak {
 			return 0, NewTypeError(r, r.Type.String(), "datetime")
 		}
-		t, err := ToDatetime(r.Str)
+		t, err := ToDatetimeIn(r.Str, opt.Location)
 		if err != nil {
 			return 0, NewTypeError(r, r.Type.String(), "datetime")
 		}
@@ -354,16 +348,16 @@ func (r *Value) CompareToInterval(to time.Duration, opt CompareOption) (int, err
 	var value time.Duration
 	switch r.Type {
 	case ValueInterval:
-		value = time.Duration(r.Int64)
+		value = intervalLength(*r)
 	case ValueString:
 		if !opt.Weak {
 			return 0, NewTypeError(r, r.Type.String(), "interval")
 		}
-		t, err := time.ParseDuration(r.Str)
+		interval, err := ParseInterval(r.Str)
 		if err != nil {
 			return 0, NewTypeError(r, r.Type.String(), "interval")
 		}
-		value = t
+		value = intervalLength(interval)
 	// case ValueInt64:
 	//  if !opt.Weak {
 	//    return 0, NewTypeError(r, r.Type.String(), "interval")
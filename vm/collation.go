@@ -0,0 +1,189 @@
+package vm
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/runner-mei/errors"
+)
+
+// Collation is the rule to compare the strings.
+type Collation uint8
+
+const (
+	// CollationBinary compares the strings byte by byte.
+	CollationBinary Collation = iota
+	// CollationASCIICI ignores the case of the ASCII letters.
+	CollationASCIICI
+	// CollationUnicodeCI ignores the case of the letters with the unicode
+	// simple case folding.
+	CollationUnicodeCI
+	// CollationNatural compares the runs of the digits as numbers, so
+	// 'eth2' is less than 'eth10'.
+	CollationNatural
+)
+
+func (c Collation) String() string {
+	switch c {
+	case CollationBinary:
+		return "binary"
+	case CollationASCIICI:
+		return "ascii_ci"
+	case CollationUnicodeCI:
+		return "unicode_ci"
+	case CollationNatural:
+		return "natural"
+	default:
+		return "unknown_collation"
+	}
+}
+
+// ParseCollation returns the collation of the name, the names of mysql such
+// as 'utf8mb4_bin' and 'utf8mb4_general_ci' are accepted.
+func ParseCollation(name string) (Collation, error) {
+	switch strings.ToLower(name) {
+	case "binary", "bin", "utf8_bin", "utf8mb4_bin", "ascii_bin", "latin1_bin", "c", "posix":
+		return CollationBinary, nil
+	case "ascii_ci", "ascii_general_ci", "latin1_general_ci", "latin1_swedish_ci", "nocase":
+		return CollationASCIICI, nil
+	case "unicode_ci", "utf8_general_ci", "utf8_unicode_ci", "utf8mb4_general_ci", "utf8mb4_unicode_ci":
+		return CollationUnicodeCI, nil
+	case "natural", "numeric":
+		return CollationNatural, nil
+	default:
+		return CollationBinary, errors.New("collation '" + name + "' is unsupported")
+	}
+}
+
+// collation 返回 opt 的 collation, IgnoreCase 等同于 CollationUnicodeCI
+func (opt CompareOption) collation() Collation {
+	if opt.Collation == CollationBinary && opt.IgnoreCase {
+		return CollationUnicodeCI
+	}
+	return opt.Collation
+}
+
+// CompareStrings compares a and b with the collation.
+func CompareStrings(a, b string, c Collation) int {
+	switch c {
+	case CollationASCIICI:
+		return compareFunc(a, b, asciiFold)
+	case CollationUnicodeCI:
+		return compareFunc(a, b, unicodeFold)
+	case CollationNatural:
+		return compareNatural(a, b)
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+// FoldString returns the string which is compared byte by byte same as s
+// is compared with the collation, it is used by LIKE.
+func FoldString(s string, c Collation) string {
+	switch c {
+	case CollationASCIICI:
+		return strings.Map(asciiFold, s)
+	case CollationUnicodeCI:
+		return strings.Map(unicodeFold, s)
+	default:
+		return s
+	}
+}
+
+func asciiFold(r rune) rune {
+	if 'A' <= r && r <= 'Z' {
+		return r + 'a' - 'A'
+	}
+	return r
+}
+
+// unicodeFold 返回 r 的大小写等价类中最小的字符
+func unicodeFold(r rune) rune {
+	min := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < min {
+			min = f
+		}
+	}
+	return min
+}
+
+func compareFunc(a, b string, fold func(rune) rune) int {
+	for a != "" && b != "" {
+		ra, sizeA := utf8.DecodeRuneInString(a)
+		rb, sizeB := utf8.DecodeRuneInString(b)
+		ra, rb = fold(ra), fold(rb)
+		if ra != rb {
+			if ra < rb {
+				return -1
+			}
+			return 1
+		}
+		a, b = a[sizeA:], b[sizeB:]
+	}
+	switch {
+	case a == "" && b == "":
+		return 0
+	case a == "":
+		return -1
+	default:
+		return 1
+	}
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// compareNatural 按数字比较连续的数字, 其它部分按字节比较. 数值相同时前导零
+// 少的在前
+func compareNatural(a, b string) int {
+	tie := 0
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			endA, endB := 1, 1
+			for endA < len(a) && isDigit(a[endA]) {
+				endA++
+			}
+			for endB < len(b) && isDigit(b[endB]) {
+				endB++
+			}
+			numA := strings.TrimLeft(a[:endA], "0")
+			numB := strings.TrimLeft(b[:endB], "0")
+			if len(numA) != len(numB) {
+				if len(numA) < len(numB) {
+					return -1
+				}
+				return 1
+			}
+			if r := strings.Compare(numA, numB); r != 0 {
+				return r
+			}
+			if tie == 0 && endA != endB {
+				if endA < endB {
+					tie = -1
+				} else {
+					tie = 1
+				}
+			}
+			a, b = a[endA:], b[endB:]
+			continue
+		}
+		if a[0] != b[0] {
+			if a[0] < b[0] {
+				return -1
+			}
+			return 1
+		}
+		a, b = a[1:], b[1:]
+	}
+	switch {
+	case a == "" && b == "":
+		return tie
+	case a == "":
+		return -1
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,60 @@
+package vm
+
+import "testing"
+
+func TestCompareStrings(t *testing.T) {
+	tests := []struct {
+		a, b string
+		c    Collation
+		want int
+	}{
+		{a: "abc", b: "ABC", c: CollationBinary, want: 1},
+		{a: "abc", b: "ABC", c: CollationASCIICI, want: 0},
+		{a: "été", b: "ÉTÉ", c: CollationASCIICI, want: 1},
+		{a: "été", b: "ÉTÉ", c: CollationUnicodeCI, want: 0},
+		{a: "a", b: "B", c: CollationUnicodeCI, want: -1},
+		{a: "ab", b: "A", c: CollationUnicodeCI, want: 1},
+		{a: "eth2", b: "eth10", c: CollationBinary, want: 1},
+		{a: "eth2", b: "eth10", c: CollationNatural, want: -1},
+		{a: "eth2/10", b: "eth2/9", c: CollationNatural, want: 1},
+		{a: "eth02", b: "eth2", c: CollationNatural, want: 1},
+		{a: "eth2", b: "eth2", c: CollationNatural, want: 0},
+		{a: "eth", b: "eth1", c: CollationNatural, want: -1},
+		{a: "10", b: "9a", c: CollationNatural, want: 1},
+	}
+	for _, test := range tests {
+		if got := CompareStrings(test.a, test.b, test.c); got != test.want {
+			t.Error(test.a, test.c, test.b, ": want", test.want, "got", got)
+		}
+		if got := CompareStrings(test.b, test.a, test.c); got != -test.want {
+			t.Error(test.b, test.c, test.a, ": want", -test.want, "got", got)
+		}
+	}
+}
+
+func TestCollationOption(t *testing.T) {
+	for _, name := range []string{"utf8mb4_bin", "ASCII_GENERAL_CI", "utf8mb4_general_ci", "natural"} {
+		if _, err := ParseCollation(name); err != nil {
+			t.Error(name, err)
+		}
+	}
+	if _, err := ParseCollation("abc"); err == nil {
+		t.Error("want error got ok")
+	}
+
+	opt := EmptyCompareOption()
+	opt.Collation = CollationUnicodeCI
+	value := StringToValue("Été")
+	if ok, err := value.EqualTo(StringToValue("éTÉ"), opt); err != nil || !ok {
+		t.Error("want true got", ok, err)
+	}
+
+	like := LikeWith(func(Context) (Value, error) {
+		return value, nil
+	}, func(Context) (Value, error) {
+		return StringToValue("ét%"), nil
+	}, opt)
+	if ok, err := like(nil); err != nil || ok != True {
+		t.Error("want true got", ok, err)
+	}
+}
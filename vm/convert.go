@@ -1,8 +1,14 @@
 package vm
 
 import (
+	"math"
+	"math/big"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/runner-mei/errors"
 )
 
 func ConvertToBool(readValue func(Context) (Value, error)) func(Context) (Value, error) {
@@ -11,140 +17,653 @@ func ConvertToBool(readValue func(Context) (Value, error)) func(Context) (Value,
 		if err != nil {
 			return Null(), err
 		}
-		switch value.Type {
-		case ValueNull:
-			return BoolToValue(false), nil
-		case ValueBool:
-			return value, nil
-		case ValueString:
-			if strings.ToLower(value.Str) == "true" {
-				return BoolToValue(true), nil
-			}
-			return BoolToValue(false), nil
-		case ValueInt64:
-			if value.Int64 != 0 {
-				return BoolToValue(true), nil
-			}
-			return BoolToValue(false), nil
-		case ValueUint64:
-			if value.Uint64 != 0 {
-				return BoolToValue(true), nil
-			}
-			return BoolToValue(false), nil
-		// case ValueFloat64:
-		// 	return Null(), NewArithmeticError("convert", value.Type.String(), "boolean")
-		// case ValueDatetime:
-		// 	return Null(), NewArithmeticError("convert", value.Type.String(), "boolean")
-		// case ValueInterval:
-		// 	return Null(), NewArithmeticError("convert", value.Type.String(), "boolean")
-		default:
-			return Null(), newConvertError(nil, value, "boolean")
+		return ConvertValueToBool(value)
+	}
+}
+
+func ConvertValueToBool(value Value) (Value, error) {
+	switch value.Type {
+	case ValueNull:
+		return BoolToValue(false), nil
+	case ValueBool:
+		return value, nil
+	case ValueString:
+		if strings.ToLower(value.Str) == "true" {
+			return BoolToValue(true), nil
+		}
+		return BoolToValue(false), nil
+	case ValueInt64:
+		if value.Int64 != 0 {
+			return BoolToValue(true), nil
+		}
+		return BoolToValue(false), nil
+	case ValueUint64:
+		if value.Uint64 != 0 {
+			return BoolToValue(true), nil
 		}
+		return BoolToValue(false), nil
+	// case ValueFloat64:
+	// 	return Null(), NewArithmeticError("convert", value.Type.String(), "boolean")
+	// case ValueDatetime:
+	// 	return Null(), NewArithmeticError("convert", value.Type.String(), "boolean")
+	// case ValueInterval:
+	// 	return Null(), NewArithmeticError("convert", value.Type.String(), "boolean")
+	default:
+		return Null(), newConvertError(nil, value, "boolean")
 	}
 }
 
 func ConvertToInt(readValue func(Context) (Value, error)) func(Context) (Value, error) {
 	return func(ctx Context) (Value, error) {
 		value, err := readValue(ctx)
-		if err != nil {
+		if err != nil || value.IsNull() {
 			return Null(), err
 		}
-		switch value.Type {
-		// case ValueNull:
-		//   return BoolToValue(false), nil
-		case ValueBool:
-			if value.BoolValue() {
-				return IntToValue(1), nil
-			}
-			return IntToValue(0), nil
-		case ValueString:
-			i64, err := strconv.ParseInt(value.Str, 10, 64)
-			if err != nil {
-				return Null(), newConvertError(err, value, "int")
-			}
-			return IntToValue(i64), nil
-		case ValueInt64:
-			return value, nil
-		case ValueUint64:
-			return IntToValue(int64(value.Uint64)), nil
-		case ValueFloat64:
-			return IntToValue(int64(value.Float64)), nil
-		// case ValueDatetime:
-		// 	return Null(), NewArithmeticError("convert", value.Type.String(), "int")
-		// case ValueInterval:
-		// 	return Null(), NewArithmeticError("convert", value.Type.String(), "int")
-		default:
+		return ConvertValueToInt(value)
+	}
+}
+
+func ConvertValueToInt(value Value) (Value, error) {
+	switch value.Type {
+	// case ValueNull:
+	//   return BoolToValue(false), nil
+	case ValueBool:
+		if value.BoolValue() {
+			return IntToValue(1), nil
+		}
+		return IntToValue(0), nil
+	case ValueString:
+		i64, err := strconv.ParseInt(value.Str, 10, 64)
+		if err != nil {
+			return Null(), newConvertError(err, value, "int")
+		}
+		return IntToValue(i64), nil
+	case ValueInt64:
+		return value, nil
+	case ValueUint64:
+		return IntToValue(int64(value.Uint64)), nil
+	case ValueFloat64:
+		return IntToValue(int64(value.Float64)), nil
+	case ValueDecimal:
+		i64, ok := value.DecimalValue().Int64()
+		if !ok {
 			return Null(), newConvertError(nil, value, "int")
 		}
+		return IntToValue(i64), nil
+	// case ValueDatetime:
+	// 	return Null(), NewArithmeticError("convert", value.Type.String(), "int")
+	// case ValueInterval:
+	// 	return Null(), NewArithmeticError("convert", value.Type.String(), "int")
+	default:
+		return Null(), newConvertError(nil, value, "int")
 	}
 }
 
 func ConvertToUint(readValue func(Context) (Value, error)) func(Context) (Value, error) {
 	return func(ctx Context) (Value, error) {
 		value, err := readValue(ctx)
-		if err != nil {
+		if err != nil || value.IsNull() {
 			return Null(), err
 		}
-		switch value.Type {
-		// case ValueNull:
-		//   return BoolToValue(false), nil
-		case ValueBool:
-			if value.BoolValue() {
-				return UintToValue(1), nil
-			}
-			return UintToValue(0), nil
-		case ValueString:
-			u64, err := strconv.ParseUint(value.Str, 10, 64)
-			if err != nil {
-				return Null(), newConvertError(err, value, "uint")
-			}
-			return UintToValue(u64), nil
-		case ValueInt64:
-			return UintToValue(uint64(value.Int64)), nil
-		case ValueUint64:
-			return value, nil
-		case ValueFloat64:
-			return UintToValue(uint64(value.Float64)), nil
-		// case ValueDatetime:
-		// 	return Null(), NewArithmeticError("convert", value.Type.String(), "uint")
-		// case ValueInterval:
-		// 	return Null(), NewArithmeticError("convert", value.Type.String(), "uint")
-		default:
+		return ConvertValueToUint(value)
+	}
+}
+
+func ConvertValueToUint(value Value) (Value, error) {
+	switch value.Type {
+	// case ValueNull:
+	//   return BoolToValue(false), nil
+	case ValueBool:
+		if value.BoolValue() {
+			return UintToValue(1), nil
+		}
+		return UintToValue(0), nil
+	case ValueString:
+		u64, err := strconv.ParseUint(value.Str, 10, 64)
+		if err != nil {
+			return Null(), newConvertError(err, value, "uint")
+		}
+		return UintToValue(u64), nil
+	case ValueInt64:
+		return UintToValue(uint64(value.Int64)), nil
+	case ValueUint64:
+		return value, nil
+	case ValueFloat64:
+		return UintToValue(uint64(value.Float64)), nil
+	case ValueDecimal:
+		i64, ok := value.DecimalValue().Int64()
+		if !ok {
 			return Null(), newConvertError(nil, value, "uint")
 		}
+		return UintToValue(uint64(i64)), nil
+	// case ValueDatetime:
+	// 	return Null(), NewArithmeticError("convert", value.Type.String(), "uint")
+	// case ValueInterval:
+	// 	return Null(), NewArithmeticError("convert", value.Type.String(), "uint")
+	default:
+		return Null(), newConvertError(nil, value, "uint")
+	}
+}
+
+func ConvertToFloat(readValue func(Context) (Value, error)) func(Context) (Value, error) {
+	return func(ctx Context) (Value, error) {
+		value, err := readValue(ctx)
+		if err != nil || value.IsNull() {
+			return Null(), err
+		}
+		return ConvertValueToFloat(value)
+	}
+}
+
+func ConvertValueToFloat(value Value) (Value, error) {
+	switch value.Type {
+	case ValueBool:
+		if value.BoolValue() {
+			return FloatToValue(1), nil
+		}
+		return FloatToValue(0), nil
+	case ValueString:
+		f64, err := strconv.ParseFloat(value.Str, 64)
+		if err != nil {
+			return Null(), newConvertError(err, value, "float")
+		}
+		return FloatToValue(f64), nil
+	case ValueInt64:
+		return FloatToValue(float64(value.Int64)), nil
+	case ValueUint64:
+		return FloatToValue(float64(value.Uint64)), nil
+	case ValueFloat64:
+		return value, nil
+	case ValueDecimal:
+		return FloatToValue(value.DecimalValue().Float64()), nil
+	default:
+		return Null(), newConvertError(nil, value, "float")
+	}
+}
+
+func ConvertValueToString(value Value) (Value, error) {
+	switch value.Type {
+	case ValueString:
+		return value, nil
+	case ValueBool, ValueInt64, ValueUint64, ValueFloat64, ValueDatetime, ValueAny, ValueDecimal:
+		return StringToValue(value.String()), nil
+	case ValueInterval:
+		return StringToValue(formatInterval(&value)), nil
+	case ValueJSON:
+		return StringToValue(jsonText(value.Any)), nil
+	default:
+		return Null(), newConvertError(nil, value, "string")
 	}
 }
 
 func ConvertToDatetime(readValue func(Context) (Value, error)) func(Context) (Value, error) {
+	return ConvertToDatetimeIn(readValue, nil)
+}
+
+// ConvertToDatetimeIn is same as ConvertToDatetime but the string without
+// the zone is read in loc, nil is TimeLocal.
+func ConvertToDatetimeIn(readValue func(Context) (Value, error), loc *time.Location) func(Context) (Value, error) {
 	return func(ctx Context) (Value, error) {
 		value, err := readValue(ctx)
+		if err != nil || value.IsNull() {
+			return Null(), err
+		}
+		return ConvertValueToDatetimeIn(value, loc)
+	}
+}
+
+func ConvertValueToDatetime(value Value) (Value, error) {
+	return ConvertValueToDatetimeIn(value, nil)
+}
+
+func ConvertValueToDatetimeIn(value Value, loc *time.Location) (Value, error) {
+	switch value.Type {
+	// case ValueNull:
+	//   return BoolToValue(false), nil
+	// case ValueBool:
+	// 	if value.BoolValue() {
+	// 		return UintToValue(1), nil
+	// 	}
+	// 	return UintToValue(0), nil
+	case ValueString:
+		t, err := ToDatetimeIn(value.Str, loc)
 		if err != nil {
 			return Null(), err
 		}
-		switch value.Type {
-		// case ValueNull:
-		//   return BoolToValue(false), nil
-		// case ValueBool:
-		// 	if value.BoolValue() {
-		// 		return UintToValue(1), nil
-		// 	}
-		// 	return UintToValue(0), nil
-		case ValueString:
-			return ToDatetimeValue(value.Str)
-		// case ValueInt64:
-		//  	return UintToValue(uint64(value.Int64)), nil
-		// case ValueUint64:
-		//  	return value, nil
-		// case ValueFloat64:
-		//  	return UintToValue(uint64(value.Float64)), nil
-		case ValueDatetime:
-			return value, nil
-		// case ValueInterval:
-		// 	return Null(), NewArithmeticError("convert", value.Type.String(), "datetime")
-		default:
-			return Null(), newConvertError(nil, value, "datetime")
+		return DatetimeToValue(t), nil
+	// case ValueInt64:
+	//  	return UintToValue(uint64(value.Int64)), nil
+	// case ValueUint64:
+	//  	return value, nil
+	// case ValueFloat64:
+	//  	return UintToValue(uint64(value.Float64)), nil
+	case ValueDatetime:
+		return value, nil
+	// case ValueInterval:
+	// 	return Null(), NewArithmeticError("convert", value.Type.String(), "datetime")
+	default:
+		return Null(), newConvertError(nil, value, "datetime")
+	}
+}
+
+func ConvertToDate(readValue func(Context) (Value, error)) func(Context) (Value, error) {
+	return ConvertToDateIn(readValue, nil)
+}
+
+func ConvertToDateIn(readValue func(Context) (Value, error), loc *time.Location) func(Context) (Value, error) {
+	return func(ctx Context) (Value, error) {
+		value, err := readValue(ctx)
+		if err != nil || value.IsNull() {
+			return Null(), err
 		}
+		return ConvertValueToDateIn(value, loc)
+	}
+}
+
+// ConvertValueToDate converts the value to a datetime at the midnight of
+// its day in TimeLocal.
+func ConvertValueToDate(value Value) (Value, error) {
+	return ConvertValueToDateIn(value, nil)
+}
+
+// ConvertValueToDateIn converts the value to a datetime at the midnight of
+// its day in loc, nil is TimeLocal.
+func ConvertValueToDateIn(value Value, loc *time.Location) (Value, error) {
+	datetime, err := ConvertValueToDatetimeIn(value, loc)
+	if err != nil {
+		return Null(), newConvertError(err, value, "date")
+	}
+	return DatetimeToValue(midnight(datetime.DatetimeValue().In(location(loc)))), nil
+}
+
+func ConvertToTime(readValue func(Context) (Value, error)) func(Context) (Value, error) {
+	return ConvertToTimeIn(readValue, nil)
+}
+
+func ConvertToTimeIn(readValue func(Context) (Value, error), loc *time.Location) func(Context) (Value, error) {
+	return func(ctx Context) (Value, error) {
+		value, err := readValue(ctx)
+		if err != nil || value.IsNull() {
+			return Null(), err
+		}
+		return ConvertValueToTimeIn(value, loc)
+	}
+}
+
+// ConvertValueToTime converts the value to an interval, the datetime is
+// converted to the time elapsed since the midnight of its day in TimeLocal,
+// the string may be 'hh:mm:ss[.fraction]' or a datetime and the integer is
+// read as hhmmss.
+func ConvertValueToTime(value Value) (Value, error) {
+	return ConvertValueToTimeIn(value, nil)
+}
+
+// ConvertValueToTimeIn is same as ConvertValueToTime but the day of the
+// datetime is in loc, nil is TimeLocal.
+func ConvertValueToTimeIn(value Value, loc *time.Location) (Value, error) {
+	switch value.Type {
+	case ValueString:
+		if d, ok := parseClock(strings.TrimSpace(value.Str)); ok {
+			return IntervalToValue(d), nil
+		}
+		if t, err := ToDatetimeIn(value.Str, loc); err == nil {
+			return ConvertValueToTimeIn(DatetimeToValue(t), loc)
+		}
+		return ConvertValueToInterval(value)
+	case ValueInt64, ValueUint64:
+		i64 := value.Int64
+		if value.Type == ValueUint64 {
+			i64 = int64(value.Uint64)
+		}
+		sign := time.Duration(1)
+		if i64 < 0 {
+			sign = -1
+			i64 = -i64
+		}
+		if i64%100 >= 60 || i64/100%100 >= 60 {
+			return Null(), newConvertError(nil, value, "time")
+		}
+		d := time.Duration(i64/10000)*time.Hour +
+			time.Duration(i64/100%100)*time.Minute +
+			time.Duration(i64%100)*time.Second
+		return IntervalToValue(sign * d), nil
+	case ValueDatetime:
+		t := value.DatetimeValue().In(location(loc))
+		return IntervalToValue(t.Sub(midnight(t))), nil
+	case ValueInterval:
+		return value, nil
+	default:
+		return Null(), newConvertError(nil, value, "time")
+	}
+}
+
+// parseClock 解析 '[-]hh:mm[:ss[.fraction]]', 小时可以超过 24
+func parseClock(s string) (time.Duration, bool) {
+	sign := time.Duration(1)
+	if strings.HasPrefix(s, "-") {
+		sign = -1
+		s = s[1:]
+	}
+	fields := strings.Split(s, ":")
+	if len(fields) < 2 || len(fields) > 3 {
+		return 0, false
+	}
+	hours, err := strconv.ParseUint(fields[0], 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	minutes, err := strconv.ParseUint(fields[1], 10, 32)
+	if err != nil || minutes >= 60 {
+		return 0, false
+	}
+	d := time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute
+	if len(fields) == 3 {
+		seconds, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil || seconds < 0 || seconds >= 60 || strings.ContainsAny(fields[2], "eE+-") {
+			return 0, false
+		}
+		d += time.Duration(seconds * float64(time.Second))
+	}
+	return sign * d, true
+}
+
+// DefaultDecimalLength and DefaultDecimalScale are used when the length or
+// the scale of the DECIMAL is omitted.
+const (
+	DefaultDecimalLength = 10
+	DefaultDecimalScale  = 0
+)
+
+func ConvertToDecimal(readValue func(Context) (Value, error), length, scale int) func(Context) (Value, error) {
+	return func(ctx Context) (Value, error) {
+		value, err := readValue(ctx)
+		if err != nil || value.IsNull() {
+			return Null(), err
+		}
+		return ConvertValueToDecimal(value, length, scale)
+	}
+}
+
+// ConvertValueToDecimal rounds the value half away from zero to scale
+// digits after the decimal point, it fails if the result has more than
+// length digits.
+func ConvertValueToDecimal(value Value, length, scale int) (Value, error) {
+	if scale < 0 || length < 1 || scale > length {
+		return Null(), errors.New("decimal(" + strconv.Itoa(length) + "," + strconv.Itoa(scale) + ") is invalid")
+	}
+	d, err := toDecimalValue(value)
+	if err != nil {
+		return Null(), err
+	}
+	d = d.Round(scale)
+	if d.IntDigits() > length-scale {
+		return Null(), errors.New("'" + value.String() + "' is out of range of decimal(" + strconv.Itoa(length) + "," + strconv.Itoa(scale) + ")")
+	}
+	return DecimalToValue(d), nil
+}
+
+func toDecimalValue(value Value) (*Decimal, error) {
+	switch value.Type {
+	case ValueBool:
+		if value.BoolValue() {
+			return IntToDecimal(1), nil
+		}
+		return IntToDecimal(0), nil
+	case ValueString:
+		d, err := ParseDecimal(value.Str)
+		if err != nil {
+			return nil, newConvertError(err, value, "decimal")
+		}
+		return d, nil
+	case ValueInt64:
+		return IntToDecimal(value.Int64), nil
+	case ValueUint64:
+		return UintToDecimal(value.Uint64), nil
+	case ValueFloat64:
+		d, err := FloatToDecimal(value.Float64)
+		if err != nil {
+			return nil, newConvertError(err, value, "decimal")
+		}
+		return d, nil
+	case ValueDecimal:
+		return value.DecimalValue(), nil
+	default:
+		return nil, newConvertError(nil, value, "decimal")
+	}
+}
+
+func ConvertToChar(readValue func(Context) (Value, error), length int, charset string) func(Context) (Value, error) {
+	return ConvertToCharIn(readValue, length, charset, nil)
+}
+
+func ConvertToCharIn(readValue func(Context) (Value, error), length int, charset string, loc *time.Location) func(Context) (Value, error) {
+	return func(ctx Context) (Value, error) {
+		value, err := readValue(ctx)
+		if err != nil || value.IsNull() {
+			return Null(), err
+		}
+		return ConvertValueToCharIn(value, length, charset, loc)
+	}
+}
+
+// ConvertValueToChar converts the value to a string in the charset and
+// truncates it to length characters, a negative length means no limit.
+func ConvertValueToChar(value Value, length int, charset string) (Value, error) {
+	return ConvertValueToCharIn(value, length, charset, nil)
+}
+
+// ConvertValueToCharIn is same as ConvertValueToChar but the datetime is
+// formatted in loc, nil is TimeLocal.
+func ConvertValueToCharIn(value Value, length int, charset string, loc *time.Location) (Value, error) {
+	str, err := ConvertValueToString(value)
+	if err != nil {
+		return Null(), err
+	}
+	if value.Type == ValueDatetime {
+		str = StringToValue(FormatDatetime(value, loc))
+	}
+	s := str.Str
+	if charset != "" {
+		s, err = ConvertCharset(s, charset)
+		if err != nil {
+			return Null(), err
+		}
+	}
+	if length >= 0 && utf8.RuneCountInString(s) > length {
+		count := 0
+		for idx := range s {
+			if count == length {
+				s = s[:idx]
+				break
+			}
+			count++
+		}
+	}
+	return StringToValue(s), nil
+}
+
+func ConvertToBinary(readValue func(Context) (Value, error), length int) func(Context) (Value, error) {
+	return func(ctx Context) (Value, error) {
+		value, err := readValue(ctx)
+		if err != nil || value.IsNull() {
+			return Null(), err
+		}
+		return ConvertValueToBinary(value, length)
+	}
+}
+
+// ConvertValueToBinary converts the value to a string and truncates it to
+// length bytes, a negative length means no limit.
+func ConvertValueToBinary(value Value, length int) (Value, error) {
+	str, err := ConvertValueToString(value)
+	if err != nil {
+		return Null(), err
+	}
+	if length >= 0 && len(str.Str) > length {
+		return StringToValue(str.Str[:length]), nil
+	}
+	return str, nil
+}
+
+func ConvertUsing(readValue func(Context) (Value, error), charset string) func(Context) (Value, error) {
+	return func(ctx Context) (Value, error) {
+		value, err := readValue(ctx)
+		if err != nil || value.IsNull() {
+			return Null(), err
+		}
+		return ConvertValueToChar(value, -1, charset)
+	}
+}
+
+// ConvertCharset converts the string to the charset. The strings are always
+// stored as utf8, so the conversion replaces the characters that the charset
+// cannot represent with '?'.
+func ConvertCharset(s, charset string) (string, error) {
+	var max rune
+	switch strings.ToLower(charset) {
+	case "binary":
+		return s, nil
+	case "utf8mb4", "utf-8":
+		max = utf8.MaxRune
+	case "utf8", "utf8mb3":
+		max = 0xFFFF
+	case "latin1":
+		max = 0xFF
+	case "ascii":
+		max = 0x7F
+	default:
+		return "", errors.New("charset '" + charset + "' is unsupported")
+	}
+
+	return strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || r > max {
+			return '?'
+		}
+		return r
+	}, s), nil
+}
+
+func ConvertValueToInterval(value Value) (Value, error) {
+	switch value.Type {
+	case ValueString:
+		interval, err := ParseInterval(value.Str)
+		if err != nil {
+			return Null(), newConvertError(err, value, "interval")
+		}
+		return interval, nil
+	case ValueInt64:
+		return IntervalToValue(IntToInterval(value.Int64)), nil
+	case ValueInterval:
+		return value, nil
+	default:
+		return Null(), newConvertError(nil, value, "interval")
+	}
+}
+
+// ConvertValue converts value to the given type for the schemas of the
+// tables, null is kept as is. Unlike CAST it returns an error if the value
+// would be changed, such as 'yes' to bool or 1.5 to int.
+func ConvertValue(value Value, typ ValueType) (Value, error) {
+	if value.IsNull() {
+		return value, nil
+	}
+	switch typ {
+	case ValueNull, ValueAny:
+		return value, nil
+	case ValueBool:
+		return convertValueToBoolExactly(value)
+	case ValueString:
+		return ConvertValueToString(value)
+	case ValueInt64:
+		return convertValueToIntExactly(value)
+	case ValueUint64:
+		return convertValueToUintExactly(value)
+	case ValueFloat64:
+		return ConvertValueToFloat(value)
+	case ValueDatetime:
+		return ConvertValueToDatetime(value)
+	case ValueInterval:
+		return ConvertValueToInterval(value)
+	case ValueJSON:
+		return ConvertValueToJSON(value)
+	case ValueDecimal:
+		d, err := toDecimalValue(value)
+		if err != nil {
+			return Null(), err
+		}
+		return DecimalToValue(d), nil
+	default:
+		return Null(), newConvertError(nil, value, typ.String())
+	}
+}
+
+func convertValueToBoolExactly(value Value) (Value, error) {
+	switch value.Type {
+	case ValueBool:
+		return value, nil
+	case ValueString:
+		switch strings.ToLower(value.Str) {
+		case "true", "1":
+			return BoolToValue(true), nil
+		case "false", "0":
+			return BoolToValue(false), nil
+		}
+	case ValueInt64:
+		if value.Int64 == 0 || value.Int64 == 1 {
+			return BoolToValue(value.Int64 == 1), nil
+		}
+	case ValueUint64:
+		if value.Uint64 == 0 || value.Uint64 == 1 {
+			return BoolToValue(value.Uint64 == 1), nil
+		}
+	}
+	return Null(), newConvertError(nil, value, "boolean")
+}
+
+func convertValueToIntExactly(value Value) (Value, error) {
+	switch value.Type {
+	case ValueUint64:
+		if value.Uint64 > math.MaxInt64 {
+			return Null(), newConvertError(nil, value, "int")
+		}
+	case ValueFloat64:
+		// float64(math.MaxInt64) 等于 2^63, 它已经超出 int64 的范围
+		if value.Float64 != math.Trunc(value.Float64) ||
+			value.Float64 < math.MinInt64 || value.Float64 >= math.MaxInt64 {
+			return Null(), newConvertError(nil, value, "int")
+		}
+	case ValueDecimal:
+		if !isIntegralDecimal(value.DecimalValue()) {
+			return Null(), newConvertError(nil, value, "int")
+		}
+	}
+	return ConvertValueToInt(value)
+}
+
+func convertValueToUintExactly(value Value) (Value, error) {
+	switch value.Type {
+	case ValueInt64:
+		if value.Int64 < 0 {
+			return Null(), newConvertError(nil, value, "uint")
+		}
+	case ValueFloat64:
+		if value.Float64 != math.Trunc(value.Float64) ||
+			value.Float64 < 0 || value.Float64 >= math.MaxUint64 {
+			return Null(), newConvertError(nil, value, "uint")
+		}
+	case ValueDecimal:
+		if !isIntegralDecimal(value.DecimalValue()) || value.DecimalValue().Sign() < 0 {
+			return Null(), newConvertError(nil, value, "uint")
+		}
+	}
+	return ConvertValueToUint(value)
+}
+
+func isIntegralDecimal(d *Decimal) bool {
+	if d.scale == 0 {
+		return true
 	}
+	return new(big.Int).Rem(&d.unscaled, pow10(d.scale)).Sign() == 0
 }
 
 func newConvertError(err error, value Value, typeStr string) error {
@@ -0,0 +1,112 @@
+package vm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConvertValueToDecimal(t *testing.T) {
+	tests := []struct {
+		value  Value
+		length int
+		scale  int
+		want   string
+		fail   bool
+	}{
+		{value: StringToValue("1.005"), length: 10, scale: 2, want: "1.01"},
+		{value: StringToValue("-1.005"), length: 10, scale: 2, want: "-1.01"},
+		{value: FloatToValue(2.675), length: 10, scale: 2, want: "2.68"},
+		{value: StringToValue("9.995"), length: 4, scale: 2, want: "10.00"},
+		{value: StringToValue("9.995"), length: 3, scale: 2, fail: true},
+		{value: StringToValue("1.5e2"), length: 10, scale: 0, want: "150"},
+		{value: IntToValue(-12), length: 5, scale: 2, want: "-12.00"},
+		{value: UintToValue(123), length: 2, scale: 0, fail: true},
+		{value: BoolToValue(true), length: 1, scale: 0, want: "1"},
+		{value: StringToValue("abc"), length: 10, scale: 0, fail: true},
+		{value: IntToValue(1), length: 2, scale: 3, fail: true},
+	}
+	for idx, test := range tests {
+		value, err := ConvertValueToDecimal(test.value, test.length, test.scale)
+		if test.fail {
+			if err == nil {
+				t.Error(idx, ": want error got", value.String())
+			}
+			continue
+		}
+		if err != nil {
+			t.Error(idx, err)
+			continue
+		}
+		if value.Type != ValueDecimal || value.String() != test.want {
+			t.Error(idx, ": want", test.want, "got", value.String())
+		}
+	}
+}
+
+func TestConvertValueToTime(t *testing.T) {
+	tests := []struct {
+		value Value
+		want  time.Duration
+		fail  bool
+	}{
+		{value: StringToValue("10:30"), want: 10*time.Hour + 30*time.Minute},
+		{value: StringToValue("-838:59:59"), want: -(838*time.Hour + 59*time.Minute + 59*time.Second)},
+		{value: StringToValue("01:02:03.5"), want: time.Hour + 2*time.Minute + 3500*time.Millisecond},
+		{value: StringToValue("1h30m"), want: 90 * time.Minute},
+		{value: IntToValue(-13005), want: -(time.Hour + 30*time.Minute + 5*time.Second)},
+		{value: IntToValue(161), fail: true},
+		{value: StringToValue("10:61"), fail: true},
+		{value: FloatToValue(1), fail: true},
+	}
+	for idx, test := range tests {
+		value, err := ConvertValueToTime(test.value)
+		if test.fail {
+			if err == nil {
+				t.Error(idx, ": want error got", value.String())
+			}
+			continue
+		}
+		if err != nil {
+			t.Error(idx, err)
+			continue
+		}
+		if value.Type != ValueInterval || value.DurationValue() != test.want {
+			t.Error(idx, ": want", test.want, "got", value.String())
+		}
+	}
+}
+
+func TestConvertCharset(t *testing.T) {
+	tests := []struct {
+		charset string
+		want    string
+	}{
+		{charset: "utf8mb4", want: "aé中\U0001F600"},
+		{charset: "UTF8", want: "aé中?"},
+		{charset: "latin1", want: "aé??"},
+		{charset: "ascii", want: "a???"},
+		{charset: "binary", want: "aé中\U0001F600"},
+	}
+	for _, test := range tests {
+		s, err := ConvertCharset("aé中\U0001F600", test.charset)
+		if err != nil {
+			t.Error(test.charset, err)
+			continue
+		}
+		if s != test.want {
+			t.Error(test.charset, ": want", test.want, "got", s)
+		}
+	}
+	if _, err := ConvertCharset("a", "gbk"); err == nil {
+		t.Error("want error got ok")
+	}
+
+	value, err := ConvertValueToChar(StringToValue("aé中"), 2, "")
+	if err != nil || value.Str != "aé" {
+		t.Error("want aé got", value.Str, err)
+	}
+	value, err = ConvertValueToBinary(StringToValue("aé中"), 3)
+	if err != nil || value.Str != "aé" {
+		t.Error("want aé got", value.Str, err)
+	}
+}
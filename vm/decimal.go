@@ -0,0 +1,378 @@
+package vm
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/runner-mei/errors"
+)
+
+const (
+	// MaxDecimalScale is the max count of the digits after the decimal
+	// point, the result of the multiplication is rounded to it.
+	MaxDecimalScale = 30
+
+	// MaxDecimalPrecision is the max count of the digits before the decimal
+	// point.
+	MaxDecimalPrecision = 65
+
+	// DivDecimalScaleIncrement is the count of the digits which is added to
+	// the scale of the dividend in the decimal division.
+	DivDecimalScaleIncrement = 4
+)
+
+var ErrDivisionByZero = errors.New("division by zero")
+
+var bigTen = big.NewInt(10)
+
+// Decimal is an exact decimal number, its value is unscaled * 10^-scale.
+// A Decimal is immutable, all the operations return a new one.
+type Decimal struct {
+	unscaled big.Int
+	scale    int
+}
+
+// ParseDecimal parses a decimal text such as '-12.340' or '1.5e3', the
+// scale of the result is the count of the digits after the decimal point,
+// it is rounded to MaxDecimalScale. It returns an error if the count of the
+// digits before the decimal point is larger than MaxDecimalPrecision.
+func ParseDecimal(s string) (*Decimal, error) {
+	text := strings.TrimSpace(s)
+	exp := 0
+	if idx := strings.IndexAny(text, "eE"); idx >= 0 {
+		e, err := strconv.Atoi(text[idx+1:])
+		if err != nil {
+			return nil, errors.New("invalid decimal '" + s + "'")
+		}
+		// 指数太大时 pow10 会占用大量的内存
+		if e > MaxDecimalPrecision || e < -(MaxDecimalPrecision+MaxDecimalScale) {
+			return nil, errors.New("decimal '" + s + "' is out of range")
+		}
+		exp = e
+		text = text[:idx]
+	}
+
+	digits := text
+	scale := 0
+	if idx := strings.IndexByte(text, '.'); idx >= 0 {
+		digits = text[:idx] + text[idx+1:]
+		scale = len(text) - idx - 1
+	}
+	body := strings.TrimLeft(digits, "+-")
+	if body == "" || len(digits)-len(body) > 1 || strings.IndexFunc(body, func(r rune) bool {
+		return r < '0' || r > '9'
+	}) >= 0 {
+		return nil, errors.New("invalid decimal '" + s + "'")
+	}
+
+	d := &Decimal{}
+	if _, ok := d.unscaled.SetString(digits, 10); !ok {
+		return nil, errors.New("invalid decimal '" + s + "'")
+	}
+	d.scale = scale - exp
+	if d.scale < 0 {
+		d.unscaled.Mul(&d.unscaled, pow10(-d.scale))
+		d.scale = 0
+	}
+	if d.IntDigits() > MaxDecimalPrecision {
+		return nil, errors.New("decimal '" + s + "' is out of range")
+	}
+	if d.scale > MaxDecimalScale {
+		return d.Round(MaxDecimalScale), nil
+	}
+	return d, nil
+}
+
+func IntToDecimal(i64 int64) *Decimal {
+	d := &Decimal{}
+	d.unscaled.SetInt64(i64)
+	return d
+}
+
+func UintToDecimal(u64 uint64) *Decimal {
+	d := &Decimal{}
+	d.unscaled.SetUint64(u64)
+	return d
+}
+
+// FloatToDecimal converts the float to the shortest decimal which is read
+// back as the same float.
+func FloatToDecimal(f64 float64) (*Decimal, error) {
+	if math.IsInf(f64, 0) || math.IsNaN(f64) {
+		return nil, errors.New("invalid decimal '" + strconv.FormatFloat(f64, 'g', -1, 64) + "'")
+	}
+	return ParseDecimal(strconv.FormatFloat(f64, 'f', -1, 64))
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+func (d *Decimal) Scale() int {
+	return d.scale
+}
+
+func (d *Decimal) Sign() int {
+	return d.unscaled.Sign()
+}
+
+func (d *Decimal) String() string {
+	s := d.unscaled.String()
+	if d.scale == 0 {
+		return s
+	}
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	if len(s) <= d.scale {
+		s = strings.Repeat("0", d.scale-len(s)+1) + s
+	}
+	s = s[:len(s)-d.scale] + "." + s[len(s)-d.scale:]
+	if negative {
+		return "-" + s
+	}
+	return s
+}
+
+func (d *Decimal) Float64() float64 {
+	f64, _ := strconv.ParseFloat(d.String(), 64)
+	return f64
+}
+
+// Int64 returns the integer part of the decimal, ok is false if it
+// overflows int64.
+func (d *Decimal) Int64() (int64, bool) {
+	i := d.truncate()
+	return i.Int64(), i.IsInt64()
+}
+
+func (d *Decimal) truncate() *big.Int {
+	if d.scale == 0 {
+		return &d.unscaled
+	}
+	return new(big.Int).Quo(&d.unscaled, pow10(d.scale))
+}
+
+// rescale 返回 scale 更大的 unscaled 值
+func (d *Decimal) rescale(scale int) *big.Int {
+	if scale == d.scale {
+		return &d.unscaled
+	}
+	return new(big.Int).Mul(&d.unscaled, pow10(scale-d.scale))
+}
+
+func maxScale(a, b *Decimal) int {
+	if a.scale > b.scale {
+		return a.scale
+	}
+	return b.scale
+}
+
+func (d *Decimal) Cmp(to *Decimal) int {
+	scale := maxScale(d, to)
+	return d.rescale(scale).Cmp(to.rescale(scale))
+}
+
+func (d *Decimal) Neg() *Decimal {
+	result := &Decimal{scale: d.scale}
+	result.unscaled.Neg(&d.unscaled)
+	return result
+}
+
+func (d *Decimal) Add(to *Decimal) *Decimal {
+	result := &Decimal{scale: maxScale(d, to)}
+	result.unscaled.Add(d.rescale(result.scale), to.rescale(result.scale))
+	return result
+}
+
+func (d *Decimal) Sub(to *Decimal) *Decimal {
+	result := &Decimal{scale: maxScale(d, to)}
+	result.unscaled.Sub(d.rescale(result.scale), to.rescale(result.scale))
+	return result
+}
+
+func (d *Decimal) Mul(to *Decimal) *Decimal {
+	result := &Decimal{scale: d.scale + to.scale}
+	result.unscaled.Mul(&d.unscaled, &to.unscaled)
+	if result.scale > MaxDecimalScale {
+		return result.Round(MaxDecimalScale)
+	}
+	return result
+}
+
+// Div returns d / to rounded to the scale of d plus
+// DivDecimalScaleIncrement digits.
+func (d *Decimal) Div(to *Decimal) (*Decimal, error) {
+	if to.Sign() == 0 {
+		return nil, ErrDivisionByZero
+	}
+	scale := d.scale + DivDecimalScaleIncrement
+	if scale > MaxDecimalScale {
+		scale = MaxDecimalScale
+	}
+
+	// d / to = (d.unscaled * 10^(scale + 1 + to.scale - d.scale) / to.unscaled) * 10^-(scale+1)
+	// 多计算一位用于四舍五入
+	numerator := new(big.Int).Mul(&d.unscaled, pow10(scale+1+to.scale-d.scale))
+	quo := new(big.Int).Quo(numerator, &to.unscaled)
+	result := &Decimal{scale: scale + 1}
+	result.unscaled.Set(quo)
+	return result.Round(scale), nil
+}
+
+// Quo returns the integer part of d / to.
+func (d *Decimal) Quo(to *Decimal) (*big.Int, error) {
+	if to.Sign() == 0 {
+		return nil, ErrDivisionByZero
+	}
+	scale := maxScale(d, to)
+	return new(big.Int).Quo(d.rescale(scale), to.rescale(scale)), nil
+}
+
+// Mod returns the remainder of d / to, it has the sign of d.
+func (d *Decimal) Mod(to *Decimal) (*Decimal, error) {
+	if to.Sign() == 0 {
+		return nil, ErrDivisionByZero
+	}
+	result := &Decimal{scale: maxScale(d, to)}
+	result.unscaled.Rem(d.rescale(result.scale), to.rescale(result.scale))
+	return result, nil
+}
+
+// Round rounds the decimal half away from zero to scale digits after the
+// decimal point.
+func (d *Decimal) Round(scale int) *Decimal {
+	result := &Decimal{scale: scale}
+	if scale >= d.scale {
+		result.unscaled.Set(d.rescale(scale))
+		return result
+	}
+
+	divisor := pow10(d.scale - scale)
+	quo, rem := new(big.Int).QuoRem(&d.unscaled, divisor, new(big.Int))
+	rem.Abs(rem).Mul(rem, big.NewInt(2))
+	if rem.Cmp(divisor) >= 0 {
+		if d.unscaled.Sign() < 0 {
+			quo.Sub(quo, big.NewInt(1))
+		} else {
+			quo.Add(quo, big.NewInt(1))
+		}
+	}
+	result.unscaled.Set(quo)
+	return result
+}
+
+// IntDigits returns the count of the digits before the decimal point.
+func (d *Decimal) IntDigits() int {
+	i := d.truncate()
+	if i.Sign() == 0 {
+		return 0
+	}
+	return len(new(big.Int).Abs(i).String())
+}
+
+func DecimalToValue(value *Decimal) Value {
+	return Value{
+		Type: ValueDecimal,
+		Any:  value,
+	}
+}
+
+func (v *Value) DecimalValue() *Decimal {
+	d, _ := v.Any.(*Decimal)
+	return d
+}
+
+// toDecimal converts the integer and the decimal to decimal, ok is false
+// for the other types.
+func toDecimal(value Value) (*Decimal, bool) {
+	switch value.Type {
+	case ValueInt64:
+		return IntToDecimal(value.Int64), true
+	case ValueUint64:
+		return UintToDecimal(value.Uint64), true
+	case ValueDecimal:
+		return value.DecimalValue(), true
+	default:
+		return nil, false
+	}
+}
+
+// decimalArithmetic 计算 decimal 与其它数字的运算, 与整数运算时结果是
+// decimal, 与浮点数运算时结果是浮点数, ff 为 nil 时不支持浮点数. 除以零
+// 的结果与整数一样是 null
+func decimalArithmetic(op string, left, right Value, f func(a, b *Decimal) (*Decimal, error), ff func(a, b float64) (Value, error)) (Value, error) {
+	if left.Type == ValueFloat64 || right.Type == ValueFloat64 {
+		if ff == nil {
+			return Null(), NewArithmeticError(op, left.Type.String(), right.Type.String())
+		}
+		a, ok := toDecimal(left)
+		b, ok2 := toDecimal(right)
+		switch {
+		case ok && right.Type == ValueFloat64:
+			return ff(a.Float64(), right.Float64)
+		case ok2 && left.Type == ValueFloat64:
+			return ff(left.Float64, b.Float64())
+		}
+		return Null(), NewArithmeticError(op, left.Type.String(), right.Type.String())
+	}
+
+	a, ok := toDecimal(left)
+	if !ok {
+		return Null(), NewArithmeticError(op, left.Type.String(), right.Type.String())
+	}
+	b, ok := toDecimal(right)
+	if !ok {
+		return Null(), NewArithmeticError(op, left.Type.String(), right.Type.String())
+	}
+	result, err := f(a, b)
+	if err != nil {
+		if err == ErrDivisionByZero {
+			return Null(), nil
+		}
+		return Null(), err
+	}
+	return DecimalToValue(result), nil
+}
+
+// compareWithDecimal 比较 decimal 与其它值, 与浮点数比较时转换成浮点数
+func compareWithDecimal(left, right Value, opt CompareOption) (int, error) {
+	var toDecimalWeak = func(value Value) (*Decimal, error) {
+		if d, ok := toDecimal(value); ok {
+			return d, nil
+		}
+		if value.Type == ValueString && opt.Weak {
+			if d, err := ParseDecimal(value.Str); err == nil {
+				return d, nil
+			}
+		}
+		return nil, NewTypeError(value, value.Type.String(), "decimal")
+	}
+
+	if left.Type == ValueFloat64 || right.Type == ValueFloat64 {
+		a, b := left.Float64, right.Float64
+		if left.Type == ValueDecimal {
+			a = left.DecimalValue().Float64()
+		} else if right.Type == ValueDecimal {
+			b = right.DecimalValue().Float64()
+		}
+		if a > b {
+			return 1, nil
+		}
+		if a < b {
+			return -1, nil
+		}
+		return 0, nil
+	}
+
+	a, err := toDecimalWeak(left)
+	if err != nil {
+		return 0, err
+	}
+	b, err := toDecimalWeak(right)
+	if err != nil {
+		return 0, err
+	}
+	return a.Cmp(b), nil
+}
@@ -0,0 +1,141 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+)
+
+func mustParseDecimal(t *testing.T, s string) Value {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return DecimalToValue(d)
+}
+
+func binaryOp(op func(left, right func(Context) (Value, error)) func(Context) (Value, error)) func(Value, Value) (Value, error) {
+	return func(x, y Value) (Value, error) {
+		return op(func(Context) (Value, error) {
+			return x, nil
+		}, func(Context) (Value, error) {
+			return y, nil
+		})(nil)
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+		fail bool
+	}{
+		{s: "0", want: "0"},
+		{s: "-0.001", want: "-0.001"},
+		{s: "+12.340", want: "12.340"},
+		{s: ".5", want: "0.5"},
+		{s: "1.5e3", want: "1500"},
+		{s: "15e-3", want: "0.015"},
+		{s: "123456789012345678901234567890.123", want: "123456789012345678901234567890.123"},
+		{s: "", fail: true},
+		{s: "1.2.3", fail: true},
+		{s: "--1", fail: true},
+		{s: "1e", fail: true},
+		{s: "abc", fail: true},
+		{s: "1e64", want: "1" + strings.Repeat("0", 64)},
+		{s: "1e65", fail: true},
+		{s: "1e999999999", fail: true},
+		{s: "1e-999999999", fail: true},
+		{s: "1e-31", want: "0." + strings.Repeat("0", 30)},
+		{s: "1" + strings.Repeat("0", 65), fail: true},
+	}
+	for _, test := range tests {
+		d, err := ParseDecimal(test.s)
+		if test.fail {
+			if err == nil {
+				t.Error(test.s, ": want error got", d.String())
+			}
+			continue
+		}
+		if err != nil {
+			t.Error(test.s, ":", err)
+			continue
+		}
+		if d.String() != test.want {
+			t.Error(test.s, ": want", test.want, "got", d.String())
+		}
+	}
+}
+
+func TestDecimalArithmetic(t *testing.T) {
+	tests := []struct {
+		f    func(Value, Value) (Value, error)
+		x    Value
+		y    Value
+		want string
+		typ  ValueType
+	}{
+		{f: Plus, x: mustParseDecimal(t, "0.1"), y: mustParseDecimal(t, "0.20"), want: "0.30", typ: ValueDecimal},
+		{f: Plus, x: IntToValue(1), y: mustParseDecimal(t, "0.5"), want: "1.5", typ: ValueDecimal},
+		{f: Plus, x: mustParseDecimal(t, "0.5"), y: FloatToValue(0.25), want: "0.75", typ: ValueFloat64},
+		{f: Div, x: mustParseDecimal(t, "1"), y: IntToValue(3), want: "0.3333", typ: ValueDecimal},
+		{f: Div, x: mustParseDecimal(t, "-2.00"), y: IntToValue(3), want: "-0.666667", typ: ValueDecimal},
+		{f: Div, x: mustParseDecimal(t, "1"), y: IntToValue(0), want: "null", typ: ValueNull},
+		{f: Div, x: mustParseDecimal(t, "1"), y: FloatToValue(0), want: "null", typ: ValueNull},
+		{f: Div, x: IntToValue(1), y: IntToValue(0), want: "null", typ: ValueNull},
+		{f: Div, x: FloatToValue(1), y: FloatToValue(0), want: "null", typ: ValueNull},
+		{f: binaryOp(ModFunc), x: IntToValue(1), y: IntToValue(0), want: "null", typ: ValueNull},
+		{f: binaryOp(MultFunc), x: mustParseDecimal(t, "1.25"), y: UintToValue(4), want: "5.00", typ: ValueDecimal},
+		{f: binaryOp(MinusFunc), x: IntToValue(1), y: mustParseDecimal(t, "0.01"), want: "0.99", typ: ValueDecimal},
+		{f: binaryOp(ModFunc), x: mustParseDecimal(t, "-7.5"), y: IntToValue(2), want: "-1.5", typ: ValueDecimal},
+		{f: binaryOp(IntDivFunc), x: mustParseDecimal(t, "7.5"), y: mustParseDecimal(t, "2.5"), want: "3", typ: ValueInt64},
+	}
+	for idx, test := range tests {
+		value, err := test.f(test.x, test.y)
+		if err != nil {
+			t.Error(idx, err)
+			continue
+		}
+		if value.Type != test.typ || value.String() != test.want {
+			t.Error(idx, ": want", test.typ, test.want, "got", value.Type, value.String())
+		}
+	}
+
+	if _, err := Plus(mustParseDecimal(t, "1"), StringToValue("1")); err == nil {
+		t.Error("want error got ok")
+	}
+}
+
+func TestDecimalCompare(t *testing.T) {
+	tests := []struct {
+		x    Value
+		y    Value
+		want int
+	}{
+		{x: mustParseDecimal(t, "1.10"), y: mustParseDecimal(t, "1.1"), want: 0},
+		{x: mustParseDecimal(t, "1.10"), y: IntToValue(2), want: -1},
+		{x: UintToValue(2), y: mustParseDecimal(t, "1.999"), want: 1},
+		{x: mustParseDecimal(t, "0.5"), y: FloatToValue(0.5), want: 0},
+		{x: mustParseDecimal(t, "12345678901234567.89"), y: mustParseDecimal(t, "12345678901234567.88"), want: 1},
+		{x: mustParseDecimal(t, "2.50"), y: StringToValue("2.5"), want: 0},
+	}
+	for idx, test := range tests {
+		x := test.x
+		r, err := x.CompareTo(test.y, EmptyCompareOption())
+		if err != nil {
+			t.Error(idx, err)
+			continue
+		}
+		if r != test.want {
+			t.Error(idx, ": want", test.want, "got", r)
+		}
+
+		ok, err := x.EqualTo(test.y, EmptyCompareOption())
+		if err != nil {
+			t.Error(idx, err)
+			continue
+		}
+		if ok != (test.want == 0) {
+			t.Error(idx, ": want", test.want == 0, "got", ok)
+		}
+	}
+}
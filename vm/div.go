@@ -16,6 +16,17 @@ func DivFunc(left, right func(Context) (Value, error)) func(Context) (Value, err
 }
 
 func Div(leftValue, rightValue Value) (Value, error) {
+	leftValue, rightValue = unwrapJSONNumber(leftValue), unwrapJSONNumber(rightValue)
+	if leftValue.Type == ValueDecimal || rightValue.Type == ValueDecimal {
+		return decimalArithmetic("/", leftValue, rightValue, func(a, b *Decimal) (*Decimal, error) {
+			return a.Div(b)
+		}, func(a, b float64) (Value, error) {
+			if b == 0 {
+				return Null(), nil
+			}
+			return FloatToValue(a / b), nil
+		})
+	}
 	switch rightValue.Type {
 	case ValueNull:
 		return Null(), NewArithmeticError("/", leftValue.Type.String(), rightValue.Type.String())
@@ -39,6 +50,10 @@ func Div(leftValue, rightValue Value) (Value, error) {
 }
 
 func divInt(left Value, right int64) (Value, error) {
+	// 与 mysql 一样, 除以 0 的结果是 NULL
+	if right == 0 {
+		return Null(), nil
+	}
 	switch left.Type {
 	case ValueNull:
 		return Null(), NewArithmeticError("/", left.Type.String(), "int")
@@ -58,6 +73,10 @@ func divInt(left Value, right int64) (Value, error) {
 }
 
 func divUint(left Value, right uint64) (Value, error) {
+	// 与 mysql 一样, 除以 0 的结果是 NULL
+	if right == 0 {
+		return Null(), nil
+	}
 	switch left.Type {
 	case ValueNull:
 		return Null(), NewArithmeticError("/", left.Type.String(), "uint")
@@ -77,6 +96,10 @@ func divUint(left Value, right uint64) (Value, error) {
 }
 
 func divFloat(left Value, right float64) (Value, error) {
+	// 与 mysql 一样, 除以 0 的结果是 NULL
+	if right == 0 {
+		return Null(), nil
+	}
 	switch left.Type {
 	case ValueNull:
 		return Null(), NewArithmeticError("/", left.Type.String(), "float")
@@ -2,11 +2,18 @@ package vm
 
 import (
 	"strconv"
-	"strings"
 	"time"
 )
 
 func (r *Value) EqualTo(to Value, opt CompareOption) (bool, error) {
+	if (r.Type == ValueJSON || to.Type == ValueJSON) && !r.IsNil() && !to.IsNil() {
+		result, err := compareWithJSON(*r, to, opt)
+		return result == 0, err
+	}
+	if (r.Type == ValueDecimal || to.Type == ValueDecimal) && !r.IsNil() && !to.IsNil() {
+		result, err := compareWithDecimal(*r, to, opt)
+		return result == 0, err
+	}
 	switch to.Type {
 	case ValueNull:
 		return r.IsNil(), nil
@@ -23,7 +30,7 @@ func (r *Value) EqualTo(to Value, opt CompareOption) (bool, error) {
 	case ValueDatetime:
 		return r.EqualToDatetime(to.Int64, opt)
 	case ValueInterval:
-		return r.EqualToInterval(time.Duration(to.Int64), opt)
+		return r.EqualToInterval(intervalLength(to), opt)
 	default:
 		return false, NewTypeMismatch(r.Type.String(), "unknown")
 	}
@@ -72,8 +79,8 @@ func (r *Value) EqualToString(to string, opt CompareOption) (bool, error) {
 		}
 		return false, NewTypeMismatch(r.Type.String(), "string")
 	case ValueString:
-		if opt.IgnoreCase {
-			return strings.EqualFold(r.Str, to), nil
+		if c := opt.collation(); c != CollationBinary {
+			return CompareStrings(r.Str, to, c) == 0, nil
 		}
 		return r.Str == to, nil
 	case ValueInt64:
@@ -94,6 +101,14 @@ func (r *Value) EqualToString(to string, opt CompareOption) (bool, error) {
 		return false, NewTypeMismatch(r.Type.String(), "string")
 	case ValueFloat64:
 		return false, NewTypeMismatch(r.Type.String(), "string")
+	case ValueDatetime:
+		if opt.Weak {
+			t, err := ToDatetimeIn(to, opt.Location)
+			if err == nil {
+				return r.Int64 == DatetimeToInt(t), nil
+			}
+		}
+		return false, NewTypeMismatch(r.Type.String(), "string")
 	default:
 		return false, NewTypeMismatch(r.Type.String(), "string")
 	}
@@ -169,12 +184,18 @@ func (r *Value) EqualToDatetime(to int64, opt CompareOption) (bool, error) {
 	if r.Type == ValueDatetime {
 		return r.Int64 == to, nil
 	}
+	if r.Type == ValueString && opt.Weak {
+		t, err := ToDatetimeIn(r.Str, opt.Location)
+		if err == nil {
+			return DatetimeToInt(t) == to, nil
+		}
+	}
 	return false, NewTypeMismatch(r.Type.String(), "datetime")
 }
 
 func (r *Value) EqualToInterval(to time.Duration, opt CompareOption) (bool, error) {
 	if r.Type == ValueInterval {
-		return time.Duration(r.Int64) == to, nil
+		return intervalLength(*r) == to, nil
 	}
 	return false, NewTypeMismatch(r.Type.String(), "interval")
 }
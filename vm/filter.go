@@ -9,376 +9,547 @@ import (
 
 type Context = GetValuer
 
-func And(left, right func(Context) (bool, error)) func(Context) (bool, error) {
-	return func(ctx Context) (bool, error) {
-		ok, err := left(ctx)
-		if err != nil {
-			return false, err
-		}
-		if !ok {
-			return false, nil
-		}
+// Truth is the result of a predicate in the three-valued logic of SQL, a
+// comparison with NULL is Unknown.
+type Truth uint8
+
+const (
+	False Truth = iota
+	True
+	Unknown
+)
 
-		return right(ctx)
+func TruthOf(b bool) Truth {
+	if b {
+		return True
 	}
+	return False
 }
 
-func Or(left, right func(Context) (bool, error)) func(Context) (bool, error) {
-	return func(ctx Context) (bool, error) {
-		ok, err := left(ctx)
-		if err != nil {
-			return false, err
-		}
-		if ok {
-			return true, nil
-		}
-		return right(ctx)
+func (t Truth) String() string {
+	switch t {
+	case False:
+		return "false"
+	case True:
+		return "true"
+	default:
+		return "unknown"
 	}
 }
 
-func Not(f func(Context) (bool, error)) func(Context) (bool, error) {
-	return func(ctx Context) (bool, error) {
-		ok, err := f(ctx)
-		if err != nil {
-			return false, err
-		}
-		return !ok, nil
+func (t Truth) Not() Truth {
+	switch t {
+	case False:
+		return True
+	case True:
+		return False
+	default:
+		return Unknown
+	}
+}
+
+func (t Truth) And(other Truth) Truth {
+	if t == False || other == False {
+		return False
+	}
+	if t == Unknown || other == Unknown {
+		return Unknown
+	}
+	return True
+}
+
+func (t Truth) Or(other Truth) Truth {
+	if t == True || other == True {
+		return True
+	}
+	if t == Unknown || other == Unknown {
+		return Unknown
+	}
+	return False
+}
+
+// ToValue returns the boolean value of t, Unknown is NULL.
+func (t Truth) ToValue() Value {
+	if t == Unknown {
+		return Null()
 	}
+	return BoolToValue(t == True)
 }
 
-func Equal(left, right func(Context) (Value, error)) func(Context) (bool, error) {
+// Filter returns the filter which only accepts True, such as WHERE.
+func Filter(f func(Context) (Truth, error)) func(Context) (bool, error) {
 	return func(ctx Context) (bool, error) {
-		leftValue, err := left(ctx)
+		t, err := f(ctx)
 		if err != nil {
 			return false, err
 		}
-		rightValue, err := right(ctx)
+		return t == True, nil
+	}
+}
+
+// Truthy reads the value as a predicate, NULL is Unknown.
+func Truthy(value func(Context) (Value, error)) func(Context) (Truth, error) {
+	return func(ctx Context) (Truth, error) {
+		v, err := value(ctx)
 		if err != nil {
-			return false, err
+			return Unknown, err
 		}
+		return ToTruth(v)
+	}
+}
 
-		return leftValue.EqualTo(rightValue, EmptyCompareOption())
+// ToTruth reads the boolean value as a truth, NULL is Unknown.
+func ToTruth(v Value) (Truth, error) {
+	if v.IsNil() {
+		return Unknown, nil
 	}
+	if v.Type != ValueBool {
+		return Unknown, NewTypeError(v.String(), v.Type.String(), "boolean")
+	}
+	return TruthOf(v.BoolValue()), nil
 }
 
-func LessThan(left, right func(Context) (Value, error)) func(Context) (bool, error) {
-	return func(ctx Context) (bool, error) {
-		leftValue, err := left(ctx)
+// TruthToValue returns the boolean value of the predicate, Unknown is NULL.
+func TruthToValue(f func(Context) (Truth, error)) func(Context) (Value, error) {
+	return func(ctx Context) (Value, error) {
+		t, err := f(ctx)
 		if err != nil {
-			return false, err
+			return Null(), err
 		}
-		rightValue, err := right(ctx)
+		return t.ToValue(), nil
+	}
+}
+
+func And(left, right func(Context) (Truth, error)) func(Context) (Truth, error) {
+	return func(ctx Context) (Truth, error) {
+		t, err := left(ctx)
 		if err != nil {
-			return false, err
+			return Unknown, err
 		}
-		result, err := leftValue.CompareTo(rightValue, EmptyCompareOption())
+		if t == False {
+			return False, nil
+		}
+		other, err := right(ctx)
 		if err != nil {
-			return false, err
+			return Unknown, err
 		}
-		return result < 0, nil
+		return t.And(other), nil
 	}
 }
 
-func GreaterThan(left, right func(Context) (Value, error)) func(Context) (bool, error) {
-	return func(ctx Context) (bool, error) {
-		leftValue, err := left(ctx)
+func Or(left, right func(Context) (Truth, error)) func(Context) (Truth, error) {
+	return func(ctx Context) (Truth, error) {
+		t, err := left(ctx)
 		if err != nil {
-			return false, err
+			return Unknown, err
 		}
-		rightValue, err := right(ctx)
+		if t == True {
+			return True, nil
+		}
+		other, err := right(ctx)
 		if err != nil {
-			return false, err
+			return Unknown, err
 		}
+		return t.Or(other), nil
+	}
+}
 
-		result, err := leftValue.CompareTo(rightValue, EmptyCompareOption())
+func Not(f func(Context) (Truth, error)) func(Context) (Truth, error) {
+	return func(ctx Context) (Truth, error) {
+		t, err := f(ctx)
 		if err != nil {
-			return false, err
+			return Unknown, err
 		}
-		return result > 0, nil
+		return t.Not(), nil
 	}
 }
 
-func LessEqual(left, right func(Context) (Value, error)) func(Context) (bool, error) {
-	return func(ctx Context) (bool, error) {
+// compareWith 读取两边的值并比较, 任一边是 NULL 时结果是 Unknown
+func compareWith(left, right func(Context) (Value, error), opt CompareOption, test func(int) bool) func(Context) (Truth, error) {
+	return func(ctx Context) (Truth, error) {
 		leftValue, err := left(ctx)
 		if err != nil {
-			return false, err
+			return Unknown, err
 		}
 		rightValue, err := right(ctx)
 		if err != nil {
-			return false, err
+			return Unknown, err
 		}
+		return compareValues(leftValue, rightValue, opt, test)
+	}
+}
 
-		result, err := leftValue.CompareTo(rightValue, EmptyCompareOption())
-		if err != nil {
-			return false, err
-		}
-		return result <= 0, nil
+func compareValues(leftValue, rightValue Value, opt CompareOption, test func(int) bool) (Truth, error) {
+	if leftValue.IsNil() || rightValue.IsNil() {
+		return Unknown, nil
 	}
+
+	result, err := leftValue.CompareTo(rightValue, opt)
+	if err != nil {
+		return Unknown, err
+	}
+	return TruthOf(test(result)), nil
 }
 
-func GreaterEqual(left, right func(Context) (Value, error)) func(Context) (bool, error) {
-	return func(ctx Context) (bool, error) {
+func Equal(left, right func(Context) (Value, error)) func(Context) (Truth, error) {
+	return EqualWith(left, right, EmptyCompareOption())
+}
+
+func EqualWith(left, right func(Context) (Value, error), opt CompareOption) func(Context) (Truth, error) {
+	return func(ctx Context) (Truth, error) {
 		leftValue, err := left(ctx)
 		if err != nil {
-			return false, err
+			return Unknown, err
 		}
 		rightValue, err := right(ctx)
 		if err != nil {
-			return false, err
+			return Unknown, err
 		}
+		return equalValues(leftValue, rightValue, opt)
+	}
+}
 
-		result, err := leftValue.CompareTo(rightValue, EmptyCompareOption())
-		if err != nil {
-			return false, err
-		}
-		return result >= 0, nil
+func equalValues(leftValue, rightValue Value, opt CompareOption) (Truth, error) {
+	if leftValue.IsNil() || rightValue.IsNil() {
+		return Unknown, nil
+	}
+
+	ok, err := leftValue.EqualTo(rightValue, opt)
+	if err != nil {
+		return Unknown, err
 	}
+	return TruthOf(ok), nil
 }
 
-func NotEqual(left, right func(Context) (Value, error)) func(Context) (bool, error) {
-	return func(ctx Context) (bool, error) {
+// NullSafeEqualWith is the operator '<=>', NULL is equal to NULL and the
+// result is never Unknown.
+func NullSafeEqualWith(left, right func(Context) (Value, error), opt CompareOption) func(Context) (Truth, error) {
+	return func(ctx Context) (Truth, error) {
 		leftValue, err := left(ctx)
 		if err != nil {
-			return false, err
+			return Unknown, err
 		}
 		rightValue, err := right(ctx)
 		if err != nil {
-			return false, err
+			return Unknown, err
 		}
+		return nullSafeEqualValues(leftValue, rightValue, opt)
+	}
+}
 
-		result, err := leftValue.EqualTo(rightValue, EmptyCompareOption())
-		if err != nil {
-			return false, err
-		}
+func nullSafeEqualValues(leftValue, rightValue Value, opt CompareOption) (Truth, error) {
+	if leftValue.IsNil() || rightValue.IsNil() {
+		return TruthOf(leftValue.IsNil() && rightValue.IsNil()), nil
+	}
 
-		return !result, nil
+	ok, err := leftValue.EqualTo(rightValue, opt)
+	if err != nil {
+		return Unknown, err
 	}
+	return TruthOf(ok), nil
 }
 
-func In(left func(Context) (Value, error), right func(Context) ([]Value, error)) func(Context) (bool, error) {
-	return func(ctx Context) (bool, error) {
+func LessThan(left, right func(Context) (Value, error)) func(Context) (Truth, error) {
+	return LessThanWith(left, right, EmptyCompareOption())
+}
+
+func LessThanWith(left, right func(Context) (Value, error), opt CompareOption) func(Context) (Truth, error) {
+	return compareWith(left, right, opt, func(result int) bool {
+		return result < 0
+	})
+}
+
+func GreaterThan(left, right func(Context) (Value, error)) func(Context) (Truth, error) {
+	return GreaterThanWith(left, right, EmptyCompareOption())
+}
+
+func GreaterThanWith(left, right func(Context) (Value, error), opt CompareOption) func(Context) (Truth, error) {
+	return compareWith(left, right, opt, func(result int) bool {
+		return result > 0
+	})
+}
+
+func LessEqual(left, right func(Context) (Value, error)) func(Context) (Truth, error) {
+	return LessEqualWith(left, right, EmptyCompareOption())
+}
+
+func LessEqualWith(left, right func(Context) (Value, error), opt CompareOption) func(Context) (Truth, error) {
+	return compareWith(left, right, opt, func(result int) bool {
+		return result <= 0
+	})
+}
+
+func GreaterEqual(left, right func(Context) (Value, error)) func(Context) (Truth, error) {
+	return GreaterEqualWith(left, right, EmptyCompareOption())
+}
+
+func GreaterEqualWith(left, right func(Context) (Value, error), opt CompareOption) func(Context) (Truth, error) {
+	return compareWith(left, right, opt, func(result int) bool {
+		return result >= 0
+	})
+}
+
+func NotEqual(left, right func(Context) (Value, error)) func(Context) (Truth, error) {
+	return NotEqualWith(left, right, EmptyCompareOption())
+}
+
+func NotEqualWith(left, right func(Context) (Value, error), opt CompareOption) func(Context) (Truth, error) {
+	return Not(EqualWith(left, right, opt))
+}
+
+func In(left func(Context) (Value, error), right func(Context) ([]Value, error)) func(Context) (Truth, error) {
+	return InWith(left, right, EmptyCompareOption())
+}
+
+// InWith is True if a value of the list is equal to the left, it is Unknown
+// if no value is equal and the left or a value of the list is NULL.
+func InWith(left func(Context) (Value, error), right func(Context) ([]Value, error), opt CompareOption) func(Context) (Truth, error) {
+	return func(ctx Context) (Truth, error) {
 		leftValue, err := left(ctx)
 		if err != nil {
-			return false, err
+			return Unknown, err
 		}
 		rightValues, err := right(ctx)
 		if err != nil {
-			return false, err
-		}
-		for _, value := range rightValues {
-			result, err := value.EqualTo(leftValue, EmptyCompareOption())
-			if err != nil {
-				return false, err
-			}
-			if result {
-				return true, nil
-			}
+			return Unknown, err
 		}
-		return false, nil
+		return inValues(leftValue, rightValues, opt)
 	}
 }
 
-func NotIn(left func(Context) (Value, error), right func(Context) ([]Value, error)) func(Context) (bool, error) {
-	return func(ctx Context) (bool, error) {
-		leftValue, err := left(ctx)
-		if err != nil {
-			return false, err
+func inValues(leftValue Value, rightValues []Value, opt CompareOption) (Truth, error) {
+	if len(rightValues) == 0 {
+		return False, nil
+	}
+	if leftValue.IsNil() {
+		return Unknown, nil
+	}
+
+	result := False
+	for _, value := range rightValues {
+		if value.IsNil() {
+			result = Unknown
+			continue
 		}
-		rightValues, err := right(ctx)
+		ok, err := value.EqualTo(leftValue, opt)
 		if err != nil {
-			return false, err
+			return Unknown, err
 		}
-		for _, value := range rightValues {
-			result, err := value.EqualTo(leftValue, EmptyCompareOption())
-			if err != nil {
-				return false, err
-			}
-			if result {
-				return false, nil
-			}
+		if ok {
+			return True, nil
 		}
-		return true, nil
 	}
+	return result, nil
 }
 
-func Like(left, right func(Context) (Value, error)) func(Context) (bool, error) {
-	return func(ctx Context) (bool, error) {
+func NotIn(left func(Context) (Value, error), right func(Context) ([]Value, error)) func(Context) (Truth, error) {
+	return NotInWith(left, right, EmptyCompareOption())
+}
+
+func NotInWith(left func(Context) (Value, error), right func(Context) ([]Value, error), opt CompareOption) func(Context) (Truth, error) {
+	return Not(InWith(left, right, opt))
+}
+
+func Like(left, right func(Context) (Value, error)) func(Context) (Truth, error) {
+	return LikeWith(left, right, EmptyCompareOption())
+}
+
+// LikeWith is same as Like but the strings are matched with the collation
+// of opt.
+func LikeWith(left, right func(Context) (Value, error), opt CompareOption) func(Context) (Truth, error) {
+	c := opt.collation()
+	return func(ctx Context) (Truth, error) {
 		leftValue, err := left(ctx)
 		if err != nil {
-			return false, err
+			return Unknown, err
 		}
 		rightValue, err := right(ctx)
 		if err != nil {
-			return false, err
-		}
-		if leftValue.Type != ValueString {
-			return false, errors.Wrap(err, "left operant isnot string")
+			return Unknown, err
 		}
-		leftStr := leftValue.Str
+		return likeValues(leftValue, rightValue, c)
+	}
+}
 
-		if rightValue.Type != ValueString {
-			return false, errors.Wrap(err, "right operant isnot string")
-		}
-		rightStr := rightValue.Str
+func likeValues(leftValue, rightValue Value, c Collation) (Truth, error) {
+	if leftValue.IsNil() || rightValue.IsNil() {
+		return Unknown, nil
+	}
+	if leftValue.Type != ValueString {
+		return Unknown, errors.New("left operant isnot string")
+	}
+	leftStr := leftValue.Str
 
-		if strings.HasPrefix(rightStr, "%") {
-			if strings.HasSuffix(rightStr, "%") {
-				s := strings.TrimPrefix(rightStr, "%")
-				s = strings.TrimSuffix(s, "%")
-				return strings.Contains(leftStr, s), nil
-			}
-			return strings.HasSuffix(leftStr, strings.TrimPrefix(rightStr, "%")), nil
-		}
-		if strings.HasSuffix(rightStr, "%") {
-			return strings.HasPrefix(leftStr, strings.TrimSuffix(rightStr, "%")), nil
+	if rightValue.Type != ValueString {
+		return Unknown, errors.New("right operant isnot string")
+	}
+	rightStr := rightValue.Str
+
+	return TruthOf(MatchLike(FoldString(leftStr, c), FoldString(rightStr, c))), nil
+}
+
+func MatchLike(s, pattern string) bool {
+	if strings.HasPrefix(pattern, "%") {
+		if strings.HasSuffix(pattern, "%") {
+			sub := strings.TrimPrefix(pattern, "%")
+			sub = strings.TrimSuffix(sub, "%")
+			return strings.Contains(s, sub)
 		}
-		return leftStr == rightStr, nil
+		return strings.HasSuffix(s, strings.TrimPrefix(pattern, "%"))
+	}
+	if strings.HasSuffix(pattern, "%") {
+		return strings.HasPrefix(s, strings.TrimSuffix(pattern, "%"))
 	}
+	return s == pattern
 }
 
-func NotLike(left, right func(Context) (Value, error)) func(Context) (bool, error) {
+func NotLike(left, right func(Context) (Value, error)) func(Context) (Truth, error) {
 	return Not(Like(left, right))
 }
 
-func Regexp(left, right func(Context) (Value, error)) func(Context) (bool, error) {
-	return func(ctx Context) (bool, error) {
+func NotLikeWith(left, right func(Context) (Value, error), opt CompareOption) func(Context) (Truth, error) {
+	return Not(LikeWith(left, right, opt))
+}
+
+func Regexp(left, right func(Context) (Value, error)) func(Context) (Truth, error) {
+	return func(ctx Context) (Truth, error) {
 		leftValue, err := left(ctx)
 		if err != nil {
-			return false, err
+			return Unknown, err
 		}
 		rightValue, err := right(ctx)
 		if err != nil {
-			return false, err
-		}
-		if leftValue.Type != ValueString {
-			return false, errors.Wrap(err, "left operant isnot string")
+			return Unknown, err
 		}
-		leftStr := leftValue.Str
+		return regexpValues(leftValue, rightValue)
+	}
+}
 
-		if rightValue.Type != ValueString {
-			return false, errors.Wrap(err, "right operant isnot string")
-		}
-		rightStr := rightValue.Str
+func regexpValues(leftValue, rightValue Value) (Truth, error) {
+	if leftValue.IsNil() || rightValue.IsNil() {
+		return Unknown, nil
+	}
+	if leftValue.Type != ValueString {
+		return Unknown, errors.New("left operant isnot string")
+	}
+	leftStr := leftValue.Str
+
+	if rightValue.Type != ValueString {
+		return Unknown, errors.New("right operant isnot string")
+	}
+	rightStr := rightValue.Str
 
-		return regexp.MatchString(rightStr, leftStr)
+	ok, err := regexp.MatchString(rightStr, leftStr)
+	if err != nil {
+		return Unknown, err
 	}
+	return TruthOf(ok), nil
 }
 
-func NotRegexp(left, right func(Context) (Value, error)) func(Context) (bool, error) {
+func NotRegexp(left, right func(Context) (Value, error)) func(Context) (Truth, error) {
 	return Not(Regexp(left, right))
 }
 
-func Between(left, from, to func(Context) (Value, error)) func(Context) (bool, error) {
-	return func(ctx Context) (bool, error) {
+func Between(left, from, to func(Context) (Value, error)) func(Context) (Truth, error) {
+	return BetweenWith(left, from, to, EmptyCompareOption())
+}
+
+// BetweenWith is 'left >= from AND left <= to', so it is False if a bound
+// is NULL and the other bound excludes the left.
+func BetweenWith(left, from, to func(Context) (Value, error), opt CompareOption) func(Context) (Truth, error) {
+	return func(ctx Context) (Truth, error) {
 		leftValue, err := left(ctx)
 		if err != nil {
-			return false, err
+			return Unknown, err
 		}
 		fromValue, err := from(ctx)
 		if err != nil {
-			return false, err
+			return Unknown, err
 		}
 		toValue, err := to(ctx)
 		if err != nil {
-			return false, err
+			return Unknown, err
 		}
+		return betweenValues(leftValue, fromValue, toValue, opt)
+	}
+}
+
+func betweenValues(leftValue, fromValue, toValue Value, opt CompareOption) (Truth, error) {
+	if leftValue.IsNil() {
+		return Unknown, nil
+	}
 
-		result, err := leftValue.CompareTo(fromValue, EmptyCompareOption())
+	lower := Unknown
+	if !fromValue.IsNil() {
+		result, err := leftValue.CompareTo(fromValue, opt)
 		if err != nil {
-			return false, err
+			return Unknown, err
 		}
-		if result < 0 {
-			return false, nil
-		}
-		result, err = leftValue.CompareTo(toValue, EmptyCompareOption())
+		lower = TruthOf(result >= 0)
+	}
+	if lower == False {
+		return False, nil
+	}
+	upper := Unknown
+	if !toValue.IsNil() {
+		result, err := leftValue.CompareTo(toValue, opt)
 		if err != nil {
-			return false, err
+			return Unknown, err
 		}
-		return result <= 0, nil
+		upper = TruthOf(result <= 0)
 	}
+	return lower.And(upper), nil
 }
 
-func NotBetween(left, from, to func(Context) (Value, error)) func(Context) (bool, error) {
+func NotBetween(left, from, to func(Context) (Value, error)) func(Context) (Truth, error) {
 	return Not(Between(left, from, to))
 }
 
-func IsNull(value func(Context) (Value, error)) func(Context) (bool, error) {
-	return func(ctx Context) (bool, error) {
+func NotBetweenWith(left, from, to func(Context) (Value, error), opt CompareOption) func(Context) (Truth, error) {
+	return Not(BetweenWith(left, from, to, opt))
+}
+
+func IsNull(value func(Context) (Value, error)) func(Context) (Truth, error) {
+	return func(ctx Context) (Truth, error) {
 		v, err := value(ctx)
 		if err != nil {
 			if errors.Is(err, ErrNotFound) {
-				return true, nil
+				return True, nil
 			}
 
-			return false, err
+			return Unknown, err
 		}
-		return v.IsNil(), nil
+		return TruthOf(v.IsNil()), nil
 	}
 }
 
-func IsNotNull(value func(Context) (Value, error)) func(Context) (bool, error) {
-	return func(ctx Context) (bool, error) {
-		v, err := value(ctx)
-		if err != nil {
-			return false, err
-		}
-		return !v.IsNil(), nil
-	}
+func IsNotNull(value func(Context) (Value, error)) func(Context) (Truth, error) {
+	return Not(IsNull(value))
 }
 
-func IsTrue(value func(Context) (Value, error)) func(Context) (bool, error) {
-	return func(ctx Context) (bool, error) {
-		v, err := value(ctx)
-		if err != nil {
-			return false, err
-		}
-
-		if v.Type != ValueBool {
-			return false, NewTypeError(v.String(), v.Type.String(), "boolean")
-		}
-		return v.BoolValue(), nil
-	}
+// IsTrue is the operator 'IS TRUE', the result is never Unknown.
+func IsTrue(f func(Context) (Truth, error)) func(Context) (Truth, error) {
+	return isTruth(f, True, false)
 }
 
-func IsNotTrue(value func(Context) (Value, error)) func(Context) (bool, error) {
-	return func(ctx Context) (bool, error) {
-		v, err := value(ctx)
-		if err != nil {
-			return false, err
-		}
-
-		if v.Type != ValueBool {
-			return false, NewTypeError(v.String(), v.Type.String(), "boolean")
-		}
-		return !v.BoolValue(), nil
-	}
+func IsNotTrue(f func(Context) (Truth, error)) func(Context) (Truth, error) {
+	return isTruth(f, True, true)
 }
 
-func IsFalse(value func(Context) (Value, error)) func(Context) (bool, error) {
-	return func(ctx Context) (bool, error) {
-		v, err := value(ctx)
-		if err != nil {
-			return false, err
-		}
+func IsFalse(f func(Context) (Truth, error)) func(Context) (Truth, error) {
+	return isTruth(f, False, false)
+}
 
-		if v.Type != ValueBool {
-			return false, NewTypeError(v.String(), v.Type.String(), "boolean")
-		}
-		return !v.BoolValue(), nil
-	}
+func IsNotFalse(f func(Context) (Truth, error)) func(Context) (Truth, error) {
+	return isTruth(f, False, true)
 }
 
-func IsNotFalse(value func(Context) (Value, error)) func(Context) (bool, error) {
-	return func(ctx Context) (bool, error) {
-		v, err := value(ctx)
+func isTruth(f func(Context) (Truth, error), want Truth, not bool) func(Context) (Truth, error) {
+	return func(ctx Context) (Truth, error) {
+		t, err := f(ctx)
 		if err != nil {
-			return false, err
-		}
-
-		if v.Type != ValueBool {
-			return false, NewTypeError(v.String(), v.Type.String(), "boolean")
+			return Unknown, err
 		}
-		return v.BoolValue(), nil
+		return TruthOf((t == want) != not), nil
 	}
 }
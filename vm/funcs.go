@@ -6,6 +6,12 @@ import (
 
 var Funcs = map[string]func(ctx Context, values []Value) (Value, error){
 	"round": Round,
+
+	"json_extract":      JSONExtract,
+	"json_unquote":      JSONUnquote,
+	"json_array_length": JSONArrayLength,
+	"json_keys":         JSONKeys,
+	"json_contains":     JSONContains,
 }
 
 func CallFunc(call func(Context, []Value) (Value, error), readValues func(Context) ([]Value, error)) func(ctx Context) (Value, error) {
@@ -1,5 +1,12 @@
 package vm
 
+import (
+	"math"
+	"strconv"
+
+	"github.com/runner-mei/errors"
+)
+
 func IntDivFunc(left, right func(Context) (Value, error)) func(Context) (Value, error) {
 	return func(ctx Context) (Value, error) {
 		leftValue, err := left(ctx)
@@ -10,31 +17,43 @@ func IntDivFunc(left, right func(Context) (Value, error)) func(Context) (Value,
 		if err != nil {
 			return Null(), err
 		}
+		return IntDiv(leftValue, rightValue)
+	}
+}
 
-		switch rightValue.Type {
-		case ValueNull:
-			return Null(), NewArithmeticError("div", leftValue.Type.String(), rightValue.Type.String())
-		case ValueBool:
-			return Null(), NewArithmeticError("div", leftValue.Type.String(), rightValue.Type.String())
-		case ValueString:
-			return Null(), NewArithmeticError("div", leftValue.Type.String(), rightValue.Type.String())
-		case ValueInt64:
-			return intDivInt(leftValue, rightValue.Int64)
-		case ValueUint64:
-			return intDivUint(leftValue, rightValue.Uint64)
-		// case ValueFloat64:
-		//   return intDivFloat(leftValue, rightValue.Float64)
-		// case ValueDatetime:
-		//   return intDivDatetime(leftValue, IntToDatetime(rightValue.Int64))
-		// case ValueInterval:
-		//   return intDivInterval(leftValue, IntToInterval(rightValue.Int64))
-		default:
-			return Null(), NewArithmeticError("div", leftValue.Type.String(), rightValue.Type.String())
-		}
+func IntDiv(leftValue, rightValue Value) (Value, error) {
+	leftValue, rightValue = unwrapJSONNumber(leftValue), unwrapJSONNumber(rightValue)
+	if leftValue.Type == ValueDecimal || rightValue.Type == ValueDecimal {
+		return intDivDecimal(leftValue, rightValue)
+	}
+
+	switch rightValue.Type {
+	case ValueNull:
+		return Null(), NewArithmeticError("div", leftValue.Type.String(), rightValue.Type.String())
+	case ValueBool:
+		return Null(), NewArithmeticError("div", leftValue.Type.String(), rightValue.Type.String())
+	case ValueString:
+		return Null(), NewArithmeticError("div", leftValue.Type.String(), rightValue.Type.String())
+	case ValueInt64:
+		return intDivInt(leftValue, rightValue.Int64)
+	case ValueUint64:
+		return intDivUint(leftValue, rightValue.Uint64)
+	case ValueFloat64:
+		return intDivFloat(leftValue, rightValue.Float64)
+	// case ValueDatetime:
+	//   return intDivDatetime(leftValue, IntToDatetime(rightValue.Int64))
+	// case ValueInterval:
+	//   return intDivInterval(leftValue, IntToInterval(rightValue.Int64))
+	default:
+		return Null(), NewArithmeticError("div", leftValue.Type.String(), rightValue.Type.String())
 	}
 }
 
 func intDivInt(left Value, right int64) (Value, error) {
+	// 与 mysql 一样, 除以 0 的结果是 NULL
+	if right == 0 {
+		return Null(), nil
+	}
 	switch left.Type {
 	case ValueNull:
 		return Null(), NewArithmeticError("div", left.Type.String(), "int")
@@ -43,19 +62,30 @@ func intDivInt(left Value, right int64) (Value, error) {
 	case ValueString:
 		return Null(), NewArithmeticError("div", left.Type.String(), "int")
 	case ValueInt64:
+		if left.Int64 == math.MinInt64 && right == -1 {
+			return Null(), errors.New("'" + strconv.FormatInt(left.Int64, 10) + " div -1' is out of range of int")
+		}
 		return IntToValue(left.Int64 / right), nil
 	case ValueUint64:
 		if right < 0 {
-			return IntToValue(-int64(left.Uint64 / uint64(-right))), nil
+			// 商的相反数最小是 math.MinInt64, 即商最大是 2^63
+			quo := left.Uint64 / uint64(-right)
+			if quo > uint64(math.MaxInt64)+1 {
+				return Null(), errors.New("'" + strconv.FormatUint(left.Uint64, 10) + " div " + strconv.FormatInt(right, 10) + "' is out of range of int")
+			}
+			return IntToValue(-int64(quo)), nil
 		}
 		return UintToValue(left.Uint64 / uint64(right)), nil
-		// case ValueFloat64:
-		// 	return FloatToValue(left.Float64 * float64(right)), nil
+	case ValueFloat64:
+		return intDivFloat(left, float64(right))
 	}
 	return Null(), NewArithmeticError("div", left.Type.String(), "int")
 }
 
 func intDivUint(left Value, right uint64) (Value, error) {
+	if right == 0 {
+		return Null(), nil
+	}
 	switch left.Type {
 	case ValueNull:
 		return Null(), NewArithmeticError("div", left.Type.String(), "uint")
@@ -65,36 +95,39 @@ func intDivUint(left Value, right uint64) (Value, error) {
 		return Null(), NewArithmeticError("div", left.Type.String(), "uint")
 	case ValueInt64:
 		if left.Int64 < 0 {
-			return IntToValue(-int64(uint64(left.Int64) / right)), nil
+			return IntToValue(-int64(uint64(-left.Int64) / right)), nil
 		}
 		return UintToValue(uint64(left.Int64) / right), nil
 	case ValueUint64:
 		return UintToValue(left.Uint64 / right), nil
-	// case ValueFloat64:
-	// 	return FloatToValue(left.Float64 * float64(right)), nil
+	case ValueFloat64:
+		return intDivFloat(left, float64(right))
 	default:
 		return Null(), NewArithmeticError("div", left.Type.String(), "uint")
 	}
 }
 
-// func intDivFloat(left Value, right float64) (Value, error) {
-// 	switch left.Type {
-// 	case ValueNull:
-// 		return Null(), NewArithmeticError("div", left.Type.String(), "float")
-// 	case ValueBool:
-// 		return Null(), NewArithmeticError("div", left.Type.String(), "float")
-// 	case ValueString:
-// 		return Null(), NewArithmeticError("div", left.Type.String(), "float")
-// 	case ValueInt64:
-// 		return FloatToValue(float64(left.Int64) * right), nil
-// 	case ValueUint64:
-// 		return FloatToValue(float64(left.Uint64) * right), nil
-// 	case ValueFloat64:
-// 		return FloatToValue(left.Float64 * right), nil
-// 	default:
-// 		return Null(), NewArithmeticError("div", left.Type.String(), "float")
-// 	}
-// }
+func intDivFloat(left Value, right float64) (Value, error) {
+	var f64 float64
+	switch left.Type {
+	case ValueInt64:
+		f64 = float64(left.Int64)
+	case ValueUint64:
+		f64 = float64(left.Uint64)
+	case ValueFloat64:
+		f64 = left.Float64
+	default:
+		return Null(), NewArithmeticError("div", left.Type.String(), "float")
+	}
+	if right == 0 {
+		return Null(), nil
+	}
+	quo := math.Trunc(f64 / right)
+	if quo < math.MinInt64 || quo >= math.MaxInt64 || math.IsNaN(quo) {
+		return Null(), errors.New("'" + strconv.FormatFloat(f64, 'g', -1, 64) + " div " + strconv.FormatFloat(right, 'g', -1, 64) + "' is out of range of int")
+	}
+	return IntToValue(int64(quo)), nil
+}
 
 // func intDivInterval(left Value, right time.Duration) (Value, error) {
 // 	switch left.Type {
@@ -108,3 +141,22 @@ func intDivUint(left Value, right uint64) (Value, error) {
 // 		return Null(), NewArithmeticError("div", left.Type.String(), "datetime")
 // 	}
 // }
+
+func intDivDecimal(left, right Value) (Value, error) {
+	a, ok := toDecimal(left)
+	if !ok {
+		return Null(), NewArithmeticError("div", left.Type.String(), right.Type.String())
+	}
+	b, ok := toDecimal(right)
+	if !ok {
+		return Null(), NewArithmeticError("div", left.Type.String(), right.Type.String())
+	}
+	quo, err := a.Quo(b)
+	if err != nil {
+		return Null(), nil
+	}
+	if !quo.IsInt64() {
+		return Null(), errors.New("'" + a.String() + " div " + b.String() + "' is out of range of int")
+	}
+	return IntToValue(quo.Int64()), nil
+}
@@ -0,0 +1,185 @@
+package vm
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/runner-mei/errors"
+)
+
+// The interval keeps the fixed part in Int64 as nanoseconds and the calendar
+// part in Months and Days. The length of a month or a day depends on the
+// datetime which the interval is added to, so they cannot be converted to
+// nanoseconds.
+
+// CalendarIntervalToValue returns an interval of months, days and d.
+func CalendarIntervalToValue(months, days int32, d time.Duration) Value {
+	return Value{
+		Type:   ValueInterval,
+		Int64:  int64(d),
+		Months: months,
+		Days:   days,
+	}
+}
+
+// IntervalMonths returns the months of the calendar interval.
+func (v *Value) IntervalMonths() int32 {
+	return v.Months
+}
+
+// IntervalDays returns the days of the calendar interval.
+func (v *Value) IntervalDays() int32 {
+	return v.Days
+}
+
+// IsCalendarInterval returns true if the interval has months or days.
+func (v *Value) IsCalendarInterval() bool {
+	return v.Type == ValueInterval && (v.Months != 0 || v.Days != 0)
+}
+
+// IsCalendarUnit returns true if the length of the unit depends on the
+// calendar.
+func IsCalendarUnit(unit string) bool {
+	switch strings.ToLower(unit) {
+	case "years", "year", "months", "month", "weeks", "week", "days", "day":
+		return true
+	}
+	return false
+}
+
+// IntervalOf returns the interval of n units.
+func IntervalOf(n int64, unit string) (Value, error) {
+	switch strings.ToLower(unit) {
+	case "years", "year":
+		return CalendarIntervalToValue(int32(n*12), 0, 0), nil
+	case "months", "month":
+		return CalendarIntervalToValue(int32(n), 0, 0), nil
+	case "weeks", "week":
+		return CalendarIntervalToValue(0, int32(n*7), 0), nil
+	case "days", "day":
+		return CalendarIntervalToValue(0, int32(n), 0), nil
+	case "hours", "hour":
+		return IntervalToValue(time.Duration(n) * time.Hour), nil
+	case "minutes", "minute":
+		return IntervalToValue(time.Duration(n) * time.Minute), nil
+	case "seconds", "second":
+		return IntervalToValue(time.Duration(n) * time.Second), nil
+	default:
+		return Null(), errors.New("interval unit '" + unit + "' is unsupported")
+	}
+}
+
+// ParseInterval parses the text of the interval such as '1 month 2 days 3h',
+// the text without the calendar part is a go duration.
+func ParseInterval(s string) (Value, error) {
+	var months, days int64
+	fields := strings.Fields(strings.TrimPrefix(strings.TrimSpace(s), "interval "))
+	for len(fields) >= 2 {
+		n, err := strconv.ParseInt(fields[0], 10, 32)
+		if err != nil {
+			break
+		}
+		switch strings.ToLower(fields[1]) {
+		case "years", "year":
+			months += n * 12
+		case "months", "month":
+			months += n
+		case "weeks", "week":
+			days += n * 7
+		case "days", "day":
+			days += n
+		default:
+			return Null(), errors.New("invalid interval '" + s + "'")
+		}
+		fields = fields[2:]
+	}
+
+	var d time.Duration
+	switch len(fields) {
+	case 0:
+		if months == 0 && days == 0 {
+			return Null(), errors.New("invalid interval '" + s + "'")
+		}
+	case 1:
+		var err error
+		d, err = time.ParseDuration(fields[0])
+		if err != nil {
+			return Null(), errors.Wrap(err, "invalid interval '"+s+"'")
+		}
+	default:
+		return Null(), errors.New("invalid interval '" + s + "'")
+	}
+	return CalendarIntervalToValue(int32(months), int32(days), d), nil
+}
+
+func formatInterval(v *Value) string {
+	if !v.IsCalendarInterval() {
+		return IntToInterval(v.Int64).String()
+	}
+
+	var sb strings.Builder
+	appendUnit := func(n int32, unit string) {
+		if n == 0 {
+			return
+		}
+		if sb.Len() > 0 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(strconv.FormatInt(int64(n), 10))
+		sb.WriteString(" ")
+		sb.WriteString(unit)
+		if n != 1 && n != -1 {
+			sb.WriteString("s")
+		}
+	}
+	appendUnit(v.IntervalMonths(), "month")
+	appendUnit(v.IntervalDays(), "day")
+	if v.Int64 != 0 {
+		sb.WriteString(" ")
+		sb.WriteString(IntToInterval(v.Int64).String())
+	}
+	return sb.String()
+}
+
+// AddInterval adds the interval to t in loc. The months are added first and
+// the day is clamped to the last day of the month, so 2021-01-31 plus one
+// month is 2021-02-28, then the days are added to the wall clock and the
+// fixed part is added at last.
+func AddInterval(t time.Time, interval Value, loc *time.Location) time.Time {
+	if !interval.IsCalendarInterval() {
+		return t.Add(IntToInterval(interval.Int64))
+	}
+
+	t = t.In(location(loc))
+	if months := int(interval.IntervalMonths()); months != 0 {
+		year, month, day := t.Date()
+		hour, min, sec := t.Clock()
+		last := time.Date(year, month+time.Month(months)+1, 0, 0, 0, 0, 0, t.Location()).Day()
+		if day > last {
+			day = last
+		}
+		t = time.Date(year, month+time.Month(months), day, hour, min, sec, t.Nanosecond(), t.Location())
+	}
+	if days := int(interval.IntervalDays()); days != 0 {
+		t = t.AddDate(0, 0, days)
+	}
+	return t.Add(IntToInterval(interval.Int64))
+}
+
+func negInterval(v Value) Value {
+	return CalendarIntervalToValue(-v.IntervalMonths(), -v.IntervalDays(), -IntToInterval(v.Int64))
+}
+
+func addIntervals(a, b Value) Value {
+	return CalendarIntervalToValue(a.IntervalMonths()+b.IntervalMonths(),
+		a.IntervalDays()+b.IntervalDays(),
+		IntToInterval(a.Int64+b.Int64))
+}
+
+// intervalLength 用于比较, 与 postgres 一样一个月按 30 天计算
+func intervalLength(v Value) time.Duration {
+	return time.Duration(v.IntervalMonths())*30*24*time.Hour +
+		time.Duration(v.IntervalDays())*24*time.Hour +
+		IntToInterval(v.Int64)
+}
@@ -0,0 +1,581 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/runner-mei/errors"
+)
+
+// JSONToValue returns the json value, the maps and the slices are converted
+// to map[string]interface{} and []interface{} and the numbers are kept as
+// json.Number.
+func JSONToValue(value interface{}) Value {
+	return Value{
+		Type: ValueJSON,
+		Any:  normalizeJSON(value),
+	}
+}
+
+// ParseJSON parses the json text.
+func ParseJSON(s string) (Value, error) {
+	v, err := decodeJSON([]byte(s))
+	if err != nil {
+		return Null(), err
+	}
+	return Value{Type: ValueJSON, Any: v}, nil
+}
+
+func decodeJSON(bs []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(bs))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, errors.Wrap(err, "invalid json '"+string(bs)+"'")
+	}
+	if decoder.More() {
+		return nil, errors.New("invalid json '" + string(bs) + "'")
+	}
+	return v, nil
+}
+
+func normalizeJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, string, bool, json.Number:
+		return v
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[key] = normalizeJSON(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for idx := range v {
+			result[idx] = normalizeJSON(v[idx])
+		}
+		return result
+	case int:
+		return json.Number(strconv.FormatInt(int64(v), 10))
+	case int64:
+		return json.Number(strconv.FormatInt(v, 10))
+	case uint64:
+		return json.Number(strconv.FormatUint(v, 10))
+	case float64:
+		return json.Number(strconv.FormatFloat(v, 'g', -1, 64))
+	case Value:
+		doc, _, err := toJSONDoc(v, false)
+		if err != nil {
+			return nil
+		}
+		return doc
+	}
+
+	// 其它类型通过 json 编码再解码
+	bs, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	v, err := decodeJSON(bs)
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+func (v *Value) JSONValue() interface{} {
+	return v.Any
+}
+
+func jsonText(v interface{}) string {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return "error_" + err.Error()
+	}
+	return string(bs)
+}
+
+// toJSONDoc 将值转换为 json 文档, parseString 为 true 时字符串被当作 json 文本
+func toJSONDoc(value Value, parseString bool) (interface{}, bool, error) {
+	switch value.Type {
+	case ValueNull:
+		return nil, true, nil
+	case ValueJSON:
+		return value.Any, false, nil
+	case ValueAny:
+		return normalizeJSON(value.Any), false, nil
+	case ValueString:
+		if parseString {
+			v, err := decodeJSON([]byte(value.Str))
+			return v, false, err
+		}
+		return value.Str, false, nil
+	case ValueBool:
+		return value.BoolValue(), false, nil
+	case ValueInt64:
+		return json.Number(strconv.FormatInt(value.Int64, 10)), false, nil
+	case ValueUint64:
+		return json.Number(strconv.FormatUint(value.Uint64, 10)), false, nil
+	case ValueFloat64:
+		return json.Number(strconv.FormatFloat(value.Float64, 'g', -1, 64)), false, nil
+	case ValueDecimal:
+		return json.Number(value.DecimalValue().String()), false, nil
+	case ValueDatetime:
+		return FormatDatetime(value, value.Location), false, nil
+	case ValueInterval:
+		return formatInterval(&value), false, nil
+	default:
+		return nil, false, newConvertError(nil, value, "json")
+	}
+}
+
+// JSONUnquoteValue converts the json value to the sql value, the strings are
+// unquoted and the objects and the arrays are converted to the json text.
+func JSONUnquoteValue(v interface{}) Value {
+	switch x := v.(type) {
+	case nil:
+		return Null()
+	case string:
+		return StringToValue(x)
+	case bool:
+		return BoolToValue(x)
+	case json.Number:
+		value, err := ToValue(x)
+		if err != nil {
+			return StringToValue(string(x))
+		}
+		return value
+	default:
+		return StringToValue(jsonText(x))
+	}
+}
+
+type jsonPathElem struct {
+	key   string
+	index int
+	isKey bool
+}
+
+// ParseJSONPath parses the path such as '$.a.b', '$.a[0]' and '$."a b"'.
+func ParseJSONPath(path string) ([]jsonPathElem, error) {
+	s := strings.TrimSpace(path)
+	if !strings.HasPrefix(s, "$") {
+		return nil, errors.New("invalid json path '" + path + "'")
+	}
+	s = s[1:]
+
+	var elems []jsonPathElem
+	for len(s) > 0 {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			if strings.HasPrefix(s, "\"") {
+				end := strings.IndexByte(s[1:], '"')
+				if end < 0 {
+					return nil, errors.New("invalid json path '" + path + "'")
+				}
+				elems = append(elems, jsonPathElem{key: s[1 : end+1], isKey: true})
+				s = s[end+2:]
+				continue
+			}
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			key := s[:end]
+			if key == "" || key == "*" {
+				return nil, errors.New("invalid json path '" + path + "'")
+			}
+			elems = append(elems, jsonPathElem{key: key, isKey: true})
+			s = s[end:]
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, errors.New("invalid json path '" + path + "'")
+			}
+			index, err := strconv.Atoi(strings.TrimSpace(s[1:end]))
+			if err != nil || index < 0 {
+				return nil, errors.New("invalid json path '" + path + "'")
+			}
+			elems = append(elems, jsonPathElem{index: index})
+			s = s[end+1:]
+		default:
+			return nil, errors.New("invalid json path '" + path + "'")
+		}
+	}
+	return elems, nil
+}
+
+func lookupJSON(doc interface{}, path []jsonPathElem) (interface{}, bool) {
+	for _, elem := range path {
+		if elem.isKey {
+			m, ok := doc.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			doc, ok = m[elem.key]
+			if !ok {
+				return nil, false
+			}
+			continue
+		}
+		array, ok := doc.([]interface{})
+		if !ok || elem.index >= len(array) {
+			return nil, false
+		}
+		doc = array[elem.index]
+	}
+	return doc, true
+}
+
+func jsonPathArg(name string, value Value) ([]jsonPathElem, error) {
+	if value.Type != ValueString {
+		return nil, newArgumentError(name, name+" path must be a string")
+	}
+	return ParseJSONPath(value.Str)
+}
+
+// jsonDocArg 读取函数的文档参数和可选的路径参数, 文档为 null 或路径不存在时
+// 返回 false
+func jsonDocArg(name string, values []Value, min int) (interface{}, bool, error) {
+	if len(values) < min || len(values) > min+1 {
+		return nil, false, newArgumentError(name, name+" argument isnot match")
+	}
+	doc, isNull, err := toJSONDoc(values[0], true)
+	if err != nil || isNull {
+		return nil, false, err
+	}
+	if len(values) == min+1 {
+		path, err := jsonPathArg(name, values[min])
+		if err != nil {
+			return nil, false, err
+		}
+		doc, ok := lookupJSON(doc, path)
+		return doc, ok, nil
+	}
+	return doc, true, nil
+}
+
+// JSONExtractValue implements 'doc->path'.
+func JSONExtractValue(doc, path Value) (Value, error) {
+	return JSONExtract(nil, []Value{doc, path})
+}
+
+// JSONUnquoteExtractValue implements 'doc->>path'.
+func JSONUnquoteExtractValue(doc, path Value) (Value, error) {
+	value, err := JSONExtract(nil, []Value{doc, path})
+	if err != nil || value.IsNull() {
+		return value, err
+	}
+	return JSONUnquoteValue(value.Any), nil
+}
+
+// JSONExtract returns the value at the path, the values are returned as a
+// array if there are multiple paths.
+func JSONExtract(ctx Context, values []Value) (Value, error) {
+	if len(values) < 2 {
+		return Null(), newArgumentError("json_extract", "json_extract argument isnot match")
+	}
+	doc, isNull, err := toJSONDoc(values[0], true)
+	if err != nil || isNull {
+		return Null(), err
+	}
+
+	var results []interface{}
+	for _, pathValue := range values[1:] {
+		if pathValue.IsNull() {
+			return Null(), nil
+		}
+		path, err := jsonPathArg("json_extract", pathValue)
+		if err != nil {
+			return Null(), err
+		}
+		v, ok := lookupJSON(doc, path)
+		if !ok {
+			continue
+		}
+		if len(values) == 2 {
+			return Value{Type: ValueJSON, Any: v}, nil
+		}
+		results = append(results, v)
+	}
+	if len(results) == 0 {
+		return Null(), nil
+	}
+	return Value{Type: ValueJSON, Any: results}, nil
+}
+
+func JSONUnquote(ctx Context, values []Value) (Value, error) {
+	if len(values) != 1 {
+		return Null(), newArgumentError("json_unquote", "json_unquote argument isnot match")
+	}
+	switch values[0].Type {
+	case ValueJSON:
+		return JSONUnquoteValue(values[0].Any), nil
+	case ValueString:
+		if s := values[0].Str; len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+			var unquoted string
+			if err := json.Unmarshal([]byte(s), &unquoted); err != nil {
+				return Null(), errors.Wrap(err, "json_unquote '"+s+"' fail")
+			}
+			return StringToValue(unquoted), nil
+		}
+		return values[0], nil
+	default:
+		return values[0], nil
+	}
+}
+
+// JSONArrayLength returns the length of the array, 0 if it isnot a array.
+func JSONArrayLength(ctx Context, values []Value) (Value, error) {
+	doc, ok, err := jsonDocArg("json_array_length", values, 1)
+	if err != nil || !ok {
+		return Null(), err
+	}
+	array, _ := doc.([]interface{})
+	return IntToValue(int64(len(array))), nil
+}
+
+// JSONKeys returns the sorted keys of the object, null if it isnot a object.
+func JSONKeys(ctx Context, values []Value) (Value, error) {
+	doc, ok, err := jsonDocArg("json_keys", values, 1)
+	if err != nil || !ok {
+		return Null(), err
+	}
+	m, ok := doc.(map[string]interface{})
+	if !ok {
+		return Null(), nil
+	}
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	results := make([]interface{}, len(keys))
+	for idx := range keys {
+		results[idx] = keys[idx]
+	}
+	return Value{Type: ValueJSON, Any: results}, nil
+}
+
+// JSONContains returns whether the candidate is contained in the target,
+// the rules are same as the JSON_CONTAINS of the mysql.
+func JSONContains(ctx Context, values []Value) (Value, error) {
+	if len(values) < 2 || len(values) > 3 {
+		return Null(), newArgumentError("json_contains", "json_contains argument isnot match")
+	}
+	candidate, isNull, err := toJSONDoc(values[1], true)
+	if err != nil || isNull {
+		return Null(), err
+	}
+	target, ok, err := jsonDocArg("json_contains", append([]Value{values[0]}, values[2:]...), 1)
+	if err != nil || !ok {
+		return Null(), err
+	}
+	return BoolToValue(jsonContains(target, candidate)), nil
+}
+
+func jsonContains(target, candidate interface{}) bool {
+	switch t := target.(type) {
+	case []interface{}:
+		if c, ok := candidate.([]interface{}); ok {
+			for _, item := range c {
+				if !jsonContains(t, item) {
+					return false
+				}
+			}
+			return true
+		}
+		for _, item := range t {
+			if jsonContains(item, candidate) {
+				return true
+			}
+		}
+		return false
+	case map[string]interface{}:
+		c, ok := candidate.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for key, value := range c {
+			item, ok := t[key]
+			if !ok || !jsonContains(item, value) {
+				return false
+			}
+		}
+		return true
+	default:
+		return compareJSON(target, candidate, emptyCompareOption) == 0
+	}
+}
+
+// jsonRank 是 json 值排序时的类型优先级, 与 mysql 一致
+func jsonRank(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case json.Number:
+		return 1
+	case string:
+		return 2
+	case map[string]interface{}:
+		return 3
+	case []interface{}:
+		return 4
+	case bool:
+		return 5
+	default:
+		return 6
+	}
+}
+
+// compareJSON 比较两个 json 值, 类型不同时按 jsonRank 排序, 数字按数值比较,
+// 数组逐个元素比较, 对象只区分是否相等
+func compareJSON(a, b interface{}, opt CompareOption) int {
+	ra, rb := jsonRank(a), jsonRank(b)
+	if ra != rb {
+		if ra < rb {
+			return -1
+		}
+		return 1
+	}
+
+	switch x := a.(type) {
+	case nil:
+		return 0
+	case json.Number:
+		av := JSONUnquoteValue(x)
+		r, err := av.CompareTo(JSONUnquoteValue(b), opt)
+		if err != nil {
+			return strings.Compare(string(x), string(b.(json.Number)))
+		}
+		return r
+	case string:
+		av := StringToValue(x)
+		r, _ := av.CompareToString(b.(string), opt)
+		return r
+	case bool:
+		y := b.(bool)
+		if x == y {
+			return 0
+		}
+		if y {
+			return -1
+		}
+		return 1
+	case []interface{}:
+		y := b.([]interface{})
+		for idx := 0; idx < len(x) && idx < len(y); idx++ {
+			if r := compareJSON(x[idx], y[idx], opt); r != 0 {
+				return r
+			}
+		}
+		if len(x) < len(y) {
+			return -1
+		}
+		if len(x) > len(y) {
+			return 1
+		}
+		return 0
+	case map[string]interface{}:
+		y := b.(map[string]interface{})
+		if len(x) == len(y) {
+			equal := true
+			for key, value := range x {
+				item, ok := y[key]
+				if !ok || compareJSON(value, item, opt) != 0 {
+					equal = false
+					break
+				}
+			}
+			if equal {
+				return 0
+			}
+		}
+		return strings.Compare(jsonText(x), jsonText(y))
+	default:
+		if reflect.DeepEqual(a, b) {
+			return 0
+		}
+		return strings.Compare(jsonText(a), jsonText(b))
+	}
+}
+
+// compareWithJSON 比较 json 值和其它的值, 其它的值先转换为 json 标量(字符串
+// 不作为 json 文本解析), 然后按 json 的规则比较
+func compareWithJSON(a, b Value, opt CompareOption) (int, error) {
+	x, _, err := toJSONDoc(a, false)
+	if err != nil {
+		return 0, NewTypeMismatch(a.Type.String(), "json")
+	}
+	y, _, err := toJSONDoc(b, false)
+	if err != nil {
+		return 0, NewTypeMismatch(b.Type.String(), "json")
+	}
+	return compareJSON(x, y, opt), nil
+}
+
+func ConvertToJSON(readValue func(Context) (Value, error)) func(Context) (Value, error) {
+	return func(ctx Context) (Value, error) {
+		value, err := readValue(ctx)
+		if err != nil {
+			return Null(), err
+		}
+		return ConvertValueToJSON(value)
+	}
+}
+
+// ConvertValueToJSON converts the value to json, the string is parsed as
+// the json text.
+func ConvertValueToJSON(value Value) (Value, error) {
+	if value.IsNull() {
+		return value, nil
+	}
+	doc, _, err := toJSONDoc(value, true)
+	if err != nil {
+		return Null(), err
+	}
+	return Value{Type: ValueJSON, Any: doc}, nil
+}
+
+func JSONExtractFunc(leftValue, rightValue func(Context) (Value, error)) func(Context) (Value, error) {
+	return func(ctx Context) (Value, error) {
+		left, err := leftValue(ctx)
+		if err != nil {
+			return Null(), err
+		}
+		right, err := rightValue(ctx)
+		if err != nil {
+			return Null(), err
+		}
+		return JSONExtractValue(left, right)
+	}
+}
+
+func JSONUnquoteExtractFunc(leftValue, rightValue func(Context) (Value, error)) func(Context) (Value, error) {
+	return func(ctx Context) (Value, error) {
+		left, err := leftValue(ctx)
+		if err != nil {
+			return Null(), err
+		}
+		right, err := rightValue(ctx)
+		if err != nil {
+			return Null(), err
+		}
+		return JSONUnquoteExtractValue(left, right)
+	}
+}
+
+// unwrapJSONNumber 算术运算时 json 数字被当作普通的数字
+func unwrapJSONNumber(value Value) Value {
+	if value.Type == ValueJSON {
+		if n, ok := value.Any.(json.Number); ok {
+			return JSONUnquoteValue(n)
+		}
+	}
+	return value
+}
@@ -0,0 +1,159 @@
+package vm
+
+import "testing"
+
+func mustParseJSON(t *testing.T, s string) Value {
+	v, err := ParseJSON(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestJSONExtract(t *testing.T) {
+	doc := mustParseJSON(t, `{"a": {"b": [1, "x", {"c": true}]}, "d e": null}`)
+
+	tests := []struct {
+		path    string
+		want    string
+		unquote string
+		missing bool
+		fail    bool
+	}{
+		{path: "$", want: `{"a":{"b":[1,"x",{"c":true}]},"d e":null}`, unquote: `{"a":{"b":[1,"x",{"c":true}]},"d e":null}`},
+		{path: "$.a.b[0]", want: "1", unquote: "1"},
+		{path: "$.a.b[1]", want: `"x"`, unquote: "x"},
+		{path: "$.a.b[2].c", want: "true", unquote: "true"},
+		{path: `$."d e"`, want: "null", unquote: "null"},
+		{path: "$.a.b[3]", missing: true},
+		{path: "$.x", missing: true},
+		{path: "a.b", fail: true},
+		{path: "$.a[x]", fail: true},
+	}
+	for _, test := range tests {
+		value, err := JSONExtractValue(doc, StringToValue(test.path))
+		if test.fail {
+			if err == nil {
+				t.Error(test.path, ": want error got ok")
+			}
+			continue
+		}
+		if err != nil {
+			t.Error(test.path, ":", err)
+			continue
+		}
+		if test.missing {
+			if !value.IsNull() {
+				t.Error(test.path, ": want null got", value.String())
+			}
+			continue
+		}
+		if value.Type != ValueJSON || value.String() != test.want {
+			t.Error(test.path, ": want", test.want, "got", value.Type, value.String())
+		}
+
+		unquoted, err := JSONUnquoteExtractValue(doc, StringToValue(test.path))
+		if err != nil {
+			t.Error(test.path, ":", err)
+			continue
+		}
+		if unquoted.String() != test.unquote {
+			t.Error(test.path, ": want", test.unquote, "got", unquoted.String())
+		}
+	}
+
+	// 字符串被当作 json 文本
+	value, err := JSONExtract(nil, []Value{StringToValue(`[1, 2]`), StringToValue("$[1]"), StringToValue("$[0]")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value.String() != "[2,1]" {
+		t.Error("want [2,1] got", value.String())
+	}
+}
+
+func TestJSONFuncs(t *testing.T) {
+	doc := mustParseJSON(t, `{"b": [1, 2, {"x": 1}], "a": {"k": "v"}}`)
+
+	tests := []struct {
+		f    func(Context, []Value) (Value, error)
+		args []Value
+		want string
+	}{
+		{f: JSONArrayLength, args: []Value{doc, StringToValue("$.b")}, want: "3"},
+		{f: JSONArrayLength, args: []Value{doc}, want: "0"},
+		{f: JSONArrayLength, args: []Value{doc, StringToValue("$.c")}, want: "null"},
+		{f: JSONKeys, args: []Value{doc}, want: `["a","b"]`},
+		{f: JSONKeys, args: []Value{doc, StringToValue("$.b")}, want: "null"},
+		{f: JSONContains, args: []Value{doc, StringToValue("2"), StringToValue("$.b")}, want: "true"},
+		{f: JSONContains, args: []Value{doc, StringToValue("[1, 2]"), StringToValue("$.b")}, want: "true"},
+		{f: JSONContains, args: []Value{doc, StringToValue("[1, 3]"), StringToValue("$.b")}, want: "false"},
+		{f: JSONContains, args: []Value{doc, StringToValue(`{"x": 1}`), StringToValue("$.b")}, want: "true"},
+		{f: JSONContains, args: []Value{doc, StringToValue(`{"a": {"k": "v"}}`)}, want: "true"},
+		{f: JSONContains, args: []Value{doc, StringToValue(`{"a": {"k": "w"}}`)}, want: "false"},
+		{f: JSONContains, args: []Value{Null(), StringToValue("1")}, want: "null"},
+		{f: JSONUnquote, args: []Value{StringToValue(`"a\"b"`)}, want: `a"b`},
+	}
+	for idx, test := range tests {
+		value, err := test.f(nil, test.args)
+		if err != nil {
+			t.Error(idx, err)
+			continue
+		}
+		if value.String() != test.want {
+			t.Error(idx, ": want", test.want, "got", value.String())
+		}
+	}
+
+	if _, err := JSONContains(nil, []Value{doc, StringToValue("{x")}); err == nil {
+		t.Error("want error got ok")
+	}
+}
+
+func TestJSONCompare(t *testing.T) {
+	tests := []struct {
+		x    Value
+		y    Value
+		want int
+	}{
+		{x: mustParseJSON(t, "1"), y: IntToValue(1), want: 0},
+		{x: mustParseJSON(t, "1.5"), y: IntToValue(1), want: 1},
+		{x: mustParseJSON(t, `"a"`), y: StringToValue("a"), want: 0},
+		{x: mustParseJSON(t, `"1"`), y: IntToValue(1), want: 1},
+		{x: mustParseJSON(t, "null"), y: IntToValue(1), want: -1},
+		{x: mustParseJSON(t, "true"), y: mustParseJSON(t, "[1]"), want: 1},
+		{x: mustParseJSON(t, "[1, 2]"), y: mustParseJSON(t, "[1, 3]"), want: -1},
+		{x: mustParseJSON(t, "[1, 2]"), y: mustParseJSON(t, "[1]"), want: 1},
+		{x: mustParseJSON(t, `{"a": 1, "b": 2}`), y: mustParseJSON(t, `{"b": 2, "a": 1}`), want: 0},
+		{x: mustParseJSON(t, `{"a": 1}`), y: StringToValue(`{"a": 1}`), want: 1},
+	}
+	for idx, test := range tests {
+		x := test.x
+		r, err := x.CompareTo(test.y, EmptyCompareOption())
+		if err != nil {
+			t.Error(idx, err)
+			continue
+		}
+		if r != test.want {
+			t.Error(idx, ": want", test.want, "got", r)
+		}
+
+		ok, err := x.EqualTo(test.y, EmptyCompareOption())
+		if err != nil {
+			t.Error(idx, err)
+			continue
+		}
+		if ok != (test.want == 0) {
+			t.Error(idx, ": want", test.want == 0, "got", ok)
+		}
+	}
+
+	jsonNull := mustParseJSON(t, "null")
+	if ok, _ := jsonNull.EqualTo(Null(), EmptyCompareOption()); ok {
+		t.Error("json null isnot sql null")
+	}
+	v, err := Plus(mustParseJSON(t, "2"), IntToValue(3))
+	if err != nil || v.String() != "5" {
+		t.Error("want 5 got", v.String(), err)
+	}
+}
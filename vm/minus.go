@@ -5,6 +5,12 @@ import (
 )
 
 func MinusFunc(left, right func(Context) (Value, error)) func(Context) (Value, error) {
+	return MinusFuncIn(left, right, nil)
+}
+
+// MinusFuncIn is same as MinusFunc but the calendar interval is subtracted
+// in loc, nil is TimeLocal.
+func MinusFuncIn(left, right func(Context) (Value, error), loc *time.Location) func(Context) (Value, error) {
 	return func(ctx Context) (Value, error) {
 		leftValue, err := left(ctx)
 		if err != nil {
@@ -14,27 +20,39 @@ func MinusFunc(left, right func(Context) (Value, error)) func(Context) (Value, e
 		if err != nil {
 			return Null(), err
 		}
+		return MinusIn(leftValue, rightValue, loc)
+	}
+}
 
-		switch rightValue.Type {
-		case ValueNull:
-			return Null(), NewArithmeticError("-", leftValue.Type.String(), rightValue.Type.String())
-		case ValueBool:
-			return Null(), NewArithmeticError("-", leftValue.Type.String(), rightValue.Type.String())
-		case ValueString:
-			return Null(), NewArithmeticError("-", leftValue.Type.String(), rightValue.Type.String())
-		case ValueInt64:
-			return minusInt(leftValue, rightValue.Int64)
-		case ValueUint64:
-			return minusUint(leftValue, rightValue.Uint64)
-		case ValueFloat64:
-			return minusFloat(leftValue, rightValue.Float64)
-		case ValueDatetime:
-			return minusDatetime(leftValue, IntToDatetime(rightValue.Int64))
-		case ValueInterval:
-			return minusInterval(leftValue, IntToInterval(rightValue.Int64))
-		default:
-			return Null(), NewArithmeticError("-", leftValue.Type.String(), rightValue.Type.String())
-		}
+func MinusIn(leftValue, rightValue Value, loc *time.Location) (Value, error) {
+	leftValue, rightValue = unwrapJSONNumber(leftValue), unwrapJSONNumber(rightValue)
+	if leftValue.Type == ValueDecimal || rightValue.Type == ValueDecimal {
+		return decimalArithmetic("-", leftValue, rightValue, func(a, b *Decimal) (*Decimal, error) {
+			return a.Sub(b), nil
+		}, func(a, b float64) (Value, error) {
+			return FloatToValue(a - b), nil
+		})
+	}
+
+	switch rightValue.Type {
+	case ValueNull:
+		return Null(), NewArithmeticError("-", leftValue.Type.String(), rightValue.Type.String())
+	case ValueBool:
+		return Null(), NewArithmeticError("-", leftValue.Type.String(), rightValue.Type.String())
+	case ValueString:
+		return Null(), NewArithmeticError("-", leftValue.Type.String(), rightValue.Type.String())
+	case ValueInt64:
+		return minusInt(leftValue, rightValue.Int64)
+	case ValueUint64:
+		return minusUint(leftValue, rightValue.Uint64)
+	case ValueFloat64:
+		return minusFloat(leftValue, rightValue.Float64)
+	case ValueDatetime:
+		return minusDatetime(leftValue, IntToDatetime(rightValue.Int64))
+	case ValueInterval:
+		return minusInterval(leftValue, rightValue, loc)
+	default:
+		return Null(), NewArithmeticError("-", leftValue.Type.String(), rightValue.Type.String())
 	}
 }
 
@@ -114,14 +132,13 @@ func minusDatetime(left Value, right time.Time) (Value, error) {
 	return IntervalToValue(t.Sub(right)), nil
 }
 
-func minusInterval(left Value, right time.Duration) (Value, error) {
+func minusInterval(left, right Value, loc *time.Location) (Value, error) {
 	switch left.Type {
 	case ValueDatetime:
 		t := IntToDatetime(left.Int64)
-		return DatetimeToValue(t.Add(-right)), nil
+		return DatetimeToValue(AddInterval(t, negInterval(right), loc)), nil
 	case ValueInterval:
-		t := IntToInterval(left.Int64)
-		return IntervalToValue(t - right), nil
+		return addIntervals(left, negInterval(right)), nil
 	default:
 		return Null(), NewArithmeticError("-", left.Type.String(), "datetime")
 	}
@@ -10,31 +10,45 @@ func ModFunc(left, right func(Context) (Value, error)) func(Context) (Value, err
 		if err != nil {
 			return Null(), err
 		}
+		return Mod(leftValue, rightValue)
+	}
+}
 
-		switch rightValue.Type {
-		case ValueNull:
-			return Null(), NewArithmeticError("mod", leftValue.Type.String(), rightValue.Type.String())
-		case ValueBool:
-			return Null(), NewArithmeticError("mod", leftValue.Type.String(), rightValue.Type.String())
-		case ValueString:
-			return Null(), NewArithmeticError("mod", leftValue.Type.String(), rightValue.Type.String())
-		case ValueInt64:
-			return modInt(leftValue, rightValue.Int64)
-		case ValueUint64:
-			return modUint(leftValue, rightValue.Uint64)
-		// case ValueFloat64:
-		//   return modFloat(leftValue, rightValue.Float64)
-		// case ValueDatetime:
-		//   return modDatetime(leftValue, IntToDatetime(rightValue.Int64))
-		// case ValueInterval:
-		//   return modInterval(leftValue, IntToInterval(rightValue.Int64))
-		default:
-			return Null(), NewArithmeticError("mod", leftValue.Type.String(), rightValue.Type.String())
-		}
+func Mod(leftValue, rightValue Value) (Value, error) {
+	leftValue, rightValue = unwrapJSONNumber(leftValue), unwrapJSONNumber(rightValue)
+	if leftValue.Type == ValueDecimal || rightValue.Type == ValueDecimal {
+		return decimalArithmetic("mod", leftValue, rightValue, func(a, b *Decimal) (*Decimal, error) {
+			return a.Mod(b)
+		}, nil)
+	}
+
+	switch rightValue.Type {
+	case ValueNull:
+		return Null(), NewArithmeticError("mod", leftValue.Type.String(), rightValue.Type.String())
+	case ValueBool:
+		return Null(), NewArithmeticError("mod", leftValue.Type.String(), rightValue.Type.String())
+	case ValueString:
+		return Null(), NewArithmeticError("mod", leftValue.Type.String(), rightValue.Type.String())
+	case ValueInt64:
+		return modInt(leftValue, rightValue.Int64)
+	case ValueUint64:
+		return modUint(leftValue, rightValue.Uint64)
+	// case ValueFloat64:
+	//   return modFloat(leftValue, rightValue.Float64)
+	// case ValueDatetime:
+	//   return modDatetime(leftValue, IntToDatetime(rightValue.Int64))
+	// case ValueInterval:
+	//   return modInterval(leftValue, IntToInterval(rightValue.Int64))
+	default:
+		return Null(), NewArithmeticError("mod", leftValue.Type.String(), rightValue.Type.String())
 	}
 }
 
 func modInt(left Value, right int64) (Value, error) {
+	// 与 mysql 一样, 除以 0 的结果是 NULL
+	if right == 0 {
+		return Null(), nil
+	}
 	switch left.Type {
 	case ValueNull:
 		return Null(), NewArithmeticError("mod", left.Type.String(), "int")
@@ -56,6 +70,10 @@ func modInt(left Value, right int64) (Value, error) {
 }
 
 func modUint(left Value, right uint64) (Value, error) {
+	// 与 mysql 一样, 除以 0 的结果是 NULL
+	if right == 0 {
+		return Null(), nil
+	}
 	switch left.Type {
 	case ValueNull:
 		return Null(), NewArithmeticError("mod", left.Type.String(), "uint")
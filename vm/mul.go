@@ -10,27 +10,39 @@ func MultFunc(left, right func(Context) (Value, error)) func(Context) (Value, er
 		if err != nil {
 			return Null(), err
 		}
+		return Mult(leftValue, rightValue)
+	}
+}
 
-		switch rightValue.Type {
-		case ValueNull:
-			return Null(), NewArithmeticError("*", leftValue.Type.String(), rightValue.Type.String())
-		case ValueBool:
-			return Null(), NewArithmeticError("*", leftValue.Type.String(), rightValue.Type.String())
-		case ValueString:
-			return Null(), NewArithmeticError("*", leftValue.Type.String(), rightValue.Type.String())
-		case ValueInt64:
-			return multInt(leftValue, rightValue.Int64)
-		case ValueUint64:
-			return multUint(leftValue, rightValue.Uint64)
-		case ValueFloat64:
-			return multFloat(leftValue, rightValue.Float64)
-		// case ValueDatetime:
-		//   return multDatetime(leftValue, IntToDatetime(rightValue.Int64))
-		// case ValueInterval:
-		//   return multInterval(leftValue, IntToInterval(rightValue.Int64))
-		default:
-			return Null(), NewArithmeticError("*", leftValue.Type.String(), rightValue.Type.String())
-		}
+func Mult(leftValue, rightValue Value) (Value, error) {
+	leftValue, rightValue = unwrapJSONNumber(leftValue), unwrapJSONNumber(rightValue)
+	if leftValue.Type == ValueDecimal || rightValue.Type == ValueDecimal {
+		return decimalArithmetic("*", leftValue, rightValue, func(a, b *Decimal) (*Decimal, error) {
+			return a.Mul(b), nil
+		}, func(a, b float64) (Value, error) {
+			return FloatToValue(a * b), nil
+		})
+	}
+
+	switch rightValue.Type {
+	case ValueNull:
+		return Null(), NewArithmeticError("*", leftValue.Type.String(), rightValue.Type.String())
+	case ValueBool:
+		return Null(), NewArithmeticError("*", leftValue.Type.String(), rightValue.Type.String())
+	case ValueString:
+		return Null(), NewArithmeticError("*", leftValue.Type.String(), rightValue.Type.String())
+	case ValueInt64:
+		return multInt(leftValue, rightValue.Int64)
+	case ValueUint64:
+		return multUint(leftValue, rightValue.Uint64)
+	case ValueFloat64:
+		return multFloat(leftValue, rightValue.Float64)
+	// case ValueDatetime:
+	//   return multDatetime(leftValue, IntToDatetime(rightValue.Int64))
+	// case ValueInterval:
+	//   return multInterval(leftValue, IntToInterval(rightValue.Int64))
+	default:
+		return Null(), NewArithmeticError("*", leftValue.Type.String(), rightValue.Type.String())
 	}
 }
 
@@ -11,6 +11,12 @@ func NewArithmeticError(op, left, right string) error {
 }
 
 func PlusFunc(left, right func(Context) (Value, error)) func(Context) (Value, error) {
+	return PlusFuncIn(left, right, nil)
+}
+
+// PlusFuncIn is same as PlusFunc but the calendar interval is added in loc,
+// nil is TimeLocal.
+func PlusFuncIn(left, right func(Context) (Value, error), loc *time.Location) func(Context) (Value, error) {
 	return func(ctx Context) (Value, error) {
 		leftValue, err := left(ctx)
 		if err != nil {
@@ -21,11 +27,23 @@ func PlusFunc(left, right func(Context) (Value, error)) func(Context) (Value, er
 			return Null(), err
 		}
 
-		return Plus(leftValue, rightValue)
+		return PlusIn(leftValue, rightValue, loc)
 	}
 }
 
 func Plus(leftValue, rightValue Value) (Value, error) {
+	return PlusIn(leftValue, rightValue, nil)
+}
+
+func PlusIn(leftValue, rightValue Value, loc *time.Location) (Value, error) {
+	leftValue, rightValue = unwrapJSONNumber(leftValue), unwrapJSONNumber(rightValue)
+	if leftValue.Type == ValueDecimal || rightValue.Type == ValueDecimal {
+		return decimalArithmetic("+", leftValue, rightValue, func(a, b *Decimal) (*Decimal, error) {
+			return a.Add(b), nil
+		}, func(a, b float64) (Value, error) {
+			return FloatToValue(a + b), nil
+		})
+	}
 	switch rightValue.Type {
 	case ValueNull:
 		return Null(), NewArithmeticError("+", leftValue.Type.String(), rightValue.Type.String())
@@ -40,9 +58,9 @@ func Plus(leftValue, rightValue Value) (Value, error) {
 	case ValueFloat64:
 		return plusFloat(leftValue, rightValue.Float64)
 	case ValueDatetime:
-		return plusDatetime(leftValue, IntToDatetime(rightValue.Int64))
+		return plusDatetime(leftValue, IntToDatetime(rightValue.Int64), loc)
 	case ValueInterval:
-		return plusInterval(leftValue, IntToInterval(rightValue.Int64))
+		return plusInterval(leftValue, rightValue, loc)
 	default:
 		return Null(), NewArithmeticError("+", leftValue.Type.String(), rightValue.Type.String())
 	}
@@ -119,19 +137,21 @@ func plusFloat(left Value, right float64) (Value, error) {
 	}
 }
 
-func plusDatetime(left Value, right time.Time) (Value, error) {
+func plusDatetime(left Value, right time.Time, loc *time.Location) (Value, error) {
 	if left.Type != ValueInterval {
 		return Null(), NewArithmeticError("+", left.Type.String(), "datetime")
 	}
 
-	return DatetimeToValue(right.Add(IntToInterval(left.Int64))), nil
+	return DatetimeToValue(AddInterval(right, left, loc)), nil
 }
 
-func plusInterval(left Value, right time.Duration) (Value, error) {
-	if left.Type != ValueDatetime {
-		return Null(), NewArithmeticError("+", left.Type.String(), "datetime")
+func plusInterval(left, right Value, loc *time.Location) (Value, error) {
+	switch left.Type {
+	case ValueDatetime:
+		return DatetimeToValue(AddInterval(IntToDatetime(left.Int64), right, loc)), nil
+	case ValueInterval:
+		return addIntervals(left, right), nil
+	default:
+		return Null(), NewArithmeticError("+", left.Type.String(), "interval")
 	}
-
-	t := IntToDatetime(left.Int64)
-	return DatetimeToValue(t.Add(right)), nil
 }
@@ -0,0 +1,424 @@
+package vm
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/runner-mei/errors"
+)
+
+// OpCode is the operation of an instruction of a Program.
+type OpCode uint8
+
+const (
+	// OpConst pushes Consts[Arg].
+	OpConst OpCode = iota
+	// OpColumn pushes the value of Columns[Arg].
+	OpColumn
+	// OpColumnOrNull is same as OpColumn but a missing column is NULL, it is
+	// used by IS NULL.
+	OpColumnOrNull
+	// OpEval pushes the result of Funcs[Arg], it is used by the expressions
+	// which aren't compiled to the instructions.
+	OpEval
+
+	OpPlus
+	OpMinus
+	OpMult
+	OpDiv
+	OpIntDiv
+	OpMod
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShiftLeft
+	OpShiftRight
+	OpUminus
+	OpUplus
+	OpBitNot
+	OpBang
+
+	// the comparisons compare the two values with Options[Arg] and push a
+	// boolean or NULL which is Unknown.
+	OpEqual
+	OpNotEqual
+	OpLessThan
+	OpLessEqual
+	OpGreaterThan
+	OpGreaterEqual
+	OpNullSafeEqual
+	OpLike
+	OpNotLike
+	OpRegexp
+	OpNotRegexp
+	// OpIn tests the value with Lists[Arg].
+	OpIn
+	OpNotIn
+	// OpBetween tests the three values with Options[Arg].
+	OpBetween
+	OpNotBetween
+	OpIsNull
+	OpIsNotNull
+	OpIsTrue
+	OpIsNotTrue
+	OpIsFalse
+	OpIsNotFalse
+
+	OpNot
+	OpAnd
+	OpOr
+	// OpJumpIfFalse jumps to Arg and keeps the value if the value is false,
+	// it is the short circuit of AND.
+	OpJumpIfFalse
+	// OpJumpIfTrue jumps to Arg and keeps the value if the value is true,
+	// it is the short circuit of OR.
+	OpJumpIfTrue
+)
+
+// Instruction is an instruction of a Program.
+type Instruction struct {
+	Op  OpCode
+	Arg int32
+}
+
+// ColumnRef is a column which is read by a Program.
+type ColumnRef struct {
+	Table string
+	Name  string
+}
+
+// InList is the list of IN.
+type InList struct {
+	Values []Value
+	Option CompareOption
+}
+
+// Program is an expression which is compiled to the instructions of a stack
+// machine. The columns are read by the slots which are resolved once for
+// the columns of the records, see Run.
+type Program struct {
+	Code    []Instruction
+	Consts  []Value
+	Columns []ColumnRef
+	Funcs   []func(Context) (Value, error)
+	Options []CompareOption
+	Lists   []InList
+
+	// Location is the time zone of the calendar intervals, nil is TimeLocal.
+	Location *time.Location
+}
+
+// smallStack 是在 goroutine 栈上分配的 stack 的大小
+const smallStack = 8
+
+func (p *Program) Emit(op OpCode, arg int) int {
+	p.Code = append(p.Code, Instruction{Op: op, Arg: int32(arg)})
+	return len(p.Code) - 1
+}
+
+// Patch sets the target of the jump at pc to the end of the code.
+func (p *Program) Patch(pc int) {
+	p.Code[pc].Arg = int32(len(p.Code))
+}
+
+func (p *Program) AddConst(value Value) int {
+	p.Consts = append(p.Consts, value)
+	return len(p.Consts) - 1
+}
+
+func (p *Program) AddColumn(table, name string) int {
+	for idx := range p.Columns {
+		if p.Columns[idx].Table == table && p.Columns[idx].Name == name {
+			return idx
+		}
+	}
+	p.Columns = append(p.Columns, ColumnRef{Table: table, Name: name})
+	return len(p.Columns) - 1
+}
+
+func (p *Program) AddFunc(f func(Context) (Value, error)) int {
+	p.Funcs = append(p.Funcs, f)
+	return len(p.Funcs) - 1
+}
+
+func (p *Program) AddOption(opt CompareOption) int {
+	for idx := range p.Options {
+		if p.Options[idx] == opt {
+			return idx
+		}
+	}
+	p.Options = append(p.Options, opt)
+	return len(p.Options) - 1
+}
+
+func (p *Program) AddList(values []Value, opt CompareOption) int {
+	p.Lists = append(p.Lists, InList{Values: values, Option: opt})
+	return len(p.Lists) - 1
+}
+
+// Fold evaluates the code which starts at start and replaces it with a
+// constant, the code must not read the columns. It returns false and keeps
+// the code if the evaluation fails, then the error is returned at run time.
+func (p *Program) Fold(start int) bool {
+	value, err := p.run(nil, nil, nil, start, make([]Value, 0, 8))
+	if err != nil {
+		return false
+	}
+	p.Code = p.Code[:start]
+	p.Emit(OpConst, p.AddConst(value))
+	return true
+}
+
+// IsConst returns true if the code which starts at start is a constant.
+func (p *Program) IsConst(start int) bool {
+	return len(p.Code) == start+1 && p.Code[start].Op == OpConst
+}
+
+// stackSize 返回 stack 的最大深度, 它不缓存结果, 这样 Program 可以被并发运行
+func (p *Program) stackSize() int {
+	depth, max := 0, 1
+	for _, instr := range p.Code {
+		switch instr.Op {
+		case OpConst, OpColumn, OpColumnOrNull, OpEval:
+			depth++
+		case OpUminus, OpUplus, OpBitNot, OpBang, OpNot,
+			OpIn, OpNotIn, OpIsNull, OpIsNotNull,
+			OpIsTrue, OpIsNotTrue, OpIsFalse, OpIsNotFalse,
+			OpJumpIfFalse, OpJumpIfTrue:
+		case OpBetween, OpNotBetween:
+			depth -= 2
+		default:
+			depth--
+		}
+		if depth > max {
+			max = depth
+		}
+	}
+	return max
+}
+
+// Run runs the program, the column Columns[i] is row[slots[i]] and it is
+// read from ctx if slots is nil or slots[i] is negative.
+func (p *Program) Run(ctx Context, row []Value, slots []int) (Value, error) {
+	var buf [smallStack]Value
+	stack := buf[:0]
+	// stack 的深度不会超过指令的个数
+	if len(p.Code) > smallStack {
+		if size := p.stackSize(); size > smallStack {
+			stack = make([]Value, 0, size)
+		}
+	}
+	return p.run(ctx, row, slots, 0, stack)
+}
+
+// Filter runs the program as a predicate, Unknown is false.
+func (p *Program) Filter(ctx Context, row []Value, slots []int) (bool, error) {
+	value, err := p.Run(ctx, row, slots)
+	if err != nil {
+		return false, err
+	}
+	t, err := ToTruth(value)
+	if err != nil {
+		return false, err
+	}
+	return t == True, nil
+}
+
+func (p *Program) column(ctx Context, idx int) (Value, error) {
+	if ctx == nil {
+		return Null(), errors.New("column '" + p.Columns[idx].Name + "' isnot found")
+	}
+	return ctx.GetValue(p.Columns[idx].Table, p.Columns[idx].Name)
+}
+
+func (p *Program) run(ctx Context, row []Value, slots []int, start int, stack []Value) (Value, error) {
+	var err error
+	var t Truth
+	code := p.Code
+	for pc := start; pc < len(code); pc++ {
+		instr := code[pc]
+		top := len(stack) - 1
+		switch instr.Op {
+		case OpConst:
+			stack = append(stack, p.Consts[instr.Arg])
+		case OpColumn:
+			if slots != nil && slots[instr.Arg] >= 0 {
+				if slot := slots[instr.Arg]; slot < len(row) {
+					stack = append(stack, row[slot])
+				} else {
+					stack = append(stack, Null())
+				}
+				continue
+			}
+			value, err := p.column(ctx, int(instr.Arg))
+			if err != nil {
+				return Null(), err
+			}
+			stack = append(stack, value)
+		case OpColumnOrNull:
+			value := Null()
+			if slots != nil && slots[instr.Arg] >= 0 {
+				if slot := slots[instr.Arg]; slot < len(row) {
+					value = row[slot]
+				}
+			} else if value, err = p.column(ctx, int(instr.Arg)); err != nil {
+				if !errors.Is(err, ErrNotFound) {
+					return Null(), err
+				}
+				value, err = Null(), nil
+			}
+			stack = append(stack, value)
+		case OpEval:
+			value, err := p.Funcs[instr.Arg](ctx)
+			if err != nil {
+				return Null(), err
+			}
+			stack = append(stack, value)
+		case OpJumpIfFalse:
+			if stack[top].Type == ValueBool && !stack[top].BoolValue() {
+				pc = int(instr.Arg) - 1
+			}
+		case OpJumpIfTrue:
+			if stack[top].Type == ValueBool && stack[top].BoolValue() {
+				pc = int(instr.Arg) - 1
+			}
+
+		case OpUminus:
+			stack[top], err = Uminus(stack[top])
+		case OpUplus:
+			stack[top], err = Uplus(stack[top])
+		case OpBitNot:
+			stack[top], err = BitNot(stack[top])
+		case OpBang:
+			stack[top], err = Bang(stack[top])
+		case OpNot:
+			t, err = ToTruth(stack[top])
+			stack[top] = t.Not().ToValue()
+		case OpIsNull:
+			stack[top] = BoolToValue(stack[top].IsNil())
+		case OpIsNotNull:
+			stack[top] = BoolToValue(!stack[top].IsNil())
+		case OpIsTrue:
+			t, err = ToTruth(stack[top])
+			stack[top] = BoolToValue(t == True)
+		case OpIsNotTrue:
+			t, err = ToTruth(stack[top])
+			stack[top] = BoolToValue(t != True)
+		case OpIsFalse:
+			t, err = ToTruth(stack[top])
+			stack[top] = BoolToValue(t == False)
+		case OpIsNotFalse:
+			t, err = ToTruth(stack[top])
+			stack[top] = BoolToValue(t != False)
+		case OpIn, OpNotIn:
+			list := &p.Lists[instr.Arg]
+			t, err = inValues(stack[top], list.Values, list.Option)
+			if instr.Op == OpNotIn {
+				t = t.Not()
+			}
+			stack[top] = t.ToValue()
+		case OpBetween, OpNotBetween:
+			t, err = betweenValues(stack[top-2], stack[top-1], stack[top], p.Options[instr.Arg])
+			if instr.Op == OpNotBetween {
+				t = t.Not()
+			}
+			stack = stack[:top-1]
+			stack[top-2] = t.ToValue()
+
+		case OpPlus:
+			stack[top-1], err = PlusIn(stack[top-1], stack[top], p.Location)
+			stack = stack[:top]
+		case OpMinus:
+			stack[top-1], err = MinusIn(stack[top-1], stack[top], p.Location)
+			stack = stack[:top]
+		case OpMult:
+			stack[top-1], err = Mult(stack[top-1], stack[top])
+			stack = stack[:top]
+		case OpDiv:
+			stack[top-1], err = Div(stack[top-1], stack[top])
+			stack = stack[:top]
+		case OpIntDiv:
+			stack[top-1], err = IntDiv(stack[top-1], stack[top])
+			stack = stack[:top]
+		case OpMod:
+			stack[top-1], err = Mod(stack[top-1], stack[top])
+			stack = stack[:top]
+		case OpBitAnd:
+			stack[top-1], err = BitAnd(stack[top-1], stack[top])
+			stack = stack[:top]
+		case OpBitOr:
+			stack[top-1], err = BitOr(stack[top-1], stack[top])
+			stack = stack[:top]
+		case OpBitXor:
+			stack[top-1], err = BitXor(stack[top-1], stack[top])
+			stack = stack[:top]
+		case OpShiftLeft:
+			stack[top-1], err = ShiftLeft(stack[top-1], stack[top])
+			stack = stack[:top]
+		case OpShiftRight:
+			stack[top-1], err = ShiftRight(stack[top-1], stack[top])
+			stack = stack[:top]
+		default:
+			t, err = p.compare(instr, &stack[top-1], &stack[top])
+			stack[top-1] = t.ToValue()
+			stack = stack[:top]
+		}
+		if err != nil {
+			return Null(), err
+		}
+	}
+	if len(stack) != 1 {
+		return Null(), errors.New("program is invalid, the size of the stack is " + strconv.Itoa(len(stack)))
+	}
+	return stack[0], nil
+}
+
+func (p *Program) compare(instr Instruction, left, right *Value) (Truth, error) {
+	switch instr.Op {
+	case OpEqual:
+		return equalValues(*left, *right, p.Options[instr.Arg])
+	case OpNotEqual:
+		t, err := equalValues(*left, *right, p.Options[instr.Arg])
+		return t.Not(), err
+	case OpLessThan:
+		return compareValues(*left, *right, p.Options[instr.Arg], isLess)
+	case OpLessEqual:
+		return compareValues(*left, *right, p.Options[instr.Arg], isLessEqual)
+	case OpGreaterThan:
+		return compareValues(*left, *right, p.Options[instr.Arg], isGreater)
+	case OpGreaterEqual:
+		return compareValues(*left, *right, p.Options[instr.Arg], isGreaterEqual)
+	case OpNullSafeEqual:
+		return nullSafeEqualValues(*left, *right, p.Options[instr.Arg])
+	case OpLike:
+		return likeValues(*left, *right, p.Options[instr.Arg].collation())
+	case OpNotLike:
+		t, err := likeValues(*left, *right, p.Options[instr.Arg].collation())
+		return t.Not(), err
+	case OpRegexp:
+		return regexpValues(*left, *right)
+	case OpNotRegexp:
+		t, err := regexpValues(*left, *right)
+		return t.Not(), err
+	case OpAnd, OpOr:
+		a, err := ToTruth(*left)
+		if err != nil {
+			return Unknown, err
+		}
+		b, err := ToTruth(*right)
+		if err != nil {
+			return Unknown, err
+		}
+		if instr.Op == OpAnd {
+			return a.And(b), nil
+		}
+		return a.Or(b), nil
+	default:
+		return Unknown, errors.New("opcode '" + strconv.Itoa(int(instr.Op)) + "' is unknown")
+	}
+}
+
+func isLess(r int) bool         { return r < 0 }
+func isLessEqual(r int) bool    { return r <= 0 }
+func isGreater(r int) bool      { return r > 0 }
+func isGreaterEqual(r int) bool { return r >= 0 }
@@ -0,0 +1,70 @@
+package vm
+
+import (
+	"testing"
+)
+
+func TestProgram(t *testing.T) {
+	// (a + 2) * 3 > 10 and b is not null
+	var p Program
+	a := p.AddColumn("", "a")
+	opt := p.AddOption(EmptyCompareOption())
+	p.Emit(OpColumn, a)
+	start := len(p.Code)
+	p.Emit(OpConst, p.AddConst(IntToValue(1)))
+	p.Emit(OpConst, p.AddConst(IntToValue(1)))
+	p.Emit(OpPlus, 0)
+	if !p.Fold(start) || !p.IsConst(start) {
+		t.Fatal("want fold")
+	}
+	p.Emit(OpPlus, 0)
+	p.Emit(OpConst, p.AddConst(IntToValue(3)))
+	p.Emit(OpMult, 0)
+	p.Emit(OpConst, p.AddConst(IntToValue(10)))
+	p.Emit(OpGreaterThan, opt)
+	jump := p.Emit(OpJumpIfFalse, 0)
+	p.Emit(OpColumnOrNull, p.AddColumn("", "b"))
+	p.Emit(OpIsNotNull, 0)
+	p.Emit(OpAnd, 0)
+	p.Patch(jump)
+
+	tests := []struct {
+		row   []Value
+		slots []int
+		want  Value
+	}{
+		{row: []Value{IntToValue(2), IntToValue(1)}, slots: []int{0, 1}, want: BoolToValue(true)},
+		{row: []Value{IntToValue(1), IntToValue(1)}, slots: []int{0, 1}, want: BoolToValue(false)},
+		{row: []Value{IntToValue(2)}, slots: []int{0, 1}, want: BoolToValue(false)},
+		{row: []Value{IntToValue(2), Null()}, slots: []int{0, 1}, want: BoolToValue(false)},
+		{row: []Value{IntToValue(1), IntToValue(2)}, slots: []int{1, 0}, want: BoolToValue(true)},
+	}
+	for idx, test := range tests {
+		got, err := p.Run(nil, test.row, test.slots)
+		if err != nil {
+			t.Error(idx, err)
+			continue
+		}
+		if got != test.want {
+			t.Error(idx, ": want", test.want.String(), "got", got.String())
+		}
+	}
+
+	if _, err := p.Run(nil, nil, []int{-1, -1}); err == nil {
+		t.Error("want error")
+	}
+
+	vectors := [][]Value{
+		{IntToValue(2), IntToValue(1), IntToValue(2), IntToValue(1)},
+		{IntToValue(1), IntToValue(1), Null(), IntToValue(2)},
+	}
+	out := make([]Value, 4)
+	if err := p.RunBatch(4, vectors, []int{0, 1}, nil, out); err != nil {
+		t.Fatal(err)
+	}
+	for idx, want := range []bool{true, false, false, false} {
+		if out[idx] != BoolToValue(want) {
+			t.Error(idx, ": want", want, "got", out[idx].String())
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package vm
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/runner-mei/errors"
+)
+
+// TimeFuncs are the functions which depend on the current time or the time
+// zone, loc is the time zone of the session and nil is TimeLocal.
+var TimeFuncs = map[string]func(loc *time.Location) func(ctx Context, values []Value) (Value, error){
+	"now":               Now,
+	"current_timestamp": Now,
+	"localtime":         Now,
+	"localtimestamp":    Now,
+	"sysdate":           Now,
+	"utc_timestamp":     UtcTimestamp,
+	"curdate":           CurDate,
+	"current_date":      CurDate,
+	"utc_date":          UtcDate,
+	"curtime":           CurTime,
+	"current_time":      CurTime,
+	"utc_time":          func(*time.Location) func(Context, []Value) (Value, error) { return CurTime(time.UTC) },
+	"date":              Date,
+	"date_format":       DateFormat,
+	"convert_tz":        ConvertTz,
+	"at_time_zone":      AtTimeZone,
+}
+
+func location(loc *time.Location) *time.Location {
+	if loc == nil {
+		return TimeLocal
+	}
+	return loc
+}
+
+var locations sync.Map
+
+// LoadLocation returns the time zone of the name, the name may be a IANA
+// time zone such as 'Asia/Shanghai', an offset such as '+08:00', 'UTC' or
+// 'SYSTEM' which is TimeLocal.
+func LoadLocation(name string) (*time.Location, error) {
+	switch strings.ToLower(name) {
+	case "system", "local":
+		return TimeLocal, nil
+	case "utc", "z":
+		return time.UTC, nil
+	case "":
+		return nil, errors.New("time zone is empty")
+	}
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+
+	var loc *time.Location
+	if name[0] == '+' || name[0] == '-' {
+		t, err := time.Parse("-07:00", name)
+		if err != nil {
+			return nil, errors.New("time zone '" + name + "' is invalid")
+		}
+		_, offset := t.Zone()
+		loc = time.FixedZone(name, offset)
+	} else {
+		var err error
+		loc, err = time.LoadLocation(name)
+		if err != nil {
+			return nil, errors.New("time zone '" + name + "' is invalid")
+		}
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// ToDatetimeIn parses the datetime, the text without the zone is read in loc.
+func ToDatetimeIn(s string, loc *time.Location) (time.Time, error) {
+	loc = location(loc)
+	for _, layout := range TimeFormats {
+		m, e := time.ParseInLocation(layout, s, loc)
+		if nil == e {
+			return m, nil
+		}
+	}
+	return time.Time{}, errors.New("invalid time: " + s)
+}
+
+// FormatDatetime formats the datetime in loc.
+func FormatDatetime(value Value, loc *time.Location) string {
+	return IntToDatetime(value.Int64).In(location(loc)).Format(time.RFC3339)
+}
+
+func midnight(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+func Now(*time.Location) func(Context, []Value) (Value, error) {
+	return func(ctx Context, values []Value) (Value, error) {
+		if len(values) != 0 {
+			return Null(), newArgumentError("now", "now argument isnot match")
+		}
+		return DatetimeToValue(time.Now()), nil
+	}
+}
+
+// utcNow 返回 loc 中与当前 UTC 时间的日期和时间相同的时间
+func utcNow(loc *time.Location) time.Time {
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute(), now.Second(), now.Nanosecond(), location(loc))
+}
+
+// UtcTimestamp returns the date and time of UTC now, it is read in loc like
+// the UTC_TIMESTAMP of mysql, so it is displayed as the UTC time.
+func UtcTimestamp(loc *time.Location) func(Context, []Value) (Value, error) {
+	return func(ctx Context, values []Value) (Value, error) {
+		if len(values) != 0 {
+			return Null(), newArgumentError("utc_timestamp", "utc_timestamp argument isnot match")
+		}
+		return DatetimeToValue(utcNow(loc)), nil
+	}
+}
+
+// UtcDate returns the midnight of today in UTC, it is read in loc like
+// UtcTimestamp.
+func UtcDate(loc *time.Location) func(Context, []Value) (Value, error) {
+	return func(ctx Context, values []Value) (Value, error) {
+		if len(values) != 0 {
+			return Null(), newArgumentError("utc_date", "utc_date argument isnot match")
+		}
+		return DatetimeToValue(midnight(utcNow(loc))), nil
+	}
+}
+
+// CurDate returns the midnight of today in loc.
+func CurDate(loc *time.Location) func(Context, []Value) (Value, error) {
+	return func(ctx Context, values []Value) (Value, error) {
+		if len(values) != 0 {
+			return Null(), newArgumentError("curdate", "curdate argument isnot match")
+		}
+		return DatetimeToValue(midnight(time.Now().In(location(loc)))), nil
+	}
+}
+
+// CurTime returns the time elapsed since the midnight of today in loc.
+func CurTime(loc *time.Location) func(Context, []Value) (Value, error) {
+	return func(ctx Context, values []Value) (Value, error) {
+		if len(values) != 0 {
+			return Null(), newArgumentError("curtime", "curtime argument isnot match")
+		}
+		now := time.Now().In(location(loc)).Truncate(time.Second)
+		return IntervalToValue(now.Sub(midnight(now))), nil
+	}
+}
+
+// Date returns the midnight of the day of the datetime in loc.
+func Date(loc *time.Location) func(Context, []Value) (Value, error) {
+	return func(ctx Context, values []Value) (Value, error) {
+		if len(values) != 1 {
+			return Null(), newArgumentError("date", "date argument isnot match")
+		}
+		if values[0].IsNull() {
+			return Null(), nil
+		}
+		return ConvertValueToDateIn(values[0], loc)
+	}
+}
+
+// DateFormat formats the datetime in loc like the DATE_FORMAT of mysql.
+func DateFormat(loc *time.Location) func(Context, []Value) (Value, error) {
+	return func(ctx Context, values []Value) (Value, error) {
+		if len(values) != 2 {
+			return Null(), newArgumentError("date_format", "date_format argument isnot match")
+		}
+		if values[0].IsNull() || values[1].IsNull() {
+			return Null(), nil
+		}
+		datetime, err := ConvertValueToDatetimeIn(values[0], loc)
+		if err != nil {
+			return Null(), err
+		}
+		if values[1].Type != ValueString {
+			return Null(), newArgumentError("date_format", "date_format format isnot string")
+		}
+		return StringToValue(formatDate(datetime.DatetimeValue().In(location(loc)), values[1].Str)), nil
+	}
+}
+
+func formatDate(t time.Time, layout string) string {
+	var sb strings.Builder
+	pad := func(n, width int) {
+		s := strconv.Itoa(n)
+		for i := len(s); i < width; i++ {
+			sb.WriteByte('0')
+		}
+		sb.WriteString(s)
+	}
+	hour12 := func() int {
+		if h := t.Hour() % 12; h != 0 {
+			return h
+		}
+		return 12
+	}
+
+	for idx := 0; idx < len(layout); idx++ {
+		c := layout[idx]
+		if c != '%' || idx+1 >= len(layout) {
+			sb.WriteByte(c)
+			continue
+		}
+		idx++
+		switch layout[idx] {
+		case 'Y':
+			pad(t.Year(), 4)
+		case 'y':
+			pad(t.Year()%100, 2)
+		case 'm':
+			pad(int(t.Month()), 2)
+		case 'c':
+			pad(int(t.Month()), 1)
+		case 'M':
+			sb.WriteString(t.Month().String())
+		case 'b':
+			sb.WriteString(t.Month().String()[:3])
+		case 'd':
+			pad(t.Day(), 2)
+		case 'e':
+			pad(t.Day(), 1)
+		case 'j':
+			pad(t.YearDay(), 3)
+		case 'W':
+			sb.WriteString(t.Weekday().String())
+		case 'a':
+			sb.WriteString(t.Weekday().String()[:3])
+		case 'w':
+			pad(int(t.Weekday()), 1)
+		case 'H':
+			pad(t.Hour(), 2)
+		case 'k':
+			pad(t.Hour(), 1)
+		case 'h', 'I':
+			pad(hour12(), 2)
+		case 'l':
+			pad(hour12(), 1)
+		case 'i':
+			pad(t.Minute(), 2)
+		case 's', 'S':
+			pad(t.Second(), 2)
+		case 'f':
+			pad(t.Nanosecond()/1000, 6)
+		case 'p':
+			if t.Hour() < 12 {
+				sb.WriteString("AM")
+			} else {
+				sb.WriteString("PM")
+			}
+		case 'T':
+			sb.WriteString(t.Format("15:04:05"))
+		case 'r':
+			sb.WriteString(t.Format("03:04:05 PM"))
+		default:
+			// 与 mysql 一样, 未知的格式输出字符本身, 包括 '%%'
+			sb.WriteByte(layout[idx])
+		}
+	}
+	return sb.String()
+}
+
+// ConvertTz reads the wall clock of the datetime in the time zone from and
+// returns the wall clock of the same instant in the time zone to, the wall
+// clocks are in loc. The result is null if a time zone is invalid.
+func ConvertTz(loc *time.Location) func(Context, []Value) (Value, error) {
+	return func(ctx Context, values []Value) (Value, error) {
+		if len(values) != 3 {
+			return Null(), newArgumentError("convert_tz", "convert_tz argument isnot match")
+		}
+		if values[0].IsNull() || values[1].IsNull() || values[2].IsNull() {
+			return Null(), nil
+		}
+		from, err := LoadLocation(values[1].String())
+		if err != nil {
+			return Null(), nil
+		}
+		to, err := LoadLocation(values[2].String())
+		if err != nil {
+			return Null(), nil
+		}
+		return convertTz(values[0], from, to, location(loc))
+	}
+}
+
+// AtTimeZone returns the wall clock of the datetime in the time zone, it is
+// convert_tz(datetime, session_time_zone, zone).
+func AtTimeZone(loc *time.Location) func(Context, []Value) (Value, error) {
+	return func(ctx Context, values []Value) (Value, error) {
+		if len(values) != 2 {
+			return Null(), newArgumentError("at time zone", "at time zone argument isnot match")
+		}
+		if values[0].IsNull() || values[1].IsNull() {
+			return Null(), nil
+		}
+		to, err := LoadLocation(values[1].String())
+		if err != nil {
+			return Null(), err
+		}
+		return convertTz(values[0], location(loc), to, location(loc))
+	}
+}
+
+func convertTz(value Value, from, to, loc *time.Location) (Value, error) {
+	datetime, err := ConvertValueToDatetimeIn(value, loc)
+	if err != nil {
+		return Null(), err
+	}
+	t := datetime.DatetimeValue().In(loc)
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), from).In(to)
+	return DatetimeToValue(time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)), nil
+}
@@ -0,0 +1,127 @@
+package vm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAddInterval(t *testing.T) {
+	shanghai := time.FixedZone("+08:00", 8*60*60)
+	tests := []struct {
+		t        time.Time
+		interval Value
+		loc      *time.Location
+		want     time.Time
+	}{
+		{t: time.Date(2021, 1, 31, 10, 0, 0, 0, time.UTC), interval: CalendarIntervalToValue(1, 0, 0), loc: time.UTC,
+			want: time.Date(2021, 2, 28, 10, 0, 0, 0, time.UTC)},
+		{t: time.Date(2020, 1, 31, 10, 0, 0, 0, time.UTC), interval: CalendarIntervalToValue(1, 0, 0), loc: time.UTC,
+			want: time.Date(2020, 2, 29, 10, 0, 0, 0, time.UTC)},
+		{t: time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC), interval: CalendarIntervalToValue(12, 0, 0), loc: time.UTC,
+			want: time.Date(2021, 2, 28, 0, 0, 0, 0, time.UTC)},
+		{t: time.Date(2021, 3, 31, 0, 0, 0, 0, time.UTC), interval: CalendarIntervalToValue(-1, 0, 0), loc: time.UTC,
+			want: time.Date(2021, 2, 28, 0, 0, 0, 0, time.UTC)},
+		// 2021-01-31T20:00Z 是上海的 2 月 1 日
+		{t: time.Date(2021, 1, 31, 20, 0, 0, 0, time.UTC), interval: CalendarIntervalToValue(1, 0, 0), loc: shanghai,
+			want: time.Date(2021, 3, 1, 4, 0, 0, 0, shanghai)},
+		{t: time.Date(2021, 1, 31, 0, 0, 0, 0, time.UTC), interval: CalendarIntervalToValue(1, 1, time.Hour), loc: time.UTC,
+			want: time.Date(2021, 3, 1, 1, 0, 0, 0, time.UTC)},
+		{t: time.Date(2021, 1, 31, 0, 0, 0, 0, time.UTC), interval: IntervalToValue(time.Hour), loc: time.UTC,
+			want: time.Date(2021, 1, 31, 1, 0, 0, 0, time.UTC)},
+	}
+	for idx, test := range tests {
+		got := AddInterval(test.t, test.interval, test.loc)
+		if !got.Equal(test.want) {
+			t.Error(idx, ": want", test.want, "got", got)
+		}
+	}
+}
+
+func TestParseInterval(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+		fail bool
+	}{
+		{s: "1h30m", want: "interval 1h30m0s"},
+		{s: "interval 1 month", want: "interval 1 month"},
+		{s: "1 year 2 months 3 days 4h", want: "interval 14 months 3 days 4h0m0s"},
+		{s: "2 weeks", want: "interval 14 days"},
+		{s: "-1 month", want: "interval -1 month"},
+		{s: "1 fortnight", fail: true},
+		{s: "1 month 2", fail: true},
+		{s: "", fail: true},
+	}
+	for _, test := range tests {
+		value, err := ParseInterval(test.s)
+		if test.fail {
+			if err == nil {
+				t.Error(test.s, ": want error got", value.String())
+			}
+			continue
+		}
+		if err != nil {
+			t.Error(test.s, err)
+			continue
+		}
+		if value.String() != test.want {
+			t.Error(test.s, ": want", test.want, "got", value.String())
+		}
+		if read := ReadValueFromString(value.String()); read != value {
+			t.Error(test.s, ": want", value.String(), "got", read.String())
+		}
+	}
+
+	x := CalendarIntervalToValue(1, 0, 0)
+	if r, err := x.CompareTo(IntervalToValue(29*24*time.Hour), EmptyCompareOption()); err != nil || r != 1 {
+		t.Error("want 1 got", r, err)
+	}
+}
+
+func TestLoadLocation(t *testing.T) {
+	for _, name := range []string{"SYSTEM", "UTC", "+08:00", "-05:30"} {
+		if _, err := LoadLocation(name); err != nil {
+			t.Error(name, err)
+		}
+	}
+	for _, name := range []string{"", "+8", "Mars/Olympus"} {
+		if _, err := LoadLocation(name); err == nil {
+			t.Error(name, ": want error got ok")
+		}
+	}
+
+	loc, _ := LoadLocation("-05:30")
+	if _, offset := time.Date(2021, 1, 1, 0, 0, 0, 0, loc).Zone(); offset != -(5*60+30)*60 {
+		t.Error("want -05:30 got", offset)
+	}
+}
+
+func TestDatetimeIn(t *testing.T) {
+	loc := time.FixedZone("+08:00", 8*60*60)
+	value := DatetimeToValue(time.Date(2021, 1, 31, 20, 5, 9, 0, time.UTC))
+
+	date, err := ConvertValueToDateIn(value, loc)
+	if err != nil || !date.DatetimeValue().Equal(time.Date(2021, 2, 1, 0, 0, 0, 0, loc)) {
+		t.Error("want 2021-02-01 got", date.String(), err)
+	}
+	if s := formatDate(value.DatetimeValue().In(loc), "%Y/%c/%e %h:%i:%s %p %a %b %j %%"); s != "2021/2/1 04:05:09 AM Mon Feb 032 %" {
+		t.Error("got", s)
+	}
+
+	opt := EmptyCompareOption()
+	opt.Location = loc
+	if ok, err := value.EqualTo(StringToValue("2021-02-01 04:05:09"), opt); err != nil || !ok {
+		t.Error("want true got", ok, err)
+	}
+	if r, err := value.CompareTo(StringToValue("2021-02-01"), opt); err != nil || r != 1 {
+		t.Error("want 1 got", r, err)
+	}
+
+	// 时区和日历 interval 不能占用 Any 和 Uint64, 它们用于通用的代码
+	if in := DatetimeIn(value, loc); in.Any != nil || in.Location != loc || !in.DatetimeValue().Equal(value.DatetimeValue()) {
+		t.Error("want datetime in", loc, "got", in)
+	}
+	if interval := CalendarIntervalToValue(-1, 2, time.Hour); interval.Uint64 != 0 || interval.IntervalMonths() != -1 || interval.IntervalDays() != 2 {
+		t.Error("want -1 month 2 days 1h got", interval)
+	}
+}
@@ -6,24 +6,31 @@ func UminusFunc(read func(Context) (Value, error)) func(Context) (Value, error)
 		if err != nil {
 			return Null(), err
 		}
+		return Uminus(value)
+	}
+}
 
-		switch value.Type {
-		// case ValueNull:
-		//   return Null(), NewArithmeticError("-", value.Type.String(), "")
-		// case ValueBool:
-		//   return Null(), NewArithmeticError("-", value.Type.String(), "")
-		// case ValueString:
-		//   return Null(), NewArithmeticError("-", value.Type.String(), "")
-		case ValueInt64:
-			return IntToValue(-value.Int64), nil
-		case ValueUint64:
-			return IntToValue(-int64(value.Uint64)), nil
-		case ValueFloat64:
-			return FloatToValue(-value.Float64), nil
-		case ValueInterval:
-			return IntToValue(-value.Int64), nil
-		default:
-			return Null(), NewArithmeticError("-", value.Type.String(), "")
-		}
+func Uminus(value Value) (Value, error) {
+	value = unwrapJSONNumber(value)
+
+	switch value.Type {
+	// case ValueNull:
+	//   return Null(), NewArithmeticError("-", value.Type.String(), "")
+	// case ValueBool:
+	//   return Null(), NewArithmeticError("-", value.Type.String(), "")
+	// case ValueString:
+	//   return Null(), NewArithmeticError("-", value.Type.String(), "")
+	case ValueInt64:
+		return IntToValue(-value.Int64), nil
+	case ValueUint64:
+		return IntToValue(-int64(value.Uint64)), nil
+	case ValueFloat64:
+		return FloatToValue(-value.Float64), nil
+	case ValueDecimal:
+		return DecimalToValue(value.DecimalValue().Neg()), nil
+	case ValueInterval:
+		return negInterval(value), nil
+	default:
+		return Null(), NewArithmeticError("-", value.Type.String(), "")
 	}
 }
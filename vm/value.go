@@ -47,6 +47,8 @@ const (
 	ValueDatetime
 	ValueInterval
 	ValueAny
+	ValueJSON
+	ValueDecimal
 )
 
 func (v ValueType) String() string {
@@ -69,6 +71,10 @@ func (v ValueType) String() string {
 		return "interval"
 	case ValueAny:
 		return "any"
+	case ValueJSON:
+		return "json"
+	case ValueDecimal:
+		return "decimal"
 	default:
 		return "unknown_" + strconv.FormatInt(int64(v), 10)
 	}
@@ -111,23 +117,15 @@ var TimeFormats = []string{
 var TimeLocal = time.Local
 
 func ToDatetime(s string) (time.Time, error) {
-	for _, layout := range TimeFormats {
-		m, e := time.ParseInLocation(layout, s, TimeLocal)
-		if nil == e {
-			return m, nil
-		}
-	}
-	return time.Time{}, errors.New("invalid time: " + s)
+	return ToDatetimeIn(s, TimeLocal)
 }
 
 func ToDatetimeValue(s string) (Value, error) {
-	for _, layout := range TimeFormats {
-		m, e := time.ParseInLocation(layout, s, TimeLocal)
-		if nil == e {
-			return DatetimeToValue(m), nil
-		}
+	m, err := ToDatetimeIn(s, TimeLocal)
+	if err != nil {
+		return Null(), err
 	}
-	return Null(), errors.New("invalid time: " + s)
+	return DatetimeToValue(m), nil
 }
 
 func DatetimeToInt(t time.Time) int64 {
@@ -135,7 +133,7 @@ func DatetimeToInt(t time.Time) int64 {
 }
 
 func IntToDatetime(t int64) time.Time {
-	return time.Unix(t, 0)
+	return time.Unix(t, 0).In(TimeLocal)
 }
 
 func DurationToInt(t time.Duration) int64 {
@@ -162,6 +160,12 @@ type Value struct {
 	Uint64  uint64
 	Float64 float64
 	Any     interface{}
+
+	// Location 是 datetime 格式化时使用的时区, 见 DatetimeIn
+	Location *time.Location
+	// Months 和 Days 是 interval 中长度依赖于日历的部分, 见 CalendarIntervalToValue
+	Months int32
+	Days   int32
 }
 
 func (v *Value) BoolValue() bool {
@@ -185,8 +189,10 @@ func (v *Value) StrValue() string {
 	return v.Str
 }
 
+// DatetimeValue returns the time in the time zone of the value, it is
+// TimeLocal if the value hasnot the time zone.
 func (v *Value) DatetimeValue() time.Time {
-	return IntToDatetime(v.Int64)
+	return IntToDatetime(v.Int64).In(location(v.Location))
 }
 
 func (v *Value) DurationValue() time.Duration {
@@ -218,15 +224,19 @@ func (v *Value) String() string {
 	case ValueFloat64:
 		return strconv.FormatFloat(v.Float64, 'g', -1, 64)
 	case ValueDatetime:
-		return IntToDatetime(v.Int64).Format(time.RFC3339)
+		return FormatDatetime(*v, v.Location)
 	case ValueInterval:
-		return "interval " + time.Duration(v.Int64).String()
+		return "interval " + formatInterval(v)
 	case ValueAny:
 		bs, err := json.Marshal(v.Any)
 		if err != nil {
 			return "error_" + err.Error()
 		}
 		return string(bs)
+	case ValueJSON:
+		return jsonText(v.Any)
+	case ValueDecimal:
+		return v.DecimalValue().String()
 	default:
 		return "unknown_value_" + strconv.FormatInt(int64(v.Type), 10)
 	}
@@ -246,11 +256,13 @@ func (v *Value) ToSQLTypeLiteral() string {
 		return "INTEGER"
 	case ValueFloat64:
 		return "REAL"
+	case ValueDecimal:
+		return "NUMERIC"
 	case ValueDatetime:
 		return "Datetime"
 	case ValueInterval:
 		return "INTEGER"
-	case ValueAny:
+	case ValueAny, ValueJSON:
 		return "TEXT"
 	default:
 		return "TEXT"
@@ -285,11 +297,11 @@ func (v *Value) ToString(w io.Writer) {
 		io.WriteString(w, strconv.FormatFloat(v.Float64, 'g', -1, 64))
 	case ValueDatetime:
 		io.WriteString(w, "'")
-		io.WriteString(w, IntToDatetime(v.Int64).Format(time.RFC3339))
+		io.WriteString(w, FormatDatetime(*v, v.Location))
 		io.WriteString(w, "'")
 	case ValueInterval:
 		io.WriteString(w, "'interval ")
-		io.WriteString(w, IntToDuration(v.Int64).String())
+		io.WriteString(w, formatInterval(v))
 		io.WriteString(w, "'")
 	case ValueAny:
 		err := json.NewEncoder(w).Encode(v.Any)
@@ -298,6 +310,10 @@ func (v *Value) ToString(w io.Writer) {
 			io.WriteString(w, err.Error())
 			io.WriteString(w, "'")
 		}
+	case ValueJSON:
+		io.WriteString(w, jsonText(v.Any))
+	case ValueDecimal:
+		io.WriteString(w, v.DecimalValue().String())
 	default:
 		io.WriteString(w, "'")
 		io.WriteString(w, "unknown_value_"+strconv.FormatInt(int64(v.Type), 10))
@@ -347,6 +363,10 @@ func (v *Value) AsString(weak bool) (string, error) {
 		if weak {
 			return strconv.FormatUint(v.Uint64, 10), nil
 		}
+	case ValueDecimal:
+		if weak {
+			return v.DecimalValue().String(), nil
+		}
 	case ValueBool:
 		if weak {
 			if v.BoolValue() {
@@ -354,6 +374,13 @@ func (v *Value) AsString(weak bool) (string, error) {
 			}
 			return "false", nil
 		}
+	case ValueJSON:
+		if weak {
+			if s, ok := v.Any.(string); ok {
+				return s, nil
+			}
+			return jsonText(v.Any), nil
+		}
 	}
 	return "", NewTypeMismatch(v.Type.String(), "string")
 }
@@ -392,6 +419,13 @@ func (v *Value) SetFloat64(f float64) {
 type CompareOption struct {
 	Weak       bool
 	IgnoreCase bool
+
+	// Collation is the rule to compare the strings.
+	Collation Collation
+
+	// Location is the time zone in which the string is read as a datetime,
+	// nil is TimeLocal.
+	Location *time.Location
 }
 
 var emptyCompareOption = CompareOption{
@@ -420,13 +454,20 @@ func (v *Value) marshalText() ([]byte, error) {
 	case ValueFloat64:
 		return []byte(strconv.FormatFloat(v.Float64, 'g', -1, 64)), nil
 	case ValueDatetime:
-		return []byte("\"" + IntToDatetime(v.Int64).Format(time.RFC3339) + "\""), nil
+		return []byte("\"" + FormatDatetime(*v, v.Location) + "\""), nil
 	case ValueInterval:
+		if v.IsCalendarInterval() {
+			return json.Marshal(formatInterval(v))
+		}
 		return []byte(strconv.FormatInt(v.Int64, 10)), nil
 	case ValueAny:
 		var buf bytes.Buffer
 		err := json.NewEncoder(&buf).Encode(v.Any)
 		return buf.Bytes(), err
+	case ValueJSON:
+		return json.Marshal(v.Any)
+	case ValueDecimal:
+		return []byte(v.DecimalValue().String()), nil
 	default:
 		return nil, ErrUnknownValueType
 	}
@@ -562,6 +603,10 @@ func ToValue(value interface{}) (Value, error) {
 		}, nil
 	case Value:
 		return v, nil
+	case *Decimal:
+		return DecimalToValue(v), nil
+	case map[string]interface{}, []interface{}, []map[string]interface{}:
+		return JSONToValue(v), nil
 	}
 	return Null(), fmt.Errorf("Unknown type %T: %v", value, value)
 }
@@ -638,6 +683,15 @@ func DatetimeToValue(value time.Time) Value {
 	}
 }
 
+// DatetimeIn returns the datetime which is formatted in loc, the other
+// values are returned as they are.
+func DatetimeIn(value Value, loc *time.Location) Value {
+	if value.Type == ValueDatetime {
+		value.Location = loc
+	}
+	return value
+}
+
 func IntervalToValue(value time.Duration) Value {
 	return Value{
 		Type:  ValueInterval,
@@ -660,6 +714,7 @@ func ReadValueFromString(s string) Value {
 		return StringToValue(strings.Trim(s, "'"))
 	}
 
+	text := s
 	s = strings.ToLower(s)
 	if s == "null" {
 		return Null()
@@ -677,18 +732,17 @@ func ReadValueFromString(s string) Value {
 		}
 		return StringToValue(s)
 	}
-	if strings.HasPrefix(s, "i") {
-		i64, err := strconv.ParseInt(strings.TrimPrefix(s, "i"), 10, 64)
+	if strings.HasPrefix(s, "interval ") {
+		interval, err := ParseInterval(s)
 		if err == nil {
-			return IntToValue(i64)
+			return interval
 		}
-		return StringToValue(s)
+		return StringToValue(strings.TrimPrefix(s, "interval "))
 	}
-	if strings.HasPrefix(s, "interval ") {
-		s = strings.TrimPrefix(s, "interval ")
-		interval, err := time.ParseDuration(s)
+	if strings.HasPrefix(s, "i") {
+		i64, err := strconv.ParseInt(strings.TrimPrefix(s, "i"), 10, 64)
 		if err == nil {
-			return IntervalToValue(interval)
+			return IntToValue(i64)
 		}
 		return StringToValue(s)
 	}
@@ -715,7 +769,8 @@ func ReadValueFromString(s string) Value {
 		"2006/01/02 15:04:05Z07:00",
 		"2006/01/02 15:04:05",
 	} {
-		t, err := time.Parse(fmtstr, s)
+		// 没有时区的时间是 TimeLocal 中的时间
+		t, err := time.ParseInLocation(fmtstr, text, TimeLocal)
 		if err == nil {
 			return DatetimeToValue(t)
 		}
@@ -0,0 +1,309 @@
+package memsql
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/runner-mei/errors"
+	"github.com/runner-mei/memsql/memcore"
+	"github.com/runner-mei/memsql/parser"
+	"github.com/xwb1989/sqlparser"
+)
+
+// DefaultMaxRecursion is the max count of the iterations of a recursive
+// common table expression.
+const DefaultMaxRecursion = 100
+
+// WithClause is the WITH clause of the select statement.
+type WithClause struct {
+	Recursive bool
+	Tables    []CommonTableExpr
+}
+
+// CommonTableExpr is a named sub-query in the WITH clause.
+type CommonTableExpr struct {
+	Name    string
+	Columns []string
+	Select  sqlparser.SelectStatement
+}
+
+type commonTable struct {
+	name    string
+	records []memcore.Record
+}
+
+// parseWith 解析 sql 开头的 WITH 子句, sqlparser 不支持它, 所以用 sqlparser
+// 的词法分析找出各个查询, 再由 sqlparser 解析它们
+func parseWith(sqlstr string) (*WithClause, sqlparser.SelectStatement, error) {
+	tokens, ok := scanTokens(sqlstr)
+	if !ok {
+		// 由 sqlparser 报告语法错误
+		stmt, err := parse(sqlstr)
+		return nil, stmt, err
+	}
+	r := &tokenReader{sqlstr: sqlstr, tokens: tokens}
+	if !r.words("with") {
+		stmt, err := parse(sqlstr)
+		return nil, stmt, err
+	}
+
+	with := &WithClause{Recursive: r.words("recursive")}
+	for {
+		name, ok := r.name()
+		if !ok {
+			return nil, nil, r.errorf("name of the common table expression is missing")
+		}
+		cte := CommonTableExpr{Name: name}
+		if r.next('(') {
+			for {
+				column, ok := r.name()
+				if !ok {
+					return nil, nil, r.errorf("column name of '" + name + "' is empty")
+				}
+				cte.Columns = append(cte.Columns, column)
+				if !r.next(',') {
+					break
+				}
+			}
+			if !r.next(')') {
+				return nil, nil, r.errorf("parenthesis isnot closed")
+			}
+		}
+		if !r.words("as") {
+			return nil, nil, r.errorf("'as' is missing after '" + name + "'")
+		}
+		body, ok := r.paren()
+		if !ok {
+			return nil, nil, r.errorf("query of '" + name + "' is missing")
+		}
+		var err error
+		cte.Select, err = parse(body)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "query of '"+name+"' is invalid")
+		}
+		for idx := range with.Tables {
+			if with.Tables[idx].Name == name {
+				return nil, nil, errors.New("common table expression '" + name + "' is already exists")
+			}
+		}
+		with.Tables = append(with.Tables, cte)
+
+		if !r.next(',') {
+			break
+		}
+	}
+
+	stmt, err := parse(r.rest())
+	if err != nil {
+		return nil, nil, err
+	}
+	return with, stmt, nil
+}
+
+func (sc *SessionContext) lookupCommonTable(name string) (*commonTable, bool) {
+	table, ok := sc.commonTables[name]
+	return table, ok
+}
+
+func (sc *SessionContext) childSession() *SessionContext {
+	return &SessionContext{
+		Context:      sc.Context,
+		alias:        map[string]string{},
+		resultSets:   map[string][]memcore.Record{},
+		commonTables: sc.commonTables,
+	}
+}
+
+// ExecuteWith evaluates the common table expressions in order, every
+// expression is evaluated once and its records are shared by all the
+// references.
+func ExecuteWith(ec *SessionContext, with *WithClause) error {
+	if with == nil {
+		return nil
+	}
+	if ec.commonTables == nil {
+		ec.commonTables = map[string]*commonTable{}
+	}
+	for idx := range with.Tables {
+		cte := &with.Tables[idx]
+		table := &commonTable{name: cte.Name}
+
+		var err error
+		union, ok := cte.Select.(*sqlparser.Union)
+		if with.Recursive && ok && referenceTable(union.Right, cte.Name) {
+			ec.commonTables[cte.Name] = table
+			table.records, err = executeRecursive(ec, cte, union)
+		} else {
+			table.records, err = executeCommonTable(ec, cte, cte.Select, nil)
+			ec.commonTables[cte.Name] = table
+		}
+		if err != nil {
+			delete(ec.commonTables, cte.Name)
+			return errors.Wrap(err, "execute '"+cte.Name+"' fail")
+		}
+	}
+	return nil
+}
+
+func executeCommonTable(ec *SessionContext, cte *CommonTableExpr, stmt sqlparser.SelectStatement, names []string) (records []memcore.Record, err error) {
+	child := ec.childSession()
+	defer func() {
+		if e := child.Close(); e != nil && err == nil {
+			err = e
+		}
+	}()
+
+	query, err := ExecuteSelectStatement(child, stmt, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := child.Init(); err != nil {
+		return nil, err
+	}
+	results, err := query.Results(child)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cte.Columns) > 0 {
+		names = cte.Columns
+	} else if names == nil {
+		names = selectColumnNames(firstSelect(stmt))
+	}
+	for idx := range results {
+		columns := make([]memcore.Column, len(results[idx].Columns))
+		for i := range columns {
+			name := results[idx].Columns[i].Name
+			if i < len(names) && names[i] != "" {
+				name = names[i]
+			}
+			if name == "" {
+				return nil, errors.New("column " + strconv.Itoa(i+1) + " has no name, please use 'as' to name it")
+			}
+			columns[i] = memcore.Column{TableName: cte.Name, Name: name}
+		}
+		if len(cte.Columns) > 0 && len(cte.Columns) != len(columns) {
+			return nil, errors.New("column count of '" + cte.Name + "' doesnot match the result")
+		}
+		results[idx].Columns = columns
+	}
+	return results, nil
+}
+
+// executeRecursive 先执行 union 的左边, 然后用上一轮的结果反复执行右边, 直到
+// 没有新的记录. UNION 时已经出现过的记录会被丢弃, 以防止环, UNION ALL 时保
+// 留所有的记录, 有环时由 MaxRecursion 终止
+func executeRecursive(ec *SessionContext, cte *CommonTableExpr, union *sqlparser.Union) ([]memcore.Record, error) {
+	maxRecursion := ec.MaxRecursion
+	if maxRecursion <= 0 {
+		maxRecursion = DefaultMaxRecursion
+	}
+
+	names := cte.Columns
+	if len(names) == 0 {
+		names = selectColumnNames(firstSelect(union.Left))
+	}
+	anchor, err := executeCommonTable(ec, cte, union.Left, names)
+	if err != nil {
+		return nil, err
+	}
+
+	var seen = map[string]struct{}{}
+	var distinct = func(records []memcore.Record) []memcore.Record {
+		if union.Type == sqlparser.UnionAllStr {
+			return records
+		}
+		var results = records[:0]
+		for _, record := range records {
+			key := recordKey(&record)
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			results = append(results, record)
+		}
+		return results
+	}
+
+	all := distinct(anchor)
+	working := all
+	table := ec.commonTables[cte.Name]
+	for iteration := 0; len(working) > 0; iteration++ {
+		if iteration >= maxRecursion {
+			return nil, errors.New("recursive query '" + cte.Name + "' exceeds the max iterations " + strconv.Itoa(maxRecursion))
+		}
+
+		table.records = working
+		records, err := executeCommonTable(ec, cte, union.Right, names)
+		if err != nil {
+			return nil, err
+		}
+		working = distinct(records)
+		all = append(all, working...)
+	}
+	return all, nil
+}
+
+func recordKey(record *memcore.Record) string {
+	var sb strings.Builder
+	sb.WriteString(record.Tags.ToKey())
+	sb.WriteString("|")
+	record.ToLine(&sb, ",")
+	return sb.String()
+}
+
+func firstSelect(stmt sqlparser.SelectStatement) sqlparser.SelectStatement {
+	for {
+		switch v := stmt.(type) {
+		case *sqlparser.Union:
+			stmt = v.Left
+		case *sqlparser.ParenSelect:
+			stmt = v.Select
+		default:
+			return stmt
+		}
+	}
+}
+
+func referenceTable(stmt sqlparser.SQLNode, name string) bool {
+	found := false
+	sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if tableName, ok := node.(sqlparser.TableName); ok {
+			if tableName.Qualifier.IsEmpty() && tableName.Name.String() == name {
+				found = true
+				return false, nil
+			}
+		}
+		return !found, nil
+	}, stmt)
+	return found
+}
+
+func fromCommonTable(ec *SessionContext, table *commonTable, ds Datasource, where *sqlparser.Where, hasJoin bool) (memcore.Query, error) {
+	var expr sqlparser.Expr
+	if where != nil {
+		expr = where.Expr
+	}
+	if hasJoin && expr != nil {
+		var err error
+		expr, err = parser.SplitByTableName(expr, ds.Table, ds.As)
+		if err != nil {
+			return memcore.Query{}, err
+		}
+	}
+
+	// 每次迭代都读取当前的记录, 递归查询中它会被更新
+	query := memcore.Query{
+		Iterate: func() memcore.Iterator {
+			return memcore.FromRecords(table.records).Iterate()
+		},
+	}
+	query, err := ExecuteWhere(ec, query, expr)
+	if err != nil {
+		return memcore.Query{}, err
+	}
+	if ds.As != "" {
+		query = query.Map(memcore.RenameTableToAlias(ds.As))
+	}
+	return query, nil
+}
@@ -0,0 +1,140 @@
+package memsql
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestParseWith(t *testing.T) {
+	with, stmt, err := parseWith("WITH a AS (select f1 from cpu where f2 = ')'), `b` (x, y) AS (select * from a) select * from b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if with == nil || with.Recursive || len(with.Tables) != 2 {
+		t.Fatalf("%#v", with)
+	}
+	if with.Tables[0].Name != "a" || with.Tables[1].Name != "b" {
+		t.Errorf("%#v", with.Tables)
+	}
+	if strings.Join(with.Tables[1].Columns, ",") != "x,y" {
+		t.Errorf("%#v", with.Tables[1].Columns)
+	}
+	if stmt == nil {
+		t.Error("select is missing")
+	}
+
+	// 注释和引号中的括号
+	with, _, err = parseWith("with /* ( */ a as (select f1 from cpu -- )\n where f2 = 'it''s )') select * from a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(with.Tables) != 1 || with.Tables[0].Name != "a" {
+		t.Errorf("%#v", with.Tables)
+	}
+
+	for _, sqlstr := range []string{
+		"WITH a (select 1) select * from a",
+		"WITH a (x,) AS (select 1) select * from a",
+		"WITH AS (select 1) select * from a",
+		"WITH a AS (select 1 select * from a",
+		"WITH a AS (select 1), a AS (select 2) select * from a",
+	} {
+		if _, _, err := parseWith(sqlstr); err == nil {
+			t.Error(sqlstr, ": want error got ok")
+		}
+	}
+}
+
+func TestWith(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Close()
+
+	ctx := &Context{
+		Ctx:     context.Background(),
+		Storage: WrapStorage(app.s),
+	}
+	_, err := Exec(ctx, "INSERT INTO cpu (@mo, f1) VALUES ('1', 10), ('2', 20), ('3', 30)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := app.Execute(t, ctx, `WITH big AS (select cpu.@mo as mo, f1 from cpu where f1 > 10),
+	   bigger AS (select mo, f1 * 2 as f2 from big)
+	   select big.mo, big.f1, bigger.f2 from big join bigger on big.mo = bigger.mo`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResults(t, true, false, results, []string{
+		`"2",20,40`,
+		`"3",30,60`,
+	})
+}
+
+func TestWithRecursive(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Close()
+
+	ctx := &Context{
+		Ctx:     context.Background(),
+		Storage: WrapStorage(app.s),
+	}
+	_, err := Exec(ctx, `INSERT INTO nodes (id, parent_id, name) VALUES
+	  (1, 0, 'root'), (2, 1, 'a'), (3, 1, 'b'), (4, 2, 'c'), (5, 6, 'x'), (6, 5, 'y')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := app.Execute(t, ctx, `WITH RECURSIVE tree (id, name, depth) AS (
+	    select id, name, 0 from nodes where parent_id = 0
+	    UNION ALL
+	    select nodes.id, nodes.name, tree.depth + 1 from nodes join tree on nodes.parent_id = tree.id
+	  ) select name, depth from tree`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResults(t, true, false, results, []string{
+		`"root",0`,
+		`"a",1`,
+		`"b",1`,
+		`"c",2`,
+	})
+
+	// x 和 y 是一个环, UNION 丢弃重复的记录
+	results, err = app.Execute(t, ctx, `WITH RECURSIVE tree (id, name) AS (
+	    select id, name from nodes where id = 5
+	    UNION
+	    select nodes.id, nodes.name from nodes join tree on nodes.parent_id = tree.id
+	  ) select name from tree`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResults(t, true, false, results, []string{
+		`"x"`,
+		`"y"`,
+	})
+
+	// UNION ALL 保留重复的记录, 环由 MaxRecursion 终止
+	_, err = app.Execute(t, ctx, `WITH RECURSIVE tree (id, name) AS (
+	    select id, name from nodes where id = 5
+	    UNION ALL
+	    select nodes.id, nodes.name from nodes join tree on nodes.parent_id = tree.id
+	  ) select name from tree`)
+	if err == nil {
+		t.Error("want error got ok")
+	} else if !strings.Contains(err.Error(), "max iterations") {
+		t.Error(err)
+	}
+
+	ctx.MaxRecursion = 1
+	_, err = app.Execute(t, ctx, `WITH RECURSIVE tree (id, name, depth) AS (
+	    select id, name, 0 from nodes where parent_id = 0
+	    UNION ALL
+	    select nodes.id, nodes.name, tree.depth + 1 from nodes join tree on nodes.parent_id = tree.id
+	  ) select name, depth from tree`)
+	if err == nil {
+		t.Error("want error got ok")
+	} else if !strings.Contains(err.Error(), "max iterations") {
+		t.Error(err)
+	}
+}